@@ -0,0 +1,583 @@
+package algo
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/event"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/oms"
+	"github.com/ueebee/tachibanashi/request"
+	"github.com/ueebee/tachibanashi/ticks"
+)
+
+const (
+	defaultLot          = model.Quantity(100)
+	defaultRefreshAfter = 30 * time.Second
+	defaultInterval     = time.Second
+	// matchWindow is how long an ambiguous slice is searched for in
+	// CLMOrderList before it is taken as not placed.
+	matchWindow = 2 * time.Minute
+	// cancelFailedCode is p_ODST 取消失敗.
+	cancelFailedCode = "8"
+)
+
+// Pricing sets the price of child slices.
+type Pricing string
+
+const (
+	// PricingPassive joins the best bid for buys and the best ask for sells.
+	PricingPassive Pricing = "passive"
+	// PricingCross takes the best ask for buys and the best bid for sells.
+	PricingCross Pricing = "cross"
+	// PricingMarket sends market slices.
+	PricingMarket Pricing = "market"
+)
+
+// State is the state of a parent order.
+type State string
+
+const (
+	StateRunning State = "running"
+	StateDone    State = "done"
+	// StateExpired ran out of time with part of the parent unfilled.
+	StateExpired State = "expired"
+)
+
+// Parent is the order to slice.
+type Parent struct {
+	// Order is the template for slices. Quantity is the parent total and a
+	// positive Price caps slice limit prices.
+	Order request.NewOrder
+	// Row is the FD board row (p_gyou_no) registered for Order.Symbol.
+	Row int
+	// Lot is the trading unit (default 100); see LotSize.
+	Lot model.Quantity
+	// Table rounds slice prices to valid ticks when set.
+	Table   *ticks.Table
+	Pricing Pricing
+	// RefreshAfter cancels and replaces a slice that rests unfilled this
+	// long (default 30s). Limit slices are also replaced when the touch
+	// moves away from them.
+	RefreshAfter time.Duration
+}
+
+// Child is one slice sent for the parent. A slice whose send failed
+// ambiguously has no OrderNumber and StatusUnknown until it is found in
+// CLMOrderList.
+type Child struct {
+	OrderNumber string
+	EigyouDay   string
+	Quantity    model.Quantity
+	Price       model.Price
+	Filled      model.Quantity
+	Status      oms.Status
+	SentAt      time.Time
+}
+
+// Progress reports the parent's execution so far.
+type Progress struct {
+	State    State
+	Total    model.Quantity
+	Target   model.Quantity
+	Filled   model.Quantity
+	AvgPrice model.Price
+	// Working is the unfilled quantity of the open slice.
+	Working      model.Quantity
+	Children     int
+	MarketVolume model.Quantity
+	UpdatedAt    time.Time
+}
+
+// OrderRouter sends and cancels slices. *request.Service and *risk.Gate
+// satisfy it.
+type OrderRouter interface {
+	KabuNewOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error)
+	KabuCancelOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error)
+}
+
+// Executor slices a parent order according to a Schedule. At most one slice
+// is open at a time; it is cancelled, and replaced once the cancel is
+// confirmed by EC, when it goes stale. A cancel that fails or gets no
+// answer within RefreshAfter is sent again.
+type Executor struct {
+	router         OrderRouter
+	lister         oms.OrderLister
+	parent         Parent
+	schedule       Schedule
+	secondPassword string
+	interval       time.Duration
+	onProgress     func(Progress)
+	now            func() time.Time
+
+	mu          sync.Mutex
+	book        *event.QuoteBook
+	bid         model.Price
+	ask         model.Price
+	volume      model.Quantity
+	baseVolume  model.Quantity
+	hasVolume   bool
+	target      model.Quantity
+	filled      model.Quantity
+	filledValue model.Price
+	children    []*Child
+	working     *Child
+	cancelling  bool
+	cancelledAt time.Time
+	lastENO     int64
+	state       State
+	updatedAt   time.Time
+}
+
+type Option func(*Executor)
+
+// WithSecondPassword sets sSecondPassword for slices and cancels.
+func WithSecondPassword(password string) Option {
+	return func(e *Executor) {
+		e.secondPassword = password
+	}
+}
+
+// WithOrderLister resolves slices whose send failed ambiguously (timeout,
+// connection reset, 5xx) from CLMOrderList. Without it such a slice blocks
+// further slices until the schedule ends. *request.Service satisfies it.
+func WithOrderLister(lister oms.OrderLister) Option {
+	return func(e *Executor) {
+		e.lister = lister
+	}
+}
+
+// WithInterval sets how often Run re-evaluates the schedule (default 1s).
+func WithInterval(d time.Duration) Option {
+	return func(e *Executor) {
+		if d > 0 {
+			e.interval = d
+		}
+	}
+}
+
+// WithProgress calls fn after every change. fn must not call back into the
+// executor.
+func WithProgress(fn func(Progress)) Option {
+	return func(e *Executor) {
+		e.onProgress = fn
+	}
+}
+
+func withClock(now func() time.Time) Option {
+	return func(e *Executor) {
+		e.now = now
+	}
+}
+
+// NewExecutor validates parent and schedule.
+func NewExecutor(router OrderRouter, parent Parent, schedule Schedule, opts ...Option) (*Executor, error) {
+	if parent.Lot == 0 {
+		parent.Lot = defaultLot
+	}
+	if parent.Pricing == "" {
+		parent.Pricing = PricingPassive
+	}
+	if parent.RefreshAfter <= 0 {
+		parent.RefreshAfter = defaultRefreshAfter
+	}
+	parent.Order.SecondPassword = ""
+	if err := validateParent(parent); err != nil {
+		return nil, err
+	}
+	if schedule == nil {
+		return nil, &terrors.ValidationError{Field: "schedule", Reason: "required"}
+	}
+	if err := schedule.Validate(); err != nil {
+		return nil, err
+	}
+	e := &Executor{
+		router:   router,
+		parent:   parent,
+		schedule: schedule,
+		interval: defaultInterval,
+		now:      time.Now,
+		book:     event.NewQuoteBook(),
+		state:    StateRunning,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(e)
+		}
+	}
+	return e, nil
+}
+
+func validateParent(parent Parent) error {
+	if err := parent.Order.Validate(); err != nil {
+		return err
+	}
+	if parent.Lot < 0 || parent.Order.Quantity%parent.Lot != 0 {
+		return &terrors.ValidationError{Field: "sOrderSuryou", Reason: "must be a multiple of the lot size " + strconv.FormatInt(int64(parent.Lot), 10)}
+	}
+	switch parent.Pricing {
+	case PricingPassive, PricingCross, PricingMarket:
+	default:
+		return &terrors.ValidationError{Field: "pricing", Reason: "invalid value: " + string(parent.Pricing)}
+	}
+	return nil
+}
+
+// Run drives the executor from events and a timer until the parent is done
+// or expired, the channel closes, or ctx is done. Errors from sending or
+// cancelling slices are passed to onError, which may be nil; the next
+// event or tick retries.
+func (e *Executor) Run(ctx context.Context, events <-chan event.Event, onError func(error)) error {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	report := func(err error) {
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+	report(e.Step(ctx))
+	for !e.finished() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			report(e.Apply(ctx, ev))
+		case <-ticker.C:
+			report(e.Step(ctx))
+		}
+	}
+	return nil
+}
+
+// Apply handles FD quotes for the parent's row and EC notices for its
+// slices, then re-evaluates the schedule.
+func (e *Executor) Apply(ctx context.Context, ev event.Event) error {
+	e.mu.Lock()
+	switch ev := ev.(type) {
+	case event.FD:
+		e.applyFD(ev)
+	case event.EC:
+		e.applyEC(ev)
+	default:
+		e.mu.Unlock()
+		return nil
+	}
+	err := e.evaluate(ctx)
+	progress := e.progressLocked()
+	e.mu.Unlock()
+	e.report(progress)
+	return err
+}
+
+// Step re-evaluates the schedule at the current time.
+func (e *Executor) Step(ctx context.Context) error {
+	e.mu.Lock()
+	err := e.evaluate(ctx)
+	progress := e.progressLocked()
+	e.mu.Unlock()
+	e.report(progress)
+	return err
+}
+
+// Progress returns the parent's execution so far.
+func (e *Executor) Progress() Progress {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.progressLocked()
+}
+
+// Children returns every slice sent so far.
+func (e *Executor) Children() []Child {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]Child, len(e.children))
+	for i, child := range e.children {
+		out[i] = *child
+	}
+	return out
+}
+
+func (e *Executor) finished() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.state != StateRunning
+}
+
+func (e *Executor) report(progress Progress) {
+	if e.onProgress != nil {
+		e.onProgress(progress)
+	}
+}
+
+func (e *Executor) progressLocked() Progress {
+	progress := Progress{
+		State:        e.state,
+		Total:        e.parent.Order.Quantity,
+		Target:       e.target,
+		Filled:       e.filled,
+		Children:     len(e.children),
+		MarketVolume: e.volume - e.baseVolume,
+		UpdatedAt:    e.updatedAt,
+	}
+	if e.filled > 0 {
+		progress.AvgPrice = e.filledValue.Div(int64(e.filled))
+	}
+	if e.working != nil {
+		progress.Working = e.working.Quantity - e.working.Filled
+	}
+	return progress
+}
+
+func (e *Executor) applyFD(fd event.FD) {
+	quotes := e.book.Apply(fd)
+	index := 0
+	for _, row := range fd.Rows {
+		if row.Fields == nil || index >= len(quotes) {
+			continue
+		}
+		quote := quotes[index]
+		index++
+		if row.Row != e.parent.Row {
+			continue
+		}
+		if bid, ok := quote.Price(model.FieldBidPrice); ok && bid > 0 {
+			e.bid = bid
+		}
+		if ask, ok := quote.Price(model.FieldAskPrice); ok && ask > 0 {
+			e.ask = ask
+		}
+		if volume, ok := quote.Quantity(model.FieldVolume); ok {
+			if !e.hasVolume {
+				e.baseVolume = volume
+				e.hasVolume = true
+			}
+			e.volume = volume
+		}
+	}
+}
+
+func (e *Executor) applyEC(ec event.EC) {
+	if eno, err := strconv.ParseInt(strings.TrimSpace(ec.EventNo), 10, 64); err == nil {
+		if e.lastENO > 0 && eno <= e.lastENO {
+			return
+		}
+		e.lastENO = eno
+	}
+	child := e.working
+	if child == nil || child.OrderNumber == "" || child.OrderNumber != strings.TrimSpace(ec.OrderNumber) {
+		return
+	}
+	if exec, ok := ec.Execution(); ok && exec.Quantity > 0 {
+		qty := min(exec.Quantity, child.Quantity-child.Filled)
+		child.Filled += qty
+		e.filled += qty
+		e.filledValue += exec.Price.Mul(qty)
+	}
+	if status := oms.StatusFromCode(ec.OrderStatus); status != oms.StatusUnknown {
+		child.Status = status
+	}
+	if child.Filled >= child.Quantity {
+		child.Status = oms.StatusFilled
+	}
+	if child.Status.Terminal() {
+		e.working = nil
+		e.cancelling = false
+	} else if strings.TrimSpace(ec.OrderStatus) == cancelFailedCode {
+		// The slice is still open; evaluate cancels it again if needed.
+		e.cancelling = false
+	}
+	e.updatedAt = e.now()
+}
+
+// evaluate sends, cancels or finishes as the schedule requires. e.mu must
+// be held.
+func (e *Executor) evaluate(ctx context.Context) error {
+	if e.state != StateRunning {
+		return nil
+	}
+	now := e.now()
+	total := e.parent.Order.Quantity
+	if e.working != nil && e.working.OrderNumber == "" {
+		if err := e.resolve(ctx, now); err != nil {
+			return err
+		}
+	}
+	if e.filled >= total {
+		e.state = StateDone
+		e.updatedAt = now
+		return nil
+	}
+	if e.schedule.Ended(now) {
+		if e.working != nil && e.working.OrderNumber != "" {
+			return e.cancel(ctx)
+		}
+		e.state = StateExpired
+		e.updatedAt = now
+		return nil
+	}
+
+	price, priced := e.price()
+	if e.working != nil {
+		child := e.working
+		if child.OrderNumber == "" {
+			return nil // still unresolved
+		}
+		stale := now.Sub(child.SentAt) >= e.parent.RefreshAfter
+		moved := priced && e.parent.Pricing != PricingMarket && price != child.Price
+		if stale || moved {
+			return e.cancel(ctx)
+		}
+		return nil
+	}
+
+	e.target = min(e.schedule.Target(now, e.volume-e.baseVolume, total), total)
+	want := (e.target - e.filled) / e.parent.Lot * e.parent.Lot
+	if want <= 0 || !priced {
+		return nil
+	}
+	return e.send(ctx, want, price)
+}
+
+// price returns the slice price from the touch, capped by the parent's
+// limit and rounded to a valid tick.
+func (e *Executor) price() (model.Price, bool) {
+	if e.parent.Pricing == PricingMarket {
+		return 0, true
+	}
+	buy := e.parent.Order.Side == request.SideBuy
+	price := e.bid
+	if buy == (e.parent.Pricing == PricingCross) {
+		price = e.ask
+	}
+	if price <= 0 {
+		return 0, false
+	}
+	if limit := e.parent.Order.Price; limit > 0 {
+		if buy {
+			price = min(price, limit)
+		} else {
+			price = max(price, limit)
+		}
+	}
+	if table := e.parent.Table; table != nil {
+		if buy {
+			price = table.RoundDown(price)
+		} else {
+			price = table.RoundUp(price)
+		}
+	}
+	return price, true
+}
+
+func (e *Executor) send(ctx context.Context, qty model.Quantity, price model.Price) error {
+	order := e.parent.Order
+	order.Quantity = qty
+	order.Price = price
+	order.SecondPassword = e.secondPassword
+	params, err := order.ToParams()
+	if err != nil {
+		return err
+	}
+	sentAt := e.now()
+	resp, err := e.router.KabuNewOrder(ctx, params)
+	if err != nil && !oms.Ambiguous(err) {
+		return err
+	}
+	child := &Child{
+		Quantity: qty,
+		Price:    price,
+		Status:   oms.StatusUnknown,
+		SentAt:   sentAt,
+	}
+	if err == nil {
+		child.OrderNumber = strings.TrimSpace(resp.OrderNumber)
+		child.EigyouDay = strings.TrimSpace(resp.EigyouDay)
+		child.Status = oms.StatusPending
+	}
+	// An ambiguous slice may be live, so it is tracked until resolved.
+	e.children = append(e.children, child)
+	e.working = child
+	e.updatedAt = child.SentAt
+	return err
+}
+
+// resolve searches CLMOrderList for the ambiguous working slice. A slice
+// not found within matchWindow is taken as not placed.
+func (e *Executor) resolve(ctx context.Context, now time.Time) error {
+	child := e.working
+	if e.lister == nil {
+		if e.schedule.Ended(now) {
+			e.working = nil
+			e.updatedAt = now
+		}
+		return nil
+	}
+	resp, err := e.lister.OrderList(ctx, request.OrderParams{"sIssueCode": e.parent.Order.Symbol})
+	if err != nil {
+		return err
+	}
+	order := e.parent.Order
+	order.Quantity = child.Quantity
+	order.Price = child.Price
+	entry, found := oms.MatchOrder(resp.Entries, order, child.SentAt, matchWindow, e.known)
+	if !found {
+		if now.Sub(child.SentAt) >= matchWindow {
+			child.Status = oms.StatusRejected
+			e.working = nil
+			e.updatedAt = now
+		}
+		return nil
+	}
+	child.OrderNumber = entry.OrderID
+	child.EigyouDay = strings.TrimSpace(entry.Fields.Value("sOrderSikkouDay"))
+	child.Status = oms.StatusFromCode(entry.Fields.Value("sOrderStatusCode"))
+	if filled, err := strconv.ParseInt(strings.TrimSpace(entry.Fields.Value("sOrderYakuzyouSuryo")), 10, 64); err == nil && filled > 0 {
+		qty := min(model.Quantity(filled), child.Quantity)
+		avg, _ := model.ParsePrice(entry.Fields.Value("sOrderYakuzyouPrice"))
+		child.Filled = qty
+		e.filled += qty
+		e.filledValue += avg.Mul(qty)
+	}
+	if child.Filled >= child.Quantity {
+		child.Status = oms.StatusFilled
+	}
+	if child.Status.Terminal() {
+		e.working = nil
+	}
+	e.updatedAt = now
+	return nil
+}
+
+// known reports whether number is one of the executor's slices.
+func (e *Executor) known(number string) bool {
+	for _, child := range e.children {
+		if child.OrderNumber == number {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Executor) cancel(ctx context.Context) error {
+	now := e.now()
+	if e.cancelling && now.Sub(e.cancelledAt) < e.parent.RefreshAfter {
+		return nil
+	}
+	child := e.working
+	if _, err := e.router.KabuCancelOrder(ctx, request.CancelParams(child.OrderNumber, child.EigyouDay, e.secondPassword)); err != nil {
+		e.cancelling = false
+		return err
+	}
+	e.cancelling = true
+	e.cancelledAt = now
+	child.Status = oms.StatusCancelling
+	e.updatedAt = now
+	return nil
+}
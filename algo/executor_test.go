@@ -0,0 +1,427 @@
+package algo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ueebee/tachibanashi/auth"
+	"github.com/ueebee/tachibanashi/client"
+	"github.com/ueebee/tachibanashi/event"
+	"github.com/ueebee/tachibanashi/master"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/oms"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+type scriptedConn struct {
+	events chan event.Event
+}
+
+func (c *scriptedConn) Recv(ctx context.Context) (event.Event, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case ev := <-c.events:
+		return ev, nil
+	}
+}
+
+func (c *scriptedConn) Close() error {
+	return nil
+}
+
+type scriptedDialer struct {
+	conn *scriptedConn
+}
+
+func (d scriptedDialer) DialEvent(ctx context.Context) (event.Conn, error) {
+	return d.conn, nil
+}
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// orderEndpoint serves CLMKabuNewOrder / CLMKabuCancelOrder and numbers new
+// orders from 1.
+func orderEndpoint(t *testing.T) (*httptest.Server, <-chan map[string]string) {
+	t.Helper()
+	requests := make(chan map[string]string, 16)
+	var next int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, err := url.QueryUnescape(r.URL.RawQuery)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var payload map[string]any
+		if err := json.Unmarshal([]byte(raw), &payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fields := make(map[string]string, len(payload))
+		for key, value := range payload {
+			fields[key] = fmt.Sprint(value)
+		}
+		resp := map[string]string{"p_errno": "0", "sResultCode": "0", "sEigyouDay": "20240603"}
+		if fields["sCLMID"] == "CLMKabuNewOrder" {
+			next++
+			resp["sOrderNumber"] = strconv.Itoa(next)
+		} else {
+			resp["sOrderNumber"] = fields["sOrderNumber"]
+		}
+		requests <- fields
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func expectRequest(t *testing.T, requests <-chan map[string]string, clmid string, want map[string]string) {
+	t.Helper()
+	select {
+	case got := <-requests:
+		if got["sCLMID"] != clmid {
+			t.Fatalf("request = %v, want %s", got, clmid)
+		}
+		for key, value := range want {
+			if got[key] != value {
+				t.Fatalf("%s %s = %q, want %q", clmid, key, got[key], value)
+			}
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for %s", clmid)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func quote(bid, ask, volume string) event.FD {
+	return event.FD{Rows: []event.FDRow{{Row: 1, Fields: model.Attributes{
+		model.FieldBidPrice: bid,
+		model.FieldAskPrice: ask,
+		model.FieldVolume:   volume,
+	}}}}
+}
+
+func fill(eno, number, status, price, qty string) event.EC {
+	return event.EC{
+		EventNo:          eno,
+		OrderNumber:      number,
+		OrderStatus:      status,
+		ExecutedPrice:    price,
+		ExecutedQuantity: qty,
+	}
+}
+
+func TestTWAPEndToEnd(t *testing.T) {
+	server, requests := orderEndpoint(t)
+	cli, err := client.New(client.Config{})
+	if err != nil {
+		t.Fatalf("client.New() error = %v", err)
+	}
+	cli.SetVirtualURLs(auth.VirtualURLs{Request: server.URL})
+
+	start := time.Date(2024, 6, 3, 9, 0, 0, 0, model.JST)
+	clock := &fakeClock{now: start}
+	var (
+		progressMu sync.Mutex
+		last       Progress
+	)
+	executor, err := NewExecutor(cli.Request(), Parent{
+		Order:        request.LimitBuy("6501", request.MarketTSE, model.Yen(3050), 300),
+		Row:          1,
+		RefreshAfter: time.Minute,
+	}, TWAP{Start: start, End: start.Add(3 * time.Minute), Slices: 3},
+		WithSecondPassword("pw"),
+		WithInterval(5*time.Millisecond),
+		WithProgress(func(p Progress) {
+			progressMu.Lock()
+			last = p
+			progressMu.Unlock()
+		}),
+		withClock(clock.Now),
+	)
+	if err != nil {
+		t.Fatalf("NewExecutor() error = %v", err)
+	}
+
+	conn := &scriptedConn{events: make(chan event.Event)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, _ := event.NewService(scriptedDialer{conn: conn}).Stream(ctx)
+	done := make(chan error, 1)
+	go func() { done <- executor.Run(ctx, events, nil) }()
+
+	conn.events <- quote("3000", "3010", "10000")
+	expectRequest(t, requests, "CLMKabuNewOrder", map[string]string{"sOrderSuryou": "100", "sOrderPrice": "3000", "sBaibaiKubun": "3"})
+	conn.events <- fill("1", "1", "10", "3000", "100")
+	waitFor(t, func() bool { return executor.Progress().Filled == 100 })
+
+	clock.Advance(time.Minute)
+	expectRequest(t, requests, "CLMKabuNewOrder", map[string]string{"sOrderSuryou": "100"})
+
+	// The second slice rests past RefreshAfter: cancel, then replace with
+	// everything the schedule now wants.
+	clock.Advance(time.Minute + time.Second)
+	expectRequest(t, requests, "CLMKabuCancelOrder", map[string]string{"sOrderNumber": "2"})
+	conn.events <- fill("2", "2", "7", "", "")
+	expectRequest(t, requests, "CLMKabuNewOrder", map[string]string{"sOrderSuryou": "200"})
+	conn.events <- fill("3", "3", "10", "3010", "200")
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Run() did not finish")
+	}
+	progress := executor.Progress()
+	if progress.State != StateDone || progress.Filled != 300 || progress.Children != 3 {
+		t.Fatalf("progress = %+v", progress)
+	}
+	if want := model.PriceFromFloat(3006.6667); progress.AvgPrice != want {
+		t.Fatalf("avg = %s, want %s", progress.AvgPrice, want)
+	}
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	if last.State != StateDone {
+		t.Fatalf("last progress = %+v", last)
+	}
+}
+
+type mockRouter struct {
+	placed    []request.OrderParams
+	cancelled []request.OrderParams
+	newErrs   []error
+	list      []request.OrderEntry
+}
+
+func (m *mockRouter) KabuNewOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error) {
+	m.placed = append(m.placed, params)
+	if len(m.newErrs) > 0 {
+		err := m.newErrs[0]
+		m.newErrs = m.newErrs[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &request.OrderResponse{OrderNumber: strconv.Itoa(len(m.placed)), EigyouDay: "20240603"}, nil
+}
+
+func (m *mockRouter) OrderList(ctx context.Context, params request.OrderParams) (*request.OrderListResponse, error) {
+	return &request.OrderListResponse{Entries: m.list}, nil
+}
+
+func (m *mockRouter) KabuCancelOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error) {
+	m.cancelled = append(m.cancelled, params)
+	return &request.OrderResponse{}, nil
+}
+
+func TestPOVFollowsVolumeAndReprices(t *testing.T) {
+	router := &mockRouter{}
+	clock := &fakeClock{now: time.Date(2024, 6, 3, 9, 0, 0, 0, model.JST)}
+	executor, err := NewExecutor(router, Parent{
+		Order:   request.MarketSell("6501", request.MarketTSE, 500),
+		Row:     1,
+		Pricing: PricingPassive,
+	}, POV{Rate: 0.1}, withClock(clock.Now))
+	if err != nil {
+		t.Fatalf("NewExecutor() error = %v", err)
+	}
+
+	ctx := context.Background()
+	executor.Apply(ctx, quote("3000", "3010", "10000"))
+	executor.Apply(ctx, quote("3000", "3010", "11500"))
+	if len(router.placed) != 1 || router.placed[0]["sOrderSuryou"] != "100" || router.placed[0]["sOrderPrice"] != "3010" {
+		t.Fatalf("placed = %v", router.placed)
+	}
+
+	// The ask moves away: the resting slice is cancelled and, once the
+	// cancel is confirmed, replaced at the new touch.
+	executor.Apply(ctx, quote("3005", "3015", "12000"))
+	if len(router.cancelled) != 1 {
+		t.Fatalf("cancelled = %v", router.cancelled)
+	}
+	executor.Apply(ctx, fill("1", "1", "7", "", ""))
+	if len(router.placed) != 2 || router.placed[1]["sOrderSuryou"] != "200" || router.placed[1]["sOrderPrice"] != "3015" {
+		t.Fatalf("placed = %v", router.placed)
+	}
+	if progress := executor.Progress(); progress.MarketVolume != 2000 || progress.Working != 200 {
+		t.Fatalf("progress = %+v", progress)
+	}
+}
+
+func TestAmbiguousSliceIsResolvedBeforeSendingMore(t *testing.T) {
+	router := &mockRouter{newErrs: []error{context.DeadlineExceeded, context.DeadlineExceeded}}
+	clock := &fakeClock{now: time.Date(2024, 6, 3, 9, 0, 0, 0, model.JST)}
+	executor, err := NewExecutor(router, Parent{
+		Order:   request.MarketSell("6501", request.MarketTSE, 500),
+		Row:     1,
+		Pricing: PricingMarket,
+	}, POV{Rate: 0.1}, WithOrderLister(router), withClock(clock.Now))
+	if err != nil {
+		t.Fatalf("NewExecutor() error = %v", err)
+	}
+
+	ctx := context.Background()
+	executor.Apply(ctx, quote("3000", "3010", "10000"))
+	if err := executor.Apply(ctx, quote("3000", "3010", "11000")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	// The slice may be live: nothing more is sent while it is unresolved.
+	executor.Apply(ctx, quote("3000", "3010", "13000"))
+	if len(router.placed) != 1 || executor.Progress().Working != 100 {
+		t.Fatalf("placed = %v, progress = %+v", router.placed, executor.Progress())
+	}
+
+	router.list = []request.OrderEntry{{OrderID: "77", Symbol: "6501", Fields: model.Attributes{
+		"sOrderBaibaiKubun":   "1",
+		"sGenkinSinyouKubun":  "0",
+		"sOrderOrderSuryou":   "100",
+		"sOrderOrderPrice":    "0",
+		"sOrderOrderDateTime": "20240603090000",
+		"sOrderSikkouDay":     "20240603",
+		"sOrderStatusCode":    "10",
+		"sOrderYakuzyouSuryo": "100",
+		"sOrderYakuzyouPrice": "3000",
+	}}}
+	executor.Apply(ctx, quote("3000", "3010", "13000"))
+	children := executor.Children()
+	if children[0].OrderNumber != "77" || children[0].Status != oms.StatusFilled || executor.Progress().Filled != 100 {
+		t.Fatalf("children = %+v", children)
+	}
+	if len(router.placed) != 2 || router.placed[1]["sOrderSuryou"] != "200" {
+		t.Fatalf("placed = %v", router.placed)
+	}
+
+	// Not listed within the match window: taken as not placed and resent.
+	clock.Advance(time.Minute)
+	executor.Step(ctx)
+	if len(router.placed) != 2 {
+		t.Fatalf("resent inside the match window: %v", router.placed)
+	}
+	clock.Advance(2 * time.Minute)
+	executor.Step(ctx)
+	if len(router.placed) != 3 || executor.Children()[1].Status != oms.StatusRejected {
+		t.Fatalf("placed = %v, children = %+v", router.placed, executor.Children())
+	}
+}
+
+func TestRejectedCancelIsRetried(t *testing.T) {
+	router := &mockRouter{}
+	clock := &fakeClock{now: time.Date(2024, 6, 3, 9, 0, 0, 0, model.JST)}
+	executor, err := NewExecutor(router, Parent{
+		Order:        request.MarketSell("6501", request.MarketTSE, 500),
+		Row:          1,
+		Pricing:      PricingPassive,
+		RefreshAfter: time.Minute,
+	}, POV{Rate: 0.1}, withClock(clock.Now))
+	if err != nil {
+		t.Fatalf("NewExecutor() error = %v", err)
+	}
+
+	ctx := context.Background()
+	executor.Apply(ctx, quote("3000", "3010", "10000"))
+	executor.Apply(ctx, quote("3000", "3010", "11000"))
+	executor.Apply(ctx, quote("3005", "3015", "11000"))
+	if len(router.cancelled) != 1 {
+		t.Fatalf("cancelled = %v", router.cancelled)
+	}
+	// 取消失敗: the slice is still open, so the next move cancels again.
+	executor.Apply(ctx, fill("1", "1", "8", "", ""))
+	executor.Apply(ctx, quote("3000", "3020", "11000"))
+	if len(router.cancelled) != 2 {
+		t.Fatalf("cancelled = %v", router.cancelled)
+	}
+	// No answer at all: the cancel is resent after RefreshAfter.
+	executor.Step(ctx)
+	if len(router.cancelled) != 2 {
+		t.Fatalf("cancelled = %v", router.cancelled)
+	}
+	clock.Advance(time.Minute)
+	executor.Step(ctx)
+	if len(router.cancelled) != 3 {
+		t.Fatalf("cancelled = %v", router.cancelled)
+	}
+}
+
+func TestTWAPTarget(t *testing.T) {
+	start := time.Date(2024, 6, 3, 9, 0, 0, 0, model.JST)
+	twap := TWAP{Start: start, End: start.Add(time.Hour), Slices: 4}
+	cases := []struct {
+		at   time.Duration
+		want model.Quantity
+	}{
+		{-time.Minute, 0},
+		{0, 250},
+		{16 * time.Minute, 500},
+		{59 * time.Minute, 1000},
+		{2 * time.Hour, 1000},
+	}
+	for _, tc := range cases {
+		if got := twap.Target(start.Add(tc.at), 0, 1000); got != tc.want {
+			t.Fatalf("Target(%s) = %d, want %d", tc.at, got, tc.want)
+		}
+	}
+}
+
+func TestNewExecutorRejectsOddLot(t *testing.T) {
+	_, err := NewExecutor(&mockRouter{}, Parent{
+		Order: request.MarketBuy("6501", request.MarketTSE, 150),
+	}, POV{Rate: 0.1})
+	if err == nil {
+		t.Fatalf("NewExecutor() expected error")
+	}
+}
+
+func TestLotSize(t *testing.T) {
+	store := master.NewMemoryStore()
+	store.Upsert(master.MasterIssueMstKabu, "6501", model.Attributes{
+		master.IssueKabuFieldBaibaiTani: "100",
+	}, master.UpdateMeta{})
+	store.Upsert(master.MasterIssueSizyouMstKabu, master.JoinIndex("1306", "00"), model.Attributes{
+		master.IssueSizyouKabuFieldSizyoubetuBaibaiTani: "10",
+	}, master.UpdateMeta{})
+	if lot, err := LotSize(store, "6501", "00"); err != nil || lot != 100 {
+		t.Fatalf("LotSize(6501) = %d, %v", lot, err)
+	}
+	if lot, err := LotSize(store, "1306", "00"); err != nil || lot != 10 {
+		t.Fatalf("LotSize(1306) = %d, %v", lot, err)
+	}
+	if _, err := LotSize(store, "9999", "00"); err == nil {
+		t.Fatalf("LotSize(9999) expected error")
+	}
+}
@@ -0,0 +1,27 @@
+package algo
+
+import (
+	"strings"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/master"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+// LotSize returns the trading unit (売買単位) for an issue on market from
+// sSizyoubetuBaibaiTani, falling back to sBaibaiTani of CLMIssueMstKabu.
+func LotSize(store master.MasterStore, issueCode, marketCode string) (model.Quantity, error) {
+	issueCode = strings.TrimSpace(issueCode)
+	marketCode = strings.TrimSpace(marketCode)
+	if record, ok := store.Get(master.MasterIssueSizyouMstKabu, master.JoinIndex(issueCode, marketCode)); ok {
+		if lot, ok := master.ParseLot(record.Fields.Value(master.IssueSizyouKabuFieldSizyoubetuBaibaiTani)); ok {
+			return lot, nil
+		}
+	}
+	if record, ok := store.Get(master.MasterIssueMstKabu, issueCode); ok {
+		if lot, ok := master.ParseLot(record.Fields.Value(master.IssueKabuFieldBaibaiTani)); ok {
+			return lot, nil
+		}
+	}
+	return 0, &terrors.ValidationError{Field: master.IssueKabuFieldBaibaiTani, Reason: "unknown for " + issueCode + "/" + marketCode}
+}
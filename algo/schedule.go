@@ -0,0 +1,75 @@
+package algo
+
+import (
+	"math"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+// Schedule decides how much of the parent should be filled by now.
+type Schedule interface {
+	// Target returns the cumulative quantity to have filled at now, given
+	// the market volume traded since the executor started.
+	Target(now time.Time, volume, total model.Quantity) model.Quantity
+	// Ended reports whether the schedule has run out of time.
+	Ended(now time.Time) bool
+	Validate() error
+}
+
+// TWAP releases the parent in equal slices between Start and End.
+type TWAP struct {
+	Start  time.Time
+	End    time.Time
+	Slices int
+}
+
+func (t TWAP) Target(now time.Time, volume, total model.Quantity) model.Quantity {
+	if now.Before(t.Start) {
+		return 0
+	}
+	interval := t.End.Sub(t.Start) / time.Duration(t.Slices)
+	slot := int64(1)
+	if interval > 0 {
+		slot = int64(now.Sub(t.Start)/interval) + 1
+	}
+	slot = min(slot, int64(t.Slices))
+	return model.Quantity(int64(total) * slot / int64(t.Slices))
+}
+
+func (t TWAP) Ended(now time.Time) bool {
+	return !now.Before(t.End)
+}
+
+func (t TWAP) Validate() error {
+	if t.Slices <= 0 {
+		return &terrors.ValidationError{Field: "slices", Reason: "must be positive"}
+	}
+	if !t.End.After(t.Start) {
+		return &terrors.ValidationError{Field: "end", Reason: "must be after start"}
+	}
+	return nil
+}
+
+// POV participates in a fixed share of market volume (pDV), which tracks
+// the VWAP over the period. A zero End runs until the parent is filled.
+type POV struct {
+	Rate float64
+	End  time.Time
+}
+
+func (p POV) Target(now time.Time, volume, total model.Quantity) model.Quantity {
+	return model.Quantity(math.Floor(float64(volume) * p.Rate))
+}
+
+func (p POV) Ended(now time.Time) bool {
+	return !p.End.IsZero() && !now.Before(p.End)
+}
+
+func (p POV) Validate() error {
+	if p.Rate <= 0 || p.Rate > 1 {
+		return &terrors.ValidationError{Field: "rate", Reason: "must be in (0, 1]"}
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package calendar
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ueebee/tachibanashi/master"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+// CLMDateZyouhou sDayKey values.
+const (
+	DayKeyToday   = "001" // 当日基準
+	DayKeyNextDay = "002" // 翌日基準（夕場）
+)
+
+// equitySettlementDays is the T+N fallback for trade dates the master does
+// not cover.
+const equitySettlementDays = 2
+
+var businessDayFields = []string{
+	master.DateInfoFieldMaeEigyouDay3,
+	master.DateInfoFieldMaeEigyouDay2,
+	master.DateInfoFieldMaeEigyouDay1,
+	master.DateInfoFieldTheDay,
+	master.DateInfoFieldYokuEigyouDay1,
+	master.DateInfoFieldYokuEigyouDay2,
+	master.DateInfoFieldYokuEigyouDay3,
+	master.DateInfoFieldYokuEigyouDay4,
+	master.DateInfoFieldYokuEigyouDay5,
+	master.DateInfoFieldYokuEigyouDay6,
+	master.DateInfoFieldYokuEigyouDay7,
+	master.DateInfoFieldYokuEigyouDay8,
+	master.DateInfoFieldYokuEigyouDay9,
+	master.DateInfoFieldYokuEigyouDay10,
+}
+
+type settlement struct {
+	kabu string
+	bond string
+}
+
+// Calendar answers business-day questions from the CLMDateZyouhou records
+// in a master store. The master only lists a window of business days
+// (three before and ten after sTheDay); inside that window any other day is
+// a holiday. Outside it weekends and the 12/31-1/3 exchange holidays are
+// treated as closed and every other day as open.
+// All results are midnight in Asia/Tokyo.
+type Calendar struct {
+	store master.MasterStore
+
+	mu         sync.RWMutex
+	days       map[string]struct{}
+	first      string
+	last       string
+	today      string
+	settlement map[string]settlement
+}
+
+// New builds a calendar from store. Call Refresh or install Handler to pick
+// up later master updates.
+func New(store master.MasterStore) *Calendar {
+	c := &Calendar{store: store}
+	c.Refresh()
+	return c
+}
+
+// Refresh rebuilds the calendar from the stored CLMDateZyouhou records.
+func (c *Calendar) Refresh() {
+	days := make(map[string]struct{})
+	settlements := make(map[string]settlement)
+	today := ""
+	if c.store != nil {
+		for _, record := range c.store.All(master.MasterDateZyouhou) {
+			fields := record.Fields
+			for _, key := range businessDayFields {
+				if day := strings.TrimSpace(fields.Value(key)); validDay(day) {
+					days[day] = struct{}{}
+				}
+			}
+			theDay := strings.TrimSpace(fields.Value(master.DateInfoFieldTheDay))
+			if !validDay(theDay) {
+				continue
+			}
+			settlements[theDay] = settlement{
+				kabu: strings.TrimSpace(fields.Value(master.DateInfoFieldKabuUkewatasiDay)),
+				bond: strings.TrimSpace(fields.Value(master.DateInfoFieldBondUkewatasiDay)),
+			}
+			if strings.TrimSpace(fields.Value(master.DateInfoFieldDayKey)) == DayKeyToday {
+				today = theDay
+			}
+		}
+	}
+
+	sorted := make([]string, 0, len(days))
+	for day := range days {
+		sorted = append(sorted, day)
+	}
+	sort.Strings(sorted)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.days = days
+	c.settlement = settlements
+	c.today = today
+	c.first, c.last = "", ""
+	if len(sorted) > 0 {
+		c.first, c.last = sorted[0], sorted[len(sorted)-1]
+	}
+}
+
+// Handler returns a master.DownloadHandler that refreshes the calendar when
+// CLMDateZyouhou changes and then calls next (which may be nil). Pass it to
+// master.Service.DownloadStream together with the calendar's store.
+func (c *Calendar) Handler(next master.DownloadHandler) master.DownloadHandler {
+	return func(message master.DownloadMessage) error {
+		switch message.Type {
+		case master.MasterDateZyouhou, master.MasterEventDownloadComplete:
+			c.Refresh()
+		}
+		if next != nil {
+			return next(message)
+		}
+		return nil
+	}
+}
+
+// Today returns sTheDay of the same-day record, or false before the master
+// has been loaded.
+func (c *Calendar) Today() (time.Time, bool) {
+	c.mu.RLock()
+	today := c.today
+	c.mu.RUnlock()
+	if today == "" {
+		return time.Time{}, false
+	}
+	parsed, err := model.ParseDate(today)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return parsed, true
+}
+
+// Covers reports whether t falls inside the window listed by the master.
+func (c *Calendar) Covers(t time.Time) bool {
+	day := model.FormatDate(t)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.first != "" && day >= c.first && day <= c.last
+}
+
+// IsBusinessDay reports whether the exchange is open on t's date in JST.
+func (c *Calendar) IsBusinessDay(t time.Time) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.isBusinessDay(Date(t))
+}
+
+func (c *Calendar) isBusinessDay(date time.Time) bool {
+	day := model.FormatDate(date)
+	if c.first != "" && day >= c.first && day <= c.last {
+		_, ok := c.days[day]
+		return ok
+	}
+	return fallbackBusinessDay(date)
+}
+
+// NextBusinessDay returns the n-th business day after t. n <= 0 returns t's
+// date unchanged.
+func (c *Calendar) NextBusinessDay(t time.Time, n int) time.Time {
+	return c.step(Date(t), n, 1)
+}
+
+// PrevBusinessDay returns the n-th business day before t. n <= 0 returns t's
+// date unchanged.
+func (c *Calendar) PrevBusinessDay(t time.Time, n int) time.Time {
+	return c.step(Date(t), n, -1)
+}
+
+func (c *Calendar) step(date time.Time, n, direction int) time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for n > 0 {
+		date = date.AddDate(0, 0, direction)
+		if c.isBusinessDay(date) {
+			n--
+		}
+	}
+	return date
+}
+
+// SettlementDate returns the equity settlement (受渡) date for a trade on
+// tradeDate: sKabuUkewatasiDay when the master lists that trade date,
+// otherwise T+2 business days.
+func (c *Calendar) SettlementDate(tradeDate time.Time) time.Time {
+	c.mu.RLock()
+	entry, ok := c.settlement[model.FormatDate(tradeDate)]
+	c.mu.RUnlock()
+	if ok {
+		if parsed, err := model.ParseDate(entry.kabu); err == nil {
+			return parsed
+		}
+	}
+	return c.NextBusinessDay(tradeDate, equitySettlementDays)
+}
+
+// BondSettlementDate returns sBondUkewatasiDay for a trade on tradeDate, or
+// false when the master does not list that trade date.
+func (c *Calendar) BondSettlementDate(tradeDate time.Time) (time.Time, bool) {
+	c.mu.RLock()
+	entry, ok := c.settlement[model.FormatDate(tradeDate)]
+	c.mu.RUnlock()
+	if !ok {
+		return time.Time{}, false
+	}
+	parsed, err := model.ParseDate(entry.bond)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return parsed, true
+}
+
+// Date returns midnight of t's calendar date in Asia/Tokyo.
+func Date(t time.Time) time.Time {
+	t = t.In(model.JST)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, model.JST)
+}
+
+func fallbackBusinessDay(date time.Time) bool {
+	switch date.Weekday() {
+	case time.Saturday, time.Sunday:
+		return false
+	}
+	month, day := date.Month(), date.Day()
+	if month == time.January && day <= 3 {
+		return false
+	}
+	if month == time.December && day == 31 {
+		return false
+	}
+	return true
+}
+
+func validDay(day string) bool {
+	if len(day) != 8 || day == "00000000" {
+		return false
+	}
+	_, err := model.ParseDate(day)
+	return err == nil
+}
@@ -0,0 +1,131 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ueebee/tachibanashi/master"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+func goldenWeek() model.Attributes {
+	return model.Attributes{
+		master.DateInfoFieldDayKey:           DayKeyToday,
+		master.DateInfoFieldMaeEigyouDay3:    "20240423",
+		master.DateInfoFieldMaeEigyouDay2:    "20240424",
+		master.DateInfoFieldMaeEigyouDay1:    "20240425",
+		master.DateInfoFieldTheDay:           "20240426",
+		master.DateInfoFieldYokuEigyouDay1:   "20240430",
+		master.DateInfoFieldYokuEigyouDay2:   "20240501",
+		master.DateInfoFieldYokuEigyouDay3:   "20240502",
+		master.DateInfoFieldYokuEigyouDay4:   "20240507",
+		master.DateInfoFieldYokuEigyouDay5:   "20240508",
+		master.DateInfoFieldYokuEigyouDay6:   "20240509",
+		master.DateInfoFieldYokuEigyouDay7:   "20240510",
+		master.DateInfoFieldYokuEigyouDay8:   "20240513",
+		master.DateInfoFieldYokuEigyouDay9:   "20240514",
+		master.DateInfoFieldYokuEigyouDay10:  "20240515",
+		master.DateInfoFieldKabuUkewatasiDay: "20240501",
+		master.DateInfoFieldBondUkewatasiDay: "20240430",
+	}
+}
+
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, model.JST)
+}
+
+func newTestCalendar() (*Calendar, *master.MemoryStore) {
+	store := master.NewMemoryStore()
+	store.Upsert(master.MasterDateZyouhou, DayKeyToday, goldenWeek(), master.UpdateMeta{})
+	return New(store), store
+}
+
+func TestIsBusinessDay(t *testing.T) {
+	cal, _ := newTestCalendar()
+	cases := []struct {
+		date time.Time
+		want bool
+	}{
+		{day(2024, 4, 26), true},
+		{day(2024, 4, 29), false}, // 昭和の日
+		{day(2024, 5, 3), false},
+		{day(2024, 5, 6), false},
+		{day(2024, 5, 7), true},
+		{day(2024, 6, 3), true},  // outside the window: weekday
+		{day(2024, 6, 1), false}, // outside the window: Saturday
+		{day(2025, 1, 2), false},
+	}
+	for _, tc := range cases {
+		if got := cal.IsBusinessDay(tc.date); got != tc.want {
+			t.Errorf("IsBusinessDay(%s) = %v, want %v", model.FormatDate(tc.date), got, tc.want)
+		}
+	}
+	// Late evening UTC on 5/6 is already 5/7 in Tokyo.
+	if !cal.IsBusinessDay(time.Date(2024, 5, 6, 16, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected JST conversion")
+	}
+}
+
+func TestNextAndPrevBusinessDay(t *testing.T) {
+	cal, _ := newTestCalendar()
+	if got := cal.NextBusinessDay(day(2024, 5, 2), 1); !got.Equal(day(2024, 5, 7)) {
+		t.Fatalf("NextBusinessDay = %s", got)
+	}
+	if got := cal.NextBusinessDay(day(2024, 4, 26), 3); !got.Equal(day(2024, 5, 2)) {
+		t.Fatalf("NextBusinessDay(3) = %s", got)
+	}
+	if got := cal.PrevBusinessDay(day(2024, 5, 7), 2); !got.Equal(day(2024, 5, 1)) {
+		t.Fatalf("PrevBusinessDay(2) = %s", got)
+	}
+	if got := cal.PrevBusinessDay(day(2024, 5, 7), 0); !got.Equal(day(2024, 5, 7)) {
+		t.Fatalf("PrevBusinessDay(0) = %s", got)
+	}
+	if got := cal.NextBusinessDay(day(2024, 5, 15), 1); !got.Equal(day(2024, 5, 16)) {
+		t.Fatalf("NextBusinessDay beyond window = %s", got)
+	}
+	if got, ok := cal.Today(); !ok || !got.Equal(day(2024, 4, 26)) {
+		t.Fatalf("Today = %s, %v", got, ok)
+	}
+}
+
+func TestSettlementDate(t *testing.T) {
+	cal, _ := newTestCalendar()
+	if got := cal.SettlementDate(day(2024, 4, 26)); !got.Equal(day(2024, 5, 1)) {
+		t.Fatalf("SettlementDate = %s", got)
+	}
+	// Not listed: T+2 on the calendar.
+	if got := cal.SettlementDate(day(2024, 5, 2)); !got.Equal(day(2024, 5, 8)) {
+		t.Fatalf("SettlementDate fallback = %s", got)
+	}
+	if got, ok := cal.BondSettlementDate(day(2024, 4, 26)); !ok || !got.Equal(day(2024, 4, 30)) {
+		t.Fatalf("BondSettlementDate = %s, %v", got, ok)
+	}
+	if _, ok := cal.BondSettlementDate(day(2024, 5, 2)); ok {
+		t.Fatalf("expected unknown bond settlement")
+	}
+}
+
+func TestHandlerRefreshesOnUpdate(t *testing.T) {
+	cal, store := newTestCalendar()
+	calls := 0
+	handler := cal.Handler(func(master.DownloadMessage) error {
+		calls++
+		return nil
+	})
+
+	fields := goldenWeek()
+	fields[master.DateInfoFieldYokuEigyouDay1] = "20240429"
+	store.Upsert(master.MasterDateZyouhou, DayKeyToday, fields, master.UpdateMeta{})
+	if cal.IsBusinessDay(day(2024, 4, 29)) {
+		t.Fatalf("calendar should not change before the handler runs")
+	}
+	if err := handler(master.DownloadMessage{Type: master.MasterDateZyouhou, Key: DayKeyToday, Fields: fields}); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if !cal.IsBusinessDay(day(2024, 4, 29)) {
+		t.Fatalf("calendar was not refreshed")
+	}
+	if calls != 1 {
+		t.Fatalf("next handler calls = %d", calls)
+	}
+}
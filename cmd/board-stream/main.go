@@ -181,7 +181,7 @@ func formatBookLevels(levels []model.BookLevel) string {
 			parts = append(parts, "-")
 			continue
 		}
-		parts = append(parts, fmt.Sprintf("%d(%d)", level.Price, level.Quantity))
+		parts = append(parts, fmt.Sprintf("%s(%d)", level.Price, level.Quantity))
 	}
 	return strings.Join(parts, " ")
 }
@@ -203,7 +203,7 @@ func formatMaybePrice(value model.Price, ok bool) string {
 	if !ok {
 		return ""
 	}
-	return fmt.Sprintf("%d", value)
+	return value.String()
 }
 
 func buildSymbolMap(rows []int, codes []string) map[int]string {
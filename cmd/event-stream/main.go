@@ -171,10 +171,10 @@ func printEvent(ev event.Event, symbols map[int]string, quoteBook *event.QuoteBo
 		fmt.Println("kp")
 	case event.EC:
 		order := e.Order()
-		fmt.Printf("ec order=%s status=%s symbol=%s side=%s qty=%d price=%d\n",
+		fmt.Printf("ec order=%s status=%s symbol=%s side=%s qty=%d price=%s\n",
 			order.ID, order.Status, order.Symbol, order.Side, order.Quantity, order.Price)
 		if exec, ok := e.Execution(); ok {
-			fmt.Printf("  exec qty=%d price=%d time=%s\n", exec.Quantity, exec.Price, exec.Time)
+			fmt.Printf("  exec qty=%d price=%s time=%s\n", exec.Quantity, exec.Price, exec.Time)
 		}
 	case event.NS:
 		fmt.Printf("ns id=%s headline=%s\n", e.NewsID, truncate(e.Headline, 120))
@@ -244,7 +244,7 @@ func formatMaybePrice(value model.Price, ok bool) string {
 	if !ok {
 		return ""
 	}
-	return fmt.Sprintf("%d", value)
+	return value.String()
 }
 
 func truncate(value string, max int) string {
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"crypto/tls"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,17 +14,40 @@ import (
 
 	"github.com/ueebee/tachibanashi/auth"
 	"github.com/ueebee/tachibanashi/client"
+	"github.com/ueebee/tachibanashi/master"
 	"github.com/ueebee/tachibanashi/request"
+	"github.com/ueebee/tachibanashi/ticks"
 )
 
 func main() {
+	filter := flag.Bool("filter", false, "cancel every open order matching the filter flags")
+	symbol := flag.String("symbol", "", "filter: issue code")
+	side := flag.String("side", "", "filter: buy, sell or sBaibaiKubun")
+	cashMargin := flag.String("cash-margin", "", "filter: cash, margin or comma-separated sGenkinShinyouKubun")
+	olderThan := flag.Duration("older-than", 0, "filter: orders placed at least this long ago")
+	reprice := flag.Int("reprice", 0, "filter: move limit prices by N ticks instead of cancelling")
+	concurrency := flag.Int("concurrency", request.DefaultBulkConcurrency, "filter: requests in flight")
+	flag.Parse()
+
 	_ = loadDotEnv(".env")
 
 	loginID := mustEnvAny("TACHIBANASHI_LOGIN_ID", "TACHIBANA_USER_ID")
 	password := mustEnvAny("TACHIBANASHI_PASSWORD", "TACHIBANA_PASSWORD")
 	secondPassword := mustEnvAny("TACHIBANASHI_SECOND_PASSWORD", "TACHIBANASHI_ORDER_SECOND_PASSWORD")
-	orderNumber := mustEnvAny("TACHIBANASHI_ORDER_NUMBER")
-	eigyouDay := mustEnvAny("TACHIBANASHI_EIGYOU_DAY")
+
+	var orderFilter request.OrderFilter
+	var orderNumber, eigyouDay string
+	if *filter {
+		orderFilter = request.OrderFilter{
+			Symbol:       *symbol,
+			Side:         parseSide(*side),
+			CashOrMargin: parseCashMargin(*cashMargin),
+			OlderThan:    *olderThan,
+		}
+	} else {
+		orderNumber = mustEnvAny("TACHIBANASHI_ORDER_NUMBER")
+		eigyouDay = mustEnvAny("TACHIBANASHI_EIGYOU_DAY")
+	}
 
 	baseURL := envOrAny(client.BaseURLDemo, "TACHIBANASHI_BASE_URL", "TACHIBANA_BASE_URL")
 	cfg := client.Config{BaseURL: baseURL}
@@ -67,6 +91,11 @@ func main() {
 		}
 	}()
 
+	if *filter {
+		runFilter(cli, orderFilter, *reprice, *concurrency, secondPassword)
+		return
+	}
+
 	params := request.OrderParams{
 		"sOrderNumber":    orderNumber,
 		"sEigyouDay":      eigyouDay,
@@ -85,6 +114,77 @@ func main() {
 	fmt.Printf("  eigyou_day: %s\n", resp.EigyouDay)
 }
 
+func runFilter(cli *client.Client, filter request.OrderFilter, reprice, concurrency int, secondPassword string) {
+	ctx := context.Background()
+	var (
+		results []request.BulkResult
+		err     error
+	)
+	if reprice != 0 {
+		store := master.NewMemoryStore()
+		if err := cli.Master().Download(ctx, store, nil); err != nil {
+			log.Fatal(err)
+		}
+		results, err = cli.Request().RepriceOrders(ctx, filter, reprice, ticks.NewResolver(store), secondPassword, request.WithConcurrency(concurrency))
+	} else {
+		results, err = cli.Request().CancelOrders(ctx, filter, secondPassword, request.WithConcurrency(concurrency))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if reprice != 0 {
+		fmt.Println("order_reprice")
+	} else {
+		fmt.Println("order_cancel_filter")
+	}
+	fmt.Printf("  matched: %d\n", len(results))
+	failed := 0
+	for _, result := range results {
+		status := "ok"
+		if result.Err != nil {
+			status = "error: " + result.Err.Error()
+			failed++
+		}
+		if reprice != 0 && result.Err == nil {
+			status = "ok " + result.Price.String()
+		}
+		fmt.Printf("  %s %s %s: %s\n", result.OrderNumber, result.EigyouDay, result.Symbol, status)
+	}
+	if failed > 0 {
+		log.Fatalf("%d of %d orders failed", failed, len(results))
+	}
+}
+
+func parseSide(value string) request.Side {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		return ""
+	case "buy", string(request.SideBuy):
+		return request.SideBuy
+	case "sell", string(request.SideSell):
+		return request.SideSell
+	}
+	log.Fatalf("invalid -side: %s", value)
+	return ""
+}
+
+func parseCashMargin(value string) []request.CashOrMargin {
+	var out []request.CashOrMargin
+	for _, part := range strings.Split(value, ",") {
+		switch part = strings.ToLower(strings.TrimSpace(part)); part {
+		case "":
+		case "cash":
+			out = append(out, request.Cash)
+		case "margin":
+			out = append(out, request.MarginSystemOpen, request.MarginSystemClose, request.MarginGeneralOpen, request.MarginGeneralClose)
+		default:
+			out = append(out, request.CashOrMargin(part))
+		}
+	}
+	return out
+}
+
 func loadDotEnv(path string) error {
 	file, err := os.Open(path)
 	if err != nil {
@@ -95,7 +95,7 @@ func main() {
 			order := entry.Order()
 			side := entry.Fields.Value("sOrderBaibaiKubun")
 			qty := valueOrNumber(entry.Fields, "sOrderOrderSuryou", int64(order.Quantity))
-			price := valueOrNumber(entry.Fields, "sOrderOrderPrice", int64(order.Price))
+			price := valueOrPrice(entry.Fields, "sOrderOrderPrice", order.Price)
 			status := entry.Fields.Value("sOrderStatus")
 			execDay := entry.Fields.Value("sOrderSikkouDay")
 			orderTime := entry.Fields.Value("sOrderOrderDateTime")
@@ -137,6 +137,18 @@ func valueOrNumber(fields model.Attributes, key string, fallback int64) string {
 	return ""
 }
 
+func valueOrPrice(fields model.Attributes, key string, fallback model.Price) string {
+	if fields != nil {
+		if value := fields.Value(key); value != "" {
+			return value
+		}
+	}
+	if fallback != 0 {
+		return fallback.String()
+	}
+	return ""
+}
+
 func envFirst(names ...string) string {
 	for _, name := range names {
 		if value := strings.TrimSpace(os.Getenv(name)); value != "" {
@@ -81,12 +81,12 @@ func main() {
 	for _, quote := range resp.Quotes {
 		fmt.Printf("%s\n", quote.Symbol)
 		if value, ok := quote.LastPrice(); ok {
-			fmt.Printf("  last: %d\n", int64(value))
+			fmt.Printf("  last: %s\n", value)
 		} else {
 			fmt.Printf("  last: \n")
 		}
 		if value, ok := quote.PrevClose(); ok {
-			fmt.Printf("  prev_close: %d\n", int64(value))
+			fmt.Printf("  prev_close: %s\n", value)
 		} else {
 			fmt.Printf("  prev_close: \n")
 		}
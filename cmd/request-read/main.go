@@ -211,7 +211,7 @@ func printPositions(title string, positions []model.Position, qtyKey, avgKey, pn
 	}
 	for _, pos := range positions {
 		qty := valueOrNumber(pos.Raw, qtyKey, int64(pos.Quantity))
-		avg := valueOrNumber(pos.Raw, avgKey, int64(pos.AvgPrice))
+		avg := valueOrPrice(pos.Raw, avgKey, pos.AvgPrice)
 		pnl := valueOrNumber(pos.Raw, pnlKey, pos.UnrealPnL)
 		fmt.Printf("  %s qty=%s avg=%s pnl=%s\n", pos.Symbol, qty, avg, pnl)
 	}
@@ -229,6 +229,18 @@ func valueOrNumber(fields model.Attributes, key string, fallback int64) string {
 	return ""
 }
 
+func valueOrPrice(fields model.Attributes, key string, fallback model.Price) string {
+	if fields != nil {
+		if value := fields.Value(key); value != "" {
+			return value
+		}
+	}
+	if fallback != 0 {
+		return fallback.String()
+	}
+	return ""
+}
+
 func loadDotEnv(path string) error {
 	file, err := os.Open(path)
 	if err != nil {
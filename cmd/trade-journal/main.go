@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ueebee/tachibanashi/auth"
+	"github.com/ueebee/tachibanashi/calendar"
+	"github.com/ueebee/tachibanashi/client"
+	"github.com/ueebee/tachibanashi/cost"
+	"github.com/ueebee/tachibanashi/event"
+	"github.com/ueebee/tachibanashi/journal"
+	"github.com/ueebee/tachibanashi/master"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+func main() {
+	_ = loadDotEnv(".env")
+
+	loginID := mustEnvAny("TACHIBANASHI_LOGIN_ID", "TACHIBANA_USER_ID")
+	password := mustEnvAny("TACHIBANASHI_PASSWORD", "TACHIBANA_PASSWORD")
+
+	day := time.Now().In(model.JST)
+	if value := strings.TrimSpace(os.Getenv("TACHIBANASHI_JOURNAL_DATE")); value != "" {
+		parsed, err := model.ParseDate(value)
+		if err != nil {
+			log.Fatalf("invalid TACHIBANASHI_JOURNAL_DATE: %v", err)
+		}
+		day = parsed
+	}
+
+	format := strings.ToLower(envOrAny("csv", "TACHIBANASHI_JOURNAL_FORMAT"))
+	if format != "csv" && format != "jsonl" {
+		log.Fatalf("invalid TACHIBANASHI_JOURNAL_FORMAT: %s", format)
+	}
+
+	schedule := cost.Schedule{
+		Cash:    parsePlan("TACHIBANASHI_JOURNAL_CASH_PLAN"),
+		Margin:  parsePlan("TACHIBANASHI_JOURNAL_MARGIN_PLAN"),
+		TaxRate: 0.10,
+	}
+	if value := strings.TrimSpace(os.Getenv("TACHIBANASHI_JOURNAL_TAX_RATE")); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.Fatalf("invalid TACHIBANASHI_JOURNAL_TAX_RATE: %v", err)
+		}
+		schedule.TaxRate = rate
+	}
+	if err := schedule.Validate(); err != nil {
+		log.Fatalf("invalid fee schedule: %v", err)
+	}
+
+	opts := []journal.Option{journal.WithSchedule(schedule)}
+	if path := strings.TrimSpace(os.Getenv("TACHIBANASHI_JOURNAL_EC_LOG")); path != "" {
+		execs, err := readECLog(path)
+		if err != nil {
+			log.Fatalf("read TACHIBANASHI_JOURNAL_EC_LOG: %v", err)
+		}
+		opts = append(opts, journal.WithExecutions(execs))
+	}
+
+	baseURL := envOrAny(client.BaseURLDemo, "TACHIBANASHI_BASE_URL", "TACHIBANA_BASE_URL")
+	cfg := client.Config{BaseURL: baseURL}
+
+	if timeout := os.Getenv("TACHIBANASHI_TIMEOUT"); timeout != "" {
+		dur, err := time.ParseDuration(timeout)
+		if err != nil {
+			log.Fatalf("invalid TACHIBANASHI_TIMEOUT: %v", err)
+		}
+		cfg.Timeout = dur
+	}
+
+	if ua := os.Getenv("TACHIBANASHI_USER_AGENT"); ua != "" {
+		cfg.UserAgent = ua
+	}
+
+	if isTrue(os.Getenv("TACHIBANASHI_INSECURE_TLS")) {
+		cfg.HTTPClient = &http.Client{
+			Timeout: cfg.Timeout,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		}
+	}
+
+	cli, err := client.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	_, err = cli.Auth().Login(ctx, auth.Credentials{
+		LoginID:  loginID,
+		Password: password,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		if err := cli.Auth().Logout(context.Background()); err != nil {
+			log.Printf("logout failed: %v", err)
+		}
+	}()
+
+	store := master.NewMemoryStore()
+	if err := cli.Master().Download(ctx, store, nil); err != nil {
+		log.Fatal(err)
+	}
+
+	exporter := journal.NewExporter(cli.Request(), store, calendar.New(store), opts...)
+	rows, err := exporter.Build(ctx, day)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var out io.Writer = os.Stdout
+	if path := strings.TrimSpace(os.Getenv("TACHIBANASHI_JOURNAL_OUT")); path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if format == "jsonl" {
+		err = journal.WriteJSONL(out, rows)
+	} else {
+		err = journal.WriteCSV(out, rows)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("trade_journal %s: %d rows", model.FormatDate(day), len(rows))
+}
+
+// parsePlan reads "zero" or "<kind>:<up_to>=<fee>,...,*=<fee>", e.g.
+// "per-trade:50000=55,100000=99,*=275". Unset means zero.
+func parsePlan(name string) cost.Plan {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" || value == string(cost.PlanZero) {
+		return cost.Plan{Kind: cost.PlanZero}
+	}
+	kind, tiers, ok := strings.Cut(value, ":")
+	if !ok {
+		log.Fatalf("invalid %s: %s", name, value)
+	}
+	plan := cost.Plan{Kind: cost.PlanKind(strings.TrimSpace(kind))}
+	for _, part := range strings.Split(tiers, ",") {
+		upTo, fee, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			log.Fatalf("invalid %s tier: %s", name, part)
+		}
+		var tier cost.Tier
+		var err error
+		if upTo = strings.TrimSpace(upTo); upTo != "*" {
+			if tier.UpTo, err = strconv.ParseInt(upTo, 10, 64); err != nil {
+				log.Fatalf("invalid %s tier: %s", name, part)
+			}
+		}
+		if tier.Fee, err = strconv.ParseInt(strings.TrimSpace(fee), 10, 64); err != nil {
+			log.Fatalf("invalid %s tier: %s", name, part)
+		}
+		plan.Tiers = append(plan.Tiers, tier)
+	}
+	return plan
+}
+
+// readECLog reads raw event frames, one per line, and keeps EC fills.
+// Redelivered notices are dropped by p_ENO.
+func readECLog(path string) ([]model.Execution, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var execs []model.Execution
+	seen := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		ev, err := event.DecodeEvent(line)
+		if err != nil {
+			continue
+		}
+		ec, ok := ev.(event.EC)
+		if !ok {
+			continue
+		}
+		if ec.EventNo != "" {
+			if _, dup := seen[ec.EventNo]; dup {
+				continue
+			}
+			seen[ec.EventNo] = struct{}{}
+		}
+		if exec, ok := ec.Execution(); ok && exec.Quantity > 0 {
+			execs = append(execs, exec)
+		}
+	}
+	return execs, scanner.Err()
+}
+
+func loadDotEnv(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		value = trimQuotes(value)
+		if key == "" {
+			continue
+		}
+		if _, exists := os.LookupEnv(key); !exists {
+			_ = os.Setenv(key, value)
+		}
+	}
+	return scanner.Err()
+}
+
+func trimQuotes(value string) string {
+	if len(value) >= 2 {
+		if (value[0] == '"' && value[len(value)-1] == '"') || (value[0] == '\'' && value[len(value)-1] == '\'') {
+			return value[1 : len(value)-1]
+		}
+	}
+	return value
+}
+
+func mustEnvAny(names ...string) string {
+	for _, name := range names {
+		value := strings.TrimSpace(os.Getenv(name))
+		if value != "" {
+			return value
+		}
+	}
+	log.Fatalf("missing %s", strings.Join(names, " or "))
+	return ""
+}
+
+func envOrAny(fallback string, names ...string) string {
+	for _, name := range names {
+		value := strings.TrimSpace(os.Getenv(name))
+		if value != "" {
+			return value
+		}
+	}
+	return fallback
+}
+
+func isTrue(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "yes", "y":
+		return true
+	default:
+		return false
+	}
+}
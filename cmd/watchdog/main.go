@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ueebee/tachibanashi/client"
+	"github.com/ueebee/tachibanashi/watchdog"
+)
+
+// pNoMargin keeps the watchdog's p_no ahead of requests the bot may have
+// sent after its last state write.
+const pNoMargin = 1000
+
+func main() {
+	_ = loadDotEnv(".env")
+
+	statePath := mustEnvAny("TACHIBANASHI_WATCHDOG_STATE")
+	secondPassword := mustEnvAny("TACHIBANASHI_SECOND_PASSWORD", "TACHIBANASHI_ORDER_SECOND_PASSWORD")
+	feedTimeout := durationEnv("TACHIBANASHI_WATCHDOG_FEED_TIMEOUT", 60*time.Second)
+	heartbeatTimeout := durationEnv("TACHIBANASHI_WATCHDOG_HEARTBEAT_TIMEOUT", 30*time.Second)
+	poll := durationEnv("TACHIBANASHI_WATCHDOG_POLL", time.Second)
+
+	cfg := client.Config{BaseURL: envOrAny(client.BaseURLDemo, "TACHIBANASHI_BASE_URL", "TACHIBANA_BASE_URL")}
+	if timeout := os.Getenv("TACHIBANASHI_TIMEOUT"); timeout != "" {
+		dur, err := time.ParseDuration(timeout)
+		if err != nil {
+			log.Fatalf("invalid TACHIBANASHI_TIMEOUT: %v", err)
+		}
+		cfg.Timeout = dur
+	}
+
+	if ua := os.Getenv("TACHIBANASHI_USER_AGENT"); ua != "" {
+		cfg.UserAgent = ua
+	}
+
+	if isTrue(os.Getenv("TACHIBANASHI_INSECURE_TLS")) {
+		cfg.HTTPClient = &http.Client{
+			Timeout: cfg.Timeout,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		}
+	}
+
+	cli, err := client.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mode := watchdog.CancelSession
+	if isTrue(os.Getenv("TACHIBANASHI_WATCHDOG_CANCEL_ALL")) {
+		mode = watchdog.CancelEverything
+	}
+	// The watchdog reuses the bot's session instead of logging in, so a trip
+	// does not invalidate the bot's own login.
+	supervisor := watchdog.NewSupervisor(cli.Request(),
+		watchdog.WithMode(mode),
+		watchdog.WithSecondPassword(secondPassword),
+		watchdog.WithFeedTimeout(feedTimeout),
+		watchdog.WithHeartbeatTimeout(heartbeatTimeout),
+	)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	fmt.Println("watchdog")
+	fmt.Printf("  state: %s\n", statePath)
+	fmt.Printf("  mode: %s\n", mode)
+
+	ctx := context.Background()
+	seen := false
+	for {
+		select {
+		case sig := <-sigs:
+			if supervisor.Pending() {
+				// A signal while cancels keep failing is the operator giving up.
+				supervisor.GiveUp()
+				fmt.Println("  exit: gave up")
+				report(supervisor)
+				return
+			}
+			if sig == os.Interrupt {
+				fmt.Println("  exit: interrupted")
+				return
+			}
+			if err := supervisor.Trip(ctx, watchdog.ReasonSignal); err != nil {
+				log.Printf("cancel failed: %v", err)
+			}
+		case <-ticker.C:
+		}
+
+		// Once tripped the last observed orders are kept until cancelled.
+		if tripped, _ := supervisor.Tripped(); !tripped {
+			state, err := watchdog.ReadState(statePath)
+			switch {
+			case errors.Is(err, fs.ErrNotExist) && seen:
+				// The bot removes its state file on a clean shutdown.
+				fmt.Println("  exit: state file removed")
+				return
+			case err != nil:
+				if seen {
+					log.Printf("read state: %v", err)
+				}
+				continue
+			}
+			seen = true
+			supervisor.Observe(state)
+			cli.SetVirtualURLs(state.VirtualURLs)
+			cli.TokenStore().Set(state.PNo + pNoMargin)
+		}
+
+		// Check also retries cancels that failed, so keep running until none
+		// are pending.
+		if err := supervisor.Check(ctx); err != nil {
+			log.Printf("cancel failed: %v", err)
+		}
+		if tripped, _ := supervisor.Tripped(); tripped && !supervisor.Pending() {
+			report(supervisor)
+			return
+		}
+	}
+}
+
+func report(supervisor *watchdog.Supervisor) {
+	_, reason := supervisor.Tripped()
+	fmt.Printf("  tripped: %s\n", reason)
+	for _, order := range supervisor.Orders() {
+		fmt.Printf("  still_open: %s %s\n", order.OrderNumber, order.EigyouDay)
+	}
+}
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+	dur, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", name, err)
+	}
+	return dur
+}
+
+func loadDotEnv(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		value = trimQuotes(value)
+		if key == "" {
+			continue
+		}
+		if _, exists := os.LookupEnv(key); !exists {
+			_ = os.Setenv(key, value)
+		}
+	}
+	return scanner.Err()
+}
+
+func trimQuotes(value string) string {
+	if len(value) >= 2 {
+		if (value[0] == '"' && value[len(value)-1] == '"') || (value[0] == '\'' && value[len(value)-1] == '\'') {
+			return value[1 : len(value)-1]
+		}
+	}
+	return value
+}
+
+func mustEnvAny(names ...string) string {
+	for _, name := range names {
+		value := strings.TrimSpace(os.Getenv(name))
+		if value != "" {
+			return value
+		}
+	}
+	log.Fatalf("missing %s", strings.Join(names, " or "))
+	return ""
+}
+
+func envOrAny(fallback string, names ...string) string {
+	for _, name := range names {
+		value := strings.TrimSpace(os.Getenv(name))
+		if value != "" {
+			return value
+		}
+	}
+	return fallback
+}
+
+func isTrue(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "yes", "y":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,98 @@
+package cost
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ueebee/tachibanashi/master"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+// FieldReverseFee is the CLMMfdsGetHibuInfo field for 逆日歩 in yen per share
+// per day.
+const FieldReverseFee = "pBWRQ"
+
+// CarryRates are annual rates for holding margin lots.
+type CarryRates struct {
+	// BuyInterest is 買方金利 on 買建 lots, e.g. 0.028.
+	BuyInterest float64
+	// LendingFee is 貸株料 on 売建 lots, e.g. 0.011.
+	LendingFee float64
+}
+
+// Carry is the estimated holding cost of one margin lot, in yen.
+type Carry struct {
+	Lot    string
+	Symbol string
+	Side   request.Side
+	// Days counts both the build date and the as-of date (両端入れ).
+	Days       int
+	Value      int64
+	Interest   int64
+	LendingFee int64
+	// ReverseFee is 逆日歩 for 売建 lots at the latest published rate.
+	ReverseFee int64
+}
+
+// Total returns interest plus lending and reverse fees.
+func (c Carry) Total() int64 {
+	return c.Interest + c.LendingFee + c.ReverseFee
+}
+
+// ReverseFees maps issue codes to 逆日歩 per share per day.
+func ReverseFees(resp *master.HibuInfoResponse) map[string]model.Price {
+	out := make(map[string]model.Price)
+	if resp == nil {
+		return out
+	}
+	for _, entry := range resp.Entries {
+		price, err := model.ParsePrice(entry.Fields.Value(FieldReverseFee))
+		if err != nil || price <= 0 {
+			continue
+		}
+		out[strings.TrimSpace(entry.IssueCode)] = price
+	}
+	return out
+}
+
+// Estimate returns the carry of each lot from its build date to asOf.
+// Interest and fees accrue on the 建代金 over 365 days. Settlement lag is
+// ignored, so treat the result as an estimate. reverse may be nil.
+func (r CarryRates) Estimate(lots []request.MarginLot, reverse map[string]model.Price, asOf time.Time) []Carry {
+	end := day(asOf)
+	out := make([]Carry, 0, len(lots))
+	for _, lot := range lots {
+		carry := Carry{
+			Lot:    lot.Number,
+			Symbol: lot.Symbol,
+			Side:   lot.Side,
+			Value:  lot.Price.Mul(lot.Quantity).Yen(),
+		}
+		if !lot.BuildDate.IsZero() {
+			if days := int(end.Sub(day(lot.BuildDate)).Hours()/24) + 1; days > 0 {
+				carry.Days = days
+			}
+		}
+		accrue := func(rate float64) int64 {
+			return int64(math.Floor(float64(carry.Value)*rate*float64(carry.Days)/365 + 1e-9))
+		}
+		if lot.Side == request.SideSell {
+			carry.LendingFee = accrue(r.LendingFee)
+			if fee, ok := reverse[lot.Symbol]; ok {
+				carry.ReverseFee = fee.Mul(lot.Quantity).Mul(model.Quantity(carry.Days)).Yen()
+			}
+		} else {
+			carry.Interest = accrue(r.BuyInterest)
+		}
+		out = append(out, carry)
+	}
+	return out
+}
+
+// day truncates t to its JST date.
+func day(t time.Time) time.Time {
+	t = t.In(model.JST)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, model.JST)
+}
@@ -0,0 +1,36 @@
+package cost
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ueebee/tachibanashi/master"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+func TestCarryEstimate(t *testing.T) {
+	var hibu master.HibuInfoResponse
+	if err := json.Unmarshal([]byte(`{"aCLMMfdsHibuInfo":[{"sIssueCode":"7203","pBWRQ":"0.05"}]}`), &hibu); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	built := time.Date(2024, 6, 3, 0, 0, 0, 0, model.JST)
+	lots := []request.MarginLot{
+		{Number: "L", Symbol: "6501", Side: request.SideBuy, BuildDate: built, Price: model.Yen(1000), Quantity: 1000},
+		{Number: "S", Symbol: "7203", Side: request.SideSell, BuildDate: built, Price: model.Yen(2000), Quantity: 500},
+	}
+	rates := CarryRates{BuyInterest: 0.028, LendingFee: 0.011}
+	carries := rates.Estimate(lots, ReverseFees(&hibu), time.Date(2024, 6, 12, 15, 0, 0, 0, model.JST))
+	if len(carries) != 2 {
+		t.Fatalf("carries = %+v", carries)
+	}
+	// 1,000,000 * 2.8% * 10 / 365 = 767.1
+	if long := carries[0]; long.Days != 10 || long.Value != 1000000 || long.Interest != 767 || long.LendingFee != 0 {
+		t.Fatalf("long = %+v", long)
+	}
+	// 1,000,000 * 1.1% * 10 / 365 = 301.3; 0.05 * 500 * 10 = 250
+	if short := carries[1]; short.Interest != 0 || short.LendingFee != 301 || short.ReverseFee != 250 || short.Total() != 551 {
+		t.Fatalf("short = %+v", short)
+	}
+}
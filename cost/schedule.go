@@ -0,0 +1,235 @@
+package cost
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+// PlanKind is how a commission plan charges.
+type PlanKind string
+
+const (
+	// PlanPerTrade charges each order by its 約定代金 for the day.
+	PlanPerTrade PlanKind = "per-trade"
+	// PlanDailyFlat charges once per day by the day's total 約定代金.
+	PlanDailyFlat PlanKind = "daily-flat"
+	// PlanZero charges nothing.
+	PlanZero PlanKind = "zero"
+)
+
+// Tier is one row of a fee table.
+type Tier struct {
+	// UpTo is the inclusive upper bound of 約定代金 in yen; 0 means no bound
+	// and must be the last tier.
+	UpTo int64
+	// Fee is the commission in yen before consumption tax.
+	Fee int64
+}
+
+// Plan is a commission fee table.
+type Plan struct {
+	Kind  PlanKind
+	Tiers []Tier
+}
+
+// Validate checks that tiers are ascending.
+func (p Plan) Validate() error {
+	switch p.Kind {
+	case PlanZero:
+		return nil
+	case PlanPerTrade, PlanDailyFlat:
+	default:
+		return &terrors.ValidationError{Field: "kind", Reason: "invalid value: " + string(p.Kind)}
+	}
+	if len(p.Tiers) == 0 {
+		return &terrors.ValidationError{Field: "tiers", Reason: "required"}
+	}
+	var previous int64
+	for i, tier := range p.Tiers {
+		if tier.Fee < 0 {
+			return &terrors.ValidationError{Field: "tiers", Reason: "negative fee at " + strconv.Itoa(i)}
+		}
+		if tier.UpTo == 0 {
+			if i != len(p.Tiers)-1 {
+				return &terrors.ValidationError{Field: "tiers", Reason: "unbounded tier must be last"}
+			}
+			continue
+		}
+		if tier.UpTo <= previous {
+			return &terrors.ValidationError{Field: "tiers", Reason: "not ascending at " + strconv.Itoa(i)}
+		}
+		previous = tier.UpTo
+	}
+	return nil
+}
+
+// Fee returns the commission before tax for value yen of 約定代金.
+func (p Plan) Fee(value int64) (int64, error) {
+	if p.Kind == PlanZero || value <= 0 {
+		return 0, nil
+	}
+	for _, tier := range p.Tiers {
+		if tier.UpTo == 0 || value <= tier.UpTo {
+			return tier.Fee, nil
+		}
+	}
+	return 0, &terrors.ValidationError{Field: "tiers", Reason: "no tier for " + strconv.FormatInt(value, 10) + " yen"}
+}
+
+// Cost is the commission charged for a fill, in yen.
+type Cost struct {
+	Commission int64
+	Tax        int64
+}
+
+// Total returns commission plus tax.
+func (c Cost) Total() int64 {
+	return c.Commission + c.Tax
+}
+
+// Summary totals a day's fills.
+type Summary struct {
+	Executions int
+	// Trades is the number of orders with fills.
+	Trades int
+	// Value is 約定代金 in yen.
+	Value      int64
+	Commission int64
+	Tax        int64
+}
+
+// Total returns commission plus tax.
+func (s Summary) Total() int64 {
+	return s.Commission + s.Tax
+}
+
+// Model prices fills. Schedule is the fee-table implementation.
+type Model interface {
+	// Cost prices one fill on its own.
+	Cost(exec model.Execution) (Cost, error)
+	// Daily prices one day's fills together, so per-order and daily plans
+	// are charged once.
+	Daily(execs []model.Execution) (Summary, error)
+}
+
+// Schedule charges cash and margin fills by separate plans.
+type Schedule struct {
+	Cash   Plan
+	Margin Plan
+	// TaxRate is consumption tax on commission, e.g. 0.10. Tax is rounded
+	// down to whole yen per charge.
+	TaxRate float64
+	// IsMargin reports whether a fill is a margin trade. Nil treats every
+	// fill as cash.
+	IsMargin func(model.Execution) bool
+}
+
+// Validate checks both plans.
+func (s Schedule) Validate() error {
+	if err := s.Cash.Validate(); err != nil {
+		return err
+	}
+	if err := s.Margin.Validate(); err != nil {
+		return err
+	}
+	if s.TaxRate < 0 || s.TaxRate >= 1 {
+		return &terrors.ValidationError{Field: "tax_rate", Reason: "must be in [0, 1)"}
+	}
+	return nil
+}
+
+func (s Schedule) Cost(exec model.Execution) (Cost, error) {
+	day := s.NewDay()
+	return day.Add(exec)
+}
+
+func (s Schedule) Daily(execs []model.Execution) (Summary, error) {
+	day := s.NewDay()
+	for _, exec := range execs {
+		if _, err := day.Add(exec); err != nil {
+			return Summary{}, err
+		}
+	}
+	return day.Summary(), nil
+}
+
+// NewDay starts an accumulator for one trading day.
+func (s Schedule) NewDay() *Day {
+	return &Day{
+		schedule: s,
+		orders:   make(map[string]int64),
+		totals:   make(map[bool]int64),
+	}
+}
+
+// Day accumulates one day's fills. Add returns the extra cost each fill
+// adds, so fills can be charged as they arrive.
+type Day struct {
+	schedule Schedule
+	orders   map[string]int64 // 約定代金 by order
+	totals   map[bool]int64   // 約定代金 by margin
+	summary  Summary
+	unnamed  int
+}
+
+// Add records a fill and returns the commission it adds.
+func (d *Day) Add(exec model.Execution) (Cost, error) {
+	value := exec.Price.Mul(exec.Quantity).Yen()
+	margin := d.schedule.IsMargin != nil && d.schedule.IsMargin(exec)
+	plan := d.schedule.Cash
+	if margin {
+		plan = d.schedule.Margin
+	}
+
+	id := strings.TrimSpace(exec.OrderID)
+	if id == "" {
+		d.unnamed++
+		id = "#" + strconv.Itoa(d.unnamed)
+	}
+	if margin {
+		id = "m:" + id
+	}
+	prior, seen := d.orders[id]
+	before := prior
+	if plan.Kind == PlanDailyFlat {
+		before = d.totals[margin]
+	}
+	after := before + value
+	feeBefore, err := plan.Fee(before)
+	if err != nil {
+		return Cost{}, err
+	}
+	feeAfter, err := plan.Fee(after)
+	if err != nil {
+		return Cost{}, err
+	}
+	if !seen {
+		d.summary.Trades++
+	}
+	d.orders[id] = prior + value
+	d.totals[margin] += value
+
+	cost := Cost{
+		Commission: feeAfter - feeBefore,
+		Tax:        d.tax(feeAfter) - d.tax(feeBefore),
+	}
+	d.summary.Executions++
+	d.summary.Value += value
+	d.summary.Commission += cost.Commission
+	d.summary.Tax += cost.Tax
+	return cost, nil
+}
+
+// Summary returns the day's totals so far.
+func (d *Day) Summary() Summary {
+	return d.summary
+}
+
+func (d *Day) tax(fee int64) int64 {
+	// The epsilon keeps exact products such as 70 * 0.10 from flooring low.
+	return int64(math.Floor(float64(fee)*d.schedule.TaxRate + 1e-9))
+}
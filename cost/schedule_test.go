@@ -0,0 +1,87 @@
+package cost
+
+import (
+	"testing"
+
+	"github.com/ueebee/tachibanashi/model"
+)
+
+var straight = Plan{Kind: PlanPerTrade, Tiers: []Tier{
+	{UpTo: 50000, Fee: 55},
+	{UpTo: 100000, Fee: 99},
+	{UpTo: 200000, Fee: 115},
+	{Fee: 275},
+}}
+
+var daily = Plan{Kind: PlanDailyFlat, Tiers: []Tier{
+	{UpTo: 1000000, Fee: 0},
+	{UpTo: 2000000, Fee: 2200},
+	{Fee: 3300},
+}}
+
+func fill(order string, price int64, qty model.Quantity) model.Execution {
+	return model.Execution{OrderID: order, Price: model.Yen(price), Quantity: qty}
+}
+
+func TestPerTradeChargesOrderOnce(t *testing.T) {
+	schedule := Schedule{Cash: straight, Margin: Plan{Kind: PlanZero}, TaxRate: 0.10}
+	if err := schedule.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	cost, err := schedule.Cost(fill("1", 400, 100))
+	if err != nil || cost.Commission != 55 || cost.Tax != 5 {
+		t.Fatalf("Cost() = %+v, %v", cost, err)
+	}
+
+	// Order 1 fills 40,000 then 40,000 more: one 80,000 yen trade.
+	day := schedule.NewDay()
+	first, _ := day.Add(fill("1", 400, 100))
+	second, _ := day.Add(fill("1", 400, 100))
+	if first.Total() != 60 || second.Commission != 44 || second.Tax != 4 {
+		t.Fatalf("fills = %+v %+v", first, second)
+	}
+	day.Add(fill("2", 1000, 300))
+	summary := day.Summary()
+	if summary.Trades != 2 || summary.Executions != 3 || summary.Value != 380000 || summary.Commission != 99+275 || summary.Tax != 9+27 {
+		t.Fatalf("summary = %+v", summary)
+	}
+}
+
+func TestDailyFlatAndMarginPlan(t *testing.T) {
+	schedule := Schedule{
+		Cash:     daily,
+		Margin:   Plan{Kind: PlanZero},
+		TaxRate:  0.10,
+		IsMargin: func(exec model.Execution) bool { return exec.OrderID == "m" },
+	}
+	summary, err := schedule.Daily([]model.Execution{
+		fill("1", 3000, 200),  // 600,000
+		fill("2", 3000, 200),  // 1,200,000 -> 2,200
+		fill("m", 5000, 1000), // margin, free
+		fill("3", 3000, 300),  // 2,100,000 -> 3,300
+	})
+	if err != nil {
+		t.Fatalf("Daily() error = %v", err)
+	}
+	if summary.Commission != 3300 || summary.Tax != 330 || summary.Trades != 4 {
+		t.Fatalf("summary = %+v", summary)
+	}
+}
+
+func TestPlanValidate(t *testing.T) {
+	bad := []Plan{
+		{Kind: "monthly"},
+		{Kind: PlanPerTrade},
+		{Kind: PlanPerTrade, Tiers: []Tier{{Fee: 10}, {UpTo: 100, Fee: 20}}},
+		{Kind: PlanPerTrade, Tiers: []Tier{{UpTo: 100, Fee: 10}, {UpTo: 50, Fee: 20}}},
+	}
+	for _, plan := range bad {
+		if err := plan.Validate(); err == nil {
+			t.Fatalf("Validate(%+v) expected error", plan)
+		}
+	}
+	bounded := Plan{Kind: PlanPerTrade, Tiers: []Tier{{UpTo: 100, Fee: 10}}}
+	if _, err := bounded.Fee(101); err == nil {
+		t.Fatalf("Fee() expected error past the last tier")
+	}
+}
@@ -40,7 +40,7 @@ func (e EC) Order() model.Order {
 		Raw:    cloneAttributes(e.Fields),
 	}
 	if price, ok := parsePrice(e.OrderPrice); ok {
-		order.Price = model.Price(price)
+		order.Price = price
 	}
 	if qty, ok := parseInt64Value(e.OrderQuantity); ok {
 		order.Quantity = model.Quantity(qty)
@@ -56,7 +56,7 @@ func (e EC) Execution() (model.Execution, bool) {
 		Raw:     cloneAttributes(e.Fields),
 	}
 	if price, ok := parsePrice(e.ExecutedPrice); ok {
-		exec.Price = model.Price(price)
+		exec.Price = price
 	}
 	if qty, ok := parseInt64Value(e.ExecutedQuantity); ok {
 		exec.Quantity = model.Quantity(qty)
@@ -112,26 +112,15 @@ func frameAttributes(fields map[string][]string) model.Attributes {
 	return out
 }
 
-func parsePrice(value string) (int64, bool) {
-	value = strings.TrimSpace(value)
-	if value == "" {
+func parsePrice(value string) (model.Price, bool) {
+	if strings.TrimSpace(value) == "" {
 		return 0, false
 	}
-	if strings.Contains(value, ".") {
-		parts := strings.SplitN(value, ".", 2)
-		if len(parts) != 2 {
-			return 0, false
-		}
-		if strings.TrimRight(parts[1], "0") != "" {
-			return 0, false
-		}
-		value = parts[0]
-	}
-	parsed, err := strconv.ParseInt(value, 10, 64)
+	price, err := model.ParsePrice(value)
 	if err != nil {
 		return 0, false
 	}
-	return parsed, true
+	return price, true
 }
 
 func parseInt64Value(value string) (int64, bool) {
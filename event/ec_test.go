@@ -3,6 +3,8 @@ package event
 import (
 	"fmt"
 	"testing"
+
+	"github.com/ueebee/tachibanashi/model"
 )
 
 func TestDecodeEventEC(t *testing.T) {
@@ -27,8 +29,8 @@ func TestDecodeEventEC(t *testing.T) {
 	}
 
 	order := ec.Order()
-	if order.Price != 850 {
-		t.Fatalf("order price = %d", order.Price)
+	if order.Price != model.Yen(850) {
+		t.Fatalf("order price = %s", order.Price)
 	}
 	if order.Quantity != 5300 {
 		t.Fatalf("order quantity = %d", order.Quantity)
@@ -41,8 +43,8 @@ func TestDecodeEventEC(t *testing.T) {
 	if !ok {
 		t.Fatalf("expected execution")
 	}
-	if exec.Price != 851 {
-		t.Fatalf("execution price = %d", exec.Price)
+	if exec.Price != model.Yen(851) {
+		t.Fatalf("execution price = %s", exec.Price)
 	}
 	if exec.Quantity != 10 {
 		t.Fatalf("execution quantity = %d", exec.Quantity)
@@ -0,0 +1,76 @@
+package event
+
+import (
+	"context"
+
+	"github.com/ueebee/tachibanashi/model"
+)
+
+// QuoteFeed adapts FD frames to model.QuoteSource through a QuoteBook.
+// Symbols maps board rows (p_gyou_no) to issue codes.
+type QuoteFeed struct {
+	service *Service
+	symbols map[int]string
+}
+
+var _ model.QuoteSource = (*QuoteFeed)(nil)
+
+func NewQuoteFeed(service *Service, symbols map[int]string) *QuoteFeed {
+	copied := make(map[int]string, len(symbols))
+	for row, symbol := range symbols {
+		copied[row] = symbol
+	}
+	return &QuoteFeed{service: service, symbols: copied}
+}
+
+// Quotes streams merged quotes for rows updated by each FD frame.
+// Other event kinds are ignored.
+func (f *QuoteFeed) Quotes(ctx context.Context) (<-chan []model.Quote, <-chan error) {
+	quotes := make(chan []model.Quote)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(quotes)
+		defer close(errs)
+
+		events, streamErrs := f.service.Stream(ctx)
+		book := NewQuoteBook()
+		for ev := range events {
+			fd, ok := ev.(FD)
+			if !ok {
+				continue
+			}
+			batch := f.apply(book, fd)
+			if len(batch) == 0 {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			case quotes <- batch:
+			}
+		}
+		if err, ok := <-streamErrs; ok && err != nil {
+			errs <- err
+		}
+	}()
+
+	return quotes, errs
+}
+
+func (f *QuoteFeed) apply(book *QuoteBook, fd FD) []model.Quote {
+	merged := book.Apply(fd)
+	index := 0
+	for _, row := range fd.Rows {
+		if row.Fields == nil {
+			continue
+		}
+		if index >= len(merged) {
+			break
+		}
+		merged[index].Symbol = f.symbols[row.Row]
+		index++
+	}
+	return merged
+}
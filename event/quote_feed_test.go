@@ -0,0 +1,67 @@
+package event
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/ueebee/tachibanashi/model"
+)
+
+type scriptedConn struct {
+	events []Event
+}
+
+func (c *scriptedConn) Recv(ctx context.Context) (Event, error) {
+	if len(c.events) == 0 {
+		return nil, io.EOF
+	}
+	ev := c.events[0]
+	c.events = c.events[1:]
+	return ev, nil
+}
+
+func (c *scriptedConn) Close() error {
+	return nil
+}
+
+type scriptedDialer struct {
+	conn Conn
+}
+
+func (d scriptedDialer) DialEvent(ctx context.Context) (Conn, error) {
+	return d.conn, nil
+}
+
+func TestQuoteFeedMergesAndLabelsRows(t *testing.T) {
+	conn := &scriptedConn{events: []Event{
+		FD{Rows: []FDRow{
+			{Row: 1, Fields: model.Attributes{"pDPP": "100", "pPRP": "90"}},
+			{Row: 2, Fields: model.Attributes{"pDPP": "200"}},
+		}},
+		Unknown{},
+		FD{Rows: []FDRow{
+			{Row: 2, Fields: model.Attributes{"pDPP": "201"}},
+		}},
+	}}
+	feed := NewQuoteFeed(NewService(scriptedDialer{conn: conn}), map[int]string{1: "6501", 2: "6502"})
+
+	quotes, errs := feed.Quotes(context.Background())
+	var batches [][]model.Quote
+	for batch := range quotes {
+		batches = append(batches, batch)
+	}
+	if err := <-errs; err != io.EOF {
+		t.Fatalf("terminal error mismatch: %v", err)
+	}
+	if len(batches) != 2 {
+		t.Fatalf("batch count mismatch: %d", len(batches))
+	}
+	if batches[0][0].Symbol != "6501" || batches[0][1].Symbol != "6502" {
+		t.Fatalf("symbols mismatch: %+v", batches[0])
+	}
+	second := batches[1]
+	if len(second) != 1 || second[0].Symbol != "6502" || second[0].Value("pDPP") != "201" {
+		t.Fatalf("second batch mismatch: %+v", second)
+	}
+}
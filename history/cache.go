@@ -0,0 +1,394 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/master"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+const (
+	defaultOverlap = 5
+	// TSE closes at 15:30 JST; bars for the current day are expected after it.
+	defaultCloseHour   = 15
+	defaultCloseMinute = 30
+	fileExt            = ".csv"
+)
+
+// Fetcher returns every stored daily bar for a symbol. *price.Service
+// satisfies it.
+type Fetcher interface {
+	DailyBars(ctx context.Context, issueCode, marketCode string) ([]model.DailyBar, error)
+}
+
+// Cache keeps daily bars per symbol in CSV files under a directory.
+//
+// CLMMfdsGetMarketPriceHistory always returns the full history, so Update
+// skips the request entirely while the cache already covers the expected
+// business days, and otherwise only appends days after the last cached one.
+type Cache struct {
+	dir        string
+	fetcher    Fetcher
+	marketCode string
+	overlap    int
+	closeAt    time.Duration
+	now        func() time.Time
+
+	mu       sync.Mutex
+	dateInfo *master.DateInfo
+	bars     map[string][]model.DailyBar
+}
+
+type Option func(*Cache)
+
+// WithMarketCode sets sSizyouC for history requests (default: exchange default).
+func WithMarketCode(code string) Option {
+	return func(c *Cache) {
+		c.marketCode = strings.TrimSpace(code)
+	}
+}
+
+// WithOverlap sets how many trailing cached days are compared for restatements.
+func WithOverlap(days int) Option {
+	return func(c *Cache) {
+		if days > 0 {
+			c.overlap = days
+		}
+	}
+}
+
+// WithCloseTime sets the JST time of day after which the current business
+// day's bar is expected.
+func WithCloseTime(hour, minute int) Option {
+	return func(c *Cache) {
+		c.closeAt = time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute
+	}
+}
+
+// WithDateInfo seeds the business day calendar (CLMDateZyouhou, sDayKey 001).
+func WithDateInfo(info master.DateInfo) Option {
+	return func(c *Cache) {
+		c.dateInfo = &info
+	}
+}
+
+func withClock(now func() time.Time) Option {
+	return func(c *Cache) {
+		c.now = now
+	}
+}
+
+func NewCache(dir string, fetcher Fetcher, opts ...Option) *Cache {
+	c := &Cache{
+		dir:     dir,
+		fetcher: fetcher,
+		overlap: defaultOverlap,
+		closeAt: defaultCloseHour*time.Hour + defaultCloseMinute*time.Minute,
+		now:     time.Now,
+		bars:    make(map[string][]model.DailyBar),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(c)
+		}
+	}
+	return c
+}
+
+// SetDateInfo replaces the business day calendar, e.g. after a master update.
+func (c *Cache) SetDateInfo(info master.DateInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dateInfo = &info
+}
+
+// UpdateResult describes what Update did for a symbol.
+type UpdateResult struct {
+	Symbol   string
+	Fetched  bool
+	Appended int
+	Restated bool
+	Last     time.Time
+}
+
+// Update brings the cached bars for symbol up to date.
+// When the overlapping days differ from the fetched data the whole series is
+// replaced and Restated is set.
+func (c *Cache) Update(ctx context.Context, symbol string) (UpdateResult, error) {
+	symbol = strings.TrimSpace(symbol)
+	if err := validateSymbol(symbol); err != nil {
+		return UpdateResult{}, err
+	}
+	if c.fetcher == nil {
+		return UpdateResult{}, errors.New("tachibanashi: history fetcher not set")
+	}
+
+	c.mu.Lock()
+	cached, err := c.loadLocked(symbol)
+	covered := err == nil && c.coveredLocked(cached)
+	c.mu.Unlock()
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	result := UpdateResult{Symbol: symbol}
+	if len(cached) > 0 {
+		result.Last = cached[len(cached)-1].Date
+	}
+	if covered {
+		return result, nil
+	}
+
+	// The full history is fetched without the lock so other symbols are
+	// not held up; the merge below re-reads what another Update may have
+	// written meanwhile.
+	fetched, err := c.fetcher.DailyBars(ctx, symbol, c.marketCode)
+	if err != nil {
+		return result, err
+	}
+	fetched = normalizeBars(fetched)
+	result.Fetched = true
+	if len(fetched) == 0 {
+		return result, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, err = c.loadLocked(symbol); err != nil {
+		return result, err
+	}
+
+	next := cached
+	if len(cached) == 0 || restated(cached, fetched, c.overlap) {
+		result.Restated = len(cached) > 0
+		result.Appended = len(fetched) - len(cached)
+		if result.Appended < 0 {
+			result.Appended = 0
+		}
+		next = fetched
+	} else {
+		last := cached[len(cached)-1].Date
+		next = append([]model.DailyBar(nil), cached...)
+		for _, bar := range fetched {
+			if bar.Date.After(last) {
+				next = append(next, bar)
+				result.Appended++
+			}
+		}
+	}
+
+	if result.Appended > 0 || result.Restated || len(cached) == 0 {
+		if err := writeFile(c.path(symbol), next); err != nil {
+			return result, err
+		}
+	}
+	c.bars[symbol] = next
+	result.Last = next[len(next)-1].Date
+	return result, nil
+}
+
+// UpdateAll runs Update for each symbol in order. Per-symbol failures are
+// joined into the returned error; results are returned for every symbol.
+func (c *Cache) UpdateAll(ctx context.Context, symbols []string) ([]UpdateResult, error) {
+	results := make([]UpdateResult, 0, len(symbols))
+	var errs []error
+	for _, symbol := range symbols {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		result, err := c.Update(ctx, symbol)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tachibanashi: history %s: %w", symbol, err))
+		}
+		results = append(results, result)
+	}
+	return results, errors.Join(errs...)
+}
+
+// Bars returns cached bars with from <= date <= to. Zero bounds are open.
+func (c *Cache) Bars(symbol string, from, to time.Time) ([]model.DailyBar, error) {
+	symbol = strings.TrimSpace(symbol)
+	if err := validateSymbol(symbol); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	cached, err := c.loadLocked(symbol)
+	c.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	start := 0
+	if !from.IsZero() {
+		start = sort.Search(len(cached), func(i int) bool {
+			return !cached[i].Date.Before(from)
+		})
+	}
+	end := len(cached)
+	if !to.IsZero() {
+		end = sort.Search(len(cached), func(i int) bool {
+			return cached[i].Date.After(to)
+		})
+	}
+	if start >= end {
+		return nil, nil
+	}
+	out := make([]model.DailyBar, end-start)
+	copy(out, cached[start:end])
+	return out, nil
+}
+
+// ExpectedLast returns the latest business day whose bar should be available,
+// or false when no DateInfo has been provided.
+func (c *Cache) ExpectedLast() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.expectedLastLocked()
+}
+
+func (c *Cache) expectedLastLocked() (time.Time, bool) {
+	if c.dateInfo == nil {
+		return time.Time{}, false
+	}
+	theDay, err := model.ParseDate(c.dateInfo.TheDay())
+	if err != nil {
+		return time.Time{}, false
+	}
+	now := c.now().In(model.JST)
+	if !now.Before(theDay.Add(c.closeAt)) {
+		return theDay, true
+	}
+	prev, err := model.ParseDate(c.dateInfo.Fields.Value(master.DateInfoFieldMaeEigyouDay1))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return prev, true
+}
+
+// coveredLocked reports whether cached already holds every expected recent
+// business day. Without DateInfo the cache is never considered current.
+func (c *Cache) coveredLocked(cached []model.DailyBar) bool {
+	if len(cached) == 0 {
+		return false
+	}
+	latest, ok := c.expectedLastLocked()
+	if !ok {
+		return false
+	}
+	last := cached[len(cached)-1].Date
+	if last.Before(latest) {
+		return false
+	}
+
+	first := cached[0].Date
+	have := make(map[string]struct{}, c.overlap)
+	for i := len(cached) - 1; i >= 0 && len(have) < c.overlap+3; i-- {
+		have[model.FormatDate(cached[i].Date)] = struct{}{}
+	}
+	for _, key := range []string{
+		master.DateInfoFieldMaeEigyouDay1,
+		master.DateInfoFieldMaeEigyouDay2,
+		master.DateInfoFieldMaeEigyouDay3,
+	} {
+		day, err := model.ParseDate(c.dateInfo.Fields.Value(key))
+		if err != nil || day.Before(first) || day.After(latest) {
+			continue
+		}
+		if _, ok := have[model.FormatDate(day)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Cache) loadLocked(symbol string) ([]model.DailyBar, error) {
+	if bars, ok := c.bars[symbol]; ok {
+		return bars, nil
+	}
+	bars, err := readFile(c.path(symbol), symbol)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	c.bars[symbol] = bars
+	return bars, nil
+}
+
+func (c *Cache) path(symbol string) string {
+	return filepath.Join(c.dir, symbol+fileExt)
+}
+
+func restated(cached, fetched []model.DailyBar, overlap int) bool {
+	byDate := make(map[string]model.DailyBar, len(fetched))
+	for _, bar := range fetched {
+		byDate[model.FormatDate(bar.Date)] = bar
+	}
+	checked := 0
+	var since time.Time
+	for i := len(cached) - 1; i >= 0 && checked < overlap; i-- {
+		bar, ok := byDate[model.FormatDate(cached[i].Date)]
+		if !ok {
+			return true
+		}
+		if !sameBar(cached[i], bar) {
+			return true
+		}
+		since = cached[i].Date
+		checked++
+	}
+
+	// Days the cache skipped inside the overlap window also count.
+	last := cached[len(cached)-1].Date
+	inWindow := 0
+	for _, bar := range fetched {
+		if !bar.Date.Before(since) && !bar.Date.After(last) {
+			inWindow++
+		}
+	}
+	return inWindow != checked
+}
+
+func sameBar(a, b model.DailyBar) bool {
+	return a.Open == b.Open &&
+		a.High == b.High &&
+		a.Low == b.Low &&
+		a.Close == b.Close &&
+		a.Volume == b.Volume &&
+		a.SplitRatio == b.SplitRatio
+}
+
+func normalizeBars(bars []model.DailyBar) []model.DailyBar {
+	out := make([]model.DailyBar, 0, len(bars))
+	for _, bar := range bars {
+		if bar.Date.IsZero() {
+			continue
+		}
+		out = append(out, bar)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Date.Before(out[j].Date)
+	})
+	return out
+}
+
+func validateSymbol(symbol string) error {
+	if symbol == "" {
+		return &terrors.ValidationError{Field: "symbol", Reason: "required"}
+	}
+	if strings.ContainsAny(symbol, `/\.`) {
+		return &terrors.ValidationError{Field: "symbol", Reason: "invalid symbol: " + symbol}
+	}
+	return nil
+}
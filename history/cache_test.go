@@ -0,0 +1,189 @@
+package history
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ueebee/tachibanashi/master"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+type fakeFetcher struct {
+	bars    []model.DailyBar
+	calls   int
+	onFetch func()
+}
+
+func (f *fakeFetcher) DailyBars(ctx context.Context, issueCode, marketCode string) ([]model.DailyBar, error) {
+	f.calls++
+	if f.onFetch != nil {
+		f.onFetch()
+	}
+	out := make([]model.DailyBar, len(f.bars))
+	copy(out, f.bars)
+	for i := range out {
+		out[i].Symbol = issueCode
+	}
+	return out, nil
+}
+
+func day(d int) time.Time {
+	return time.Date(2024, 1, d, 0, 0, 0, 0, model.JST)
+}
+
+func bar(d int, close int64) model.DailyBar {
+	return model.DailyBar{
+		Date:   day(d),
+		Open:   model.Yen(close),
+		High:   model.Yen(close + 10),
+		Low:    model.Yen(close - 10),
+		Close:  model.Yen(close),
+		Volume: 1000,
+	}
+}
+
+func dateInfo(theDay string, mae ...string) master.DateInfo {
+	fields := model.Attributes{master.DateInfoFieldTheDay: theDay}
+	keys := []string{
+		master.DateInfoFieldMaeEigyouDay1,
+		master.DateInfoFieldMaeEigyouDay2,
+		master.DateInfoFieldMaeEigyouDay3,
+	}
+	for i, value := range mae {
+		fields[keys[i]] = value
+	}
+	return master.DateInfo{Fields: fields}
+}
+
+func TestCacheUpdateAppendsAndSkipsWhenCurrent(t *testing.T) {
+	dir := t.TempDir()
+	fetcher := &fakeFetcher{bars: []model.DailyBar{bar(4, 100), bar(5, 110)}}
+	now := time.Date(2024, 1, 9, 10, 0, 0, 0, model.JST)
+	cache := NewCache(dir, fetcher,
+		WithDateInfo(dateInfo("20240109", "20240105", "20240104")),
+		withClock(func() time.Time { return now }),
+	)
+
+	result, err := cache.Update(context.Background(), "6501")
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if !result.Fetched || result.Appended != 2 || result.Restated {
+		t.Fatalf("unexpected first result: %+v", result)
+	}
+
+	result, err = cache.Update(context.Background(), "6501")
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if result.Fetched || fetcher.calls != 1 {
+		t.Fatalf("expected cached data to be current: %+v calls=%d", result, fetcher.calls)
+	}
+
+	// After the close the current day is expected.
+	now = time.Date(2024, 1, 9, 16, 0, 0, 0, model.JST)
+	fetcher.bars = append(fetcher.bars, bar(9, 120))
+	result, err = cache.Update(context.Background(), "6501")
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if !result.Fetched || result.Appended != 1 || result.Restated {
+		t.Fatalf("unexpected incremental result: %+v", result)
+	}
+	if !result.Last.Equal(day(9)) {
+		t.Fatalf("last date mismatch: %s", result.Last)
+	}
+
+	reloaded := NewCache(dir, fetcher)
+	bars, err := reloaded.Bars("6501", day(5), time.Time{})
+	if err != nil {
+		t.Fatalf("Bars() error = %v", err)
+	}
+	if len(bars) != 2 {
+		t.Fatalf("bars length mismatch: %d", len(bars))
+	}
+	if bars[0].Close != model.Yen(110) || bars[1].Close != model.Yen(120) {
+		t.Fatalf("bars mismatch: %+v", bars)
+	}
+	if bars[0].Symbol != "6501" {
+		t.Fatalf("symbol mismatch: %s", bars[0].Symbol)
+	}
+}
+
+func TestCacheUpdateDetectsRestatement(t *testing.T) {
+	dir := t.TempDir()
+	fetcher := &fakeFetcher{bars: []model.DailyBar{bar(4, 100), bar(5, 110)}}
+	cache := NewCache(dir, fetcher)
+
+	if _, err := cache.Update(context.Background(), "6501"); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	fetcher.bars = []model.DailyBar{bar(4, 100), bar(5, 111), bar(9, 120)}
+	result, err := cache.Update(context.Background(), "6501")
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if !result.Restated {
+		t.Fatalf("expected restatement: %+v", result)
+	}
+
+	bars, err := cache.Bars("6501", time.Time{}, day(5))
+	if err != nil {
+		t.Fatalf("Bars() error = %v", err)
+	}
+	if len(bars) != 2 || bars[1].Close != model.Yen(111) {
+		t.Fatalf("restated bars mismatch: %+v", bars)
+	}
+}
+
+func TestCacheUpdateRefetchesMissingBusinessDay(t *testing.T) {
+	dir := t.TempDir()
+	fetcher := &fakeFetcher{bars: []model.DailyBar{bar(4, 100), bar(9, 120)}}
+	now := time.Date(2024, 1, 10, 10, 0, 0, 0, model.JST)
+	cache := NewCache(dir, fetcher,
+		WithDateInfo(dateInfo("20240110", "20240109", "20240105", "20240104")),
+		withClock(func() time.Time { return now }),
+	)
+
+	if _, err := cache.Update(context.Background(), "6501"); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	fetcher.bars = []model.DailyBar{bar(4, 100), bar(5, 110), bar(9, 120)}
+	result, err := cache.Update(context.Background(), "6501")
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if !result.Fetched {
+		t.Fatalf("expected refetch for missing business day")
+	}
+	bars, _ := cache.Bars("6501", time.Time{}, time.Time{})
+	if len(bars) != 3 {
+		t.Fatalf("bars length mismatch: %d", len(bars))
+	}
+}
+
+func TestCacheReadsWhileFetching(t *testing.T) {
+	fetcher := &fakeFetcher{bars: []model.DailyBar{bar(4, 100), bar(5, 110)}}
+	cache := NewCache(t.TempDir(), fetcher)
+	fetcher.onFetch = func() {
+		// The fetch runs without the cache lock held.
+		if _, err := cache.Bars("7203", time.Time{}, time.Time{}); err != nil {
+			t.Errorf("Bars() error = %v", err)
+		}
+	}
+	if result, err := cache.Update(context.Background(), "6501"); err != nil || result.Appended != 2 {
+		t.Fatalf("Update() = %+v, %v", result, err)
+	}
+}
+
+func TestCacheRejectsInvalidSymbol(t *testing.T) {
+	cache := NewCache(t.TempDir(), &fakeFetcher{})
+	if _, err := cache.Update(context.Background(), "../etc"); err == nil {
+		t.Fatalf("expected error for invalid symbol")
+	}
+	if _, err := cache.Bars("", time.Time{}, time.Time{}); err == nil {
+		t.Fatalf("expected error for empty symbol")
+	}
+}
@@ -0,0 +1,129 @@
+package history
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ueebee/tachibanashi/model"
+)
+
+var csvHeader = []string{"date", "open", "high", "low", "close", "volume", "split_ratio", "discontinuity"}
+
+// readFile loads bars from a CSV file. Raw attributes are not persisted.
+func readFile(path, symbol string) ([]model.DailyBar, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = len(csvHeader)
+	if _, err := reader.Read(); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("tachibanashi: history %s: %w", path, err)
+	}
+
+	var bars []model.DailyBar
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tachibanashi: history %s: %w", path, err)
+		}
+		bar, err := decodeRow(row)
+		if err != nil {
+			return nil, fmt.Errorf("tachibanashi: history %s: %w", path, err)
+		}
+		bar.Symbol = symbol
+		bars = append(bars, bar)
+	}
+	return bars, nil
+}
+
+// writeFile replaces the CSV file atomically.
+func writeFile(path string, bars []model.DailyBar) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := csv.NewWriter(tmp)
+	if err := writer.Write(csvHeader); err != nil {
+		tmp.Close()
+		return err
+	}
+	for _, bar := range bars {
+		if err := writer.Write(encodeRow(bar)); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func encodeRow(bar model.DailyBar) []string {
+	return []string{
+		model.FormatDate(bar.Date),
+		bar.Open.String(),
+		bar.High.String(),
+		bar.Low.String(),
+		bar.Close.String(),
+		strconv.FormatInt(int64(bar.Volume), 10),
+		strconv.FormatFloat(bar.SplitRatio, 'f', -1, 64),
+		bar.Discontinuity,
+	}
+}
+
+func decodeRow(row []string) (model.DailyBar, error) {
+	date, err := model.ParseDate(row[0])
+	if err != nil {
+		return model.DailyBar{}, err
+	}
+	prices := make([]model.Price, 4)
+	for i := range prices {
+		parsed, err := model.ParsePrice(row[i+1])
+		if err != nil {
+			return model.DailyBar{}, fmt.Errorf("invalid %s %q", csvHeader[i+1], row[i+1])
+		}
+		prices[i] = parsed
+	}
+	volume, err := strconv.ParseInt(row[5], 10, 64)
+	if err != nil {
+		return model.DailyBar{}, fmt.Errorf("invalid %s %q", csvHeader[5], row[5])
+	}
+	ratio, err := strconv.ParseFloat(row[6], 64)
+	if err != nil {
+		return model.DailyBar{}, fmt.Errorf("invalid split_ratio %q", row[6])
+	}
+	return model.DailyBar{
+		Date:          date,
+		Open:          prices[0],
+		High:          prices[1],
+		Low:           prices[2],
+		Close:         prices[3],
+		Volume:        model.Quantity(volume),
+		SplitRatio:    ratio,
+		Discontinuity: row[7],
+	}, nil
+}
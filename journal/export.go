@@ -0,0 +1,64 @@
+package journal
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+var csvHeader = []string{
+	"trade_date", "executed_at", "settlement_date", "order_number", "symbol", "issue_name", "market",
+	"side", "cash_margin", "account", "price", "quantity", "value", "commission", "tax", "realized_pnl",
+}
+
+// WriteCSV writes rows with a header line. Unknown realized P&L is empty.
+func WriteCSV(w io.Writer, rows []Row) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.Write(encodeRow(row)); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteJSONL writes one JSON object per line.
+func WriteJSONL(w io.Writer, rows []Row) error {
+	encoder := json.NewEncoder(w)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeRow(row Row) []string {
+	realized := ""
+	if row.RealizedPnL != nil {
+		realized = strconv.FormatInt(*row.RealizedPnL, 10)
+	}
+	return []string{
+		row.TradeDate,
+		row.ExecutedAt,
+		row.SettlementDate,
+		row.OrderNumber,
+		row.Symbol,
+		row.IssueName,
+		row.Market,
+		row.Side,
+		row.CashOrMargin,
+		row.Account,
+		row.Price.String(),
+		strconv.FormatInt(int64(row.Quantity), 10),
+		strconv.FormatInt(row.Value, 10),
+		strconv.FormatInt(row.Commission, 10),
+		strconv.FormatInt(row.Tax, 10),
+		realized,
+	}
+}
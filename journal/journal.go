@@ -0,0 +1,385 @@
+package journal
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ueebee/tachibanashi/calendar"
+	"github.com/ueebee/tachibanashi/cost"
+	"github.com/ueebee/tachibanashi/master"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/portfolio"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+// Row is one fill in the journal. Money fields are whole yen except Price.
+type Row struct {
+	TradeDate      string         `json:"trade_date"`
+	ExecutedAt     string         `json:"executed_at"`
+	SettlementDate string         `json:"settlement_date"`
+	OrderNumber    string         `json:"order_number"`
+	Symbol         string         `json:"symbol"`
+	IssueName      string         `json:"issue_name"`
+	Market         string         `json:"market"`
+	Side           string         `json:"side"`
+	CashOrMargin   string         `json:"cash_margin"` // sGenkinShinyouKubun
+	Account        string         `json:"account"`     // sOrderZyoutoekiKazeiC
+	Price          model.Price    `json:"price"`
+	Quantity       model.Quantity `json:"quantity"`
+	Value          int64          `json:"value"`
+	Commission     int64          `json:"commission"`
+	Tax            int64          `json:"tax"`
+	// RealizedPnL is set on closing fills whose cost basis is known. It is
+	// before fees.
+	RealizedPnL *int64 `json:"realized_pnl,omitempty"`
+}
+
+// Source provides orders, fills and positions. *request.Service satisfies it.
+type Source interface {
+	OrderList(ctx context.Context, params request.OrderParams) (*request.OrderListResponse, error)
+	OrderListDetail(ctx context.Context, orderNumber, eigyouDay string) (*request.OrderListDetailResponse, error)
+	CashPositions(ctx context.Context, issueCode string) (*request.CashPositionsSnapshot, error)
+	MarginPositions(ctx context.Context, issueCode string) (*request.MarginPositionsSnapshot, error)
+}
+
+// Exporter builds a day's journal.
+type Exporter struct {
+	source     Source
+	store      master.MasterStore
+	calendar   *calendar.Calendar
+	schedule   cost.Schedule
+	executions map[string][]model.Execution
+}
+
+type Option func(*Exporter)
+
+// WithSchedule sets the fee schedule. Without it fees are zero. A nil
+// IsMargin classifies fills by their order's sGenkinShinyouKubun.
+func WithSchedule(schedule cost.Schedule) Option {
+	return func(e *Exporter) {
+		e.schedule = schedule
+	}
+}
+
+// WithExecutions supplies fills recorded from EC notices. Orders found here
+// are not fetched with OrderListDetail.
+func WithExecutions(execs []model.Execution) Option {
+	return func(e *Exporter) {
+		for _, exec := range execs {
+			id := strings.TrimSpace(exec.OrderID)
+			if id != "" && exec.Quantity > 0 {
+				e.executions[id] = append(e.executions[id], exec)
+			}
+		}
+	}
+}
+
+// NewExporter uses store for issue names (IssueMstKabu) and cal for
+// settlement dates (sKabuUkewatasiDay); either may be nil.
+func NewExporter(source Source, store master.MasterStore, cal *calendar.Calendar, opts ...Option) *Exporter {
+	e := &Exporter{
+		source:     source,
+		store:      store,
+		calendar:   cal,
+		schedule:   cost.Schedule{Cash: cost.Plan{Kind: cost.PlanZero}, Margin: cost.Plan{Kind: cost.PlanZero}},
+		executions: make(map[string][]model.Execution),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(e)
+		}
+	}
+	return e
+}
+
+type fill struct {
+	exec    model.Execution
+	order   request.OrderEntry
+	kind    request.CashOrMargin
+	side    request.Side
+	account string
+}
+
+// Build returns one row per fill executed on day, in execution order.
+func (e *Exporter) Build(ctx context.Context, day time.Time) ([]Row, error) {
+	if err := e.schedule.Validate(); err != nil {
+		return nil, err
+	}
+	tradeDay := model.FormatDate(day)
+	list, err := e.source.OrderList(ctx, request.OrderParams{"sSikkouDay": tradeDay})
+	if err != nil {
+		return nil, err
+	}
+
+	var fills []fill
+	for _, entry := range list.Entries {
+		filled, _ := strconv.ParseInt(strings.TrimSpace(entry.Fields.Value("sOrderYakuzyouSuryo")), 10, 64)
+		if filled <= 0 {
+			continue
+		}
+		base := fill{
+			order:   entry,
+			kind:    request.ListedCashOrMargin(entry.Fields),
+			side:    request.Side(strings.TrimSpace(entry.Fields.Value("sOrderBaibaiKubun"))),
+			account: strings.TrimSpace(entry.Fields.Value("sOrderZyoutoekiKazeiC")),
+		}
+		execs, err := e.orderExecutions(ctx, entry, &base)
+		if err != nil {
+			return nil, err
+		}
+		for _, exec := range execs {
+			f := base
+			f.exec = exec
+			fills = append(fills, f)
+		}
+	}
+	sort.SliceStable(fills, func(i, j int) bool {
+		if fills[i].exec.Time != fills[j].exec.Time {
+			return fills[i].exec.Time < fills[j].exec.Time
+		}
+		return fills[i].exec.OrderID < fills[j].exec.OrderID
+	})
+
+	basis, err := e.openingBasis(ctx, fills)
+	if err != nil {
+		return nil, err
+	}
+	schedule := e.schedule
+	if schedule.IsMargin == nil {
+		schedule.IsMargin = func(exec model.Execution) bool {
+			return request.CashOrMargin(exec.Raw.Value("sGenkinShinyouKubun")).IsMargin()
+		}
+	}
+	fees := schedule.NewDay()
+
+	rows := make([]Row, 0, len(fills))
+	for _, f := range fills {
+		exec := f.exec
+		exec.Raw = model.Attributes{"sGenkinShinyouKubun": string(f.kind)}
+		charge, err := fees.Add(exec)
+		if err != nil {
+			return nil, err
+		}
+		date := tradeDay
+		if len(exec.Time) >= 8 {
+			date = exec.Time[:8]
+		}
+		row := Row{
+			TradeDate:    date,
+			ExecutedAt:   exec.Time,
+			OrderNumber:  exec.OrderID,
+			Symbol:       exec.Symbol,
+			IssueName:    e.issueName(exec.Symbol),
+			Market:       strings.TrimSpace(f.order.Fields.Value("sOrderSizyouC")),
+			Side:         sideName(f.side),
+			CashOrMargin: string(f.kind),
+			Account:      f.account,
+			Price:        exec.Price,
+			Quantity:     exec.Quantity,
+			Value:        exec.Price.Mul(exec.Quantity).Yen(),
+			Commission:   charge.Commission,
+			Tax:          charge.Tax,
+			RealizedPnL:  basis.apply(f),
+		}
+		if e.calendar != nil {
+			if traded, err := model.ParseDate(date); err == nil {
+				row.SettlementDate = model.FormatDate(e.calendar.SettlementDate(traded))
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// orderExecutions returns an order's fills from the EC log, else from
+// OrderListDetail, else one aggregate fill from the list entry.
+func (e *Exporter) orderExecutions(ctx context.Context, entry request.OrderEntry, base *fill) ([]model.Execution, error) {
+	logged, ok := e.executions[entry.OrderID]
+	if ok && base.account != "" && base.kind != "" {
+		return withSymbol(logged, entry.Symbol), nil
+	}
+	detail, err := e.source.OrderListDetail(ctx, entry.OrderID, strings.TrimSpace(entry.Fields.Value("sOrderSikkouDay")))
+	if err != nil {
+		return nil, err
+	}
+	if base.kind == "" {
+		base.kind = request.ListedCashOrMargin(detail.Fields)
+	}
+	if base.account == "" {
+		// The detail splits the account by the order's cash/margin type.
+		key := "sGenbutuZyoutoekiKazeiC"
+		if base.kind != "" && base.kind.IsMargin() {
+			key = "sSinyouZyoutoekiKazeiC"
+		}
+		base.account = strings.TrimSpace(detail.Fields.Value(key))
+	}
+	if ok {
+		return withSymbol(logged, entry.Symbol), nil
+	}
+	var out []model.Execution
+	for _, item := range detail.Executions {
+		if exec := item.Execution(entry.OrderID, entry.Symbol); exec.Quantity > 0 {
+			out = append(out, exec)
+		}
+	}
+	if len(out) > 0 {
+		return out, nil
+	}
+	exec := model.Execution{OrderID: entry.OrderID, Symbol: entry.Symbol, Time: entry.Fields.Value("sOrderOrderDateTime")}
+	exec.Price, _ = model.ParsePrice(entry.Fields.Value("sOrderYakuzyouPrice"))
+	qty, _ := strconv.ParseInt(strings.TrimSpace(entry.Fields.Value("sOrderYakuzyouSuryo")), 10, 64)
+	exec.Quantity = model.Quantity(qty)
+	return []model.Execution{exec}, nil
+}
+
+func withSymbol(execs []model.Execution, symbol string) []model.Execution {
+	out := make([]model.Execution, len(execs))
+	for i, exec := range execs {
+		if exec.Symbol == "" {
+			exec.Symbol = symbol
+		}
+		out[i] = exec
+	}
+	return out
+}
+
+func (e *Exporter) issueName(symbol string) string {
+	if e.store == nil {
+		return ""
+	}
+	record, ok := e.store.Get(master.MasterIssueMstKabu, symbol)
+	if !ok {
+		return ""
+	}
+	return record.Fields.Value(master.IssueKabuFieldName)
+}
+
+func sideName(side request.Side) string {
+	switch side {
+	case request.SideBuy:
+		return "buy"
+	case request.SideSell:
+		return "sell"
+	}
+	return string(side)
+}
+
+type bookKey struct {
+	symbol string
+	book   portfolio.Book
+}
+
+type lot struct {
+	quantity model.Quantity
+	cost     model.Price // total
+	known    bool
+}
+
+type basisBook map[bookKey]*lot
+
+// openingBasis rebuilds start-of-day holdings: the broker's current
+// quantities less the day's net fills, at the broker's current average
+// cost. A position closed out entirely today has no known basis.
+func (e *Exporter) openingBasis(ctx context.Context, fills []fill) (basisBook, error) {
+	cash, err := e.source.CashPositions(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	margin, err := e.source.MarginPositions(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	book := make(basisBook)
+	current := func(k bookKey) *lot {
+		l, ok := book[k]
+		if !ok {
+			l = &lot{known: true}
+			book[k] = l
+		}
+		return l
+	}
+	for _, pos := range cash.Positions {
+		l := current(bookKey{symbol: strings.TrimSpace(pos.Symbol), book: portfolio.BookCash})
+		l.quantity += pos.Quantity
+		l.cost += pos.AvgPrice.Mul(pos.Quantity)
+	}
+	for _, pos := range margin.Positions {
+		b := portfolio.BookMarginLong
+		if request.Side(strings.TrimSpace(pos.Raw.Value("sOrderBaibaiKubun"))) == request.SideSell {
+			b = portfolio.BookMarginShort
+		}
+		l := current(bookKey{symbol: strings.TrimSpace(pos.Symbol), book: b})
+		l.quantity += pos.Quantity
+		l.cost += pos.AvgPrice.Mul(pos.Quantity)
+	}
+
+	net := make(map[bookKey]model.Quantity)
+	for _, f := range fills {
+		b, opening, ok := portfolio.Classify(f.kind, f.side)
+		if !ok {
+			continue
+		}
+		k := bookKey{symbol: strings.TrimSpace(f.exec.Symbol), book: b}
+		if opening {
+			net[k] += f.exec.Quantity
+		} else {
+			net[k] -= f.exec.Quantity
+		}
+	}
+	for k, change := range net {
+		l := current(k)
+		start := max(l.quantity-change, 0)
+		if l.quantity > 0 {
+			l.cost = l.cost.Div(int64(l.quantity)).Mul(start)
+		} else {
+			l.known = start == 0
+			l.cost = 0
+		}
+		l.quantity = start
+	}
+	return book, nil
+}
+
+// apply replays f against the basis and returns realized P&L for closing
+// fills with a known basis.
+func (b basisBook) apply(f fill) *int64 {
+	book, opening, ok := portfolio.Classify(f.kind, f.side)
+	if !ok {
+		return nil
+	}
+	k := bookKey{symbol: strings.TrimSpace(f.exec.Symbol), book: book}
+	l, ok := b[k]
+	if !ok {
+		l = &lot{known: true}
+		b[k] = l
+	}
+	qty, price := f.exec.Quantity, f.exec.Price
+	if opening {
+		if l.quantity == 0 {
+			l.known = true
+		}
+		l.quantity += qty
+		l.cost += price.Mul(qty)
+		return nil
+	}
+	closed := min(qty, l.quantity)
+	if !l.known || closed == 0 {
+		l.quantity -= closed
+		return nil
+	}
+	avg := l.cost.Div(int64(l.quantity))
+	diff := price - avg
+	if book == portfolio.BookMarginShort {
+		diff = -diff
+	}
+	pnl := diff.Mul(closed).Round(0).Yen()
+	l.quantity -= closed
+	l.cost -= avg.Mul(closed)
+	if l.quantity == 0 {
+		l.cost = 0
+	}
+	return &pnl
+}
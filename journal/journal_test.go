@@ -0,0 +1,172 @@
+package journal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ueebee/tachibanashi/calendar"
+	"github.com/ueebee/tachibanashi/cost"
+	"github.com/ueebee/tachibanashi/master"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+type mockSource struct {
+	orders  string
+	details map[string]string
+	cash    []model.Position
+	margin  []model.Position
+	fetched []string
+	params  request.OrderParams
+}
+
+func (m *mockSource) OrderList(ctx context.Context, params request.OrderParams) (*request.OrderListResponse, error) {
+	m.params = params
+	var resp request.OrderListResponse
+	if err := json.Unmarshal([]byte(m.orders), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (m *mockSource) OrderListDetail(ctx context.Context, orderNumber, eigyouDay string) (*request.OrderListDetailResponse, error) {
+	m.fetched = append(m.fetched, orderNumber)
+	raw, ok := m.details[orderNumber]
+	if !ok {
+		raw = `{"sResultCode":"0"}`
+	}
+	var resp request.OrderListDetailResponse
+	if err := json.Unmarshal([]byte(raw), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (m *mockSource) CashPositions(ctx context.Context, issueCode string) (*request.CashPositionsSnapshot, error) {
+	return &request.CashPositionsSnapshot{Positions: m.cash}, nil
+}
+
+func (m *mockSource) MarginPositions(ctx context.Context, issueCode string) (*request.MarginPositionsSnapshot, error) {
+	return &request.MarginPositionsSnapshot{Positions: m.margin}, nil
+}
+
+func newTestStore() *master.MemoryStore {
+	store := master.NewMemoryStore()
+	store.Upsert(master.MasterDateZyouhou, calendar.DayKeyToday, model.Attributes{
+		master.DateInfoFieldDayKey:           calendar.DayKeyToday,
+		master.DateInfoFieldTheDay:           "20240426",
+		master.DateInfoFieldKabuUkewatasiDay: "20240501",
+	}, master.UpdateMeta{})
+	store.Upsert(master.MasterIssueMstKabu, "6501", model.Attributes{master.IssueKabuFieldName: "日立製作所"}, master.UpdateMeta{})
+	return store
+}
+
+func newTestSource() *mockSource {
+	return &mockSource{
+		orders: `{"sResultCode":"0","aOrderList":[
+{"sOrderOrderNumber":"2","sOrderIssueCode":"6501","sOrderSizyouC":"00","sOrderBaibaiKubun":"1","sGenkinSinyouKubun":"0","sOrderZyoutoekiKazeiC":"1","sOrderYakuzyouSuryo":"100","sOrderYakuzyouPrice":"1200","sOrderSikkouDay":"20240426"},
+{"sOrderOrderNumber":"1","sOrderIssueCode":"6501","sOrderSizyouC":"00","sOrderBaibaiKubun":"3","sGenkinSinyouKubun":"0","sOrderZyoutoekiKazeiC":"1","sOrderYakuzyouSuryo":"100","sOrderYakuzyouPrice":"1100","sOrderSikkouDay":"20240426"},
+{"sOrderOrderNumber":"3","sOrderIssueCode":"7203","sOrderSizyouC":"00","sOrderBaibaiKubun":"3","sGenkinSinyouKubun":"4","sOrderYakuzyouSuryo":"100","sOrderYakuzyouPrice":"1900","sOrderOrderDateTime":"20240426133000","sOrderSikkouDay":"20240426"},
+{"sOrderOrderNumber":"4","sOrderIssueCode":"6501","sOrderBaibaiKubun":"3","sGenkinSinyouKubun":"0","sOrderYakuzyouSuryo":"0","sOrderSikkouDay":"20240426"}
+]}`,
+		details: map[string]string{
+			"1": `{"sResultCode":"0","aYakuzyouSikkouList":[
+{"sYakuzyouDate":"20240426091000","sYakuzyouSuryou":"60","sYakuzyouPrice":"1100"},
+{"sYakuzyouDate":"20240426091005","sYakuzyouSuryou":"40","sYakuzyouPrice":"1100"}
+]}`,
+			"3": `{"sResultCode":"0","sGenkinSinyouKubun":"4","sGenbutuZyoutoekiKazeiC":"1","sSinyouZyoutoekiKazeiC":"2"}`,
+		},
+		cash: []model.Position{{Symbol: "6501", Quantity: 100, AvgPrice: model.Yen(1000)}},
+	}
+}
+
+func TestBuildJoinsFillsFeesAndPnL(t *testing.T) {
+	source := newTestSource()
+	store := newTestStore()
+	schedule := cost.Schedule{
+		Cash:    cost.Plan{Kind: cost.PlanPerTrade, Tiers: []cost.Tier{{UpTo: 100000, Fee: 99}, {Fee: 275}}},
+		Margin:  cost.Plan{Kind: cost.PlanZero},
+		TaxRate: 0.10,
+	}
+	ec := []model.Execution{{OrderID: "2", Price: model.Yen(1200), Quantity: 100, Time: "20240426100000"}}
+	exporter := NewExporter(source, store, calendar.New(store), WithSchedule(schedule), WithExecutions(ec))
+
+	rows, err := exporter.Build(context.Background(), time.Date(2024, 4, 26, 0, 0, 0, 0, model.JST))
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if source.params["sSikkouDay"] != "20240426" {
+		t.Fatalf("params = %v", source.params)
+	}
+	if strings.Join(source.fetched, ",") != "1,3" {
+		t.Fatalf("detail fetched for %v", source.fetched)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("rows = %+v", rows)
+	}
+
+	first := rows[0]
+	if first.OrderNumber != "1" || first.Quantity != 60 || first.Side != "buy" || first.IssueName != "日立製作所" || first.SettlementDate != "20240501" || first.Account != "1" {
+		t.Fatalf("first = %+v", first)
+	}
+	if first.Value != 66000 || first.Commission != 99 || first.Tax != 9 || first.RealizedPnL != nil {
+		t.Fatalf("first cost = %+v", first)
+	}
+	if second := rows[1]; second.Commission != 176 || second.Tax != 18 {
+		t.Fatalf("second cost = %+v", second)
+	}
+
+	// Opening 100 @ 1000, bought 100 @ 1100, sold 100 @ 1200 against 1050.
+	sell := rows[2]
+	if sell.OrderNumber != "2" || sell.Side != "sell" || sell.RealizedPnL == nil || *sell.RealizedPnL != 15000 {
+		t.Fatalf("sell = %+v", sell)
+	}
+	if sell.Commission != 275 || sell.Tax != 27 {
+		t.Fatalf("sell cost = %+v", sell)
+	}
+
+	// The short was built and closed with no position left, so no basis.
+	cover := rows[3]
+	if cover.OrderNumber != "3" || cover.CashOrMargin != "4" || cover.Account != "2" || cover.ExecutedAt != "20240426133000" {
+		t.Fatalf("cover = %+v", cover)
+	}
+	if cover.RealizedPnL != nil || cover.Commission != 0 {
+		t.Fatalf("cover pnl = %+v", cover)
+	}
+}
+
+func TestWriters(t *testing.T) {
+	pnl := int64(-500)
+	rows := []Row{
+		{TradeDate: "20240426", OrderNumber: "1", Symbol: "6501", IssueName: "日立, 製作所", Side: "buy", Price: model.Yen(1100), Quantity: 100, Value: 110000},
+		{TradeDate: "20240426", OrderNumber: "2", Symbol: "6501", Side: "sell", Price: model.Price(10955000), Quantity: 100, Value: 109550, RealizedPnL: &pnl},
+	}
+
+	var csvOut bytes.Buffer
+	if err := WriteCSV(&csvOut, rows); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(csvOut.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "trade_date,") {
+		t.Fatalf("csv = %q", csvOut.String())
+	}
+	if !strings.Contains(lines[1], `"日立, 製作所"`) || !strings.HasSuffix(lines[1], ",110000,0,0,") {
+		t.Fatalf("csv row = %q", lines[1])
+	}
+	if !strings.Contains(lines[2], ",1095.5,100,") || !strings.HasSuffix(lines[2], ",-500") {
+		t.Fatalf("csv row = %q", lines[2])
+	}
+
+	var jsonOut bytes.Buffer
+	if err := WriteJSONL(&jsonOut, rows); err != nil {
+		t.Fatalf("WriteJSONL() error = %v", err)
+	}
+	lines = strings.Split(strings.TrimSpace(jsonOut.String()), "\n")
+	if len(lines) != 2 || strings.Contains(lines[0], "realized_pnl") || !strings.Contains(lines[1], `"realized_pnl":-500`) {
+		t.Fatalf("jsonl = %q", jsonOut.String())
+	}
+}
@@ -0,0 +1,192 @@
+package margincall
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+// DefaultCooldown is the minimum time between deleveraging rounds, so fills
+// can show up in the next poll before more lots are closed.
+const DefaultCooldown = 5 * time.Minute
+
+// OrderSender sends close orders. *request.Service and *risk.Gate satisfy
+// it.
+type OrderSender interface {
+	KabuNewOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error)
+}
+
+// Policy closes margin lots at market once the estimated ratio falls below
+// Trigger, sized to bring it back to Target. Closing a lot is assumed to
+// leave 受入保証金 unchanged, since its valuation P&L is already counted.
+type Policy struct {
+	Trigger float64
+	Target  float64
+	// Selection orders the lots to close across symbols. Defaults to
+	// request.PositionSelectionLossFirst.
+	Selection request.PositionSelectionMode
+	// Unit rounds a partial close up to whole trading units. Defaults to 100.
+	Unit           model.Quantity
+	Cooldown       time.Duration
+	SecondPassword string
+}
+
+// Validate checks the ratios.
+func (p Policy) Validate() error {
+	if p.Trigger <= 0 {
+		return &terrors.ValidationError{Field: "trigger", Reason: "must be positive"}
+	}
+	if p.Target <= p.Trigger {
+		return &terrors.ValidationError{Field: "target", Reason: "must be above trigger"}
+	}
+	if p.Unit < 0 {
+		return &terrors.ValidationError{Field: "unit", Reason: "must not be negative"}
+	}
+	return nil
+}
+
+// Close is one deleveraging order and its outcome.
+type Close struct {
+	Order    request.NewOrder
+	Response *request.OrderResponse
+	Err      error
+}
+
+// WithDeleverage sends close orders through sender according to policy.
+func WithDeleverage(sender OrderSender, policy Policy) Option {
+	return func(m *Monitor) {
+		if policy.Selection == "" {
+			policy.Selection = request.PositionSelectionLossFirst
+		}
+		if policy.Unit == 0 {
+			policy.Unit = 100
+		}
+		if policy.Cooldown <= 0 {
+			policy.Cooldown = DefaultCooldown
+		}
+		m.sender = sender
+		m.policy = policy
+	}
+}
+
+// deleverageLocked plans a round when the policy triggers.
+func (m *Monitor) deleverageLocked() ([]request.NewOrder, error) {
+	if m.sender == nil || m.status.Exposure <= 0 || m.status.Ratio >= m.policy.Trigger {
+		return nil, nil
+	}
+	now := m.now()
+	if !m.lastDelever.IsZero() && now.Sub(m.lastDelever) < m.policy.Cooldown {
+		return nil, nil
+	}
+	if err := m.policy.Validate(); err != nil {
+		return nil, err
+	}
+	m.lastDelever = now
+	return planCloses(m.lots, m.status.Collateral, m.status.Exposure, m.policy)
+}
+
+// planCloses picks lots whose 建代金 covers the exposure to shed and groups
+// them into one specified-lot order per symbol, side, account and kind.
+func planCloses(lots []lot, collateral, exposure int64, policy Policy) ([]request.NewOrder, error) {
+	shed := exposure
+	if collateral > 0 {
+		shed = exposure - int64(float64(collateral)*100/policy.Target)
+	}
+	if shed <= 0 {
+		return nil, nil
+	}
+
+	open := make([]request.MarginLot, 0, len(lots))
+	byNumber := make(map[string]lot, len(lots))
+	var closable model.Quantity
+	for _, l := range lots {
+		if l.Closable <= 0 || l.Price <= 0 {
+			continue
+		}
+		open = append(open, l.MarginLot)
+		byNumber[l.Number] = l
+		closable += l.Closable
+	}
+	if closable == 0 {
+		return nil, nil
+	}
+	ordered, err := request.SelectLots(open, closable, policy.Selection)
+	if err != nil {
+		return nil, err
+	}
+
+	type group struct {
+		symbol, market string
+		side           request.Side
+		tax            request.TaxAccount
+		kind           request.CashOrMargin
+	}
+	var groups []group
+	picked := make(map[group][]request.CloseLot)
+	remaining := model.Yen(shed)
+	for _, item := range ordered {
+		if remaining <= 0 {
+			break
+		}
+		l := byNumber[item.Number]
+		qty := model.Quantity((int64(remaining) + int64(l.Price) - 1) / int64(l.Price))
+		if policy.Unit > 1 {
+			qty = (qty + policy.Unit - 1) / policy.Unit * policy.Unit
+		}
+		qty = min(qty, item.Quantity)
+		remaining -= l.Price.Mul(qty)
+
+		g := group{symbol: strings.TrimSpace(l.Symbol), market: l.Market, side: l.Side, tax: l.Tax, kind: l.kind}
+		if _, ok := picked[g]; !ok {
+			groups = append(groups, g)
+		}
+		picked[g] = append(picked[g], request.CloseLot{Number: l.Number, Quantity: qty})
+	}
+
+	orders := make([]request.NewOrder, 0, len(groups))
+	for _, g := range groups {
+		market := g.market
+		if market == "" {
+			market = request.MarketTSE
+		}
+		order := request.MarketSell(g.symbol, market, 0)
+		if g.side == request.SideSell {
+			order = request.MarketBuy(g.symbol, market, 0)
+		}
+		if g.tax != "" {
+			order.Tax = g.tax
+		}
+		order = order.Margin(g.kind).WithLots(picked[g])
+		order.SecondPassword = policy.SecondPassword
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+// send places the round's orders and reports them as one AlertDeleverage.
+func (m *Monitor) send(ctx context.Context, orders []request.NewOrder) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	closes := make([]Close, 0, len(orders))
+	var errs []error
+	for _, order := range orders {
+		c := Close{Order: order}
+		params, err := order.ToParams()
+		if err == nil {
+			c.Response, err = m.sender.KabuNewOrder(ctx, params)
+		}
+		if err != nil {
+			c.Err = err
+			errs = append(errs, err)
+		}
+		closes = append(closes, c)
+	}
+	m.emit([]Alert{{Kind: AlertDeleverage, Status: m.Status(), Closes: closes}})
+	return errors.Join(errs...)
+}
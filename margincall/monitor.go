@@ -0,0 +1,444 @@
+package margincall
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ueebee/tachibanashi/event"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+// DefaultPollInterval is how often Watch refetches the broker's figures.
+const DefaultPollInterval = time.Minute
+
+// CallRatio is the 委託保証金率 (%) below which a 追証 is raised at the close.
+const CallRatio = 20.0
+
+// DefaultThresholds are the ratios (%) that raise AlertThreshold.
+var DefaultThresholds = []float64{30, 25, CallRatio}
+
+// rearmBand is how far (points) the ratio must recover above a threshold
+// before it can alert again, so quotes around the line do not flap.
+const rearmBand = 1.0
+
+// AlertKind says why an Alert was raised.
+type AlertKind string
+
+const (
+	AlertThreshold         AlertKind = "threshold"
+	AlertMarginCall        AlertKind = "margin-call"
+	AlertMarginCallCleared AlertKind = "margin-call-cleared"
+	AlertDeleverage        AlertKind = "deleverage"
+)
+
+// Call is one aOisyouHasseiZyoukyouList row from CLMZanKaiSummary.
+type Call struct {
+	Date     string // sOhzHasseiDay
+	Deadline string // sOhzNyukinKigenDay
+	Ratio    float64
+	Amount   int64 // sOhzOisyouKingaku
+	// Unpaid is sOhzMikaisyouKingaku, the part not yet covered.
+	Unpaid    int64
+	Confirmed bool // sOhzKakuteiFlg
+	Fields    model.Attributes
+}
+
+// Status is the monitor's view of the account. Money fields are whole yen.
+type Status struct {
+	// Ratio is the estimated 委託保証金率 (%): Reported at the last poll,
+	// moved by FD last prices since.
+	Ratio     float64
+	Estimated bool
+	// Reported is sItakuHosyoukinRitu from CLMZanRealHosyoukinRitu.
+	Reported float64
+	// BuyingPowerRatio is MarginBuyingPower().MaintenanceRatio.
+	BuyingPowerRatio float64
+	// Collateral is 受入保証金 including the estimated valuation change.
+	Collateral int64
+	// Exposure is 建株代金.
+	Exposure int64
+	// Required is 追証必要保証金 at CallRatio.
+	Required   int64
+	MarginCall bool
+	Calls      []Call
+	PolledAt   time.Time
+	UpdatedAt  time.Time
+}
+
+// Alert reports a threshold crossing, a change in 追証 status or a
+// deleveraging round.
+type Alert struct {
+	Kind AlertKind
+	// Threshold is the ratio crossed for AlertThreshold.
+	Threshold float64
+	Status    Status
+	// Closes are the orders sent for AlertDeleverage.
+	Closes []Close
+}
+
+// Source provides the margin figures. *request.Service satisfies it.
+type Source interface {
+	ZanRealHosyoukinRitu(ctx context.Context) (*request.ZanRealHosyoukinRituResponse, error)
+	MarginBuyingPower(ctx context.Context) (*request.MarginBuyingPowerSnapshot, error)
+	ZanKaiSummary(ctx context.Context) (*request.ZanKaiSummaryResponse, error)
+	ShinyouTategyokuList(ctx context.Context, issueCode string) (*request.ShinyouTategyokuListResponse, error)
+}
+
+// lot is an open margin lot with its valuation at the last poll.
+type lot struct {
+	request.MarginLot
+	kind request.CashOrMargin // close kind from sOrderBensaiKubun
+}
+
+// Monitor polls the 委託保証金率 and 追証 status and re-estimates the ratio
+// from FD last prices between polls. The estimate only moves margin lots;
+// 代用有価証券 and cash holdings keep their polled value.
+type Monitor struct {
+	source     Source
+	symbols    map[int]string
+	interval   time.Duration
+	thresholds []float64
+	onAlert    func(Alert)
+	sender     OrderSender
+	policy     Policy
+	now        func() time.Time
+
+	mu          sync.Mutex
+	book        *event.QuoteBook
+	status      Status
+	collateral  int64 // 受入保証金 at the last poll
+	lots        []lot
+	marks       map[string]model.Price
+	armed       []bool
+	polled      bool
+	lastDelever time.Time
+}
+
+type Option func(*Monitor)
+
+// WithPollInterval sets how often Watch polls.
+func WithPollInterval(every time.Duration) Option {
+	return func(m *Monitor) {
+		if every > 0 {
+			m.interval = every
+		}
+	}
+}
+
+// WithThresholds replaces DefaultThresholds. Ratios are in percent.
+func WithThresholds(ratios ...float64) Option {
+	return func(m *Monitor) {
+		m.thresholds = append([]float64(nil), ratios...)
+	}
+}
+
+// WithAlerts sets where alerts are delivered. It is called without locks
+// held.
+func WithAlerts(report func(Alert)) Option {
+	return func(m *Monitor) {
+		m.onAlert = report
+	}
+}
+
+func withClock(now func() time.Time) Option {
+	return func(m *Monitor) {
+		m.now = now
+	}
+}
+
+// NewMonitor marks FD rows mapped to issue codes by symbols (p_gyou_no to
+// sIssueCode), as registered with the event service.
+func NewMonitor(source Source, symbols map[int]string, opts ...Option) *Monitor {
+	copied := make(map[int]string, len(symbols))
+	for row, symbol := range symbols {
+		copied[row] = symbol
+	}
+	m := &Monitor{
+		source:     source,
+		symbols:    copied,
+		interval:   DefaultPollInterval,
+		thresholds: append([]float64(nil), DefaultThresholds...),
+		now:        time.Now,
+		book:       event.NewQuoteBook(),
+		marks:      make(map[string]model.Price),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(m)
+		}
+	}
+	m.armed = make([]bool, len(m.thresholds))
+	for i := range m.armed {
+		m.armed[i] = true
+	}
+	return m
+}
+
+// Poll fetches CLMZanRealHosyoukinRitu, MarginBuyingPower, CLMZanKaiSummary
+// and the margin lots, then raises any alerts and runs the deleveraging
+// policy.
+func (m *Monitor) Poll(ctx context.Context) error {
+	ratio, err := m.source.ZanRealHosyoukinRitu(ctx)
+	if err != nil {
+		return err
+	}
+	power, err := m.source.MarginBuyingPower(ctx)
+	if err != nil {
+		return err
+	}
+	summary, err := m.source.ZanKaiSummary(ctx)
+	if err != nil {
+		return err
+	}
+	positions, err := m.source.ShinyouTategyokuList(ctx, "")
+	if err != nil {
+		return err
+	}
+	lots, err := decodeLots(positions)
+	if err != nil {
+		return err
+	}
+	calls, err := decodeCalls(summary.OisyouHasseiZyoukyouList)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	wasCall := m.status.MarginCall
+	m.polled = true
+	m.collateral = parseInt(ratio.Fields.Value("sUkeireHosyoukin"))
+	m.lots = lots
+	m.marks = make(map[string]model.Price)
+	m.status.Reported = parseFloat(ratio.Fields.Value("sItakuHosyoukinRitu"))
+	m.status.BuyingPowerRatio = power.MaintenanceRatio
+	m.status.Exposure = parseInt(ratio.Fields.Value("sTateKabuDaikin"))
+	if m.status.Exposure == 0 {
+		for _, l := range lots {
+			m.status.Exposure += l.Price.Mul(l.Quantity).Yen()
+		}
+	}
+	m.status.Required = parseInt(ratio.Fields.Value("sOisyouHituyouHosyoukin"))
+	m.status.MarginCall = strings.TrimSpace(summary.Fields.Value("sOisyouHasseiFlg")) == "1"
+	m.status.Calls = calls
+	m.status.PolledAt = m.now()
+	m.estimateLocked()
+
+	var alerts []Alert
+	switch {
+	case m.status.MarginCall && !wasCall:
+		alerts = append(alerts, Alert{Kind: AlertMarginCall, Status: m.statusLocked()})
+	case !m.status.MarginCall && wasCall:
+		alerts = append(alerts, Alert{Kind: AlertMarginCallCleared, Status: m.statusLocked()})
+	}
+	alerts = append(alerts, m.crossingsLocked()...)
+	orders, err := m.deleverageLocked()
+	m.mu.Unlock()
+
+	m.emit(alerts)
+	if err != nil {
+		return err
+	}
+	return m.send(ctx, orders)
+}
+
+// Apply marks margin lots from FD last prices and re-estimates the ratio.
+// Other events are ignored.
+func (m *Monitor) Apply(ctx context.Context, ev event.Event) error {
+	fd, ok := ev.(event.FD)
+	if !ok {
+		return nil
+	}
+	m.mu.Lock()
+	quotes := m.book.Apply(fd)
+	index := 0
+	changed := false
+	for _, row := range fd.Rows {
+		if row.Fields == nil || index >= len(quotes) {
+			continue
+		}
+		quote := quotes[index]
+		index++
+		symbol := m.symbols[row.Row]
+		last, ok := quote.LastPrice()
+		if symbol == "" || !ok || last <= 0 || m.marks[symbol] == last {
+			continue
+		}
+		m.marks[symbol] = last
+		changed = true
+	}
+	if !changed || !m.polled {
+		m.mu.Unlock()
+		return nil
+	}
+	m.estimateLocked()
+	alerts := m.crossingsLocked()
+	orders, err := m.deleverageLocked()
+	m.mu.Unlock()
+
+	m.emit(alerts)
+	if err != nil {
+		return err
+	}
+	return m.send(ctx, orders)
+}
+
+// Watch polls once, then applies events and polls every interval until ctx
+// is done or events is closed. onError may be nil.
+func (m *Monitor) Watch(ctx context.Context, events <-chan event.Event, onError func(error)) error {
+	report := func(err error) {
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+	report(m.Poll(ctx))
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			report(m.Apply(ctx, ev))
+		case <-ticker.C:
+			report(m.Poll(ctx))
+		}
+	}
+}
+
+// Status returns the latest view of the account.
+func (m *Monitor) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.statusLocked()
+}
+
+func (m *Monitor) statusLocked() Status {
+	status := m.status
+	status.Calls = append([]Call(nil), m.status.Calls...)
+	return status
+}
+
+// estimateLocked moves the polled 受入保証金 by each marked lot's change
+// from its polled 評価単価.
+func (m *Monitor) estimateLocked() {
+	collateral := m.collateral
+	estimated := false
+	for _, l := range m.lots {
+		mark, ok := m.marks[l.Symbol]
+		if !ok || l.Valuation <= 0 {
+			continue
+		}
+		change := mark - l.Valuation
+		if l.Side == request.SideSell {
+			change = -change
+		}
+		collateral += change.Mul(l.Quantity).Round(0).Yen()
+		estimated = true
+	}
+	m.status.Collateral = collateral
+	m.status.Estimated = estimated
+	m.status.Ratio = m.status.Reported
+	if estimated && m.status.Exposure > 0 {
+		m.status.Ratio = float64(collateral) * 100 / float64(m.status.Exposure)
+	}
+	m.status.UpdatedAt = m.now()
+}
+
+// crossingsLocked returns an alert for each threshold the ratio fell
+// below and re-arms those it recovered above.
+func (m *Monitor) crossingsLocked() []Alert {
+	if m.status.Exposure <= 0 {
+		return nil
+	}
+	var alerts []Alert
+	for i, threshold := range m.thresholds {
+		switch {
+		case m.armed[i] && m.status.Ratio < threshold:
+			m.armed[i] = false
+			alerts = append(alerts, Alert{Kind: AlertThreshold, Threshold: threshold, Status: m.statusLocked()})
+		case !m.armed[i] && m.status.Ratio >= threshold+rearmBand:
+			m.armed[i] = true
+		}
+	}
+	return alerts
+}
+
+func (m *Monitor) emit(alerts []Alert) {
+	if m.onAlert == nil {
+		return
+	}
+	for _, alert := range alerts {
+		m.onAlert(alert)
+	}
+}
+
+func decodeLots(resp *request.ShinyouTategyokuListResponse) ([]lot, error) {
+	if resp == nil {
+		return nil, nil
+	}
+	lots := make([]lot, 0, len(resp.Entries))
+	for _, entry := range resp.Entries {
+		marginLot, err := entry.Lot()
+		if err != nil {
+			return nil, err
+		}
+		kind := request.MarginSystemClose
+		if strings.HasPrefix(strings.TrimSpace(entry.Fields.Value("sOrderBensaiKubun")), "3") {
+			kind = request.MarginGeneralClose
+		}
+		lots = append(lots, lot{MarginLot: marginLot, kind: kind})
+	}
+	return lots, nil
+}
+
+// decodeCalls reads aOisyouHasseiZyoukyouList, which is "" when there is no
+// 追証.
+func decodeCalls(raw json.RawMessage) ([]Call, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || raw[0] != '[' {
+		return nil, nil
+	}
+	var rows []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &rows); err != nil {
+		return nil, err
+	}
+	calls := make([]Call, 0, len(rows))
+	for _, row := range rows {
+		fields := make(model.Attributes, len(row))
+		for key, value := range row {
+			var s string
+			if err := json.Unmarshal(value, &s); err == nil {
+				fields[key] = s
+			}
+		}
+		calls = append(calls, Call{
+			Date:      fields.Value("sOhzHasseiDay"),
+			Deadline:  fields.Value("sOhzNyukinKigenDay"),
+			Ratio:     parseFloat(fields.Value("sOhzHosyoukinRitu")),
+			Amount:    parseInt(fields.Value("sOhzOisyouKingaku")),
+			Unpaid:    parseInt(fields.Value("sOhzMikaisyouKingaku")),
+			Confirmed: fields.Value("sOhzKakuteiFlg") == "1",
+			Fields:    fields,
+		})
+	}
+	return calls, nil
+}
+
+func parseInt(value string) int64 {
+	parsed, _ := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	return parsed
+}
+
+func parseFloat(value string) float64 {
+	parsed, _ := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	return parsed
+}
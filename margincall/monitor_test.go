@@ -0,0 +1,208 @@
+package margincall
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ueebee/tachibanashi/event"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+type mockSource struct {
+	real    string
+	summary string
+	lots    string
+}
+
+func (m *mockSource) ZanRealHosyoukinRitu(ctx context.Context) (*request.ZanRealHosyoukinRituResponse, error) {
+	var resp request.ZanRealHosyoukinRituResponse
+	err := json.Unmarshal([]byte(m.real), &resp)
+	return &resp, err
+}
+
+func (m *mockSource) MarginBuyingPower(ctx context.Context) (*request.MarginBuyingPowerSnapshot, error) {
+	return &request.MarginBuyingPowerSnapshot{MaintenanceRatio: 31.5}, nil
+}
+
+func (m *mockSource) ZanKaiSummary(ctx context.Context) (*request.ZanKaiSummaryResponse, error) {
+	var resp request.ZanKaiSummaryResponse
+	err := json.Unmarshal([]byte(m.summary), &resp)
+	return &resp, err
+}
+
+func (m *mockSource) ShinyouTategyokuList(ctx context.Context, issueCode string) (*request.ShinyouTategyokuListResponse, error) {
+	var resp request.ShinyouTategyokuListResponse
+	err := json.Unmarshal([]byte(m.lots), &resp)
+	return &resp, err
+}
+
+type mockSender struct {
+	sent []request.OrderParams
+}
+
+func (m *mockSender) KabuNewOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error) {
+	m.sent = append(m.sent, params)
+	return &request.OrderResponse{}, nil
+}
+
+const (
+	realRatio = `{"sResultCode":"0","sUkeireHosyoukin":"660000","sTateKabuDaikin":"2200000","sItakuHosyoukinRitu":"30.00","sOisyouHituyouHosyoukin":"440000"}`
+	noCall    = `{"sResultCode":"0","sOisyouHasseiFlg":"0","aOisyouHasseiZyoukyouList":""}`
+	openLots  = `{"sResultCode":"0","aShinyouTategyokuList":[
+{"sOrderTategyokuNumber":"A1","sOrderIssueCode":"7203","sOrderSizyouC":"00","sOrderBaibaiKubun":"3","sOrderBensaiKubun":"36","sOrderZyoutoekiKazeiC":"1","sOrderTategyokuSuryou":"1000","sOrderTategyokuTanka":"2000","sOrderHyoukaTanka":"2000","sOrderHensaiKanouSuryou":"1000","sOrderTategyokuDay":"20240401"},
+{"sOrderTategyokuNumber":"B1","sOrderIssueCode":"6501","sOrderSizyouC":"00","sOrderBaibaiKubun":"1","sOrderBensaiKubun":"26","sOrderZyoutoekiKazeiC":"1","sOrderTategyokuSuryou":"200","sOrderTategyokuTanka":"1000","sOrderHyoukaTanka":"1100","sOrderHensaiKanouSuryou":"200","sOrderTategyokuDay":"20240402"}
+]}`
+)
+
+func last(row int, price string) event.FD {
+	return event.FD{Rows: []event.FDRow{{Row: row, Fields: model.Attributes{model.FieldLastPrice: price}}}}
+}
+
+func TestMonitorThresholdsFromQuotes(t *testing.T) {
+	var alerts []Alert
+	monitor := NewMonitor(&mockSource{real: realRatio, summary: noCall, lots: openLots}, map[int]string{1: "7203"},
+		WithAlerts(func(a Alert) { alerts = append(alerts, a) }))
+	ctx := context.Background()
+
+	if err := monitor.Apply(ctx, last(1, "1900")); err != nil {
+		t.Fatalf("Apply() before poll error = %v", err)
+	}
+	if err := monitor.Poll(ctx); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	status := monitor.Status()
+	if status.Ratio != 30 || status.Estimated || status.BuyingPowerRatio != 31.5 || status.Exposure != 2200000 || len(alerts) != 0 {
+		t.Fatalf("status = %+v alerts = %v", status, alerts)
+	}
+
+	steps := []struct {
+		price      string
+		collateral int64
+		alerts     []float64
+	}{
+		{"1900", 560000, []float64{30}},
+		{"1850", 510000, []float64{25}},
+		{"1950", 610000, nil}, // 27.7%: re-arms 25
+		{"1860", 520000, []float64{25}},
+		{"2000", 660000, nil}, // 30%: 30 stays disarmed until 31
+	}
+	for _, step := range steps {
+		alerts = nil
+		if err := monitor.Apply(ctx, last(1, step.price)); err != nil {
+			t.Fatalf("Apply(%s) error = %v", step.price, err)
+		}
+		status := monitor.Status()
+		if !status.Estimated || status.Collateral != step.collateral {
+			t.Fatalf("%s: status = %+v", step.price, status)
+		}
+		if len(alerts) != len(step.alerts) {
+			t.Fatalf("%s: alerts = %+v", step.price, alerts)
+		}
+		for i, threshold := range step.alerts {
+			if alerts[i].Kind != AlertThreshold || alerts[i].Threshold != threshold {
+				t.Fatalf("%s: alert = %+v", step.price, alerts[i])
+			}
+		}
+	}
+
+	// A poll replaces the estimate with the reported figures.
+	if err := monitor.Poll(ctx); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if status := monitor.Status(); status.Estimated || status.Collateral != 660000 {
+		t.Fatalf("after poll = %+v", status)
+	}
+}
+
+func TestMonitorMarginCallStatus(t *testing.T) {
+	var alerts []Alert
+	source := &mockSource{real: realRatio, summary: noCall, lots: `{"sResultCode":"0","aShinyouTategyokuList":""}`}
+	monitor := NewMonitor(source, nil, WithAlerts(func(a Alert) { alerts = append(alerts, a) }))
+	ctx := context.Background()
+
+	source.summary = `{"sResultCode":"0","sOisyouHasseiFlg":"1","aOisyouHasseiZyoukyouList":[
+{"sOhzHasseiDay":"20240426","sOhzHosyoukinRitu":"18.5","sOhzNyukinKigenDay":"202404301200","sOhzOisyouKingaku":"35000","sOhzKakuteiFlg":"1","sOhzMikaisyouKingaku":"35000"}]}`
+	for range 2 {
+		if err := monitor.Poll(ctx); err != nil {
+			t.Fatalf("Poll() error = %v", err)
+		}
+	}
+	if len(alerts) != 1 || alerts[0].Kind != AlertMarginCall {
+		t.Fatalf("alerts = %+v", alerts)
+	}
+	calls := alerts[0].Status.Calls
+	if len(calls) != 1 || calls[0].Amount != 35000 || calls[0].Ratio != 18.5 || !calls[0].Confirmed || calls[0].Deadline != "202404301200" {
+		t.Fatalf("calls = %+v", calls)
+	}
+
+	source.summary = noCall
+	if err := monitor.Poll(ctx); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if len(alerts) != 2 || alerts[1].Kind != AlertMarginCallCleared || alerts[1].Status.MarginCall {
+		t.Fatalf("alerts = %+v", alerts)
+	}
+}
+
+func TestMonitorDeleverage(t *testing.T) {
+	now := time.Date(2024, 4, 26, 10, 0, 0, 0, model.JST)
+	sender := &mockSender{}
+	var rounds []Alert
+	monitor := NewMonitor(&mockSource{real: realRatio, summary: noCall, lots: openLots}, map[int]string{1: "7203"},
+		WithDeleverage(sender, Policy{Trigger: 25, Target: 35, SecondPassword: "pw"}),
+		WithAlerts(func(a Alert) {
+			if a.Kind == AlertDeleverage {
+				rounds = append(rounds, a)
+			}
+		}),
+		withClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	if err := monitor.Poll(ctx); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if err := monitor.Apply(ctx, last(1, "1850")); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	// 510000 / 35% leaves room for 1457142 of 建株代金, so 742858 is shed:
+	// the losing short first (200000), then 272 shares of 7203 rounded up.
+	if len(sender.sent) != 2 || len(rounds) != 1 || len(rounds[0].Closes) != 2 {
+		t.Fatalf("sent = %v rounds = %+v", sender.sent, rounds)
+	}
+	short := sender.sent[0]
+	if short["sIssueCode"] != "6501" || short["sBaibaiKubun"] != string(request.SideBuy) || short["sGenkinShinyouKubun"] != string(request.MarginSystemClose) ||
+		short["sOrderSuryou"] != "200" || short["sOrderPrice"] != "0" || short["sSecondPassword"] != "pw" {
+		t.Fatalf("short close = %v", short)
+	}
+	long := sender.sent[1]
+	if long["sIssueCode"] != "7203" || long["sBaibaiKubun"] != string(request.SideSell) || long["sGenkinShinyouKubun"] != string(request.MarginGeneralClose) || long["sOrderSuryou"] != "300" {
+		t.Fatalf("long close = %v", long)
+	}
+	if lots := long["aCLMKabuHensaiData"].([]map[string]string); len(lots) != 1 || lots[0]["sTategyokuNumber"] != "A1" || lots[0]["sOrderSuryou"] != "300" {
+		t.Fatalf("close lots = %v", lots)
+	}
+
+	// Within the cooldown a lower ratio sends nothing more.
+	now = now.Add(time.Minute)
+	monitor.Apply(ctx, last(1, "1800"))
+	if len(sender.sent) != 2 {
+		t.Fatalf("sent during cooldown = %d", len(sender.sent))
+	}
+	now = now.Add(DefaultCooldown)
+	monitor.Apply(ctx, last(1, "1790"))
+	if len(sender.sent) != 4 {
+		t.Fatalf("sent after cooldown = %d", len(sender.sent))
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	if err := (Policy{Trigger: 25, Target: 25}).Validate(); err == nil {
+		t.Fatalf("expected error for target at trigger")
+	}
+	if err := (Policy{Trigger: 25, Target: 30}).Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+}
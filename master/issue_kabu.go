@@ -1,6 +1,11 @@
 package master
 
-import "github.com/ueebee/tachibanashi/model"
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ueebee/tachibanashi/model"
+)
 
 const (
 	IssueKabuFieldCode                  = "sIssueCode"
@@ -57,3 +62,14 @@ func (i IssueMstKabu) IssueCode() string {
 func (i IssueMstKabu) IssueName() string {
 	return i.Fields.Value(IssueKabuFieldName)
 }
+
+// ParseLot parses a trading unit (sBaibaiTani, sSizyoubetuBaibaiTani and
+// their 翌日 variants). It reports false for a missing, fractional or
+// non-positive unit.
+func ParseLot(value string) (model.Quantity, bool) {
+	lot, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || lot <= 0 {
+		return 0, false
+	}
+	return model.Quantity(lot), true
+}
@@ -33,3 +33,24 @@ func TestIssueMstKabuUnmarshal(t *testing.T) {
 		t.Fatalf("unexpected master key: %v %s", ok, key)
 	}
 }
+
+func TestParseLot(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+		ok    bool
+	}{
+		{"100", 100, true},
+		{" 1 ", 1, true},
+		{"0", 0, false},
+		{"", 0, false},
+		{"100.5", 0, false},
+		{"-100", 0, false},
+	}
+	for _, tt := range tests {
+		lot, ok := ParseLot(tt.value)
+		if ok != tt.ok || int64(lot) != tt.want {
+			t.Errorf("ParseLot(%q) = %d, %v", tt.value, lot, ok)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// DailyBar is one trading day of OHLCV data.
+type DailyBar struct {
+	Symbol string
+	// Date is midnight of the trading day in JST.
+	Date   time.Time
+	Open   Price
+	High   Price
+	Low    Price
+	Close  Price
+	Volume Quantity
+	// SplitRatio is the conversion factor (before units / after units) set on
+	// the first trading day after a split or consolidation. Zero otherwise.
+	SplitRatio float64
+	// Discontinuity carries the xDCFS marker when present (e.g. "分", "併").
+	Discontinuity string
+	Raw           Attributes
+}
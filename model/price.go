@@ -0,0 +1,173 @@
+package model
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// PriceScale is the number of Price units per yen. Prices keep four decimal
+// places, enough for ¥0.1 TOPIX100 ticks and the API's "2300.0000" values.
+const PriceScale = 10000
+
+const priceDecimals = 4
+
+// Price is a fixed-point yen amount in units of 1/PriceScale.
+// Use Yen or ParsePrice to build one; the zero value means no price.
+type Price int64
+
+// Yen returns the Price of a whole-yen amount.
+func Yen(yen int64) Price {
+	return Price(yen * PriceScale)
+}
+
+// PriceFromFloat rounds f yen to the nearest Price unit.
+func PriceFromFloat(f float64) Price {
+	return Price(math.Round(f * PriceScale))
+}
+
+// ParsePrice parses decimal strings such as "3050", "850.000000" or
+// "2300.5". Digits beyond four decimal places must be zero.
+func ParsePrice(value string) (Price, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, errors.New("tachibanashi: empty price")
+	}
+	negative := strings.HasPrefix(value, "-")
+	digits := value
+	if negative || strings.HasPrefix(value, "+") {
+		digits = value[1:]
+	}
+	whole, frac, dot := strings.Cut(digits, ".")
+	if whole == "" || (dot && frac == "") {
+		return 0, errors.New("tachibanashi: invalid price: " + value)
+	}
+	if len(frac) > priceDecimals {
+		if strings.Trim(frac[priceDecimals:], "0") != "" {
+			return 0, errors.New("tachibanashi: price has more than 4 decimal places: " + value)
+		}
+		frac = frac[:priceDecimals]
+	}
+	frac += strings.Repeat("0", priceDecimals-len(frac))
+	w, err := strconv.ParseUint(whole, 10, 63)
+	if err != nil || w > math.MaxInt64/PriceScale {
+		return 0, errors.New("tachibanashi: invalid price: " + value)
+	}
+	f, err := strconv.ParseUint(frac, 10, 63)
+	if err != nil {
+		return 0, errors.New("tachibanashi: invalid price: " + value)
+	}
+	out := Price(int64(w)*PriceScale + int64(f))
+	if negative {
+		out = -out
+	}
+	return out, nil
+}
+
+// String formats the price without trailing zeros, e.g. "3050" or "2300.5".
+func (p Price) String() string {
+	return p.Format(-1)
+}
+
+// Format formats the price with a fixed number of decimal places, truncating
+// extra digits. Negative decimals trims trailing zeros.
+func (p Price) Format(decimals int) string {
+	sign := ""
+	value := int64(p)
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	whole := strconv.FormatInt(value/PriceScale, 10)
+	frac := strconv.FormatInt(value%PriceScale+PriceScale, 10)[1:]
+	switch {
+	case decimals < 0:
+		frac = strings.TrimRight(frac, "0")
+	case decimals < len(frac):
+		frac = frac[:decimals]
+	default:
+		frac += strings.Repeat("0", decimals-len(frac))
+	}
+	if frac == "" {
+		return sign + whole
+	}
+	return sign + whole + "." + frac
+}
+
+func (p Price) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Price) UnmarshalText(data []byte) error {
+	parsed, err := ParsePrice(string(data))
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// Yen returns the whole-yen part, truncated toward zero.
+func (p Price) Yen() int64 {
+	return int64(p) / PriceScale
+}
+
+// Float64 returns the price in yen.
+func (p Price) Float64() float64 {
+	return float64(p) / PriceScale
+}
+
+// IsWhole reports whether the price has no fractional yen.
+func (p Price) IsWhole() bool {
+	return p%PriceScale == 0
+}
+
+func (p Price) Add(other Price) Price {
+	return p + other
+}
+
+func (p Price) Sub(other Price) Price {
+	return p - other
+}
+
+// Mul returns the notional value of qty units at p.
+func (p Price) Mul(qty Quantity) Price {
+	return p * Price(qty)
+}
+
+// Div divides by n, rounding half away from zero.
+func (p Price) Div(n int64) Price {
+	if n == 0 {
+		return 0
+	}
+	a, b := int64(p), n
+	negative := (a < 0) != (b < 0)
+	if a < 0 {
+		a = -a
+	}
+	if b < 0 {
+		b = -b
+	}
+	q := a / b
+	if 2*(a%b) >= b {
+		q++
+	}
+	if negative {
+		q = -q
+	}
+	return Price(q)
+}
+
+// Round rounds to the given number of decimal places (0-4), half away
+// from zero.
+func (p Price) Round(decimals int) Price {
+	if decimals >= priceDecimals {
+		return p
+	}
+	if decimals < 0 {
+		decimals = 0
+	}
+	unit := int64(math.Pow10(priceDecimals - decimals))
+	return p.Div(unit) * Price(unit)
+}
@@ -0,0 +1,86 @@
+package model
+
+import "testing"
+
+func TestParsePriceAndString(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Price
+		str   string
+	}{
+		{"850.000000", Yen(850), "850"},
+		{"2300.5", Price(23005000), "2300.5"},
+		{"-0.25", Price(-2500), "-0.25"},
+		{"0.0001", Price(1), "0.0001"},
+		{" 3050 ", Yen(3050), "3050"},
+		{"+12", Yen(12), "12"},
+	}
+	for _, tt := range tests {
+		got, err := ParsePrice(tt.input)
+		if err != nil {
+			t.Fatalf("ParsePrice(%q) error: %v", tt.input, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParsePrice(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+		if got.String() != tt.str {
+			t.Errorf("String() = %q, want %q", got.String(), tt.str)
+		}
+	}
+	for _, input := range []string{"", "abc", "1.00001", "1.2.3", ".", "-", "+", "1.", ".5", "-.5", "-+5", "+-5", "--5"} {
+		if _, err := ParsePrice(input); err == nil {
+			t.Errorf("ParsePrice(%q) expected error", input)
+		}
+	}
+}
+
+func TestPriceFormat(t *testing.T) {
+	price := Price(123456)
+	if got := price.Format(2); got != "12.34" {
+		t.Errorf("Format(2) = %q", got)
+	}
+	if got := Yen(5).Format(1); got != "5.0" {
+		t.Errorf("Format(1) = %q", got)
+	}
+	text, err := price.MarshalText()
+	if err != nil || string(text) != "12.3456" {
+		t.Fatalf("MarshalText = %q, %v", text, err)
+	}
+	var decoded Price
+	if err := decoded.UnmarshalText(text); err != nil || decoded != price {
+		t.Fatalf("UnmarshalText = %d, %v", decoded, err)
+	}
+}
+
+func TestPriceArithmetic(t *testing.T) {
+	if got := Yen(100).Mul(3); got != Yen(300) {
+		t.Errorf("Mul = %s", got)
+	}
+	if got := Yen(10).Div(3); got != Price(33333) {
+		t.Errorf("Div = %d", got)
+	}
+	if got := Yen(-10).Div(4); got != Price(-25000) {
+		t.Errorf("Div negative = %d", got)
+	}
+	if got := Price(15).Div(10); got != Price(2) {
+		t.Errorf("Div half = %d", got)
+	}
+	if got := Price(-15).Div(10); got != Price(-2) {
+		t.Errorf("Div negative half = %d", got)
+	}
+	if got := Price(10500).Round(1); got != Price(11000) {
+		t.Errorf("Round(1) = %s", got)
+	}
+	if got := Price(12500).Round(0); got != Yen(1) {
+		t.Errorf("Round(0) = %s", got)
+	}
+	if got := Price(23005000).Yen(); got != 2300 {
+		t.Errorf("Yen() = %d", got)
+	}
+	if !Yen(7).IsWhole() || Price(70001).IsWhole() {
+		t.Errorf("IsWhole mismatch")
+	}
+	if got := PriceFromFloat(850.12345); got != Price(8501235) {
+		t.Errorf("PriceFromFloat = %d", got)
+	}
+}
@@ -18,12 +18,17 @@ func (q Quote) Float64(key string) (float64, bool) {
 	return q.Fields.Float64(key)
 }
 
+// Price parses a decimal price field such as "2300.0000".
 func (q Quote) Price(key string) (Price, bool) {
-	value, ok := q.Fields.Int64(key)
+	value, ok := q.Fields.lookup(key)
 	if !ok {
 		return 0, false
 	}
-	return Price(value), true
+	price, err := ParsePrice(value)
+	if err != nil {
+		return 0, false
+	}
+	return price, true
 }
 
 func (q Quote) Quantity(key string) (Quantity, bool) {
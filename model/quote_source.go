@@ -0,0 +1,10 @@
+package model
+
+import "context"
+
+// QuoteSource streams quote updates. Each batch holds the full current
+// fields of the symbols that changed since the previous batch.
+// The error channel receives at most one terminal error before closing.
+type QuoteSource interface {
+	Quotes(ctx context.Context) (<-chan []Quote, <-chan error)
+}
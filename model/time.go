@@ -0,0 +1,25 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// JST is the fixed Japan Standard Time zone used by the API.
+var JST = time.FixedZone("JST", 9*60*60)
+
+const dateLayout = "20060102"
+
+// ParseDate parses a YYYYMMDD value into midnight JST.
+func ParseDate(value string) (time.Time, error) {
+	parsed, err := time.ParseInLocation(dateLayout, value, JST)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("tachibanashi: invalid date %q", value)
+	}
+	return parsed, nil
+}
+
+// FormatDate formats t as YYYYMMDD in JST.
+func FormatDate(t time.Time) string {
+	return t.In(JST).Format(dateLayout)
+}
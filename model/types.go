@@ -1,5 +1,3 @@
 package model
 
-type Price int64
-
 type Quantity int64
@@ -0,0 +1,876 @@
+package oms
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/event"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+// BracketState is the lifecycle state of an OCO or bracket.
+type BracketState string
+
+const (
+	// BracketPending waits for the entry's first fill.
+	BracketPending BracketState = "pending"
+	// BracketActive has exit legs working for the filled quantity.
+	BracketActive BracketState = "active"
+	// BracketDone has every leg finished and the position closed.
+	BracketDone BracketState = "done"
+	// BracketOverfilled closed more than the position because both exits
+	// filled before the sibling could be cancelled; see Excess.
+	BracketOverfilled BracketState = "overfilled"
+	// BracketFailed ended with part of the position still open.
+	BracketFailed BracketState = "failed"
+)
+
+// LegRole names a leg within a bracket.
+type LegRole string
+
+const (
+	LegEntry      LegRole = "entry"
+	LegTakeProfit LegRole = "take_profit"
+	LegStopLoss   LegRole = "stop_loss"
+	LegOCO        LegRole = "oco"
+)
+
+// Leg is one order of a bracket. Order never holds the second password.
+type Leg struct {
+	Role LegRole
+	// Slot groups an exit with the exits added for later entry fills; the
+	// legs of one slot share the open position between them.
+	Slot        int
+	Order       request.NewOrder
+	OrderNumber string
+	EigyouDay   string
+	// SentAt is when the leg was sent. A leg with SentAt but neither an
+	// order number nor an error is unresolved: the send failed ambiguously
+	// and Reconcile looks for it in the order list.
+	SentAt time.Time
+	Filled model.Quantity
+	// EventFilled sums the EC executions applied to the leg, the last with
+	// LastENO. Filled is the larger of it and the last CLMOrderList
+	// cumulative fill, so executions replayed after a restart or reconcile
+	// are not counted twice.
+	EventFilled model.Quantity
+	LastENO     int64
+	Status      Status
+	Error       string
+
+	// busy is set while a router call for the leg is in flight; held after
+	// a failed cancel or correction until the bracket next changes.
+	busy bool
+	held bool
+}
+
+// fill raises Filled to a cumulative quantity known to have filled, capped
+// at the order quantity.
+func (l *Leg) fill(qty model.Quantity) {
+	l.Filled = max(l.Filled, qty)
+	if l.Order.Quantity > 0 {
+		l.Filled = min(l.Filled, l.Order.Quantity)
+	}
+}
+
+func (l *Leg) sent() bool {
+	return l.OrderNumber != ""
+}
+
+func (l *Leg) unsent() bool {
+	return !l.sent() && l.SentAt.IsZero() && l.Error == ""
+}
+
+func (l *Leg) unresolved() bool {
+	return !l.sent() && !l.SentAt.IsZero() && l.Error == ""
+}
+
+// done reports whether the leg will not fill further.
+func (l *Leg) done() bool {
+	return l.Status.Terminal() || (!l.sent() && l.Error != "")
+}
+
+// Bracket is an OCO pair or an entry with take-profit and stop-loss exits.
+type Bracket struct {
+	ID    string
+	State BracketState
+	// Entry is nil for OCO.
+	Entry *Leg
+	Exits []*Leg
+	// Position is the quantity the exits close: the OCO quantity, or the
+	// entry's filled quantity so far.
+	Position model.Quantity
+	// Covered is the part of Position exits have been added for.
+	Covered model.Quantity
+	// Excess is the quantity closed beyond Position.
+	Excess    model.Quantity
+	Cancelled bool
+	Error     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (b Bracket) clone() Bracket {
+	if b.Entry != nil {
+		entry := *b.Entry
+		b.Entry = &entry
+	}
+	exits := make([]*Leg, len(b.Exits))
+	for i, leg := range b.Exits {
+		copied := *leg
+		exits[i] = &copied
+	}
+	b.Exits = exits
+	return b
+}
+
+// addExits adds exits for qty more of the position: the first time by
+// sizing the exits given at construction, then as a new leg per slot,
+// because a correction can only reduce an order's quantity.
+func (b *Bracket) addExits(qty model.Quantity) {
+	if b.Covered == 0 {
+		for _, leg := range b.Exits {
+			if leg.unsent() {
+				leg.Order.Quantity = qty
+			}
+		}
+		return
+	}
+	slots := 0
+	for _, leg := range b.Exits {
+		slots = max(slots, leg.Slot+1)
+	}
+	for slot := 0; slot < slots && slot < len(b.Exits); slot++ {
+		template := b.Exits[slot]
+		leg := newLeg(template.Role, template.Order)
+		leg.Slot = slot
+		leg.Order.Quantity = qty
+		b.Exits = append(b.Exits, leg)
+	}
+}
+
+func (b *Bracket) legs() []*Leg {
+	if b.Entry == nil {
+		return b.Exits
+	}
+	return append([]*Leg{b.Entry}, b.Exits...)
+}
+
+// Finished reports whether the bracket needs no further management.
+func (b Bracket) Finished() bool {
+	switch b.State {
+	case BracketDone, BracketFailed:
+		return true
+	case BracketOverfilled:
+		for _, leg := range b.Exits {
+			if !leg.done() {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// NewOCO pairs two exit orders for the same symbol, side and quantity; when
+// one fills the other is resized or cancelled.
+func NewOCO(id string, first, second request.NewOrder) (Bracket, error) {
+	for _, order := range []request.NewOrder{first, second} {
+		if err := order.Validate(); err != nil {
+			return Bracket{}, err
+		}
+	}
+	if first.Symbol != second.Symbol || first.Side != second.Side || first.Quantity != second.Quantity {
+		return Bracket{}, &terrors.ValidationError{Field: "oco", Reason: "legs must share symbol, side and quantity"}
+	}
+	return Bracket{
+		ID:       idOrNew(id),
+		Exits:    []*Leg{newLeg(LegOCO, first), newLeg(LegOCO, second)},
+		Position: first.Quantity,
+	}, nil
+}
+
+// NewBracket sends entry first and, from its first fill, a take-profit and
+// a stop-loss sized to the entry's filled quantity. Later entry fills add
+// a further take-profit and stop-loss for the new quantity. The exit
+// quantities given here are ignored.
+func NewBracket(id string, entry, takeProfit, stopLoss request.NewOrder) (Bracket, error) {
+	if err := entry.Validate(); err != nil {
+		return Bracket{}, err
+	}
+	exitSide := request.SideSell
+	if entry.Side == request.SideSell {
+		exitSide = request.SideBuy
+	}
+	for _, exit := range []request.NewOrder{takeProfit, stopLoss} {
+		exit.Quantity = entry.Quantity
+		if err := exit.Validate(); err != nil {
+			return Bracket{}, err
+		}
+		if exit.Symbol != entry.Symbol || exit.Side != exitSide {
+			return Bracket{}, &terrors.ValidationError{Field: "bracket", Reason: "exits must close the entry symbol on the opposite side"}
+		}
+	}
+	return Bracket{
+		ID:    idOrNew(id),
+		Entry: newLeg(LegEntry, entry),
+		Exits: []*Leg{newLeg(LegTakeProfit, takeProfit), newLeg(LegStopLoss, stopLoss)},
+	}, nil
+}
+
+func newLeg(role LegRole, order request.NewOrder) *Leg {
+	order.SecondPassword = ""
+	return &Leg{Role: role, Order: order}
+}
+
+func idOrNew(id string) string {
+	if id = strings.TrimSpace(id); id != "" {
+		return id
+	}
+	return NewClientID()
+}
+
+// BracketStore persists brackets keyed by ID.
+type BracketStore interface {
+	Save(bracket Bracket) error
+	All() ([]Bracket, error)
+}
+
+type MemoryBracketStore struct {
+	mu       sync.Mutex
+	brackets map[string]Bracket
+}
+
+func NewMemoryBracketStore() *MemoryBracketStore {
+	return &MemoryBracketStore{brackets: make(map[string]Bracket)}
+}
+
+func (s *MemoryBracketStore) Save(bracket Bracket) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.brackets[bracket.ID] = bracket.clone()
+	return nil
+}
+
+func (s *MemoryBracketStore) All() ([]Bracket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedBrackets(s.brackets), nil
+}
+
+// FileBracketStore keeps brackets in a JSON file rewritten on every Save.
+type FileBracketStore struct {
+	path string
+
+	mu       sync.Mutex
+	brackets map[string]Bracket
+}
+
+// NewFileBracketStore loads path if it exists.
+func NewFileBracketStore(path string) (*FileBracketStore, error) {
+	s := &FileBracketStore{path: path, brackets: make(map[string]Bracket)}
+	var brackets []Bracket
+	if _, err := readJSON(path, &brackets); err != nil {
+		return nil, err
+	}
+	for _, bracket := range brackets {
+		s.brackets[bracket.ID] = bracket
+	}
+	return s, nil
+}
+
+func (s *FileBracketStore) Save(bracket Bracket) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, had := s.brackets[bracket.ID]
+	s.brackets[bracket.ID] = bracket.clone()
+	if err := writeJSON(s.path, sortedBrackets(s.brackets)); err != nil {
+		if had {
+			s.brackets[bracket.ID] = previous
+		} else {
+			delete(s.brackets, bracket.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *FileBracketStore) All() ([]Bracket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedBrackets(s.brackets), nil
+}
+
+func sortedBrackets(brackets map[string]Bracket) []Bracket {
+	out := make([]Bracket, 0, len(brackets))
+	for _, bracket := range brackets {
+		out = append(out, bracket.clone())
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// OrderRouter sends, corrects and cancels orders. *request.Service and
+// *risk.Gate satisfy it.
+type OrderRouter interface {
+	KabuNewOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error)
+	KabuCorrectOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error)
+	KabuCancelOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error)
+}
+
+// OrderLister lists orders. *request.Service satisfies it.
+type OrderLister interface {
+	OrderList(ctx context.Context, params request.OrderParams) (*request.OrderListResponse, error)
+}
+
+// Orchestrator runs OCO and bracket orders client-side. Legs are sent with
+// KabuNewOrder; EC fills shrink or cancel the sibling exits.
+type Orchestrator struct {
+	router         OrderRouter
+	store          BracketStore
+	secondPassword string
+	now            func() time.Time
+
+	mu       sync.Mutex
+	brackets map[string]*Bracket
+	orders   map[string]string // sOrderNumber -> bracket ID
+}
+
+type BracketOption func(*Orchestrator)
+
+// WithBracketStore persists brackets in store (default: in memory).
+func WithBracketStore(store BracketStore) BracketOption {
+	return func(o *Orchestrator) {
+		if store != nil {
+			o.store = store
+		}
+	}
+}
+
+// WithSecondPassword sets sSecondPassword for every leg, correction and
+// cancel. It is never persisted.
+func WithSecondPassword(password string) BracketOption {
+	return func(o *Orchestrator) {
+		o.secondPassword = password
+	}
+}
+
+func withBracketClock(now func() time.Time) BracketOption {
+	return func(o *Orchestrator) {
+		o.now = now
+	}
+}
+
+func NewOrchestrator(router OrderRouter, opts ...BracketOption) *Orchestrator {
+	o := &Orchestrator{
+		router:   router,
+		store:    NewMemoryBracketStore(),
+		now:      time.Now,
+		brackets: make(map[string]*Bracket),
+		orders:   make(map[string]string),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	return o
+}
+
+// Restore loads unfinished brackets from the store, e.g. after a restart.
+// Call Reconcile afterwards to pick up fills missed while down.
+func (o *Orchestrator) Restore() error {
+	brackets, err := o.store.All()
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, bracket := range brackets {
+		if bracket.Finished() {
+			continue
+		}
+		b := bracket.clone()
+		o.track(&b)
+	}
+	return nil
+}
+
+// Submit persists b and sends its first legs.
+func (o *Orchestrator) Submit(ctx context.Context, b Bracket) (Bracket, error) {
+	if len(b.Exits) == 0 {
+		return Bracket{}, &terrors.ValidationError{Field: "bracket", Reason: "no exit legs"}
+	}
+	o.mu.Lock()
+	if _, ok := o.brackets[b.ID]; ok {
+		o.mu.Unlock()
+		return Bracket{}, &terrors.ValidationError{Field: "bracket", Reason: "duplicate id: " + b.ID}
+	}
+
+	bracket := b.clone()
+	now := o.now()
+	bracket.CreatedAt, bracket.UpdatedAt = now, now
+	bracket.State = BracketPending
+	if bracket.Entry == nil {
+		bracket.State = BracketActive
+	}
+	for i, leg := range bracket.Exits {
+		leg.Slot = i
+	}
+	o.track(&bracket)
+	if err := o.store.Save(bracket); err != nil {
+		delete(o.brackets, bracket.ID)
+		o.mu.Unlock()
+		return Bracket{}, err
+	}
+	actions, err := o.settle(&bracket)
+	o.mu.Unlock()
+
+	err = errors.Join(err, o.run(ctx, actions))
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return bracket.clone(), err
+}
+
+// Cancel cancels every working leg of the bracket. No exits are sent for
+// an entry cancelled before it filled; exits already working are
+// cancelled too.
+func (o *Orchestrator) Cancel(ctx context.Context, id string) (Bracket, error) {
+	o.mu.Lock()
+	bracket, ok := o.brackets[id]
+	if !ok {
+		o.mu.Unlock()
+		return Bracket{}, &terrors.ValidationError{Field: "bracket", Reason: "unknown id: " + id}
+	}
+	bracket.Cancelled = true
+	actions, err := o.change(bracket)
+	o.mu.Unlock()
+
+	err = errors.Join(err, o.run(ctx, actions))
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return bracket.clone(), err
+}
+
+// Apply handles an EC event for a tracked leg and reports whether it was
+// used. p_ENO values at or below the leg's LastENO, e.g. the day's events
+// replayed after a restart, are ignored.
+func (o *Orchestrator) Apply(ctx context.Context, ev event.Event) (bool, error) {
+	ec, ok := ev.(event.EC)
+	if !ok {
+		return false, nil
+	}
+	o.mu.Lock()
+	bracket, leg := o.lookup(strings.TrimSpace(ec.OrderNumber))
+	if leg == nil {
+		o.mu.Unlock()
+		return false, nil
+	}
+	if eno, err := strconv.ParseInt(strings.TrimSpace(ec.EventNo), 10, 64); err == nil {
+		if leg.LastENO > 0 && eno <= leg.LastENO {
+			o.mu.Unlock()
+			return false, nil
+		}
+		leg.LastENO = eno
+	}
+	if exec, ok := ec.Execution(); ok && exec.Quantity > 0 {
+		leg.EventFilled += exec.Quantity
+		leg.fill(leg.EventFilled)
+	}
+	o.setStatus(leg, StatusFromCode(ec.OrderStatus))
+	actions, err := o.change(bracket)
+	o.mu.Unlock()
+
+	return true, errors.Join(err, o.run(ctx, actions))
+}
+
+// Watch applies events until the channel closes or ctx is done. Errors
+// from sending or cancelling legs are passed to onError, which may be nil.
+func (o *Orchestrator) Watch(ctx context.Context, events <-chan event.Event, onError func(error)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if _, err := o.Apply(ctx, ev); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Reconcile raises leg fills to the CLMOrderList cumulative fill and takes
+// its statuses, e.g. after Restore or an event reconnect, and acts on any
+// change. Legs whose send
+// failed ambiguously are matched to the list with MatchOrder; one still
+// missing after the match window is treated as never placed, and an exit
+// is sent again.
+func (o *Orchestrator) Reconcile(ctx context.Context, lister OrderLister) error {
+	resp, err := lister.OrderList(ctx, request.OrderParams{})
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	touched := make(map[string]*Bracket)
+	for _, entry := range resp.Entries {
+		bracket, leg := o.lookup(entry.OrderID)
+		if leg == nil {
+			continue
+		}
+		o.refresh(leg, entry)
+		touched[bracket.ID] = bracket
+	}
+	now := o.now()
+	taken := func(number string) bool {
+		_, ok := o.orders[number]
+		return ok
+	}
+	for _, bracket := range o.brackets {
+		for _, leg := range bracket.legs() {
+			if !leg.unresolved() || leg.busy {
+				continue
+			}
+			entry, found := MatchOrder(resp.Entries, leg.Order, leg.SentAt, defaultMatchWindow, taken)
+			switch {
+			case found:
+				leg.OrderNumber = entry.OrderID
+				leg.EigyouDay = strings.TrimSpace(entry.Fields.Value("sOrderSikkouDay"))
+				leg.Status = StatusPending
+				o.orders[leg.OrderNumber] = bracket.ID
+				o.refresh(leg, entry)
+			case now.Sub(leg.SentAt) < defaultMatchWindow:
+				continue
+			case leg == bracket.Entry:
+				o.reject(bracket, leg, "not found in the order list")
+			default:
+				leg.SentAt = time.Time{}
+			}
+			touched[bracket.ID] = bracket
+		}
+	}
+	var (
+		actions []legAction
+		errs    []error
+	)
+	for _, bracket := range touched {
+		more, err := o.change(bracket)
+		actions = append(actions, more...)
+		errs = append(errs, err)
+	}
+	o.mu.Unlock()
+
+	errs = append(errs, o.run(ctx, actions))
+	return errors.Join(errs...)
+}
+
+// Bracket returns the current state of one bracket.
+func (o *Orchestrator) Bracket(id string) (Bracket, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	bracket, ok := o.brackets[id]
+	if !ok {
+		return Bracket{}, false
+	}
+	return bracket.clone(), true
+}
+
+// Brackets returns every tracked bracket.
+func (o *Orchestrator) Brackets() []Bracket {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	out := make([]Bracket, 0, len(o.brackets))
+	for _, bracket := range o.brackets {
+		out = append(out, bracket.clone())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+func (o *Orchestrator) track(b *Bracket) {
+	o.brackets[b.ID] = b
+	for _, leg := range b.legs() {
+		if leg.sent() {
+			o.orders[leg.OrderNumber] = b.ID
+		}
+	}
+}
+
+func (o *Orchestrator) lookup(orderNumber string) (*Bracket, *Leg) {
+	id, ok := o.orders[orderNumber]
+	if !ok {
+		return nil, nil
+	}
+	bracket := o.brackets[id]
+	for _, leg := range bracket.legs() {
+		if leg.OrderNumber == orderNumber {
+			return bracket, leg
+		}
+	}
+	return nil, nil
+}
+
+func (o *Orchestrator) refresh(leg *Leg, entry request.OrderEntry) {
+	if filled, ok := parseQuantity(entry.Fields.Value("sOrderYakuzyouSuryo")); ok {
+		leg.fill(filled)
+	}
+	o.setStatus(leg, StatusFromCode(entry.Fields.Value("sOrderStatusCode")))
+}
+
+func (o *Orchestrator) setStatus(leg *Leg, status Status) {
+	if leg.Order.Quantity > 0 && leg.Filled >= leg.Order.Quantity {
+		status = StatusFilled
+	}
+	if status == StatusUnknown || leg.Status.Terminal() {
+		return
+	}
+	leg.Status = status
+}
+
+func (o *Orchestrator) reject(b *Bracket, leg *Leg, reason string) {
+	leg.Error = reason
+	leg.Status = StatusRejected
+	if leg == b.Entry {
+		b.State = BracketFailed
+		b.Error = reason
+	}
+}
+
+// change settles b after a fill, status change or cancel request, first
+// allowing failed cancels and corrections to be retried. o.mu must be
+// held.
+func (o *Orchestrator) change(b *Bracket) ([]legAction, error) {
+	for _, leg := range b.legs() {
+		leg.held = false
+	}
+	return o.settle(b)
+}
+
+type actionKind int
+
+const (
+	actionSend actionKind = iota
+	actionCancel
+	actionResize
+)
+
+// legAction is a router call planned under o.mu and made without it.
+type legAction struct {
+	kind    actionKind
+	bracket *Bracket
+	leg     *Leg
+	qty     model.Quantity
+	params  request.OrderParams
+}
+
+// settle acts on the bracket's current fills, persists it and returns the
+// router calls to make. o.mu must be held.
+func (o *Orchestrator) settle(b *Bracket) ([]legAction, error) {
+	var (
+		actions []legAction
+		errs    []error
+	)
+	plan := func(kind actionKind, leg *Leg, qty model.Quantity) {
+		action, err := o.plan(kind, b, leg, qty)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		actions = append(actions, action)
+	}
+
+	if b.Cancelled {
+		for _, leg := range b.legs() {
+			if leg.sent() && !leg.done() && !leg.busy && !leg.held && leg.Status != StatusCancelling {
+				plan(actionCancel, leg, 0)
+			}
+		}
+	}
+
+	if entry := b.Entry; entry != nil && (b.State == BracketPending || b.State == BracketActive) {
+		b.Position = max(b.Position, entry.Filled)
+		switch {
+		case b.State != BracketPending:
+		case entry.unsent():
+			plan(actionSend, entry, entry.Order.Quantity)
+		case b.Position > 0 && !b.Cancelled:
+			b.State = BracketActive
+		case !entry.done():
+		case b.Position == 0:
+			b.State = BracketDone
+		default:
+			b.State = BracketFailed
+			b.Error = "cancelled with " + strconv.FormatInt(int64(b.Position), 10) + " filled and no exits"
+		}
+	}
+
+	if b.State == BracketActive && !b.Cancelled && b.Position > b.Covered {
+		b.addExits(b.Position - b.Covered)
+		b.Covered = b.Position
+	}
+
+	if b.State == BracketActive || b.State == BracketOverfilled {
+		var filled model.Quantity
+		for _, leg := range b.Exits {
+			filled += leg.Filled
+		}
+		remaining := b.Position - filled
+		if remaining < 0 {
+			b.State = BracketOverfilled
+			b.Excess = -remaining
+			remaining = 0
+		}
+		// Each slot's open exits may close at most what remains.
+		budgets := make(map[int]model.Quantity)
+		allDone := b.Entry == nil || b.Entry.done()
+		for _, leg := range b.Exits {
+			if leg.done() {
+				continue
+			}
+			budget, ok := budgets[leg.Slot]
+			if !ok {
+				budget = remaining
+			}
+			open := leg.Order.Quantity - leg.Filled
+			allowed := min(open, budget)
+			budgets[leg.Slot] = budget - allowed
+			if leg.unsent() && (allowed == 0 || b.Cancelled) {
+				leg.Status = StatusCancelled
+				continue
+			}
+			allDone = false
+			switch {
+			case leg.busy || leg.held || leg.Status == StatusCancelling || b.Cancelled:
+			case leg.unsent():
+				plan(actionSend, leg, allowed)
+			case !leg.sent():
+				// Unresolved: it may be working, so it keeps its share until
+				// Reconcile finds it.
+			case allowed == 0:
+				plan(actionCancel, leg, 0)
+			case allowed < open:
+				plan(actionResize, leg, leg.Filled+allowed)
+			}
+		}
+		if allDone && b.State == BracketActive {
+			if remaining == 0 {
+				b.State = BracketDone
+			} else {
+				b.State = BracketFailed
+				b.Error = strconv.FormatInt(int64(remaining), 10) + " left open after every exit ended"
+			}
+		}
+	}
+	errs = append(errs, o.save(b))
+	return actions, errors.Join(errs...)
+}
+
+// plan builds the parameters for a router call on leg and marks the leg
+// busy until the result is recorded.
+func (o *Orchestrator) plan(kind actionKind, b *Bracket, leg *Leg, qty model.Quantity) (legAction, error) {
+	action := legAction{kind: kind, bracket: b, leg: leg, qty: qty}
+	var err error
+	switch kind {
+	case actionSend:
+		leg.Order.Quantity = qty
+		order := leg.Order
+		order.SecondPassword = o.secondPassword
+		if action.params, err = order.ToParams(); err != nil {
+			o.reject(b, leg, err.Error())
+			return legAction{}, err
+		}
+		leg.SentAt = o.now()
+	case actionCancel:
+		action.params = request.CancelParams(leg.OrderNumber, leg.EigyouDay, o.secondPassword)
+	case actionResize:
+		action.params, err = request.Correction{
+			OrderNumber:    leg.OrderNumber,
+			EigyouDay:      leg.EigyouDay,
+			Quantity:       qty,
+			SecondPassword: o.secondPassword,
+		}.ToParams()
+		if err != nil {
+			leg.Error = err.Error()
+			leg.held = true
+			return legAction{}, err
+		}
+	}
+	leg.busy = true
+	return action, nil
+}
+
+// run makes the planned router calls without holding o.mu, records each
+// result and settles the bracket again, which may plan further calls.
+func (o *Orchestrator) run(ctx context.Context, actions []legAction) error {
+	var errs []error
+	for len(actions) > 0 {
+		action := actions[0]
+		actions = actions[1:]
+
+		var (
+			resp *request.OrderResponse
+			err  error
+		)
+		switch action.kind {
+		case actionSend:
+			resp, err = o.router.KabuNewOrder(ctx, action.params)
+		case actionCancel:
+			_, err = o.router.KabuCancelOrder(ctx, action.params)
+		case actionResize:
+			_, err = o.router.KabuCorrectOrder(ctx, action.params)
+		}
+
+		o.mu.Lock()
+		o.record(action, resp, err)
+		more, settleErr := o.settle(action.bracket)
+		o.mu.Unlock()
+		actions = append(actions, more...)
+		errs = append(errs, err, settleErr)
+	}
+	return errors.Join(errs...)
+}
+
+// record applies the result of a router call. o.mu must be held.
+func (o *Orchestrator) record(action legAction, resp *request.OrderResponse, err error) {
+	leg := action.leg
+	leg.busy = false
+	switch {
+	case err == nil && action.kind == actionSend:
+		leg.OrderNumber = strings.TrimSpace(resp.OrderNumber)
+		leg.EigyouDay = strings.TrimSpace(resp.EigyouDay)
+		leg.Status = StatusPending
+		o.orders[leg.OrderNumber] = action.bracket.ID
+	case err == nil && action.kind == actionCancel:
+		if !leg.done() {
+			leg.Status = StatusCancelling
+		}
+	case err == nil:
+		leg.Order.Quantity = action.qty
+	case action.kind == actionSend && Ambiguous(err):
+		// The order may be working; Reconcile resolves it.
+	case action.kind == actionSend:
+		o.reject(action.bracket, leg, err.Error())
+	default:
+		leg.Error = err.Error()
+		leg.held = true
+	}
+}
+
+func (o *Orchestrator) save(b *Bracket) error {
+	b.UpdatedAt = o.now()
+	return o.store.Save(*b)
+}
@@ -0,0 +1,290 @@
+package oms
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+type mockRouter struct {
+	next      int
+	placed    []request.OrderParams
+	corrected []request.OrderParams
+	cancelled []request.OrderParams
+	cancelErr error
+	newErr    error
+	onSend    func()
+}
+
+func (m *mockRouter) KabuNewOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error) {
+	m.placed = append(m.placed, params)
+	if m.onSend != nil {
+		m.onSend()
+	}
+	if err := m.newErr; err != nil {
+		m.newErr = nil
+		return nil, err
+	}
+	m.next++
+	return &request.OrderResponse{OrderNumber: strconv.Itoa(100 + m.next), EigyouDay: "20240603"}, nil
+}
+
+func (m *mockRouter) KabuCorrectOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error) {
+	m.corrected = append(m.corrected, params)
+	return &request.OrderResponse{}, nil
+}
+
+func (m *mockRouter) KabuCancelOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error) {
+	m.cancelled = append(m.cancelled, params)
+	return &request.OrderResponse{}, m.cancelErr
+}
+
+func exitOrders() (request.NewOrder, request.NewOrder) {
+	takeProfit := request.LimitSell("6501", request.MarketTSE, model.Yen(3300), 300)
+	stopLoss := request.MarketSell("6501", request.MarketTSE, 300).
+		WithStop(request.StopOrder{Type: request.StopOnly, Trigger: model.Yen(2900)})
+	return takeProfit, stopLoss
+}
+
+func testOCO(t *testing.T, router *mockRouter, opts ...BracketOption) (*Orchestrator, Bracket) {
+	t.Helper()
+	takeProfit, stopLoss := exitOrders()
+	oco, err := NewOCO("b1", takeProfit, stopLoss)
+	if err != nil {
+		t.Fatalf("NewOCO() error = %v", err)
+	}
+	orchestrator := NewOrchestrator(router, append([]BracketOption{withBracketClock(fixedClock())}, opts...)...)
+	bracket, err := orchestrator.Submit(context.Background(), oco)
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	return orchestrator, bracket
+}
+
+func TestOCOPartialFillResizesSibling(t *testing.T) {
+	router := &mockRouter{}
+	orchestrator, bracket := testOCO(t, router, WithSecondPassword("pw"))
+	if bracket.State != BracketActive || len(router.placed) != 2 || router.placed[0]["sSecondPassword"] != "pw" {
+		t.Fatalf("bracket = %+v, placed = %v", bracket, router.placed)
+	}
+	if bracket.Exits[0].Order.SecondPassword != "" {
+		t.Fatalf("second password persisted")
+	}
+
+	ctx := context.Background()
+	if _, err := orchestrator.Apply(ctx, execEvent("1", "101", "9", "3300", "100")); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(router.corrected) != 1 || router.corrected[0]["sOrderNumber"] != "102" || router.corrected[0]["sOrderSuryou"] != "200" {
+		t.Fatalf("corrected = %v", router.corrected)
+	}
+
+	if _, err := orchestrator.Apply(ctx, execEvent("2", "101", "10", "3300", "200")); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(router.cancelled) != 1 || router.cancelled[0]["sOrderNumber"] != "102" {
+		t.Fatalf("cancelled = %v", router.cancelled)
+	}
+	if _, err := orchestrator.Apply(ctx, execEvent("3", "102", "7", "", "")); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	bracket, _ = orchestrator.Bracket("b1")
+	if bracket.State != BracketDone || bracket.Excess != 0 {
+		t.Fatalf("bracket = %+v", bracket)
+	}
+}
+
+func TestOCOBothLegsFill(t *testing.T) {
+	router := &mockRouter{cancelErr: errors.New("already filled")}
+	orchestrator, _ := testOCO(t, router)
+
+	ctx := context.Background()
+	if _, err := orchestrator.Apply(ctx, execEvent("1", "101", "10", "3300", "300")); err == nil {
+		t.Fatalf("Apply() expected cancel error")
+	}
+	if _, err := orchestrator.Apply(ctx, execEvent("2", "102", "10", "2890", "300")); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	bracket, _ := orchestrator.Bracket("b1")
+	if bracket.State != BracketOverfilled || bracket.Excess != 300 || !bracket.Finished() {
+		t.Fatalf("bracket = %+v", bracket)
+	}
+}
+
+func TestApplyIgnoresDuplicateENO(t *testing.T) {
+	router := &mockRouter{}
+	orchestrator, _ := testOCO(t, router)
+
+	ctx := context.Background()
+	orchestrator.Apply(ctx, execEvent("1", "101", "9", "3300", "100"))
+	if used, _ := orchestrator.Apply(ctx, execEvent("1", "101", "9", "3300", "100")); used {
+		t.Fatalf("duplicate ENO applied")
+	}
+	bracket, _ := orchestrator.Bracket("b1")
+	if bracket.Exits[0].Filled != 100 {
+		t.Fatalf("filled = %d", bracket.Exits[0].Filled)
+	}
+}
+
+func TestBracketProtectsEachEntryFill(t *testing.T) {
+	router := &mockRouter{}
+	takeProfit, stopLoss := exitOrders()
+	entry := request.LimitBuy("6501", request.MarketTSE, model.Yen(3000), 300)
+	b, err := NewBracket("b2", entry, takeProfit, stopLoss)
+	if err != nil {
+		t.Fatalf("NewBracket() error = %v", err)
+	}
+	orchestrator := NewOrchestrator(router, withBracketClock(fixedClock()))
+	bracket, err := orchestrator.Submit(context.Background(), b)
+	if err != nil || bracket.State != BracketPending || len(router.placed) != 1 {
+		t.Fatalf("Submit() = %+v, %v", bracket, err)
+	}
+
+	// The first partial fill is protected while the entry keeps working.
+	ctx := context.Background()
+	orchestrator.Apply(ctx, execEvent("1", "101", "9", "3000", "200"))
+	bracket, _ = orchestrator.Bracket("b2")
+	if bracket.State != BracketActive || bracket.Position != 200 || len(router.placed) != 3 {
+		t.Fatalf("bracket = %+v", bracket)
+	}
+	if router.placed[1]["sOrderSuryou"] != "200" || router.placed[2]["sOrderSuryou"] != "200" {
+		t.Fatalf("placed = %v", router.placed)
+	}
+
+	// The rest of the entry gets its own pair of exits.
+	orchestrator.Apply(ctx, execEvent("2", "101", "10", "3000", "100"))
+	if len(router.placed) != 5 || router.placed[3]["sOrderSuryou"] != "100" || router.placed[4]["sOrderSuryou"] != "100" {
+		t.Fatalf("placed = %v", router.placed)
+	}
+
+	// Take-profit 102 closes 200: stop-loss 103 shrinks and 105 is cancelled.
+	orchestrator.Apply(ctx, execEvent("3", "102", "10", "3300", "200"))
+	if len(router.corrected) != 1 || router.corrected[0]["sOrderNumber"] != "103" || router.corrected[0]["sOrderSuryou"] != "100" {
+		t.Fatalf("corrected = %v", router.corrected)
+	}
+	if len(router.cancelled) != 1 || router.cancelled[0]["sOrderNumber"] != "105" {
+		t.Fatalf("cancelled = %v", router.cancelled)
+	}
+}
+
+func TestBracketResolvesAmbiguousEntry(t *testing.T) {
+	router := &mockRouter{newErr: context.DeadlineExceeded}
+	takeProfit, stopLoss := exitOrders()
+	entry := request.LimitBuy("6501", request.MarketTSE, model.Yen(3000), 100)
+	b, err := NewBracket("b3", entry, takeProfit, stopLoss)
+	if err != nil {
+		t.Fatalf("NewBracket() error = %v", err)
+	}
+	orchestrator := NewOrchestrator(router, withBracketClock(fixedClock()))
+	router.onSend = func() {
+		// The router is called without the orchestrator's lock held.
+		orchestrator.Bracket("b3")
+	}
+	bracket, err := orchestrator.Submit(context.Background(), b)
+	if err == nil || bracket.State != BracketPending || bracket.Entry.Status == StatusRejected || bracket.Entry.Error != "" {
+		t.Fatalf("Submit() = %+v, %v", bracket, err)
+	}
+
+	ctx := context.Background()
+	source := &mockSource{list: &request.OrderListResponse{Entries: []request.OrderEntry{placedEntry("5001", entry, "20240603090000")}}}
+	if err := orchestrator.Reconcile(ctx, source); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	orchestrator.Apply(ctx, execEvent("1", "5001", "10", "3000", "100"))
+	bracket, _ = orchestrator.Bracket("b3")
+	if bracket.Entry.OrderNumber != "5001" || bracket.State != BracketActive || len(router.placed) != 3 {
+		t.Fatalf("bracket = %+v, placed = %d", bracket, len(router.placed))
+	}
+}
+
+func TestNewBracketRejectsSameSideExit(t *testing.T) {
+	entry := request.LimitBuy("6501", request.MarketTSE, model.Yen(3000), 300)
+	takeProfit, _ := exitOrders()
+	if _, err := NewBracket("b", entry, takeProfit, entry); err == nil {
+		t.Fatalf("NewBracket() expected error")
+	}
+}
+
+func TestOrchestratorRestoresAndReconciles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "brackets.json")
+	store, err := NewFileBracketStore(path)
+	if err != nil {
+		t.Fatalf("NewFileBracketStore() error = %v", err)
+	}
+	testOCO(t, &mockRouter{}, WithBracketStore(store))
+
+	reopened, err := NewFileBracketStore(path)
+	if err != nil {
+		t.Fatalf("NewFileBracketStore() error = %v", err)
+	}
+	router := &mockRouter{}
+	orchestrator := NewOrchestrator(router, WithBracketStore(reopened), withBracketClock(fixedClock()))
+	if err := orchestrator.Restore(); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	source := &mockSource{list: &request.OrderListResponse{Entries: []request.OrderEntry{listEntry("101", "10", "300", "300", "3300.0000")}}}
+	if err := orchestrator.Reconcile(context.Background(), source); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(router.cancelled) != 1 || router.cancelled[0]["sOrderNumber"] != "102" {
+		t.Fatalf("cancelled = %v", router.cancelled)
+	}
+}
+
+func TestOrchestratorIgnoresReplayedFillsAfterRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "brackets.json")
+	store, err := NewFileBracketStore(path)
+	if err != nil {
+		t.Fatalf("NewFileBracketStore() error = %v", err)
+	}
+	takeProfit, stopLoss := exitOrders()
+	entry := request.LimitBuy("6501", request.MarketTSE, model.Yen(3000), 300)
+	b, err := NewBracket("b4", entry, takeProfit, stopLoss)
+	if err != nil {
+		t.Fatalf("NewBracket() error = %v", err)
+	}
+	ctx := context.Background()
+	first := NewOrchestrator(&mockRouter{}, WithBracketStore(store), withBracketClock(fixedClock()))
+	if _, err := first.Submit(ctx, b); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	first.Apply(ctx, execEvent("1", "101", "9", "3000", "100"))
+
+	// ENO 2 fills another 100 while the process is down.
+	reopened, err := NewFileBracketStore(path)
+	if err != nil {
+		t.Fatalf("NewFileBracketStore() error = %v", err)
+	}
+	router := &mockRouter{next: 10}
+	orchestrator := NewOrchestrator(router, WithBracketStore(reopened), withBracketClock(fixedClock()))
+	if err := orchestrator.Restore(); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	source := &mockSource{list: &request.OrderListResponse{Entries: []request.OrderEntry{listEntry("101", "9", "300", "200", "3000.0000")}}}
+	if err := orchestrator.Reconcile(ctx, source); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(router.placed) != 2 {
+		t.Fatalf("placed = %v", router.placed)
+	}
+
+	// The event stream replays the day from p_eno=0.
+	orchestrator.Apply(ctx, execEvent("1", "101", "9", "3000", "100"))
+	orchestrator.Apply(ctx, execEvent("2", "101", "9", "3000", "100"))
+	bracket, _ := orchestrator.Bracket("b4")
+	if bracket.Entry.Filled != 200 || bracket.Position != 200 || len(router.placed) != 2 {
+		t.Fatalf("bracket = %+v, placed = %d", bracket, len(router.placed))
+	}
+
+	// A later fill still adds exits, and fills never exceed the order.
+	orchestrator.Apply(ctx, execEvent("3", "101", "10", "3000", "500"))
+	bracket, _ = orchestrator.Bracket("b4")
+	if bracket.Entry.Filled != 300 || bracket.Position != 300 || len(router.placed) != 4 {
+		t.Fatalf("bracket = %+v, placed = %d", bracket, len(router.placed))
+	}
+}
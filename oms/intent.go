@@ -0,0 +1,183 @@
+package oms
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ueebee/tachibanashi/request"
+)
+
+// IntentState is the submission state of a client order.
+type IntentState string
+
+const (
+	// IntentPending is persisted but not yet sent.
+	IntentPending IntentState = "pending"
+	// IntentUnknown was sent and the outcome is ambiguous.
+	IntentUnknown IntentState = "unknown"
+	// IntentPlaced is mapped to an sOrderNumber.
+	IntentPlaced IntentState = "placed"
+	// IntentFailed was rejected and was not placed.
+	IntentFailed IntentState = "failed"
+)
+
+// Intent is a client order persisted before it is sent. Order never holds
+// the second password.
+type Intent struct {
+	ClientID    string
+	Order       request.NewOrder
+	State       IntentState
+	OrderNumber string
+	EigyouDay   string
+	Attempts    int
+	LastError   string
+	CreatedAt   time.Time
+	SentAt      time.Time
+	UpdatedAt   time.Time
+}
+
+// IntentStore persists intents keyed by ClientID.
+type IntentStore interface {
+	Save(intent Intent) error
+	Load(clientID string) (Intent, bool, error)
+	All() ([]Intent, error)
+}
+
+type MemoryIntentStore struct {
+	mu      sync.Mutex
+	intents map[string]Intent
+}
+
+func NewMemoryIntentStore() *MemoryIntentStore {
+	return &MemoryIntentStore{intents: make(map[string]Intent)}
+}
+
+func (s *MemoryIntentStore) Save(intent Intent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.intents[intent.ClientID] = intent
+	return nil
+}
+
+func (s *MemoryIntentStore) Load(clientID string) (Intent, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	intent, ok := s.intents[clientID]
+	return intent, ok, nil
+}
+
+func (s *MemoryIntentStore) All() ([]Intent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedIntents(s.intents), nil
+}
+
+// Prune removes placed and failed intents last updated before cutoff.
+func (s *MemoryIntentStore) Prune(cutoff time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, intent := range s.intents {
+		if prunable(intent, cutoff) {
+			delete(s.intents, id)
+		}
+	}
+	return nil
+}
+
+// FileIntentStore keeps intents in a JSON file that is rewritten atomically
+// on every Save, so an intent survives a crash between persist and send.
+type FileIntentStore struct {
+	path string
+
+	mu      sync.Mutex
+	intents map[string]Intent
+}
+
+// NewFileIntentStore loads path if it exists.
+func NewFileIntentStore(path string) (*FileIntentStore, error) {
+	s := &FileIntentStore{path: path, intents: make(map[string]Intent)}
+	var intents []Intent
+	if _, err := readJSON(path, &intents); err != nil {
+		return nil, err
+	}
+	for _, intent := range intents {
+		s.intents[intent.ClientID] = intent
+	}
+	return s, nil
+}
+
+func (s *FileIntentStore) Save(intent Intent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, had := s.intents[intent.ClientID]
+	s.intents[intent.ClientID] = intent
+	if err := s.writeLocked(); err != nil {
+		if had {
+			s.intents[intent.ClientID] = previous
+		} else {
+			delete(s.intents, intent.ClientID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *FileIntentStore) Load(clientID string) (Intent, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	intent, ok := s.intents[clientID]
+	return intent, ok, nil
+}
+
+func (s *FileIntentStore) All() ([]Intent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedIntents(s.intents), nil
+}
+
+// Prune removes placed and failed intents last updated before cutoff and
+// rewrites the file. Pending and unknown intents are kept until resolved.
+func (s *FileIntentStore) Prune(cutoff time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := make(map[string]Intent)
+	for id, intent := range s.intents {
+		if prunable(intent, cutoff) {
+			removed[id] = intent
+			delete(s.intents, id)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	if err := s.writeLocked(); err != nil {
+		for id, intent := range removed {
+			s.intents[id] = intent
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *FileIntentStore) writeLocked() error {
+	return writeJSON(s.path, sortedIntents(s.intents))
+}
+
+func prunable(intent Intent, cutoff time.Time) bool {
+	return (intent.State == IntentPlaced || intent.State == IntentFailed) && intent.UpdatedAt.Before(cutoff)
+}
+
+func sortedIntents(intents map[string]Intent) []Intent {
+	out := make([]Intent, 0, len(intents))
+	for _, intent := range intents {
+		out = append(out, intent)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ClientID < out[j].ClientID
+	})
+	return out
+}
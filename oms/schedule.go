@@ -0,0 +1,544 @@
+package oms
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ueebee/tachibanashi/calendar"
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+	"github.com/ueebee/tachibanashi/session"
+)
+
+// DefaultMaxLateness is how late a wall-clock schedule may be released,
+// e.g. after a restart, before it expires instead.
+const DefaultMaxLateness = time.Minute
+
+// ScheduleState is the release state of a scheduled order.
+type ScheduleState string
+
+const (
+	// SchedulePending waits for its trigger.
+	SchedulePending ScheduleState = "pending"
+	// ScheduleSending is persisted just before the order is sent.
+	ScheduleSending ScheduleState = "sending"
+	// ScheduleReleased was accepted and is mapped to an sOrderNumber.
+	ScheduleReleased ScheduleState = "released"
+	// ScheduleUnknown was being sent when the process stopped, or the send
+	// failed ambiguously. Check the order list before sending it again.
+	ScheduleUnknown   ScheduleState = "unknown"
+	ScheduleFailed    ScheduleState = "failed"
+	ScheduleCancelled ScheduleState = "cancelled"
+	// ScheduleSkipped was due on a non-business day.
+	ScheduleSkipped ScheduleState = "skipped"
+	// ScheduleExpired was due more than the maximum lateness ago.
+	ScheduleExpired ScheduleState = "expired"
+)
+
+// Trigger releases a schedule at a wall-clock time or when a market session
+// moves into a status or phase. Session triggers fire only on transitions
+// seen while running, not for a session already in that state.
+type Trigger struct {
+	At      time.Time
+	Market  string
+	Product string
+	// Status is the sUnyouStatus / p_US code to wait for, e.g. "220"
+	// (後場立会開始).
+	Status string
+	Phase  session.Phase
+}
+
+// AtTime releases at t.
+func AtTime(t time.Time) Trigger {
+	return Trigger{At: t.In(model.JST)}
+}
+
+// OnSessionStatus releases when market and product move to status.
+func OnSessionStatus(market, product, status string) Trigger {
+	return Trigger{Market: market, Product: product, Status: status}
+}
+
+// OnSessionPhase releases when market and product enter phase.
+func OnSessionPhase(market, product string, phase session.Phase) Trigger {
+	return Trigger{Market: market, Product: product, Phase: phase}
+}
+
+func (t Trigger) session() bool {
+	return t.At.IsZero()
+}
+
+func (t Trigger) matches(change session.Change) bool {
+	current, previous := change.Current, change.Previous
+	if current.Market != strings.TrimSpace(t.Market) || current.Product != strings.TrimSpace(t.Product) {
+		return false
+	}
+	// Seeding a session is not a transition.
+	if previous.Status == "" {
+		return false
+	}
+	if t.Status != "" {
+		return current.Status == strings.TrimSpace(t.Status) && previous.Status != current.Status
+	}
+	return current.Phase == t.Phase && previous.Phase != current.Phase
+}
+
+func (t Trigger) validate() error {
+	if !t.At.IsZero() {
+		return nil
+	}
+	if strings.TrimSpace(t.Market) == "" {
+		return &terrors.ValidationError{Field: "market", Reason: "required for session triggers"}
+	}
+	if strings.TrimSpace(t.Status) == "" && t.Phase == session.PhaseUnknown {
+		return &terrors.ValidationError{Field: "trigger", Reason: "set a time, status or phase"}
+	}
+	return nil
+}
+
+// Schedule is an order held until its trigger. Params never holds the
+// second password.
+type Schedule struct {
+	ID          string
+	Params      request.OrderParams
+	Trigger     Trigger
+	State       ScheduleState
+	OrderNumber string
+	EigyouDay   string
+	Error       string
+	CreatedAt   time.Time
+	ReleasedAt  time.Time
+	UpdatedAt   time.Time
+}
+
+// Finished reports whether the schedule will not be sent.
+func (s Schedule) Finished() bool {
+	return s.State != SchedulePending && s.State != ScheduleSending
+}
+
+// ScheduleStore persists schedules keyed by ID.
+type ScheduleStore interface {
+	Save(schedule Schedule) error
+	All() ([]Schedule, error)
+}
+
+type MemoryScheduleStore struct {
+	mu        sync.Mutex
+	schedules map[string]Schedule
+}
+
+func NewMemoryScheduleStore() *MemoryScheduleStore {
+	return &MemoryScheduleStore{schedules: make(map[string]Schedule)}
+}
+
+func (s *MemoryScheduleStore) Save(schedule Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedules[schedule.ID] = schedule
+	return nil
+}
+
+func (s *MemoryScheduleStore) All() ([]Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedSchedules(s.schedules), nil
+}
+
+// FileScheduleStore keeps schedules in a JSON file rewritten on every Save.
+type FileScheduleStore struct {
+	path string
+
+	mu        sync.Mutex
+	schedules map[string]Schedule
+}
+
+// NewFileScheduleStore loads path if it exists.
+func NewFileScheduleStore(path string) (*FileScheduleStore, error) {
+	s := &FileScheduleStore{path: path, schedules: make(map[string]Schedule)}
+	var schedules []Schedule
+	if _, err := readJSON(path, &schedules); err != nil {
+		return nil, err
+	}
+	for _, schedule := range schedules {
+		s.schedules[schedule.ID] = schedule
+	}
+	return s, nil
+}
+
+func (s *FileScheduleStore) Save(schedule Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, had := s.schedules[schedule.ID]
+	s.schedules[schedule.ID] = schedule
+	if err := writeJSON(s.path, sortedSchedules(s.schedules)); err != nil {
+		if had {
+			s.schedules[schedule.ID] = previous
+		} else {
+			delete(s.schedules, schedule.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *FileScheduleStore) All() ([]Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedSchedules(s.schedules), nil
+}
+
+func sortedSchedules(schedules map[string]Schedule) []Schedule {
+	out := make([]Schedule, 0, len(schedules))
+	for _, schedule := range schedules {
+		out = append(out, schedule)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// OrderSender sends raw order params. *request.Service and *risk.Gate
+// satisfy it.
+type OrderSender interface {
+	KabuNewOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error)
+}
+
+// Scheduler holds orders and releases them at JST wall-clock times or on
+// market session transitions. Nothing is sent on days the calendar marks
+// as holidays.
+type Scheduler struct {
+	sender         OrderSender
+	sessions       *session.Tracker
+	calendar       *calendar.Calendar
+	store          ScheduleStore
+	secondPassword string
+	maxLateness    time.Duration
+	now            func() time.Time
+
+	mu        sync.Mutex
+	schedules map[string]Schedule
+	wake      chan struct{}
+}
+
+type ScheduleOption func(*Scheduler)
+
+// WithScheduleStore persists schedules in store (default: in memory).
+func WithScheduleStore(store ScheduleStore) ScheduleOption {
+	return func(s *Scheduler) {
+		if store != nil {
+			s.store = store
+		}
+	}
+}
+
+// WithScheduleSecondPassword sets sSecondPassword for released orders. It
+// is never persisted.
+func WithScheduleSecondPassword(password string) ScheduleOption {
+	return func(s *Scheduler) {
+		s.secondPassword = password
+	}
+}
+
+// WithMaxLateness sets how late a wall-clock schedule may still be
+// released (default DefaultMaxLateness).
+func WithMaxLateness(d time.Duration) ScheduleOption {
+	return func(s *Scheduler) {
+		if d > 0 {
+			s.maxLateness = d
+		}
+	}
+}
+
+func withScheduleClock(now func() time.Time) ScheduleOption {
+	return func(s *Scheduler) {
+		s.now = now
+	}
+}
+
+// NewScheduler releases orders through sender. sessions may be nil when
+// only wall-clock triggers are used; cal is required.
+func NewScheduler(sender OrderSender, sessions *session.Tracker, cal *calendar.Calendar, opts ...ScheduleOption) *Scheduler {
+	s := &Scheduler{
+		sender:      sender,
+		sessions:    sessions,
+		calendar:    cal,
+		store:       NewMemoryScheduleStore(),
+		maxLateness: DefaultMaxLateness,
+		now:         time.Now,
+		schedules:   make(map[string]Schedule),
+		wake:        make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	return s
+}
+
+// Restore loads schedules from the store. Schedules that were being sent
+// when the process stopped become ScheduleUnknown rather than being sent
+// again.
+func (s *Scheduler) Restore() error {
+	schedules, err := s.store.All()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, schedule := range schedules {
+		if schedule.State == ScheduleSending {
+			schedule.State = ScheduleUnknown
+			schedule.UpdatedAt = s.now()
+			errs = append(errs, s.store.Save(schedule))
+		}
+		s.schedules[schedule.ID] = schedule
+	}
+	s.signal()
+	return errors.Join(errs...)
+}
+
+// Add persists an order to release on trigger. An empty id is generated.
+func (s *Scheduler) Add(id string, params request.OrderParams, trigger Trigger) (Schedule, error) {
+	if err := trigger.validate(); err != nil {
+		return Schedule{}, err
+	}
+	if trigger.session() && s.sessions == nil {
+		return Schedule{}, &terrors.ValidationError{Field: "trigger", Reason: "session triggers need a session tracker"}
+	}
+	if !trigger.session() && s.calendar != nil && !s.calendar.IsBusinessDay(trigger.At) {
+		return Schedule{}, &terrors.ValidationError{Field: "trigger", Reason: "not a business day: " + model.FormatDate(trigger.At.In(model.JST))}
+	}
+	id = idOrNew(id)
+	stored := cloneParams(params)
+	delete(stored, "sSecondPassword")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.schedules[id]; ok {
+		return Schedule{}, &terrors.ValidationError{Field: "id", Reason: "duplicate: " + id}
+	}
+	now := s.now()
+	schedule := Schedule{
+		ID:        id,
+		Params:    stored,
+		Trigger:   trigger,
+		State:     SchedulePending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.store.Save(schedule); err != nil {
+		return Schedule{}, err
+	}
+	s.schedules[id] = schedule
+	s.signal()
+	return schedule, nil
+}
+
+// Cancel withdraws a pending schedule.
+func (s *Scheduler) Cancel(id string) (Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schedule, ok := s.schedules[id]
+	if !ok {
+		return Schedule{}, &terrors.ValidationError{Field: "id", Reason: "unknown: " + id}
+	}
+	if schedule.State != SchedulePending {
+		return schedule, &terrors.ValidationError{Field: "id", Reason: "already " + string(schedule.State) + ": " + id}
+	}
+	schedule.State = ScheduleCancelled
+	if err := s.saveLocked(schedule); err != nil {
+		return Schedule{}, err
+	}
+	s.signal()
+	return schedule, nil
+}
+
+// Schedule returns one schedule.
+func (s *Scheduler) Schedule(id string) (Schedule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schedule, ok := s.schedules[id]
+	return schedule, ok
+}
+
+// Schedules returns every schedule ordered by creation time.
+func (s *Scheduler) Schedules() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedSchedules(s.schedules)
+}
+
+// Poll releases wall-clock schedules that are due.
+func (s *Scheduler) Poll(ctx context.Context) error {
+	s.mu.Lock()
+	now := s.now()
+	var (
+		due  []Schedule
+		errs []error
+	)
+	for _, schedule := range sortedSchedules(s.schedules) {
+		if schedule.State != SchedulePending || schedule.Trigger.session() || schedule.Trigger.At.After(now) {
+			continue
+		}
+		if now.Sub(schedule.Trigger.At) > s.maxLateness {
+			schedule.State = ScheduleExpired
+			schedule.Error = "due at " + schedule.Trigger.At.In(model.JST).Format(time.RFC3339)
+			errs = append(errs, s.saveLocked(schedule))
+			continue
+		}
+		due, errs = s.claim(schedule, due, errs)
+	}
+	s.mu.Unlock()
+	return errors.Join(append(errs, s.send(ctx, due))...)
+}
+
+// ApplySession releases session-anchored schedules matching change.
+func (s *Scheduler) ApplySession(ctx context.Context, change session.Change) error {
+	s.mu.Lock()
+	var (
+		due  []Schedule
+		errs []error
+	)
+	for _, schedule := range sortedSchedules(s.schedules) {
+		if schedule.State != SchedulePending || !schedule.Trigger.session() || !schedule.Trigger.matches(change) {
+			continue
+		}
+		due, errs = s.claim(schedule, due, errs)
+	}
+	s.mu.Unlock()
+	return errors.Join(append(errs, s.send(ctx, due))...)
+}
+
+// Run releases schedules until ctx is done. Errors from releases are
+// passed to onError, which may be nil.
+func (s *Scheduler) Run(ctx context.Context, onError func(error)) error {
+	var changes <-chan session.Change
+	if s.sessions != nil {
+		changes = s.sessions.Changes(ctx)
+	}
+	report := func(err error) {
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case change, ok := <-changes:
+			if !ok {
+				changes = nil
+				continue
+			}
+			report(s.ApplySession(ctx, change))
+		case <-s.wake:
+		case <-timer.C:
+			report(s.Poll(ctx))
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(s.untilNext())
+	}
+}
+
+// untilNext returns the wait until the next wall-clock schedule, capped so
+// clock changes are noticed.
+func (s *Scheduler) untilNext() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wait := time.Minute
+	now := s.now()
+	for _, schedule := range s.schedules {
+		if schedule.State != SchedulePending || schedule.Trigger.session() {
+			continue
+		}
+		wait = min(wait, max(schedule.Trigger.At.Sub(now), 0))
+	}
+	return wait
+}
+
+// claim persists schedule as ScheduleSending and appends it to due, or
+// skips it on a non-business day. s.mu must be held.
+func (s *Scheduler) claim(schedule Schedule, due []Schedule, errs []error) ([]Schedule, []error) {
+	now := s.now()
+	if s.calendar == nil || !s.calendar.IsBusinessDay(now) {
+		schedule.State = ScheduleSkipped
+		schedule.Error = "not a business day: " + model.FormatDate(now.In(model.JST))
+		return due, append(errs, s.saveLocked(schedule))
+	}
+	schedule.State = ScheduleSending
+	schedule.ReleasedAt = now
+	if err := s.saveLocked(schedule); err != nil {
+		return due, append(errs, err)
+	}
+	return append(due, schedule), errs
+}
+
+// send releases claimed schedules without holding s.mu and records each
+// result.
+func (s *Scheduler) send(ctx context.Context, due []Schedule) error {
+	var errs []error
+	for _, schedule := range due {
+		params := cloneParams(schedule.Params)
+		if s.secondPassword != "" {
+			params["sSecondPassword"] = s.secondPassword
+		}
+		resp, err := s.sender.KabuNewOrder(ctx, params)
+		switch {
+		case err == nil:
+			schedule.State = ScheduleReleased
+			schedule.OrderNumber = strings.TrimSpace(resp.OrderNumber)
+			schedule.EigyouDay = strings.TrimSpace(resp.EigyouDay)
+		case Ambiguous(err):
+			schedule.State = ScheduleUnknown
+			schedule.Error = err.Error()
+		default:
+			schedule.State = ScheduleFailed
+			schedule.Error = err.Error()
+		}
+		s.mu.Lock()
+		errs = append(errs, err, s.saveLocked(schedule))
+		s.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Scheduler) saveLocked(schedule Schedule) error {
+	schedule.UpdatedAt = s.now()
+	if err := s.store.Save(schedule); err != nil {
+		return err
+	}
+	s.schedules[schedule.ID] = schedule
+	return nil
+}
+
+func (s *Scheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func cloneParams(params request.OrderParams) request.OrderParams {
+	out := make(request.OrderParams, len(params))
+	for key, value := range params {
+		out[key] = value
+	}
+	return out
+}
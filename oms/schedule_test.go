@@ -0,0 +1,206 @@
+package oms
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ueebee/tachibanashi/calendar"
+	"github.com/ueebee/tachibanashi/master"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+	"github.com/ueebee/tachibanashi/session"
+)
+
+type mockSender struct {
+	sent   []request.OrderParams
+	err    error
+	onSend func()
+}
+
+func (m *mockSender) KabuNewOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error) {
+	m.sent = append(m.sent, params)
+	if m.onSend != nil {
+		m.onSend()
+	}
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &request.OrderResponse{OrderNumber: "7000", EigyouDay: "20240426"}, nil
+}
+
+func testCalendar() *calendar.Calendar {
+	store := master.NewMemoryStore()
+	store.Upsert(master.MasterDateZyouhou, calendar.DayKeyToday, model.Attributes{
+		master.DateInfoFieldDayKey:         calendar.DayKeyToday,
+		master.DateInfoFieldMaeEigyouDay1:  "20240425",
+		master.DateInfoFieldTheDay:         "20240426",
+		master.DateInfoFieldYokuEigyouDay1: "20240430",
+	}, master.UpdateMeta{})
+	return calendar.New(store)
+}
+
+type scheduleClock struct {
+	now time.Time
+}
+
+func (c *scheduleClock) Now() time.Time {
+	return c.now
+}
+
+func newTestScheduler(sender *mockSender, opts ...ScheduleOption) (*Scheduler, *scheduleClock) {
+	clock := &scheduleClock{now: time.Date(2024, 4, 26, 8, 0, 0, 0, model.JST)}
+	opts = append([]ScheduleOption{withScheduleClock(clock.Now), WithScheduleSecondPassword("pw")}, opts...)
+	return NewScheduler(sender, session.NewTracker(), testCalendar(), opts...), clock
+}
+
+func scheduledParams() request.OrderParams {
+	params, _ := request.MarketBuy("6501", request.MarketTSE, 100).ToParams()
+	return params
+}
+
+func TestSchedulerReleasesAtTime(t *testing.T) {
+	sender := &mockSender{}
+	scheduler, clock := newTestScheduler(sender)
+	at := time.Date(2024, 4, 26, 8, 59, 30, 0, model.JST)
+	if _, err := scheduler.Add("s1", scheduledParams(), AtTime(at)); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	ctx := context.Background()
+	scheduler.Poll(ctx)
+	if len(sender.sent) != 0 {
+		t.Fatalf("released early")
+	}
+	clock.now = at
+	sender.onSend = func() {
+		// The order is sent without the scheduler's lock held.
+		if schedule, _ := scheduler.Schedule("s1"); schedule.State != ScheduleSending {
+			t.Errorf("state while sending = %s", schedule.State)
+		}
+	}
+	if err := scheduler.Poll(ctx); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	schedule, _ := scheduler.Schedule("s1")
+	if schedule.State != ScheduleReleased || schedule.OrderNumber != "7000" || len(sender.sent) != 1 {
+		t.Fatalf("schedule = %+v", schedule)
+	}
+	if sender.sent[0]["sSecondPassword"] != "pw" || schedule.Params["sSecondPassword"] != nil {
+		t.Fatalf("second password handling: sent %v, stored %v", sender.sent[0], schedule.Params)
+	}
+}
+
+func TestSchedulerRejectsHoliday(t *testing.T) {
+	scheduler, clock := newTestScheduler(&mockSender{})
+	holiday := time.Date(2024, 4, 29, 9, 0, 0, 0, model.JST)
+	if _, err := scheduler.Add("s1", scheduledParams(), AtTime(holiday)); err == nil {
+		t.Fatalf("Add() expected error for holiday")
+	}
+
+	sender := &mockSender{}
+	scheduler, clock = newTestScheduler(sender)
+	scheduler.Add("s2", scheduledParams(), OnSessionStatus("00", "", "220"))
+	clock.now = holiday
+	change := session.Change{
+		Previous: session.State{Key: session.Key{Market: "00"}, Status: "200"},
+		Current:  session.State{Key: session.Key{Market: "00"}, Status: "220"},
+	}
+	scheduler.ApplySession(context.Background(), change)
+	schedule, _ := scheduler.Schedule("s2")
+	if schedule.State != ScheduleSkipped || len(sender.sent) != 0 {
+		t.Fatalf("schedule = %+v", schedule)
+	}
+}
+
+func TestSchedulerReleasesOnSessionTransition(t *testing.T) {
+	sender := &mockSender{}
+	scheduler, _ := newTestScheduler(sender)
+	scheduler.Add("pm", scheduledParams(), OnSessionStatus("00", "", "220"))
+	scheduler.Add("auction", scheduledParams(), OnSessionPhase("00", "", session.PhaseClosingAuction))
+
+	ctx := context.Background()
+	seed := session.Change{Current: session.State{Key: session.Key{Market: "00"}, Status: "220", Phase: session.PhaseContinuous}}
+	scheduler.ApplySession(ctx, seed)
+	if len(sender.sent) != 0 {
+		t.Fatalf("released on seed")
+	}
+
+	scheduler.ApplySession(ctx, session.Change{
+		Previous: session.State{Key: session.Key{Market: "00"}, Status: "200", Phase: session.PhasePreOpen},
+		Current:  session.State{Key: session.Key{Market: "00"}, Status: "220", Phase: session.PhaseContinuous},
+	})
+	if pm, _ := scheduler.Schedule("pm"); pm.State != ScheduleReleased {
+		t.Fatalf("pm = %+v", pm)
+	}
+	if auction, _ := scheduler.Schedule("auction"); auction.State != SchedulePending {
+		t.Fatalf("auction = %+v", auction)
+	}
+}
+
+func TestSchedulerCancelAndExpire(t *testing.T) {
+	sender := &mockSender{}
+	scheduler, clock := newTestScheduler(sender)
+	scheduler.Add("s1", scheduledParams(), AtTime(clock.now.Add(time.Minute)))
+	scheduler.Add("s2", scheduledParams(), AtTime(clock.now.Add(time.Minute)))
+	if _, err := scheduler.Cancel("s1"); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+
+	clock.now = clock.now.Add(5 * time.Minute)
+	scheduler.Poll(context.Background())
+	s1, _ := scheduler.Schedule("s1")
+	s2, _ := scheduler.Schedule("s2")
+	if s1.State != ScheduleCancelled || s2.State != ScheduleExpired || len(sender.sent) != 0 {
+		t.Fatalf("s1 = %+v, s2 = %+v", s1, s2)
+	}
+	if _, err := scheduler.Cancel("s2"); err == nil {
+		t.Fatalf("Cancel() expected error after expiry")
+	}
+}
+
+func TestSchedulerRestoresFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	store, err := NewFileScheduleStore(path)
+	if err != nil {
+		t.Fatalf("NewFileScheduleStore() error = %v", err)
+	}
+	scheduler, clock := newTestScheduler(&mockSender{}, WithScheduleStore(store))
+	at := clock.now.Add(time.Hour)
+	scheduler.Add("s1", scheduledParams(), AtTime(at))
+	store.Save(Schedule{ID: "s2", Params: scheduledParams(), Trigger: AtTime(at), State: ScheduleSending})
+
+	reopened, err := NewFileScheduleStore(path)
+	if err != nil {
+		t.Fatalf("NewFileScheduleStore() error = %v", err)
+	}
+	sender := &mockSender{}
+	restored, clock := newTestScheduler(sender, WithScheduleStore(reopened))
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	clock.now = at
+	restored.Poll(context.Background())
+	s1, _ := restored.Schedule("s1")
+	s2, _ := restored.Schedule("s2")
+	if s1.State != ScheduleReleased || s2.State != ScheduleUnknown || len(sender.sent) != 1 {
+		t.Fatalf("s1 = %+v, s2 = %+v", s1, s2)
+	}
+	if s1.Params["sIssueCode"] != "6501" {
+		t.Fatalf("params = %v", s1.Params)
+	}
+}
+
+func TestSchedulerAmbiguousSendIsUnknown(t *testing.T) {
+	sender := &mockSender{err: context.DeadlineExceeded}
+	scheduler, clock := newTestScheduler(sender)
+	scheduler.Add("s1", scheduledParams(), AtTime(clock.now))
+	if err := scheduler.Poll(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if s1, _ := scheduler.Schedule("s1"); s1.State != ScheduleUnknown {
+		t.Fatalf("s1 = %+v", s1)
+	}
+}
@@ -0,0 +1,82 @@
+package oms
+
+import "strings"
+
+// Status is the lifecycle state of an order.
+type Status int
+
+const (
+	StatusUnknown Status = iota
+	StatusPending
+	StatusAccepted
+	StatusPartiallyFilled
+	StatusFilled
+	StatusCancelling
+	StatusCancelled
+	StatusRejected
+	StatusExpired
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusPending:
+		return "pending"
+	case StatusAccepted:
+		return "accepted"
+	case StatusPartiallyFilled:
+		return "partially-filled"
+	case StatusFilled:
+		return "filled"
+	case StatusCancelling:
+		return "cancelling"
+	case StatusCancelled:
+		return "cancelled"
+	case StatusRejected:
+		return "rejected"
+	case StatusExpired:
+		return "expired"
+	}
+	return "unknown"
+}
+
+// Terminal reports whether no further fills or transitions are expected.
+func (s Status) Terminal() bool {
+	switch s {
+	case StatusFilled, StatusCancelled, StatusRejected, StatusExpired:
+		return true
+	}
+	return false
+}
+
+// orderStatuses maps sOrderStatusCode (CLMOrderList) and p_ODST (EC) to a
+// Status. 15-17 are shared by switch orders and stop orders; both readings
+// map to the same Status.
+var orderStatuses = map[string]Status{
+	"0":  StatusPending,         // 受付未済
+	"1":  StatusAccepted,        // 未約定
+	"2":  StatusRejected,        // 受付エラー
+	"3":  StatusAccepted,        // 訂正中
+	"4":  StatusAccepted,        // 訂正完了
+	"5":  StatusAccepted,        // 訂正失敗
+	"6":  StatusCancelling,      // 取消中
+	"7":  StatusCancelled,       // 取消完了
+	"8":  StatusAccepted,        // 取消失敗
+	"9":  StatusPartiallyFilled, // 一部約定
+	"10": StatusFilled,          // 全部約定
+	"11": StatusExpired,         // 一部失効
+	"12": StatusExpired,         // 全部失効
+	"13": StatusPending,         // 発注待ち
+	"14": StatusRejected,        // 無効
+	"15": StatusPending,         // 切替注文 / 逆指注文(切替中)
+	"16": StatusAccepted,        // 切替完了 / 逆指注文(未約定)
+	"17": StatusRejected,        // 切替注文失敗 / 逆指注文(失敗)
+	"19": StatusExpired,         // 繰越失効
+	"20": StatusRejected,        // 一部障害処理
+	"21": StatusRejected,        // 障害処理
+	"50": StatusPending,         // 発注中
+}
+
+// StatusFromCode maps an order status code to a Status.
+func StatusFromCode(code string) Status {
+	return orderStatuses[strings.TrimSpace(code)]
+}
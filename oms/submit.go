@@ -0,0 +1,451 @@
+package oms
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+const (
+	defaultMatchWindow    = 2 * time.Minute
+	defaultMaxAttempts    = 2
+	defaultPollBackoff    = time.Second
+	defaultMaxPollBackoff = 15 * time.Second
+	// orderTimeSkew allows for the server clock running behind ours.
+	orderTimeSkew  = 30 * time.Second
+	dateTimeLayout = "20060102150405"
+)
+
+// ErrAmbiguous reports that an order may or may not have been placed and no
+// matching order was found within the attempt budget, or before ctx ended.
+// The intent stays in IntentUnknown; call Resolve later before sending
+// anything new.
+var ErrAmbiguous = errors.New("tachibanashi: order outcome unknown")
+
+// OrderPlacer sends new orders and lists them. *request.Service satisfies it.
+type OrderPlacer interface {
+	PlaceNewOrder(ctx context.Context, order request.NewOrder) (*request.OrderResponse, error)
+	OrderList(ctx context.Context, params request.OrderParams) (*request.OrderListResponse, error)
+}
+
+// Submitter sends orders at most once per client ID. Each intent is
+// persisted before it is sent; after an ambiguous failure (timeout,
+// connection reset, 5xx) CLMOrderList is polled for a matching new order,
+// with backoff, until the match window has passed. Only then is the order
+// retried. Calls for the same client ID are serialized.
+type Submitter struct {
+	placer         OrderPlacer
+	store          IntentStore
+	matchWindow    time.Duration
+	maxAttempts    int
+	pollBackoff    time.Duration
+	maxPollBackoff time.Duration
+	now            func() time.Time
+	sleep          func(ctx context.Context, d time.Duration) error
+
+	mu    sync.Mutex
+	locks map[string]*clientLock
+}
+
+type clientLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+type SubmitOption func(*Submitter)
+
+// WithIntentStore persists intents in store (default: in memory).
+func WithIntentStore(store IntentStore) SubmitOption {
+	return func(s *Submitter) {
+		if store != nil {
+			s.store = store
+		}
+	}
+}
+
+// WithMatchWindow sets how long after sending an order may appear in
+// CLMOrderList (sOrderOrderDateTime) and still match the intent.
+func WithMatchWindow(window time.Duration) SubmitOption {
+	return func(s *Submitter) {
+		if window > 0 {
+			s.matchWindow = window
+		}
+	}
+}
+
+// WithMaxAttempts caps sends per intent, including the first.
+func WithMaxAttempts(n int) SubmitOption {
+	return func(s *Submitter) {
+		if n > 0 {
+			s.maxAttempts = n
+		}
+	}
+}
+
+// WithPollBackoff sets the delay before the second CLMOrderList poll after
+// an ambiguous send, doubled up to max for each later poll.
+func WithPollBackoff(initial, max time.Duration) SubmitOption {
+	return func(s *Submitter) {
+		if initial > 0 {
+			s.pollBackoff = initial
+		}
+		if max > 0 {
+			s.maxPollBackoff = max
+		}
+	}
+}
+
+func withSubmitClock(now func() time.Time, sleep func(ctx context.Context, d time.Duration) error) SubmitOption {
+	return func(s *Submitter) {
+		s.now = now
+		s.sleep = sleep
+	}
+}
+
+func NewSubmitter(placer OrderPlacer, opts ...SubmitOption) *Submitter {
+	s := &Submitter{
+		placer:         placer,
+		store:          NewMemoryIntentStore(),
+		matchWindow:    defaultMatchWindow,
+		maxAttempts:    defaultMaxAttempts,
+		pollBackoff:    defaultPollBackoff,
+		maxPollBackoff: defaultMaxPollBackoff,
+		now:            time.Now,
+		sleep:          sleepContext,
+		locks:          make(map[string]*clientLock),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	return s
+}
+
+// NewClientID returns a random client order ID.
+func NewClientID() string {
+	var buf [12]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(buf[:])
+}
+
+// Submit places order under clientID (a new ID when empty). Submitting a
+// client ID again returns its intent without sending when it is already
+// placed or failed, and resolves it first when the outcome is unknown.
+func (s *Submitter) Submit(ctx context.Context, clientID string, order request.NewOrder) (Intent, error) {
+	if s.placer == nil {
+		return Intent{}, errors.New("tachibanashi: order placer not set")
+	}
+	if err := order.Validate(); err != nil {
+		return Intent{}, err
+	}
+	clientID = strings.TrimSpace(clientID)
+	if clientID == "" {
+		clientID = NewClientID()
+	}
+	defer s.lock(clientID)()
+
+	intent, ok, err := s.store.Load(clientID)
+	if err != nil {
+		return Intent{}, err
+	}
+	if !ok {
+		now := s.now()
+		stored := order
+		stored.SecondPassword = ""
+		intent = Intent{ClientID: clientID, Order: stored, State: IntentPending, CreatedAt: now, UpdatedAt: now}
+		if err := s.store.Save(intent); err != nil {
+			return Intent{}, err
+		}
+	}
+	return s.run(ctx, intent, order.SecondPassword)
+}
+
+// Resolve settles an IntentUnknown intent by polling CLMOrderList until the
+// match window has passed and, when nothing matches and attempts remain,
+// sending again. secondPassword is needed only for a resend.
+func (s *Submitter) Resolve(ctx context.Context, clientID, secondPassword string) (Intent, error) {
+	clientID = strings.TrimSpace(clientID)
+	defer s.lock(clientID)()
+
+	intent, ok, err := s.store.Load(clientID)
+	if err != nil {
+		return Intent{}, err
+	}
+	if !ok {
+		return Intent{}, &terrors.ValidationError{Field: "clientID", Reason: "unknown client order id: " + clientID}
+	}
+	return s.run(ctx, intent, secondPassword)
+}
+
+// Lookup returns the intent for clientID.
+func (s *Submitter) Lookup(clientID string) (Intent, bool, error) {
+	return s.store.Load(strings.TrimSpace(clientID))
+}
+
+// ByOrderNumber returns the intent mapped to sOrderNumber.
+func (s *Submitter) ByOrderNumber(orderNumber string) (Intent, bool, error) {
+	intents, err := s.store.All()
+	if err != nil {
+		return Intent{}, false, err
+	}
+	for _, intent := range intents {
+		if intent.OrderNumber != "" && intent.OrderNumber == strings.TrimSpace(orderNumber) {
+			return intent, true, nil
+		}
+	}
+	return Intent{}, false, nil
+}
+
+// lock holds clientID until the returned func is called, so a second Submit
+// sees the first one's outcome instead of sending again.
+func (s *Submitter) lock(clientID string) func() {
+	s.mu.Lock()
+	l, ok := s.locks[clientID]
+	if !ok {
+		l = &clientLock{}
+		s.locks[clientID] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		s.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(s.locks, clientID)
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *Submitter) run(ctx context.Context, intent Intent, secondPassword string) (Intent, error) {
+	for {
+		switch intent.State {
+		case IntentPlaced:
+			return intent, nil
+		case IntentFailed:
+			return intent, errors.New("tachibanashi: order failed: " + intent.LastError)
+		case IntentUnknown:
+			var matched bool
+			var err error
+			intent, matched, err = s.await(ctx, intent)
+			if err != nil {
+				return intent, err
+			}
+			if matched {
+				return intent, nil
+			}
+			if intent.Attempts >= s.maxAttempts {
+				return intent, ErrAmbiguous
+			}
+		}
+
+		var err error
+		intent, err = s.send(ctx, intent, secondPassword)
+		if err != nil && intent.State != IntentUnknown {
+			return intent, err
+		}
+	}
+}
+
+func (s *Submitter) send(ctx context.Context, intent Intent, secondPassword string) (Intent, error) {
+	// Record the attempt before sending so a crash mid-request leaves the
+	// intent unknown rather than pending.
+	intent.Attempts++
+	intent.State = IntentUnknown
+	intent.SentAt = s.now()
+	intent.UpdatedAt = intent.SentAt
+	if err := s.store.Save(intent); err != nil {
+		return intent, err
+	}
+
+	order := intent.Order
+	order.SecondPassword = secondPassword
+	resp, err := s.placer.PlaceNewOrder(ctx, order)
+	intent.UpdatedAt = s.now()
+	switch {
+	case err == nil && resp != nil && strings.TrimSpace(resp.OrderNumber) != "":
+		intent.State = IntentPlaced
+		intent.OrderNumber = strings.TrimSpace(resp.OrderNumber)
+		intent.EigyouDay = strings.TrimSpace(resp.EigyouDay)
+		intent.LastError = ""
+	case err == nil:
+		intent.LastError = "response without sOrderNumber"
+	case Ambiguous(err):
+		intent.LastError = err.Error()
+	default:
+		intent.State = IntentFailed
+		intent.LastError = err.Error()
+	}
+	if saveErr := s.store.Save(intent); saveErr != nil {
+		return intent, saveErr
+	}
+	return intent, err
+}
+
+// await polls CLMOrderList for the intent's order until it is found or the
+// match window after the send has passed, backing off between polls. If
+// ctx ends first the outcome is still unknown and ErrAmbiguous is returned.
+func (s *Submitter) await(ctx context.Context, intent Intent) (Intent, bool, error) {
+	deadline := intent.SentAt.Add(s.matchWindow)
+	backoff := s.pollBackoff
+	for {
+		if err := ctx.Err(); err != nil {
+			return intent, false, fmt.Errorf("%w: %w", ErrAmbiguous, err)
+		}
+		var (
+			found bool
+			err   error
+		)
+		intent, found, err = s.match(ctx, intent)
+		if err != nil || found {
+			return intent, found, err
+		}
+		wait := deadline.Sub(s.now())
+		if wait <= 0 {
+			return intent, false, nil
+		}
+		if err := s.sleep(ctx, min(backoff, wait)); err != nil {
+			return intent, false, fmt.Errorf("%w: %w", ErrAmbiguous, err)
+		}
+		backoff = min(backoff*2, s.maxPollBackoff)
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// match searches CLMOrderList for the intent's order and records it when
+// found. Orders already mapped to another intent are skipped.
+func (s *Submitter) match(ctx context.Context, intent Intent) (Intent, bool, error) {
+	resp, err := s.placer.OrderList(ctx, request.OrderParams{"sIssueCode": intent.Order.Symbol})
+	if err != nil {
+		return intent, false, err
+	}
+	taken := make(map[string]struct{})
+	intents, err := s.store.All()
+	if err != nil {
+		return intent, false, err
+	}
+	for _, other := range intents {
+		if other.OrderNumber != "" && other.ClientID != intent.ClientID {
+			taken[other.OrderNumber] = struct{}{}
+		}
+	}
+
+	best, found := MatchOrder(resp.Entries, intent.Order, intent.SentAt, s.matchWindow, func(number string) bool {
+		_, ok := taken[number]
+		return ok
+	})
+	if !found {
+		return intent, false, nil
+	}
+
+	intent.State = IntentPlaced
+	intent.OrderNumber = best.OrderID
+	intent.EigyouDay = strings.TrimSpace(best.Fields.Value("sOrderSikkouDay"))
+	intent.LastError = ""
+	intent.UpdatedAt = s.now()
+	if err := s.store.Save(intent); err != nil {
+		return intent, false, err
+	}
+	return intent, true, nil
+}
+
+// MatchOrder finds the CLMOrderList entry for order sent at sentAt after
+// an ambiguous failure: same symbol, side, cash/margin kind, quantity and
+// price, placed within window of sentAt. The entry closest in time wins.
+// skip, which may be nil, excludes order numbers already claimed.
+func MatchOrder(entries []request.OrderEntry, order request.NewOrder, sentAt time.Time, window time.Duration, skip func(orderNumber string) bool) (request.OrderEntry, bool) {
+	var (
+		best     request.OrderEntry
+		bestDiff time.Duration
+		found    bool
+	)
+	for _, entry := range entries {
+		if entry.OrderID == "" || (skip != nil && skip(entry.OrderID)) {
+			continue
+		}
+		placed, ok := matches(order, sentAt, window, entry)
+		if !ok {
+			continue
+		}
+		diff := placed.Sub(sentAt)
+		if diff < 0 {
+			diff = -diff
+		}
+		if !found || diff < bestDiff {
+			best, bestDiff, found = entry, diff, true
+		}
+	}
+	return best, found
+}
+
+func matches(order request.NewOrder, sentAt time.Time, window time.Duration, entry request.OrderEntry) (time.Time, bool) {
+	fields := entry.Fields
+	if strings.TrimSpace(entry.Symbol) != strings.TrimSpace(order.Symbol) {
+		return time.Time{}, false
+	}
+	if strings.TrimSpace(fields.Value("sOrderBaibaiKubun")) != string(order.Side) {
+		return time.Time{}, false
+	}
+	if kind := request.ListedCashOrMargin(fields); kind != "" && kind != order.CashOrMargin {
+		return time.Time{}, false
+	}
+	if qty, ok := parseQuantity(fields.Value("sOrderOrderSuryou")); !ok || qty != order.Quantity {
+		return time.Time{}, false
+	}
+	price, err := model.ParsePrice(fields.Value("sOrderOrderPrice"))
+	if err != nil || price != order.Price {
+		return time.Time{}, false
+	}
+	placed, err := time.ParseInLocation(dateTimeLayout, strings.TrimSpace(fields.Value("sOrderOrderDateTime")), model.JST)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if placed.Before(sentAt.Add(-orderTimeSkew)) || placed.After(sentAt.Add(window)) {
+		return time.Time{}, false
+	}
+	return placed, true
+}
+
+// Ambiguous reports whether err leaves it unknown if a request reached the
+// server: timeouts, dropped connections and 5xx responses.
+func Ambiguous(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return terrors.IsRetryable(err)
+}
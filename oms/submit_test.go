@@ -0,0 +1,319 @@
+package oms
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+type mockPlacer struct {
+	results []error
+	placed  []request.NewOrder
+	list    []request.OrderEntry
+	// onPlace lists the order on the server when the send fails.
+	onPlace bool
+	// hidden is how many OrderList polls return nothing.
+	hidden int
+	polls  int
+}
+
+func (m *mockPlacer) PlaceNewOrder(ctx context.Context, order request.NewOrder) (*request.OrderResponse, error) {
+	m.placed = append(m.placed, order)
+	var err error
+	if len(m.results) > 0 {
+		err, m.results = m.results[0], m.results[1:]
+	}
+	if err != nil {
+		if m.onPlace {
+			m.list = append(m.list, placedEntry("5001", order, "20240603090000"))
+		}
+		return nil, err
+	}
+	return &request.OrderResponse{OrderNumber: "5000", EigyouDay: "20240603"}, nil
+}
+
+func (m *mockPlacer) OrderList(ctx context.Context, params request.OrderParams) (*request.OrderListResponse, error) {
+	if m.polls++; m.polls <= m.hidden {
+		return &request.OrderListResponse{}, nil
+	}
+	return &request.OrderListResponse{Entries: m.list}, nil
+}
+
+func placedEntry(number string, order request.NewOrder, at string) request.OrderEntry {
+	return request.OrderEntry{
+		OrderID: number,
+		Symbol:  order.Symbol,
+		Fields: model.Attributes{
+			"sOrderBaibaiKubun":   string(order.Side),
+			"sGenkinSinyouKubun":  string(order.CashOrMargin),
+			"sOrderOrderSuryou":   "100",
+			"sOrderOrderPrice":    order.Price.String() + ".0000",
+			"sOrderOrderDateTime": at,
+			"sOrderSikkouDay":     "20240603",
+		},
+	}
+}
+
+// submitTestClock starts at 09:00 JST and moves only when slept on.
+type submitTestClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *submitTestClock) Now() time.Time {
+	return c.now
+}
+
+func (c *submitTestClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.slept = append(c.slept, d)
+	c.now = c.now.Add(d)
+	return ctx.Err()
+}
+
+func submitClock() (*submitTestClock, SubmitOption) {
+	clock := &submitTestClock{now: time.Date(2024, 6, 3, 9, 0, 0, 0, model.JST)}
+	return clock, withSubmitClock(clock.Now, clock.Sleep)
+}
+
+func testOrder() request.NewOrder {
+	order := request.LimitBuy("6501", request.MarketTSE, model.Yen(3000), 100)
+	order.SecondPassword = "pw"
+	return order
+}
+
+func TestSubmitMapsOrderNumber(t *testing.T) {
+	placer := &mockPlacer{}
+	_, clockOpt := submitClock()
+	submitter := NewSubmitter(placer, clockOpt)
+
+	intent, err := submitter.Submit(context.Background(), "c1", testOrder())
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if intent.State != IntentPlaced || intent.OrderNumber != "5000" || intent.EigyouDay != "20240603" || intent.Order.SecondPassword != "" {
+		t.Fatalf("intent = %+v", intent)
+	}
+	if placer.placed[0].SecondPassword != "pw" {
+		t.Fatalf("second password not sent")
+	}
+
+	if _, err := submitter.Submit(context.Background(), "c1", testOrder()); err != nil || len(placer.placed) != 1 {
+		t.Fatalf("resubmit should not send again: %v, sends = %d", err, len(placer.placed))
+	}
+	if found, ok, _ := submitter.ByOrderNumber("5000"); !ok || found.ClientID != "c1" {
+		t.Fatalf("ByOrderNumber mismatch: %+v", found)
+	}
+}
+
+func TestSubmitTimeoutFindsPlacedOrder(t *testing.T) {
+	placer := &mockPlacer{results: []error{context.DeadlineExceeded}, onPlace: true}
+	_, clockOpt := submitClock()
+	submitter := NewSubmitter(placer, clockOpt)
+
+	intent, err := submitter.Submit(context.Background(), "c1", testOrder())
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if len(placer.placed) != 1 {
+		t.Fatalf("order should not be resent, sends = %d", len(placer.placed))
+	}
+	if intent.State != IntentPlaced || intent.OrderNumber != "5001" {
+		t.Fatalf("intent = %+v", intent)
+	}
+}
+
+func TestSubmitTimeoutRetriesWhenNotFound(t *testing.T) {
+	placer := &mockPlacer{results: []error{context.DeadlineExceeded}}
+	// An identical order outside the match window must not be claimed, nor a
+	// margin order in the window.
+	margin := testOrder().Margin(request.MarginSystemOpen)
+	placer.list = []request.OrderEntry{
+		placedEntry("4000", testOrder(), "20240603080000"),
+		placedEntry("4001", margin, "20240603090000"),
+	}
+	clock, clockOpt := submitClock()
+	submitter := NewSubmitter(placer, clockOpt)
+
+	intent, err := submitter.Submit(context.Background(), "c1", testOrder())
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if len(placer.placed) != 2 || intent.OrderNumber != "5000" || intent.Attempts != 2 {
+		t.Fatalf("intent = %+v, sends = %d", intent, len(placer.placed))
+	}
+	// The resend waits out the match window, polling with backoff.
+	if !intent.SentAt.Equal(time.Date(2024, 6, 3, 9, 2, 0, 0, model.JST)) {
+		t.Fatalf("resent at %s", intent.SentAt)
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 15 * time.Second}
+	for i, d := range want {
+		if clock.slept[i] != d {
+			t.Fatalf("sleeps = %v", clock.slept)
+		}
+	}
+}
+
+func TestSubmitTimeoutPollsUntilListed(t *testing.T) {
+	placer := &mockPlacer{results: []error{context.DeadlineExceeded}, onPlace: true, hidden: 3}
+	clock, clockOpt := submitClock()
+	submitter := NewSubmitter(placer, clockOpt)
+
+	intent, err := submitter.Submit(context.Background(), "c1", testOrder())
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if len(placer.placed) != 1 || intent.State != IntentPlaced || intent.OrderNumber != "5001" {
+		t.Fatalf("intent = %+v, sends = %d", intent, len(placer.placed))
+	}
+	if placer.polls != 4 || len(clock.slept) != 3 {
+		t.Fatalf("polls = %d, sleeps = %v", placer.polls, clock.slept)
+	}
+}
+
+func TestSubmitCancelledWhilePollingIsUnresolved(t *testing.T) {
+	placer := &mockPlacer{results: []error{context.DeadlineExceeded}}
+	_, clockOpt := submitClock()
+	submitter := NewSubmitter(placer, clockOpt)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	intent, err := submitter.Submit(ctx, "c1", testOrder())
+	if !errors.Is(err, ErrAmbiguous) || intent.State != IntentUnknown || len(placer.placed) != 1 {
+		t.Fatalf("intent = %+v, err = %v, sends = %d", intent, err, len(placer.placed))
+	}
+}
+
+func TestSubmitGivesUpWhenStillAmbiguous(t *testing.T) {
+	placer := &mockPlacer{results: []error{context.DeadlineExceeded, &terrors.HTTPError{Status: 503}}}
+	_, clockOpt := submitClock()
+	submitter := NewSubmitter(placer, clockOpt)
+
+	intent, err := submitter.Submit(context.Background(), "c1", testOrder())
+	if !errors.Is(err, ErrAmbiguous) {
+		t.Fatalf("expected ErrAmbiguous, got %v", err)
+	}
+	if intent.State != IntentUnknown || len(placer.placed) != 2 {
+		t.Fatalf("intent = %+v, sends = %d", intent, len(placer.placed))
+	}
+
+	placer.list = []request.OrderEntry{placedEntry("5002", testOrder(), intent.SentAt.Add(5*time.Second).Format(dateTimeLayout))}
+	intent, err = submitter.Resolve(context.Background(), "c1", "")
+	if err != nil || intent.OrderNumber != "5002" {
+		t.Fatalf("Resolve() = %+v, %v", intent, err)
+	}
+}
+
+func TestSubmitRejectedIsNotRetried(t *testing.T) {
+	placer := &mockPlacer{results: []error{&terrors.APIError{Code: "991", Message: "rejected"}}}
+	_, clockOpt := submitClock()
+	submitter := NewSubmitter(placer, clockOpt)
+
+	intent, err := submitter.Submit(context.Background(), "c1", testOrder())
+	var apiErr *terrors.APIError
+	if !errors.As(err, &apiErr) || intent.State != IntentFailed || len(placer.placed) != 1 {
+		t.Fatalf("intent = %+v, err = %v", intent, err)
+	}
+}
+
+func TestFileIntentStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "intents.json")
+	store, err := NewFileIntentStore(path)
+	if err != nil {
+		t.Fatalf("NewFileIntentStore() error = %v", err)
+	}
+	placer := &mockPlacer{}
+	_, clockOpt := submitClock()
+	submitter := NewSubmitter(placer, WithIntentStore(store), clockOpt)
+	if _, err := submitter.Submit(context.Background(), "c1", testOrder()); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	reloaded, err := NewFileIntentStore(path)
+	if err != nil {
+		t.Fatalf("reload error = %v", err)
+	}
+	intent, ok, err := reloaded.Load("c1")
+	if err != nil || !ok {
+		t.Fatalf("Load() = %v, %v", ok, err)
+	}
+	if intent.OrderNumber != "5000" || intent.Order.Price != model.Yen(3000) || intent.Order.SecondPassword != "" {
+		t.Fatalf("reloaded intent = %+v", intent)
+	}
+}
+
+type blockingPlacer struct {
+	mockPlacer
+	mu      sync.Mutex
+	release chan struct{}
+}
+
+func (b *blockingPlacer) PlaceNewOrder(ctx context.Context, order request.NewOrder) (*request.OrderResponse, error) {
+	<-b.release
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.mockPlacer.PlaceNewOrder(ctx, order)
+}
+
+func TestSubmitSerializesClientID(t *testing.T) {
+	placer := &blockingPlacer{release: make(chan struct{})}
+	_, clockOpt := submitClock()
+	submitter := NewSubmitter(placer, clockOpt)
+
+	var wg sync.WaitGroup
+	results := make([]Intent, 2)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = submitter.Submit(context.Background(), "c1", testOrder())
+		}()
+	}
+	close(placer.release)
+	wg.Wait()
+
+	if len(placer.placed) != 1 {
+		t.Fatalf("sends = %d", len(placer.placed))
+	}
+	if results[0].OrderNumber != "5000" || results[1].OrderNumber != "5000" {
+		t.Fatalf("results = %+v", results)
+	}
+}
+
+func TestIntentStorePrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "intents.json")
+	store, err := NewFileIntentStore(path)
+	if err != nil {
+		t.Fatalf("NewFileIntentStore() error = %v", err)
+	}
+	old := time.Date(2024, 6, 1, 15, 0, 0, 0, model.JST)
+	cutoff := time.Date(2024, 6, 3, 0, 0, 0, 0, model.JST)
+	for _, intent := range []Intent{
+		{ClientID: "placed", State: IntentPlaced, UpdatedAt: old},
+		{ClientID: "failed", State: IntentFailed, UpdatedAt: old},
+		{ClientID: "unknown", State: IntentUnknown, UpdatedAt: old},
+		{ClientID: "today", State: IntentPlaced, UpdatedAt: cutoff.Add(time.Hour)},
+	} {
+		if err := store.Save(intent); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	if err := store.Prune(cutoff); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+
+	reloaded, err := NewFileIntentStore(path)
+	if err != nil {
+		t.Fatalf("reload error = %v", err)
+	}
+	intents, _ := reloaded.All()
+	if len(intents) != 2 || intents[0].ClientID != "today" || intents[1].ClientID != "unknown" {
+		t.Fatalf("intents = %+v", intents)
+	}
+}
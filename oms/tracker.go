@@ -0,0 +1,472 @@
+package oms
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ueebee/tachibanashi/event"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+// Update sources.
+const (
+	SourcePoll   = "poll"
+	SourceEvent  = "event"
+	SourceDetail = "detail"
+)
+
+const changeBufferSize = 16
+
+// OrderSource polls order state. *request.Service satisfies it.
+type OrderSource interface {
+	OrderList(ctx context.Context, params request.OrderParams) (*request.OrderListResponse, error)
+	OrderListDetail(ctx context.Context, orderNumber, eigyouDay string) (*request.OrderListDetailResponse, error)
+}
+
+// Transition records one status change.
+type Transition struct {
+	From   Status
+	To     Status
+	Code   string // sOrderStatusCode / p_ODST
+	Source string // SourcePoll, SourceEvent or SourceDetail
+	At     time.Time
+}
+
+// Order is the tracked state of one order.
+type Order struct {
+	Number      string
+	BusinessDay string // sEigyouDay / p_ED
+	Symbol      string
+	Market      string
+	Side        string
+	Price       model.Price
+	Quantity    model.Quantity
+	Status      Status
+	StatusCode  string
+	Filled      model.Quantity
+	AvgPrice    model.Price
+	// Notice is the last EC p_NT received for the order.
+	Notice      string
+	Transitions []Transition
+	UpdatedAt   time.Time
+
+	// Filled is the larger of the last polled cumulative fill and the sum
+	// of the EC executions seen, so executions replayed after a poll are
+	// not counted twice. lastENO dedupes the order's events.
+	polled      model.Quantity
+	polledAvg   model.Price
+	eventFilled model.Quantity
+	eventValue  model.Price
+	lastENO     int64
+}
+
+// Remaining returns the unfilled quantity.
+func (o Order) Remaining() model.Quantity {
+	if o.Filled >= o.Quantity {
+		return 0
+	}
+	return o.Quantity - o.Filled
+}
+
+// sumFills sets Filled and AvgPrice from the polled and event fills,
+// capped at the order quantity.
+func (o *Order) sumFills() {
+	o.Filled, o.AvgPrice = o.polled, o.polledAvg
+	if o.eventFilled > o.polled {
+		o.Filled = o.eventFilled
+		o.AvgPrice = o.eventValue.Div(int64(o.eventFilled))
+	}
+	if o.Quantity > 0 && o.Filled > o.Quantity {
+		o.Filled = o.Quantity
+	}
+}
+
+func (o Order) clone() Order {
+	o.Transitions = append([]Transition(nil), o.Transitions...)
+	return o
+}
+
+// Change is sent whenever an order's status or fills change.
+type Change struct {
+	Previous Order
+	Current  Order
+}
+
+// Tracker keeps per-order state seeded from CLMOrderList, updated from EC
+// events and re-polled after reconnects or on an interval.
+type Tracker struct {
+	source   OrderSource
+	now      func() time.Time
+	interval time.Duration
+
+	mu     sync.RWMutex
+	orders map[string]Order
+	subs   map[chan Change]struct{}
+}
+
+type Option func(*Tracker)
+
+func withClock(now func() time.Time) Option {
+	return func(t *Tracker) {
+		t.now = now
+	}
+}
+
+// WithReconcileInterval makes Watch re-poll CLMOrderList every d, so notices
+// lost without a reconnect are still picked up. p_ENO is unique but not
+// sequential, so missed events cannot be detected from the numbers alone.
+func WithReconcileInterval(d time.Duration) Option {
+	return func(t *Tracker) {
+		t.interval = d
+	}
+}
+
+// NewTracker returns a Tracker that polls source. A nil source disables
+// polling; state then comes from events only.
+func NewTracker(source OrderSource, opts ...Option) *Tracker {
+	t := &Tracker{
+		source: source,
+		now:    time.Now,
+		orders: make(map[string]Order),
+		subs:   make(map[chan Change]struct{}),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(t)
+		}
+	}
+	return t
+}
+
+// Reconcile polls CLMOrderList and merges the result. Orders that are still
+// open locally but missing from the list are refreshed with
+// CLMOrderListDetail. An order's fill is the larger of the polled
+// cumulative fill and its EC executions, so events replayed afterwards are
+// not added on top of the poll.
+func (t *Tracker) Reconcile(ctx context.Context) error {
+	if t.source == nil {
+		return nil
+	}
+	resp, err := t.source.OrderList(ctx, request.OrderParams{})
+	if err != nil {
+		return err
+	}
+	listed := make(map[string]struct{}, len(resp.Entries))
+	for _, entry := range resp.Entries {
+		if entry.OrderID == "" {
+			continue
+		}
+		listed[entry.OrderID] = struct{}{}
+		t.applyPoll(SourcePoll, polled{
+			number:      entry.OrderID,
+			businessDay: entry.Fields.Value("sOrderSikkouDay"),
+			symbol:      entry.Symbol,
+			market:      entry.Fields.Value("sOrderSizyouC"),
+			side:        entry.Fields.Value("sOrderBaibaiKubun"),
+			price:       entry.Fields.Value("sOrderOrderPrice"),
+			quantity:    entry.Fields.Value("sOrderOrderSuryou"),
+			code:        entry.Fields.Value("sOrderStatusCode"),
+			filled:      entry.Fields.Value("sOrderYakuzyouSuryo"),
+			avgPrice:    entry.Fields.Value("sOrderYakuzyouPrice"),
+		})
+	}
+
+	for _, order := range t.Orders() {
+		if _, ok := listed[order.Number]; ok || order.Status.Terminal() || order.BusinessDay == "" {
+			continue
+		}
+		if err := t.Refresh(ctx, order.Number, order.BusinessDay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Refresh polls CLMOrderListDetail for one order.
+func (t *Tracker) Refresh(ctx context.Context, orderNumber, eigyouDay string) error {
+	if t.source == nil {
+		return nil
+	}
+	resp, err := t.source.OrderListDetail(ctx, orderNumber, eigyouDay)
+	if err != nil {
+		return err
+	}
+	number := resp.OrderNumber
+	if number == "" {
+		number = orderNumber
+	}
+	day := resp.EigyouDay
+	if day == "" {
+		day = eigyouDay
+	}
+	t.applyPoll(SourceDetail, polled{
+		number:      number,
+		businessDay: day,
+		symbol:      resp.IssueCode,
+		market:      resp.Fields.Value("sOrderSizyouC"),
+		side:        resp.Fields.Value("sOrderBaibaiKubun"),
+		price:       resp.Fields.Value("sOrderOrderPrice"),
+		quantity:    resp.Fields.Value("sOrderOrderSuryou"),
+		code:        resp.Fields.Value("sOrderStatusCode"),
+		filled:      resp.Fields.Value("sYakuzyouSuryou"),
+		avgPrice:    resp.Fields.Value("sYakuzyouPrice"),
+	})
+	return nil
+}
+
+// Apply updates state from an EC event and reports whether it was used.
+// Events at or below the order's last p_ENO are treated as replays.
+func (t *Tracker) Apply(ev event.Event) bool {
+	ec, ok := ev.(event.EC)
+	if !ok {
+		return false
+	}
+	number := strings.TrimSpace(ec.OrderNumber)
+	if number == "" {
+		return false
+	}
+
+	t.mu.Lock()
+	previous, known := t.orders[number]
+	eno, enoErr := strconv.ParseInt(strings.TrimSpace(ec.EventNo), 10, 64)
+	if enoErr == nil && previous.lastENO > 0 && eno <= previous.lastENO {
+		t.mu.Unlock()
+		return false // already seen
+	}
+	order := previous.clone()
+	if !known {
+		order = Order{Number: number}
+		base := ec.Order()
+		order.Symbol = base.Symbol
+		order.Side = base.Side
+		order.Price = base.Price
+		order.Quantity = base.Quantity
+	} else if qty, ok := parseQuantity(ec.OrderQuantity); ok && qty > 0 {
+		order.Quantity = qty
+	}
+	if day := strings.TrimSpace(ec.BusinessDay); day != "" {
+		order.BusinessDay = day
+	}
+	if market := strings.TrimSpace(ec.MarketCode); market != "" {
+		order.Market = market
+	}
+	order.Notice = strings.TrimSpace(ec.NoticeType)
+	if enoErr == nil {
+		order.lastENO = eno
+	}
+
+	if exec, ok := ec.Execution(); ok && exec.Quantity > 0 {
+		order.eventFilled += exec.Quantity
+		order.eventValue += exec.Price.Mul(exec.Quantity)
+	}
+	order.sumFills()
+
+	code := strings.TrimSpace(ec.OrderStatus)
+	status := deriveStatus(StatusFromCode(code), order)
+	if previous.Status.Terminal() && !status.Terminal() {
+		status = previous.Status // a late event cannot reopen a closed order
+	}
+	t.commit(previous, order, status, code, SourceEvent)
+	t.mu.Unlock()
+	return true
+}
+
+// Watch reconciles, then applies events until the channel closes or ctx is
+// done. Call it again after each reconnect so missed notices are polled.
+// With WithReconcileInterval it also re-polls on that interval.
+func (t *Tracker) Watch(ctx context.Context, events <-chan event.Event) error {
+	if err := t.Reconcile(ctx); err != nil {
+		return err
+	}
+	var tick <-chan time.Time
+	if t.interval > 0 {
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick:
+			if err := t.Reconcile(ctx); err != nil {
+				return err
+			}
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			t.Apply(ev)
+		}
+	}
+}
+
+// Order returns the tracked state of one order.
+func (t *Tracker) Order(number string) (Order, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	order, ok := t.orders[strings.TrimSpace(number)]
+	return order.clone(), ok
+}
+
+// Orders returns every tracked order.
+func (t *Tracker) Orders() []Order {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	out := make([]Order, 0, len(t.orders))
+	for _, order := range t.orders {
+		out = append(out, order.clone())
+	}
+	return out
+}
+
+// Open returns orders that are not in a terminal state.
+func (t *Tracker) Open() []Order {
+	var out []Order
+	for _, order := range t.Orders() {
+		if !order.Status.Terminal() {
+			out = append(out, order)
+		}
+	}
+	return out
+}
+
+// Changes subscribes to order changes until ctx is done. The channel is
+// buffered; when a subscriber falls behind further changes are dropped for
+// it, so Order remains the source of truth.
+func (t *Tracker) Changes(ctx context.Context) <-chan Change {
+	ch := make(chan Change, changeBufferSize)
+	t.mu.Lock()
+	t.subs[ch] = struct{}{}
+	t.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		t.mu.Lock()
+		delete(t.subs, ch)
+		t.mu.Unlock()
+		close(ch)
+	}()
+	return ch
+}
+
+type polled struct {
+	number      string
+	businessDay string
+	symbol      string
+	market      string
+	side        string
+	price       string
+	quantity    string
+	code        string
+	filled      string
+	avgPrice    string
+}
+
+func (t *Tracker) applyPoll(source string, p polled) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	previous, known := t.orders[p.number]
+	order := previous.clone()
+	if !known {
+		order = Order{Number: p.number}
+	}
+	if day := strings.TrimSpace(p.businessDay); day != "" && day != "00000000" {
+		order.BusinessDay = day
+	}
+	if symbol := strings.TrimSpace(p.symbol); symbol != "" {
+		order.Symbol = symbol
+	}
+	if market := strings.TrimSpace(p.market); market != "" {
+		order.Market = market
+	}
+	if side := strings.TrimSpace(p.side); side != "" {
+		order.Side = side
+	}
+	if price, err := model.ParsePrice(p.price); err == nil {
+		order.Price = price
+	}
+	if qty, ok := parseQuantity(p.quantity); ok {
+		order.Quantity = qty
+	}
+	if filled, ok := parseQuantity(p.filled); ok {
+		order.polled = filled
+		order.polledAvg = 0
+		if avg, err := model.ParsePrice(p.avgPrice); err == nil && filled > 0 {
+			order.polledAvg = avg
+		}
+	}
+	order.sumFills()
+
+	code := strings.TrimSpace(p.code)
+	t.commit(previous, order, deriveStatus(StatusFromCode(code), order), code, source)
+}
+
+// commit stores order with status and notifies subscribers. t.mu must be
+// held.
+func (t *Tracker) commit(previous, order Order, status Status, code, source string) {
+	now := t.now()
+	if code != "" {
+		order.StatusCode = code
+	}
+	if status != StatusUnknown && status != order.Status {
+		order.Transitions = append(order.Transitions, Transition{
+			From:   order.Status,
+			To:     status,
+			Code:   code,
+			Source: source,
+			At:     now,
+		})
+		order.Status = status
+	}
+	order.UpdatedAt = now
+	t.orders[order.Number] = order
+
+	if previous.Number != "" && previous.Status == order.Status && previous.Filled == order.Filled &&
+		previous.AvgPrice == order.AvgPrice && previous.Quantity == order.Quantity {
+		return
+	}
+	change := Change{Previous: previous.clone(), Current: order.clone()}
+	for ch := range t.subs {
+		select {
+		case ch <- change:
+		default:
+		}
+	}
+}
+
+// deriveStatus reconciles the reported status with the fill totals:
+// open orders with fills are partially filled, and fully filled orders are
+// filled whatever the code says.
+func deriveStatus(status Status, order Order) Status {
+	if order.Quantity > 0 && order.Filled >= order.Quantity {
+		switch status {
+		case StatusUnknown, StatusPending, StatusAccepted, StatusPartiallyFilled, StatusCancelling:
+			return StatusFilled
+		}
+	}
+	if status == StatusAccepted && order.Filled > 0 {
+		return StatusPartiallyFilled
+	}
+	if status == StatusUnknown && order.Filled > 0 {
+		return StatusPartiallyFilled
+	}
+	return status
+}
+
+func parseQuantity(value string) (model.Quantity, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return model.Quantity(parsed), true
+}
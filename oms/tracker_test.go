@@ -0,0 +1,221 @@
+package oms
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ueebee/tachibanashi/event"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+type mockSource struct {
+	list    *request.OrderListResponse
+	details map[string]*request.OrderListDetailResponse
+	polls   int
+}
+
+func (m *mockSource) OrderList(ctx context.Context, params request.OrderParams) (*request.OrderListResponse, error) {
+	m.polls++
+	if m.list == nil {
+		return &request.OrderListResponse{}, nil
+	}
+	return m.list, nil
+}
+
+func (m *mockSource) OrderListDetail(ctx context.Context, orderNumber, eigyouDay string) (*request.OrderListDetailResponse, error) {
+	if resp, ok := m.details[orderNumber]; ok {
+		return resp, nil
+	}
+	return &request.OrderListDetailResponse{OrderNumber: orderNumber, EigyouDay: eigyouDay}, nil
+}
+
+func listEntry(number, code, qty, filled, avg string) request.OrderEntry {
+	return request.OrderEntry{
+		OrderID: number,
+		Symbol:  "6501",
+		Fields: model.Attributes{
+			"sOrderSizyouC":       "00",
+			"sOrderBaibaiKubun":   "3",
+			"sOrderOrderPrice":    "3000.0000",
+			"sOrderOrderSuryou":   qty,
+			"sOrderStatusCode":    code,
+			"sOrderYakuzyouSuryo": filled,
+			"sOrderYakuzyouPrice": avg,
+			"sOrderSikkouDay":     "20240603",
+		},
+	}
+}
+
+func fixedClock() func() time.Time {
+	return func() time.Time { return time.Date(2024, 6, 3, 9, 0, 0, 0, model.JST) }
+}
+
+func execEvent(eno, number, status, price, qty string) event.EC {
+	return event.EC{
+		EventNo:          eno,
+		NoticeType:       "2",
+		OrderNumber:      number,
+		BusinessDay:      "20240603",
+		Symbol:           "6501",
+		MarketCode:       "00",
+		Side:             "3",
+		OrderPrice:       "3000",
+		OrderQuantity:    "300",
+		ExecutedPrice:    price,
+		ExecutedQuantity: qty,
+		OrderStatus:      status,
+	}
+}
+
+func TestReconcileSeedsFromOrderList(t *testing.T) {
+	source := &mockSource{list: &request.OrderListResponse{Entries: []request.OrderEntry{
+		listEntry("1001", "1", "300", "0", "0.0000"),
+		listEntry("1002", "10", "100", "100", "2999.5000"),
+	}}}
+	tracker := NewTracker(source, withClock(fixedClock()))
+	if err := tracker.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	open, ok := tracker.Order("1001")
+	if !ok || open.Status != StatusAccepted || open.Quantity != 300 || open.Price != model.Yen(3000) || open.BusinessDay != "20240603" {
+		t.Fatalf("open order = %+v", open)
+	}
+	filled, _ := tracker.Order("1002")
+	if filled.Status != StatusFilled || filled.Filled != 100 || filled.AvgPrice != model.Price(29995000) {
+		t.Fatalf("filled order = %+v", filled)
+	}
+	if len(tracker.Open()) != 1 {
+		t.Fatalf("open orders mismatch: %d", len(tracker.Open()))
+	}
+}
+
+func TestApplyExecutionsAccumulateFills(t *testing.T) {
+	source := &mockSource{list: &request.OrderListResponse{Entries: []request.OrderEntry{
+		listEntry("1001", "1", "300", "0", "0.0000"),
+	}}}
+	tracker := NewTracker(source, withClock(fixedClock()))
+	if err := tracker.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := tracker.Changes(ctx)
+
+	if !tracker.Apply(execEvent("1", "1001", "9", "3000", "100")) {
+		t.Fatalf("EC event was not applied")
+	}
+	if tracker.Apply(execEvent("1", "1001", "9", "3000", "100")) {
+		t.Fatalf("duplicate p_ENO should be ignored")
+	}
+	tracker.Apply(execEvent("2", "1001", "10", "3010", "200"))
+
+	order, _ := tracker.Order("1001")
+	if order.Status != StatusFilled || order.Filled != 300 {
+		t.Fatalf("order = %+v", order)
+	}
+	// (3000*100 + 3010*200) / 300
+	if want, _ := model.ParsePrice("3006.6667"); order.AvgPrice != want {
+		t.Fatalf("avg price mismatch: %s", order.AvgPrice)
+	}
+	if len(order.Transitions) != 3 || order.Transitions[1].To != StatusPartiallyFilled || order.Transitions[2].Source != SourceEvent {
+		t.Fatalf("transitions = %+v", order.Transitions)
+	}
+
+	select {
+	case change := <-changes:
+		if change.Previous.Status != StatusAccepted || change.Current.Status != StatusPartiallyFilled {
+			t.Fatalf("first change = %+v", change)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected change notification")
+	}
+
+	// A late cancel notice cannot reopen a filled order.
+	tracker.Apply(execEvent("3", "1001", "1", "", ""))
+	if order, _ := tracker.Order("1001"); order.Status != StatusFilled {
+		t.Fatalf("terminal status was overwritten: %s", order.Status)
+	}
+}
+
+func TestReplayAfterReconcileIsNotCountedTwice(t *testing.T) {
+	source := &mockSource{list: &request.OrderListResponse{Entries: []request.OrderEntry{
+		listEntry("1001", "9", "300", "100", "3000.0000"),
+	}}}
+	tracker := NewTracker(source, withClock(fixedClock()))
+	if err := tracker.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	// The poll already includes the execution the stream now replays.
+	tracker.Apply(execEvent("1", "1001", "9", "3000", "100"))
+	if order, _ := tracker.Order("1001"); order.Filled != 100 || order.Status != StatusPartiallyFilled {
+		t.Fatalf("order = %+v", order)
+	}
+	if err := tracker.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if tracker.Apply(execEvent("1", "1001", "9", "3000", "100")) {
+		t.Fatalf("replayed p_ENO applied after reconcile")
+	}
+
+	tracker.Apply(execEvent("2", "1001", "9", "3020", "100"))
+	order, _ := tracker.Order("1001")
+	if order.Filled != 200 || order.AvgPrice != model.Yen(3010) {
+		t.Fatalf("order = %+v", order)
+	}
+}
+
+func TestWatchReconcilesOnInterval(t *testing.T) {
+	source := &mockSource{list: &request.OrderListResponse{Entries: []request.OrderEntry{
+		listEntry("1001", "1", "300", "0", "0.0000"),
+	}}}
+	tracker := NewTracker(source, withClock(fixedClock()), WithReconcileInterval(time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- tracker.Watch(ctx, make(chan event.Event)) }()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	<-done
+
+	if source.polls < 2 {
+		t.Fatalf("expected periodic reconcile, polls = %d", source.polls)
+	}
+}
+
+func TestReconcileRefreshesMissingOrders(t *testing.T) {
+	source := &mockSource{details: map[string]*request.OrderListDetailResponse{
+		"2001": {OrderNumber: "2001", EigyouDay: "20240603", IssueCode: "7203", Fields: model.Attributes{
+			"sOrderStatusCode":  "12",
+			"sOrderOrderSuryou": "100",
+			"sYakuzyouSuryou":   "0",
+		}},
+	}}
+	tracker := NewTracker(source, withClock(fixedClock()))
+	tracker.Apply(execEvent("1", "2001", "1", "", ""))
+
+	if err := tracker.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	order, _ := tracker.Order("2001")
+	if order.Status != StatusExpired || order.Symbol != "7203" {
+		t.Fatalf("order = %+v", order)
+	}
+}
+
+func TestStatusFromCode(t *testing.T) {
+	cases := map[string]Status{
+		"0": StatusPending, "1": StatusAccepted, "2": StatusRejected, "6": StatusCancelling,
+		"7": StatusCancelled, "9": StatusPartiallyFilled, "10": StatusFilled, "12": StatusExpired,
+		"99": StatusUnknown,
+	}
+	for code, want := range cases {
+		if got := StatusFromCode(code); got != want {
+			t.Fatalf("StatusFromCode(%s) = %s, want %s", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,577 @@
+package portfolio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ueebee/tachibanashi/event"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+// DefaultReconcileInterval is how often Watch compares the ledger with the
+// broker's position lists.
+const DefaultReconcileInterval = time.Minute
+
+// relistAfter limits CLMOrderList lookups for fills of unknown orders.
+const relistAfter = 5 * time.Second
+
+// Book separates holdings that the broker keeps apart. Each book only
+// holds a non-negative quantity.
+type Book string
+
+const (
+	BookCash        Book = "cash"
+	BookMarginLong  Book = "margin-long"  // 買建
+	BookMarginShort Book = "margin-short" // 売建
+)
+
+// Position is the local view of one symbol in one book. Money fields are in
+// yen at model.Price precision.
+type Position struct {
+	Symbol   string
+	Book     Book
+	Quantity model.Quantity
+	AvgCost  model.Price
+	// Realized is P&L closed since the ledger started.
+	Realized   model.Price
+	Mark       model.Price
+	Unrealized model.Price
+	MarkedAt   time.Time
+	UpdatedAt  time.Time
+}
+
+// Discrepancy is a difference between the ledger and the broker found by
+// Reconcile.
+type Discrepancy struct {
+	Symbol        string
+	Book          Book
+	Local         model.Quantity
+	Broker        model.Quantity
+	LocalAvgCost  model.Price
+	BrokerAvgCost model.Price
+}
+
+func (d Discrepancy) String() string {
+	return fmt.Sprintf("%s %s: local %d @ %s, broker %d @ %s",
+		d.Symbol, d.Book, d.Local, d.LocalAvgCost, d.Broker, d.BrokerAvgCost)
+}
+
+// Source provides broker positions and order metadata. *request.Service
+// satisfies it.
+type Source interface {
+	CashPositions(ctx context.Context, issueCode string) (*request.CashPositionsSnapshot, error)
+	MarginPositions(ctx context.Context, issueCode string) (*request.MarginPositionsSnapshot, error)
+	OrderList(ctx context.Context, params request.OrderParams) (*request.OrderListResponse, error)
+}
+
+type key struct {
+	symbol string
+	book   Book
+}
+
+// Ledger keeps positions, average cost and P&L from EC executions and marks
+// them to market from FD last prices. EC notices do not say whether an
+// order is cash or margin, so each order's sGenkinShinyouKubun comes from
+// Track or, for unknown orders, from CLMOrderList. Fills whose type is not
+// known yet are queued until Retry finds it.
+type Ledger struct {
+	source   Source
+	symbols  map[int]string
+	interval time.Duration
+	onDiff   func([]Discrepancy)
+	now      func() time.Time
+
+	listMu   sync.Mutex
+	lastList time.Time
+
+	mu        sync.Mutex
+	book      *event.QuoteBook
+	positions map[key]*Position
+	marks     map[string]model.Price
+	kinds     map[string]request.CashOrMargin
+	queued    []event.EC
+	lastENO   int64
+}
+
+type Option func(*Ledger)
+
+// WithReconcile sets how often Watch reconciles and where discrepancies are
+// reported. report may be nil.
+func WithReconcile(every time.Duration, report func([]Discrepancy)) Option {
+	return func(l *Ledger) {
+		if every > 0 {
+			l.interval = every
+		}
+		l.onDiff = report
+	}
+}
+
+func withClock(now func() time.Time) Option {
+	return func(l *Ledger) {
+		l.now = now
+	}
+}
+
+// NewLedger marks FD rows mapped to issue codes by symbols (p_gyou_no to
+// sIssueCode), as registered with the event service.
+func NewLedger(source Source, symbols map[int]string, opts ...Option) *Ledger {
+	copied := make(map[int]string, len(symbols))
+	for row, symbol := range symbols {
+		copied[row] = symbol
+	}
+	l := &Ledger{
+		source:    source,
+		symbols:   copied,
+		interval:  DefaultReconcileInterval,
+		now:       time.Now,
+		book:      event.NewQuoteBook(),
+		positions: make(map[key]*Position),
+		marks:     make(map[string]model.Price),
+		kinds:     make(map[string]request.CashOrMargin),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(l)
+		}
+	}
+	return l
+}
+
+// Track records the cash/margin type of an order this process placed.
+// Queued fills for it are applied by the next Retry.
+func (l *Ledger) Track(orderNumber string, kind request.CashOrMargin) {
+	l.mu.Lock()
+	l.kinds[strings.TrimSpace(orderNumber)] = kind
+	l.mu.Unlock()
+}
+
+// Load replaces every position with the broker's lists. Realized P&L is
+// kept.
+func (l *Ledger) Load(ctx context.Context) error {
+	broker, err := l.brokerPositions(ctx)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for k, pos := range l.positions {
+		if _, ok := broker[k]; !ok {
+			pos.Quantity, pos.AvgCost = 0, 0
+			pos.UpdatedAt = now
+			l.markLocked(pos)
+		}
+	}
+	for k, held := range broker {
+		pos := l.positionLocked(k)
+		pos.Quantity, pos.AvgCost = held.quantity, held.avgCost
+		pos.UpdatedAt = now
+		l.markLocked(pos)
+	}
+	return nil
+}
+
+// Reconcile compares quantities with the broker's lists without changing
+// the ledger. Fills still in flight show up as transient differences.
+func (l *Ledger) Reconcile(ctx context.Context) ([]Discrepancy, error) {
+	broker, err := l.brokerPositions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	keys := make(map[key]bool, len(broker)+len(l.positions))
+	for k := range broker {
+		keys[k] = true
+	}
+	for k := range l.positions {
+		keys[k] = true
+	}
+	var out []Discrepancy
+	for k := range keys {
+		local := l.positions[k]
+		held := broker[k]
+		var localQty model.Quantity
+		var localCost model.Price
+		if local != nil {
+			localQty, localCost = local.Quantity, local.AvgCost
+		}
+		if localQty == held.quantity {
+			continue
+		}
+		out = append(out, Discrepancy{
+			Symbol:        k.symbol,
+			Book:          k.book,
+			Local:         localQty,
+			Broker:        held.quantity,
+			LocalAvgCost:  localCost,
+			BrokerAvgCost: held.avgCost,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Symbol != out[j].Symbol {
+			return out[i].Symbol < out[j].Symbol
+		}
+		return out[i].Book < out[j].Book
+	})
+	return out, nil
+}
+
+type holding struct {
+	quantity model.Quantity
+	avgCost  model.Price
+}
+
+// brokerPositions sums CashPositions (all tax accounts) and margin lots by
+// symbol and book.
+func (l *Ledger) brokerPositions(ctx context.Context) (map[key]holding, error) {
+	cash, err := l.source.CashPositions(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	margin, err := l.source.MarginPositions(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	cost := make(map[key]model.Price)
+	out := make(map[key]holding)
+	add := func(k key, pos model.Position) {
+		if pos.Quantity <= 0 {
+			return
+		}
+		held := out[k]
+		held.quantity += pos.Quantity
+		cost[k] += pos.AvgPrice.Mul(pos.Quantity)
+		out[k] = held
+	}
+	for _, pos := range cash.Positions {
+		add(key{symbol: strings.TrimSpace(pos.Symbol), book: BookCash}, pos)
+	}
+	for _, pos := range margin.Positions {
+		book := BookMarginLong
+		if request.Side(strings.TrimSpace(pos.Raw.Value("sOrderBaibaiKubun"))) == request.SideSell {
+			book = BookMarginShort
+		}
+		add(key{symbol: strings.TrimSpace(pos.Symbol), book: book}, pos)
+	}
+	for k, held := range out {
+		held.avgCost = cost[k].Div(int64(held.quantity))
+		out[k] = held
+	}
+	return out, nil
+}
+
+// Apply handles EC executions and FD last prices. Other events are ignored.
+func (l *Ledger) Apply(ctx context.Context, ev event.Event) error {
+	switch ev := ev.(type) {
+	case event.FD:
+		l.applyFD(ev)
+	case event.EC:
+		return l.applyEC(ctx, ev)
+	}
+	return nil
+}
+
+func (l *Ledger) applyFD(fd event.FD) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	quotes := l.book.Apply(fd)
+	index := 0
+	for _, row := range fd.Rows {
+		if row.Fields == nil || index >= len(quotes) {
+			continue
+		}
+		quote := quotes[index]
+		index++
+		symbol := l.symbols[row.Row]
+		last, ok := quote.LastPrice()
+		if symbol == "" || !ok || last <= 0 {
+			continue
+		}
+		l.markSymbolLocked(symbol, last)
+	}
+}
+
+// Mark sets the price used for unrealized P&L on symbol.
+func (l *Ledger) Mark(symbol string, price model.Price) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.markSymbolLocked(strings.TrimSpace(symbol), price)
+}
+
+func (l *Ledger) markSymbolLocked(symbol string, price model.Price) {
+	l.marks[symbol] = price
+	for k, pos := range l.positions {
+		if k.symbol == symbol {
+			pos.MarkedAt = l.now()
+			l.markLocked(pos)
+		}
+	}
+}
+
+func (l *Ledger) markLocked(pos *Position) {
+	mark, ok := l.marks[pos.Symbol]
+	pos.Mark = mark
+	if !ok || mark <= 0 || pos.Quantity == 0 {
+		pos.Unrealized = 0
+		return
+	}
+	diff := mark - pos.AvgCost
+	if pos.Book == BookMarginShort {
+		diff = -diff
+	}
+	pos.Unrealized = diff.Mul(pos.Quantity)
+}
+
+func (l *Ledger) applyEC(ctx context.Context, ec event.EC) error {
+	exec, ok := ec.Execution()
+	if !ok || exec.Quantity <= 0 {
+		return nil
+	}
+	number := strings.TrimSpace(ec.OrderNumber)
+
+	l.mu.Lock()
+	if eno, err := strconv.ParseInt(strings.TrimSpace(ec.EventNo), 10, 64); err == nil {
+		if l.lastENO > 0 && eno <= l.lastENO {
+			l.mu.Unlock()
+			return nil // already seen
+		}
+		l.lastENO = eno
+	}
+	kind, known := l.kinds[number]
+	l.mu.Unlock()
+
+	if !known {
+		var err error
+		kind, known, err = l.lookupKind(ctx, number)
+		if err != nil || !known {
+			l.mu.Lock()
+			l.queued = append(l.queued, ec)
+			l.mu.Unlock()
+		}
+		if err != nil {
+			return err
+		}
+		if !known {
+			return fmt.Errorf("tachibanashi: portfolio: cash/margin type unknown for order %s; fill queued", number)
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.fillLocked(kind, ec)
+}
+
+// fillLocked applies one execution. A close larger than the position
+// closes what is held and reports the excess. l.mu must be held.
+func (l *Ledger) fillLocked(kind request.CashOrMargin, ec event.EC) error {
+	exec, _ := ec.Execution()
+	side := request.Side(strings.TrimSpace(ec.Side))
+	book, opening, ok := Classify(kind, side)
+	if !ok {
+		return nil // 現引/現渡 and unknown sides do not trade shares here
+	}
+	pos := l.positionLocked(key{symbol: strings.TrimSpace(exec.Symbol), book: book})
+	var err error
+	if opening {
+		cost := pos.AvgCost.Mul(pos.Quantity) + exec.Price.Mul(exec.Quantity)
+		pos.Quantity += exec.Quantity
+		pos.AvgCost = cost.Div(int64(pos.Quantity))
+	} else {
+		qty := min(exec.Quantity, pos.Quantity)
+		if excess := exec.Quantity - qty; excess > 0 {
+			err = fmt.Errorf("tachibanashi: portfolio: order %s closes %d %s %s but only %d is held; %d ignored",
+				strings.TrimSpace(ec.OrderNumber), exec.Quantity, pos.Symbol, book, qty, excess)
+		}
+		diff := exec.Price - pos.AvgCost
+		if book == BookMarginShort {
+			diff = -diff
+		}
+		pos.Realized += diff.Mul(qty)
+		pos.Quantity -= qty
+		if pos.Quantity == 0 {
+			pos.AvgCost = 0
+		}
+	}
+	pos.UpdatedAt = l.now()
+	l.markLocked(pos)
+	return err
+}
+
+// Retry applies queued fills whose cash/margin type is now known from
+// Track or CLMOrderList. Watch calls it every interval.
+func (l *Ledger) Retry(ctx context.Context) error {
+	l.mu.Lock()
+	queued := l.queued
+	l.mu.Unlock()
+	if len(queued) == 0 {
+		return nil
+	}
+	var errs []error
+	for _, ec := range queued {
+		number := strings.TrimSpace(ec.OrderNumber)
+		if _, _, err := l.lookupKind(ctx, number); err != nil {
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	kept := l.queued[:0]
+	for _, ec := range l.queued {
+		kind, ok := l.kinds[strings.TrimSpace(ec.OrderNumber)]
+		if !ok {
+			kept = append(kept, ec)
+			continue
+		}
+		if err := l.fillLocked(kind, ec); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	l.queued = kept
+	return errors.Join(errs...)
+}
+
+// Queued returns the number of fills waiting for their order's type.
+func (l *Ledger) Queued() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.queued)
+}
+
+// lookupKind reads sGenkinShinyouKubun for every listed order. Lists are
+// fetched at most once per few seconds.
+func (l *Ledger) lookupKind(ctx context.Context, number string) (request.CashOrMargin, bool, error) {
+	l.listMu.Lock()
+	defer l.listMu.Unlock()
+	l.mu.Lock()
+	kind, ok := l.kinds[number]
+	l.mu.Unlock()
+	if ok {
+		return kind, true, nil
+	}
+	if !l.lastList.IsZero() && l.now().Sub(l.lastList) < relistAfter {
+		return "", false, nil
+	}
+	l.lastList = l.now()
+	resp, err := l.source.OrderList(ctx, request.OrderParams{})
+	if err != nil {
+		return "", false, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, entry := range resp.Entries {
+		kind := request.ListedCashOrMargin(entry.Fields)
+		if id := strings.TrimSpace(entry.OrderID); id != "" && kind != "" {
+			l.kinds[id] = kind
+		}
+	}
+	kind, ok = l.kinds[number]
+	return kind, ok, nil
+}
+
+// Classify maps an order type and side to the book it trades and whether
+// the fill adds to it.
+func Classify(kind request.CashOrMargin, side request.Side) (Book, bool, bool) {
+	switch {
+	case kind == request.Cash && side == request.SideBuy:
+		return BookCash, true, true
+	case kind == request.Cash && side == request.SideSell:
+		return BookCash, false, true
+	case kind.IsMargin() && !kind.IsClose() && side == request.SideBuy:
+		return BookMarginLong, true, true
+	case kind.IsMargin() && !kind.IsClose() && side == request.SideSell:
+		return BookMarginShort, true, true
+	case kind.IsClose() && side == request.SideSell:
+		return BookMarginLong, false, true
+	case kind.IsClose() && side == request.SideBuy:
+		return BookMarginShort, false, true
+	}
+	return "", false, false
+}
+
+func (l *Ledger) positionLocked(k key) *Position {
+	pos, ok := l.positions[k]
+	if !ok {
+		pos = &Position{Symbol: k.symbol, Book: k.book}
+		l.positions[k] = pos
+	}
+	return pos
+}
+
+// Watch applies events until the channel closes or ctx is done, and
+// retries queued fills and reconciles every interval. Errors are passed to onError, which may be nil.
+func (l *Ledger) Watch(ctx context.Context, events <-chan event.Event, onError func(error)) error {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+	report := func(err error) {
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			report(l.Apply(ctx, ev))
+		case <-ticker.C:
+			report(l.Retry(ctx))
+			diffs, err := l.Reconcile(ctx)
+			report(err)
+			if len(diffs) > 0 && l.onDiff != nil {
+				l.onDiff(diffs)
+			}
+		}
+	}
+}
+
+// Position returns one position.
+func (l *Ledger) Position(symbol string, book Book) (Position, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	pos, ok := l.positions[key{symbol: strings.TrimSpace(symbol), book: book}]
+	if !ok {
+		return Position{}, false
+	}
+	return *pos, true
+}
+
+// Positions returns every position, including flat ones with realized
+// P&L, sorted by symbol and book.
+func (l *Ledger) Positions() []Position {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]Position, 0, len(l.positions))
+	for _, pos := range l.positions {
+		out = append(out, *pos)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Symbol != out[j].Symbol {
+			return out[i].Symbol < out[j].Symbol
+		}
+		return out[i].Book < out[j].Book
+	})
+	return out
+}
+
+// PnL returns realized and unrealized P&L across all positions.
+func (l *Ledger) PnL() (realized, unrealized model.Price) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, pos := range l.positions {
+		realized += pos.Realized
+		unrealized += pos.Unrealized
+	}
+	return realized, unrealized
+}
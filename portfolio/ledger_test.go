@@ -0,0 +1,170 @@
+package portfolio
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ueebee/tachibanashi/event"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+type mockSource struct {
+	cash   []model.Position
+	margin []model.Position
+	orders string
+	lists  int
+}
+
+func (m *mockSource) CashPositions(ctx context.Context, issueCode string) (*request.CashPositionsSnapshot, error) {
+	return &request.CashPositionsSnapshot{Positions: m.cash}, nil
+}
+
+func (m *mockSource) MarginPositions(ctx context.Context, issueCode string) (*request.MarginPositionsSnapshot, error) {
+	return &request.MarginPositionsSnapshot{Positions: m.margin}, nil
+}
+
+func (m *mockSource) OrderList(ctx context.Context, params request.OrderParams) (*request.OrderListResponse, error) {
+	m.lists++
+	var resp request.OrderListResponse
+	if err := json.Unmarshal([]byte(m.orders), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func execution(eno, number, side, symbol, price, qty string) event.EC {
+	return event.EC{
+		EventNo:          eno,
+		OrderNumber:      number,
+		Side:             side,
+		Symbol:           symbol,
+		ExecutedPrice:    price,
+		ExecutedQuantity: qty,
+	}
+}
+
+func last(row int, price string) event.FD {
+	return event.FD{Rows: []event.FDRow{{Row: row, Fields: model.Attributes{model.FieldLastPrice: price}}}}
+}
+
+func TestLedgerCashAverageCostAndPnL(t *testing.T) {
+	ledger := NewLedger(&mockSource{}, map[int]string{1: "6501"})
+	ledger.Track("1", request.Cash)
+	ledger.Track("2", request.Cash)
+	ctx := context.Background()
+
+	for _, ev := range []event.Event{
+		execution("1", "1", "3", "6501", "1000", "100"),
+		execution("2", "1", "3", "6501", "1100", "100"),
+		execution("2", "1", "3", "6501", "1100", "100"), // redelivered
+		last(1, "1200"),
+		execution("3", "2", "1", "6501", "1200", "50"),
+	} {
+		if err := ledger.Apply(ctx, ev); err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+	}
+	pos, ok := ledger.Position("6501", BookCash)
+	if !ok || pos.Quantity != 150 || pos.AvgCost != model.Yen(1050) {
+		t.Fatalf("position = %+v", pos)
+	}
+	if pos.Realized != model.Yen(7500) || pos.Unrealized != model.Yen(22500) || pos.Mark != model.Yen(1200) {
+		t.Fatalf("pnl = %s / %s", pos.Realized, pos.Unrealized)
+	}
+}
+
+func TestLedgerMarginShortFromOrderList(t *testing.T) {
+	source := &mockSource{orders: `{"p_errno":"0","sResultCode":"0","aOrderList":[
+{"sOrderOrderNumber":"5","sOrderIssueCode":"7203","sGenkinSinyouKubun":"2"},
+{"sOrderOrderNumber":"6","sOrderIssueCode":"7203","sGenkinSinyouKubun":"4"}
+]}`}
+	ledger := NewLedger(source, map[int]string{2: "7203"})
+	ctx := context.Background()
+
+	if err := ledger.Apply(ctx, execution("1", "5", "1", "7203", "2000", "100")); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	ledger.Apply(ctx, last(2, "1950"))
+	if pos, _ := ledger.Position("7203", BookMarginShort); pos.Quantity != 100 || pos.Unrealized != model.Yen(5000) {
+		t.Fatalf("short = %+v", pos)
+	}
+	if err := ledger.Apply(ctx, execution("2", "6", "3", "7203", "1900", "100")); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if source.lists != 1 {
+		t.Fatalf("order list fetched %d times", source.lists)
+	}
+	pos, _ := ledger.Position("7203", BookMarginShort)
+	if pos.Quantity != 0 || pos.Realized != model.Yen(10000) || pos.Unrealized != 0 {
+		t.Fatalf("closed short = %+v", pos)
+	}
+	if _, ok := ledger.Position("7203", BookMarginLong); ok {
+		t.Fatalf("close fill opened a long")
+	}
+
+	if err := ledger.Apply(ctx, execution("3", "99", "3", "7203", "1900", "100")); err == nil {
+		t.Fatalf("expected error for an order of unknown type")
+	}
+	// The fill is kept, not lost with its p_ENO.
+	if ledger.Queued() != 1 {
+		t.Fatalf("queued = %d", ledger.Queued())
+	}
+	ledger.Track("99", request.Cash)
+	if err := ledger.Retry(ctx); err != nil {
+		t.Fatalf("Retry() error = %v", err)
+	}
+	if pos, _ := ledger.Position("7203", BookCash); pos.Quantity != 100 || ledger.Queued() != 0 {
+		t.Fatalf("queued fill = %+v, queued = %d", pos, ledger.Queued())
+	}
+
+	// Selling more than is held closes the position and reports the rest.
+	ledger.Track("100", request.Cash)
+	if err := ledger.Apply(ctx, execution("4", "100", "1", "7203", "2000", "150")); err == nil {
+		t.Fatalf("expected error for a close larger than the position")
+	}
+	if pos, _ := ledger.Position("7203", BookCash); pos.Quantity != 0 || pos.Realized != model.Yen(10000) {
+		t.Fatalf("over-closed = %+v", pos)
+	}
+}
+
+func TestLedgerReconcileAndLoad(t *testing.T) {
+	source := &mockSource{
+		cash: []model.Position{
+			{Symbol: "6501", Quantity: 100, AvgPrice: model.Yen(1000)},
+			{Symbol: "6501", Quantity: 100, AvgPrice: model.Yen(1200)},
+		},
+		margin: []model.Position{
+			{Symbol: "7203", Quantity: 300, AvgPrice: model.Yen(2000), Raw: model.Attributes{"sOrderBaibaiKubun": "1"}},
+		},
+	}
+	ledger := NewLedger(source, nil)
+	ledger.Track("1", request.Cash)
+	ctx := context.Background()
+	ledger.Apply(ctx, execution("1", "1", "3", "6501", "1000", "100"))
+
+	diffs, err := ledger.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(diffs) != 2 {
+		t.Fatalf("diffs = %v", diffs)
+	}
+	if d := diffs[0]; d.Symbol != "6501" || d.Book != BookCash || d.Local != 100 || d.Broker != 200 || d.BrokerAvgCost != model.Yen(1100) {
+		t.Fatalf("cash diff = %+v", d)
+	}
+	if d := diffs[1]; d.Symbol != "7203" || d.Book != BookMarginShort || d.Local != 0 || d.Broker != 300 {
+		t.Fatalf("margin diff = %+v", d)
+	}
+
+	if err := ledger.Load(ctx); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if diffs, _ := ledger.Reconcile(ctx); len(diffs) != 0 {
+		t.Fatalf("diffs after Load = %v", diffs)
+	}
+	if pos, _ := ledger.Position("6501", BookCash); pos.Quantity != 200 || pos.AvgCost != model.Yen(1100) {
+		t.Fatalf("loaded = %+v", pos)
+	}
+}
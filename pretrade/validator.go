@@ -0,0 +1,316 @@
+package pretrade
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/master"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+	"github.com/ueebee/tachibanashi/ticks"
+)
+
+// DefaultSystemKouza is sSystemKouzaKubun for e支店 accounts.
+const DefaultSystemKouza = "102"
+
+// Restriction codes (sTeisiKubun) used by IssueSizyouKiseiKabu.
+const (
+	restrictionNone      = "0"
+	restrictionAll       = "1" // 取引禁止
+	restrictionMarket    = "2" // 成行禁止
+	restrictionOddLot    = "3" // 端株禁止
+	haltCodeHalted       = "9" // sBaibaiTeisiC 停止中
+	marginCodeLendable   = "1" // sSinyouC 貸借銘柄
+	marginCodeSystemOnly = "2" // sSinyouC 信用制度銘柄
+)
+
+// Violations lists every check an order failed.
+type Violations []*terrors.ValidationError
+
+func (v Violations) Error() string {
+	if len(v) == 0 {
+		return "tachibanashi: validation error"
+	}
+	parts := make([]string, 0, len(v))
+	for _, violation := range v {
+		parts = append(parts, violation.Field+": "+violation.Reason)
+	}
+	return "tachibanashi: pre-trade validation failed: " + strings.Join(parts, "; ")
+}
+
+func (v Violations) Unwrap() []error {
+	errs := make([]error, 0, len(v))
+	for _, violation := range v {
+		errs = append(errs, violation)
+	}
+	return errs
+}
+
+// Validator checks orders against master data before they are sent.
+type Validator struct {
+	store       master.MasterStore
+	systemKouza string
+	nextDay     bool
+	now         func() time.Time
+	resolver    *ticks.Resolver
+}
+
+type Option func(*Validator)
+
+// WithSystemKouza overrides sSystemKouzaKubun used for restriction lookups.
+func WithSystemKouza(code string) Option {
+	return func(v *Validator) {
+		v.systemKouza = strings.TrimSpace(code)
+	}
+}
+
+// WithNextDay validates against the next business day (...Yoku) values,
+// e.g. for orders placed after the close.
+func WithNextDay() Option {
+	return func(v *Validator) {
+		v.nextDay = true
+	}
+}
+
+// WithClock sets the clock used to pick the effective CLMYobine table.
+func WithClock(now func() time.Time) Option {
+	return func(v *Validator) {
+		v.now = now
+	}
+}
+
+func NewValidator(store master.MasterStore, opts ...Option) *Validator {
+	v := &Validator{
+		store:       store,
+		systemKouza: DefaultSystemKouza,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(v)
+		}
+	}
+	resolverOpts := []ticks.Option{ticks.WithClock(v.now)}
+	if v.nextDay {
+		resolverOpts = append(resolverOpts, ticks.WithNextDay())
+	}
+	v.resolver = ticks.NewResolver(store, resolverOpts...)
+	return v
+}
+
+// ValidateNewOrder returns Violations when the order would be rejected.
+func (v *Validator) ValidateNewOrder(order request.NewOrder) error {
+	var out Violations
+	if err := order.Validate(); err != nil {
+		if validation, ok := err.(*terrors.ValidationError); ok {
+			out = append(out, validation)
+		} else {
+			return err
+		}
+	}
+	out = append(out, v.check(order)...)
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// ValidateCorrection checks a KabuCorrectOrder. Pass the original order with
+// the corrected price and quantity applied.
+func (v *Validator) ValidateCorrection(order request.NewOrder) error {
+	return v.ValidateNewOrder(order)
+}
+
+func (v *Validator) check(order request.NewOrder) Violations {
+	symbol := strings.TrimSpace(order.Symbol)
+	market := strings.TrimSpace(order.Market)
+	if symbol == "" || market == "" || v.store == nil {
+		return nil
+	}
+
+	var out Violations
+	sizyou, ok := v.store.Get(master.MasterIssueSizyouMstKabu, master.JoinIndex(symbol, market))
+	if !ok {
+		return Violations{{Field: "sIssueCode", Reason: "unknown issue/market: " + symbol + "/" + market}}
+	}
+	issue, hasIssue := v.store.Get(master.MasterIssueMstKabu, symbol)
+
+	if hasIssue && strings.TrimSpace(issue.Fields.Value(master.IssueKabuFieldBaibaiTeisiC)) == haltCodeHalted {
+		out = append(out, &terrors.ValidationError{Field: "sBaibaiTeisiC", Reason: "trading halted"})
+	}
+
+	if lot := v.lotSize(sizyou.Fields, issue.Fields); lot > 0 && int64(order.Quantity)%lot != 0 {
+		out = append(out, &terrors.ValidationError{
+			Field:  "sOrderSuryou",
+			Reason: "quantity " + strconv.FormatInt(int64(order.Quantity), 10) + " is not a multiple of lot " + strconv.FormatInt(lot, 10),
+		})
+	}
+
+	for _, price := range orderPrices(order) {
+		out = append(out, v.checkPrice(price.field, price.value, symbol, market, sizyou.Fields)...)
+	}
+
+	out = append(out, v.checkRestrictions(order, symbol, market)...)
+	out = append(out, checkMarginEligibility(order, sizyou.Fields)...)
+	return out
+}
+
+type pricedField struct {
+	field string
+	value model.Price
+}
+
+func orderPrices(order request.NewOrder) []pricedField {
+	var out []pricedField
+	if order.Price > 0 && order.Stop.Type != request.StopOnly {
+		out = append(out, pricedField{field: "sOrderPrice", value: order.Price})
+	}
+	if order.Stop.Type == request.StopOnly || order.Stop.Type == request.StopWithNormal {
+		if order.Stop.Trigger > 0 {
+			out = append(out, pricedField{field: "sGyakusasiZyouken", value: order.Stop.Trigger})
+		}
+		if order.Stop.Price > 0 {
+			out = append(out, pricedField{field: "sGyakusasiPrice", value: order.Stop.Price})
+		}
+	}
+	return out
+}
+
+func (v *Validator) lotSize(sizyou, issue model.Attributes) int64 {
+	sizyouKey := master.IssueSizyouKabuFieldSizyoubetuBaibaiTani
+	issueKey := master.IssueKabuFieldBaibaiTani
+	if v.nextDay {
+		sizyouKey = master.IssueSizyouKabuFieldSizyoubetuBaibaiTaniYoku
+		issueKey = master.IssueKabuFieldBaibaiTaniYoku
+	}
+	if lot, ok := master.ParseLot(sizyou.Value(sizyouKey)); ok {
+		return int64(lot)
+	}
+	if lot, ok := master.ParseLot(issue.Value(issueKey)); ok {
+		return int64(lot)
+	}
+	return 0
+}
+
+func (v *Validator) checkPrice(field string, value model.Price, symbol, market string, sizyou model.Attributes) Violations {
+	var out Violations
+
+	minimum, minErr := model.ParsePrice(sizyou.Value(master.IssueSizyouKabuFieldNehabaMin))
+	maximum, maxErr := model.ParsePrice(sizyou.Value(master.IssueSizyouKabuFieldNehabaMax))
+	if minErr == nil && minimum > 0 && value < minimum {
+		out = append(out, &terrors.ValidationError{
+			Field:  field,
+			Reason: "price " + value.String() + " below band minimum " + minimum.String(),
+		})
+	}
+	if maxErr == nil && maximum > 0 && value > maximum {
+		out = append(out, &terrors.ValidationError{
+			Field:  field,
+			Reason: "price " + value.String() + " above band maximum " + maximum.String(),
+		})
+	}
+
+	table, err := v.resolver.ForIssue(symbol, market)
+	if err != nil {
+		if validation, ok := err.(*terrors.ValidationError); ok {
+			out = append(out, validation)
+		}
+		return out
+	}
+	if !table.Valid(value) {
+		out = append(out, &terrors.ValidationError{
+			Field:  field,
+			Reason: "price " + value.String() + " is not on tick " + table.TickAt(value).String(),
+		})
+	}
+	return out
+}
+
+func (v *Validator) checkRestrictions(order request.NewOrder, symbol, market string) Violations {
+	record, ok := v.store.Get(master.MasterIssueSizyouKiseiKabu, master.JoinIndex(v.systemKouza, symbol, market))
+	if !ok {
+		return nil
+	}
+	var out Violations
+	if code := strings.TrimSpace(record.Fields.Value(master.IssueKiseiKabuFieldTeisiKubun)); code == restrictionAll {
+		out = append(out, &terrors.ValidationError{Field: master.IssueKiseiKabuFieldTeisiKubun, Reason: "trading prohibited"})
+	}
+
+	field, label := restrictionField(order)
+	if field == "" {
+		return out
+	}
+	if v.nextDay {
+		field += "Yoku"
+	}
+	switch strings.TrimSpace(record.Fields.Value(field)) {
+	case restrictionAll:
+		out = append(out, &terrors.ValidationError{Field: field, Reason: label + " prohibited"})
+	case restrictionMarket:
+		if order.Price == 0 && order.Stop.Type != request.StopOnly {
+			out = append(out, &terrors.ValidationError{Field: field, Reason: label + " market orders prohibited"})
+		}
+	case restrictionOddLot, restrictionNone, "":
+	}
+	return out
+}
+
+func restrictionField(order request.NewOrder) (string, string) {
+	buy := order.Side == request.SideBuy
+	switch order.CashOrMargin {
+	case request.Cash:
+		if buy {
+			return master.IssueKiseiKabuFieldGenbutuKaituke, "cash buy"
+		}
+		return master.IssueKiseiKabuFieldGenbutuUrituke, "cash sell"
+	case request.MarginSystemOpen:
+		if buy {
+			return master.IssueKiseiKabuFieldSeidoSinyouSinkiKaitate, "system margin buy"
+		}
+		return master.IssueKiseiKabuFieldSeidoSinyouSinkiUritate, "system margin short"
+	case request.MarginGeneralOpen:
+		if buy {
+			return master.IssueKiseiKabuFieldIppanSinyouSinkiKaitate, "general margin buy"
+		}
+		return master.IssueKiseiKabuFieldIppanSinyouSinkiUritate, "general margin short"
+	case request.MarginSystemClose:
+		switch order.Side {
+		case request.SideReceive:
+			return master.IssueKiseiKabuFieldSeidoSinyouGenbiki, "system margin genbiki"
+		case request.SideDeliver:
+			return master.IssueKiseiKabuFieldSeidoSinyouGenwatasi, "system margin genwatasi"
+		case request.SideBuy:
+			return master.IssueKiseiKabuFieldSeidoSinyouKaiHensai, "system margin buy close"
+		default:
+			return master.IssueKiseiKabuFieldSeidoSinyouUriHensai, "system margin sell close"
+		}
+	case request.MarginGeneralClose:
+		switch order.Side {
+		case request.SideReceive:
+			return master.IssueKiseiKabuFieldIppanSinyouGenbiki, "general margin genbiki"
+		case request.SideDeliver:
+			return master.IssueKiseiKabuFieldIppanSinyouGenwatasi, "general margin genwatasi"
+		case request.SideBuy:
+			return master.IssueKiseiKabuFieldIppanSinyouKaiHensai, "general margin buy close"
+		default:
+			return master.IssueKiseiKabuFieldIppanSinyouUriHensai, "general margin sell close"
+		}
+	}
+	return "", ""
+}
+
+func checkMarginEligibility(order request.NewOrder, sizyou model.Attributes) Violations {
+	if order.CashOrMargin != request.MarginSystemOpen {
+		return nil
+	}
+	code := strings.TrimSpace(sizyou.Value(master.IssueSizyouKabuFieldSinyouC))
+	switch {
+	case order.Side == request.SideSell && code != marginCodeLendable:
+		return Violations{{Field: master.IssueSizyouKabuFieldSinyouC, Reason: "system margin short requires a lendable (taisyaku) issue"}}
+	case order.Side == request.SideBuy && code != marginCodeLendable && code != marginCodeSystemOnly:
+		return Violations{{Field: master.IssueSizyouKabuFieldSinyouC, Reason: "issue is not eligible for system margin"}}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package pretrade
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/master"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+func testStore() *master.MemoryStore {
+	store := master.NewMemoryStore()
+	store.Upsert(master.MasterIssueMstKabu, "7203", model.Attributes{
+		master.IssueKabuFieldBaibaiTani:     "100",
+		master.IssueKabuFieldBaibaiTeisiC:   " ",
+		master.IssueKabuFieldBaibaiTaniYoku: "100",
+	}, master.UpdateMeta{})
+	store.Upsert(master.MasterIssueSizyouMstKabu, master.JoinIndex("7203", "00"), model.Attributes{
+		master.IssueSizyouKabuFieldNehabaMin:            "2000.000000",
+		master.IssueSizyouKabuFieldNehabaMax:            "4000.000000",
+		master.IssueSizyouKabuFieldSinyouC:              "2",
+		master.IssueSizyouKabuFieldYobineTaniNumber:     "101",
+		master.IssueSizyouKabuFieldSizyoubetuBaibaiTani: "0",
+	}, master.UpdateMeta{})
+	store.Upsert(master.MasterYobine, master.JoinIndex("101", "20140101"), model.Attributes{
+		master.YobineFieldTaniNumber:  "101",
+		master.YobineFieldTekiyouDay:  "20140101",
+		master.YobineFieldKizunPrice1: "3000.000000",
+		master.YobineFieldTanka1:      "1.000000",
+		master.YobineFieldKizunPrice2: "999999999.000000",
+		master.YobineFieldTanka2:      "5.000000",
+	}, master.UpdateMeta{})
+	store.Upsert(master.MasterYobine, master.JoinIndex("101", "20990101"), model.Attributes{
+		master.YobineFieldTaniNumber:  "101",
+		master.YobineFieldTekiyouDay:  "20990101",
+		master.YobineFieldKizunPrice1: "999999999.000000",
+		master.YobineFieldTanka1:      "100.000000",
+	}, master.UpdateMeta{})
+	store.Upsert(master.MasterIssueSizyouKiseiKabu, master.JoinIndex("102", "7203", "00"), model.Attributes{
+		master.IssueKiseiKabuFieldTeisiKubun:              "0",
+		master.IssueKiseiKabuFieldGenbutuKaituke:          "0",
+		master.IssueKiseiKabuFieldGenbutuUrituke:          "2",
+		master.IssueKiseiKabuFieldSeidoSinyouSinkiKaitate: "0",
+		master.IssueKiseiKabuFieldSeidoSinyouSinkiUritate: "1",
+	}, master.UpdateMeta{})
+	return store
+}
+
+func testValidator(store *master.MemoryStore) *Validator {
+	clock := func() time.Time { return time.Date(2024, 6, 3, 9, 0, 0, 0, model.JST) }
+	return NewValidator(store, WithClock(clock))
+}
+
+func violationFields(t *testing.T, err error) []string {
+	t.Helper()
+	var violations Violations
+	if !errors.As(err, &violations) {
+		t.Fatalf("expected Violations, got %v", err)
+	}
+	fields := make([]string, 0, len(violations))
+	for _, v := range violations {
+		fields = append(fields, v.Field)
+	}
+	return fields
+}
+
+func TestValidateNewOrderAccepts(t *testing.T) {
+	v := testValidator(testStore())
+	if err := v.ValidateNewOrder(request.LimitBuy("7203", "00", model.Yen(3005), 200)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := v.ValidateNewOrder(request.LimitBuy("7203", "00", model.Yen(2999), 100)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestValidateNewOrderCollectsViolations(t *testing.T) {
+	v := testValidator(testStore())
+	err := v.ValidateNewOrder(request.LimitBuy("7203", "00", model.Yen(4003), 150))
+	fields := violationFields(t, err)
+	want := []string{"sOrderSuryou", "sOrderPrice", "sOrderPrice"}
+	if len(fields) != len(want) {
+		t.Fatalf("fields = %v, want %v", fields, want)
+	}
+	for i := range want {
+		if fields[i] != want[i] {
+			t.Fatalf("fields = %v, want %v", fields, want)
+		}
+	}
+	var validation *terrors.ValidationError
+	if !errors.As(err, &validation) {
+		t.Fatalf("expected errors.As to reach ValidationError")
+	}
+}
+
+func TestValidateNewOrderHaltAndUnknown(t *testing.T) {
+	store := testStore()
+	store.Upsert(master.MasterIssueMstKabu, "7203", model.Attributes{
+		master.IssueKabuFieldBaibaiTani:   "100",
+		master.IssueKabuFieldBaibaiTeisiC: "9",
+	}, master.UpdateMeta{})
+	v := testValidator(store)
+	fields := violationFields(t, v.ValidateNewOrder(request.LimitBuy("7203", "00", model.Yen(3000), 100)))
+	if len(fields) != 1 || fields[0] != "sBaibaiTeisiC" {
+		t.Fatalf("fields = %v", fields)
+	}
+
+	fields = violationFields(t, v.ValidateNewOrder(request.LimitBuy("9999", "00", model.Yen(3000), 100)))
+	if len(fields) != 1 || fields[0] != "sIssueCode" {
+		t.Fatalf("fields = %v", fields)
+	}
+}
+
+func TestValidateNewOrderRestrictions(t *testing.T) {
+	v := testValidator(testStore())
+
+	fields := violationFields(t, v.ValidateNewOrder(request.MarketSell("7203", "00", 100)))
+	if len(fields) != 1 || fields[0] != master.IssueKiseiKabuFieldGenbutuUrituke {
+		t.Fatalf("fields = %v", fields)
+	}
+	if err := v.ValidateNewOrder(request.LimitSell("7203", "00", model.Yen(3000), 100)); err != nil {
+		t.Fatalf("limit sell should pass: %v", err)
+	}
+
+	short := request.LimitSell("7203", "00", model.Yen(3000), 100).Margin(request.MarginSystemOpen)
+	fields = violationFields(t, v.ValidateNewOrder(short))
+	if len(fields) != 2 || fields[0] != master.IssueKiseiKabuFieldSeidoSinyouSinkiUritate || fields[1] != master.IssueSizyouKabuFieldSinyouC {
+		t.Fatalf("fields = %v", fields)
+	}
+
+	long := request.LimitBuy("7203", "00", model.Yen(3000), 100).Margin(request.MarginSystemOpen)
+	if err := v.ValidateNewOrder(long); err != nil {
+		t.Fatalf("system margin buy should pass: %v", err)
+	}
+}
+
+func TestValidateStopPrices(t *testing.T) {
+	v := testValidator(testStore())
+	order := request.LimitBuy("7203", "00", 0, 100).WithStop(request.StopOrder{
+		Type:    request.StopOnly,
+		Trigger: model.Yen(3002),
+		Price:   model.Yen(3003),
+	})
+	fields := violationFields(t, v.ValidateCorrection(order))
+	if len(fields) != 2 || fields[0] != "sGyakusasiZyouken" || fields[1] != "sGyakusasiPrice" {
+		t.Fatalf("fields = %v", fields)
+	}
+}
@@ -0,0 +1,174 @@
+package price
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ueebee/tachibanashi/model"
+)
+
+// History row keys (CLMMfdsGetMarketPriceHistory).
+const (
+	HistoryFieldOpen          = model.FieldOpenPrice
+	HistoryFieldHigh          = model.FieldHighPrice
+	HistoryFieldLow           = model.FieldLowPrice
+	HistoryFieldClose         = model.FieldLastPrice
+	HistoryFieldVolume        = model.FieldVolume
+	HistoryFieldSplitBefore   = "pSPUO"
+	HistoryFieldSplitAfter    = "pSPUC"
+	HistoryFieldSplitRatio    = "pSPUK"
+	HistoryFieldDiscontinuity = "xDCFS"
+)
+
+// Discontinuity markers (xDCFS) that change the share count. History rows
+// normally carry no xDCFS, so AdjustForSplits keys off the split fields.
+const (
+	DiscontinuitySplit         = "分"
+	DiscontinuityConsolidation = "併"
+)
+
+// DailyBars fetches history and decodes it into typed daily bars.
+func (s *Service) DailyBars(ctx context.Context, issueCode, marketCode string) ([]model.DailyBar, error) {
+	resp, err := s.History(ctx, issueCode, marketCode)
+	if err != nil {
+		return nil, err
+	}
+	return resp.DailyBars()
+}
+
+// DailyBars decodes every history entry into a model.DailyBar.
+func (r *MarketPriceHistoryResponse) DailyBars() ([]model.DailyBar, error) {
+	if r == nil {
+		return nil, nil
+	}
+	bars := make([]model.DailyBar, 0, len(r.Entries))
+	for _, entry := range r.Entries {
+		bar, err := entry.DailyBar(r.IssueCode)
+		if err != nil {
+			return nil, err
+		}
+		bars = append(bars, bar)
+	}
+	return bars, nil
+}
+
+// DailyBar decodes a single history entry. Empty values decode as zero.
+func (e MarketPriceHistoryEntry) DailyBar(symbol string) (model.DailyBar, error) {
+	date, err := model.ParseDate(e.Date)
+	if err != nil {
+		return model.DailyBar{}, err
+	}
+	bar := model.DailyBar{
+		Symbol:        symbol,
+		Date:          date,
+		Discontinuity: strings.TrimSpace(e.Fields.Value(HistoryFieldDiscontinuity)),
+		Raw:           cloneAttributes(e.Fields),
+	}
+
+	prices := []struct {
+		key string
+		dst *model.Price
+	}{
+		{HistoryFieldOpen, &bar.Open},
+		{HistoryFieldHigh, &bar.High},
+		{HistoryFieldLow, &bar.Low},
+		{HistoryFieldClose, &bar.Close},
+	}
+	for _, item := range prices {
+		value, err := parseHistoryNumber(e.Fields.Value(item.key))
+		if err != nil {
+			return model.DailyBar{}, fmt.Errorf("tachibanashi: history %s %s: %w", e.Date, item.key, err)
+		}
+		*item.dst = model.PriceFromFloat(value)
+	}
+
+	volume, err := parseHistoryNumber(e.Fields.Value(HistoryFieldVolume))
+	if err != nil {
+		return model.DailyBar{}, fmt.Errorf("tachibanashi: history %s %s: %w", e.Date, HistoryFieldVolume, err)
+	}
+	bar.Volume = model.Quantity(math.Round(volume))
+
+	ratio, err := splitRatio(e.Fields)
+	if err != nil {
+		return model.DailyBar{}, fmt.Errorf("tachibanashi: history %s: %w", e.Date, err)
+	}
+	bar.SplitRatio = ratio
+	return bar, nil
+}
+
+// AdjustForSplits returns a back-adjusted copy of bars. A split or
+// consolidation is taken from the bars with a SplitRatio, which
+// CLMMfdsGetMarketPriceHistory reports through pSPUK (or pSPUO/pSPUC) on the
+// split day only; prices before it are multiplied by that ratio and volumes
+// divided by it, so the series is continuous with the latest share unit.
+// Input order does not matter; the result is sorted by date ascending.
+func AdjustForSplits(bars []model.DailyBar) []model.DailyBar {
+	if len(bars) == 0 {
+		return nil
+	}
+	out := make([]model.DailyBar, len(bars))
+	copy(out, bars)
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Date.Before(out[j].Date)
+	})
+
+	factor := 1.0
+	for i := len(out) - 1; i >= 0; i-- {
+		bar := &out[i]
+		if factor != 1 {
+			bar.Open = adjustPrice(bar.Open, factor)
+			bar.High = adjustPrice(bar.High, factor)
+			bar.Low = adjustPrice(bar.Low, factor)
+			bar.Close = adjustPrice(bar.Close, factor)
+			bar.Volume = model.Quantity(math.Round(float64(bar.Volume) / factor))
+		}
+		// The ratio is reported on the first day trading in the new unit,
+		// so it applies to every earlier bar.
+		if bar.SplitRatio > 0 && bar.SplitRatio != 1 {
+			factor *= bar.SplitRatio
+		}
+	}
+	return out
+}
+
+func adjustPrice(value model.Price, factor float64) model.Price {
+	return model.PriceFromFloat(value.Float64() * factor)
+}
+
+func splitRatio(fields model.Attributes) (float64, error) {
+	ratio, err := parseHistoryNumber(fields.Value(HistoryFieldSplitRatio))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", HistoryFieldSplitRatio, err)
+	}
+	if ratio > 0 {
+		return ratio, nil
+	}
+	before, err := parseHistoryNumber(fields.Value(HistoryFieldSplitBefore))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", HistoryFieldSplitBefore, err)
+	}
+	after, err := parseHistoryNumber(fields.Value(HistoryFieldSplitAfter))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", HistoryFieldSplitAfter, err)
+	}
+	if before > 0 && after > 0 {
+		return before / after, nil
+	}
+	return 0, nil
+}
+
+func parseHistoryNumber(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", value)
+	}
+	return parsed, nil
+}
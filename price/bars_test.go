@@ -0,0 +1,145 @@
+package price
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ueebee/tachibanashi/auth"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+func TestDailyBarsDecodesHistory(t *testing.T) {
+	response := []byte(`{
+		"sCLMID":"CLMMfdsGetMarketPriceHistory",
+		"sIssueCode":"6501",
+		"sSizyouC":"00",
+		"aCLMMfdsGetMarketPriceHistory":[
+			{"sDate":"20240104","pDOP":"100","pDHP":"110","pDLP":"90","pDPP":"105","pDV":"1000","pSPUO":"","pSPUC":"","pSPUK":""},
+			{"sDate":"20240105","pDOP":"52.5","pDHP":"56","pDLP":"50","pDPP":"55","pDV":"2400","pSPUO":"1","pSPUC":"2","pSPUK":"0.5"}
+		]
+	}`)
+
+	client := &mockClient{
+		urls:     auth.VirtualURLs{Price: "https://example.invalid/price"},
+		response: response,
+	}
+	svc := NewService(client)
+
+	bars, err := svc.DailyBars(context.Background(), "6501", "00")
+	if err != nil {
+		t.Fatalf("DailyBars() error = %v", err)
+	}
+	if len(bars) != 2 {
+		t.Fatalf("bars length mismatch: %d", len(bars))
+	}
+
+	first := bars[0]
+	if first.Symbol != "6501" {
+		t.Fatalf("symbol mismatch: %s", first.Symbol)
+	}
+	want := time.Date(2024, 1, 4, 0, 0, 0, 0, model.JST)
+	if !first.Date.Equal(want) || first.Date.Location() != model.JST {
+		t.Fatalf("date mismatch: %s", first.Date)
+	}
+	if first.Open != model.Yen(100) || first.High != model.Yen(110) || first.Low != model.Yen(90) || first.Close != model.Yen(105) {
+		t.Fatalf("ohlc mismatch: %+v", first)
+	}
+	if first.Volume != 1000 {
+		t.Fatalf("volume mismatch: %d", first.Volume)
+	}
+	if first.SplitRatio != 0 {
+		t.Fatalf("split ratio mismatch: %v", first.SplitRatio)
+	}
+
+	second := bars[1]
+	if second.Open != model.Price(525000) {
+		t.Fatalf("decimal open mismatch: %s", second.Open)
+	}
+	if second.SplitRatio != 0.5 {
+		t.Fatalf("split ratio mismatch: %v", second.SplitRatio)
+	}
+}
+
+func TestDailyBarRejectsInvalidDate(t *testing.T) {
+	entry := MarketPriceHistoryEntry{Date: "2024-01-04", Fields: model.Attributes{}}
+	if _, err := entry.DailyBar("6501"); err == nil {
+		t.Fatalf("expected error for invalid date")
+	}
+}
+
+func TestDailyBarFallsBackToSplitUnits(t *testing.T) {
+	entry := MarketPriceHistoryEntry{
+		Date:   "20240105",
+		Fields: model.Attributes{"pSPUO": "5", "pSPUC": "1", "xDCFS": "併"},
+	}
+	bar, err := entry.DailyBar("6501")
+	if err != nil {
+		t.Fatalf("DailyBar() error = %v", err)
+	}
+	if bar.SplitRatio != 5 {
+		t.Fatalf("split ratio mismatch: %v", bar.SplitRatio)
+	}
+	if bar.Discontinuity != DiscontinuityConsolidation {
+		t.Fatalf("discontinuity mismatch: %s", bar.Discontinuity)
+	}
+}
+
+func TestAdjustForSplitsBackAdjusts(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, model.JST)
+	}
+	bars := []model.DailyBar{
+		{Date: day(9), Open: model.Yen(60), High: model.Yen(60), Low: model.Yen(60), Close: model.Yen(60), Volume: 100},
+		{Date: day(4), Open: model.Yen(200), High: model.Yen(220), Low: model.Yen(180), Close: model.Yen(210), Volume: 1000},
+		{Date: day(5), Open: model.Yen(100), High: model.Yen(110), Low: model.Yen(90), Close: model.Yen(105), Volume: 2000, SplitRatio: 0.5},
+		{Date: day(8), Open: model.Yen(300), High: model.Yen(300), Low: model.Yen(300), Close: model.Yen(300), Volume: 30, SplitRatio: 5},
+	}
+
+	adjusted := AdjustForSplits(bars)
+	if len(adjusted) != 4 {
+		t.Fatalf("adjusted length mismatch: %d", len(adjusted))
+	}
+	if !adjusted[0].Date.Equal(day(4)) {
+		t.Fatalf("adjusted order mismatch: %s", adjusted[0].Date)
+	}
+	// 20240104 sits before both actions: factor 0.5 * 5 = 2.5.
+	if adjusted[0].Close != model.Yen(525) || adjusted[0].Volume != 400 {
+		t.Fatalf("oldest bar mismatch: close=%s volume=%d", adjusted[0].Close, adjusted[0].Volume)
+	}
+	// 20240105 sits before the consolidation only.
+	if adjusted[1].Close != model.Yen(525) || adjusted[1].Volume != 400 {
+		t.Fatalf("split day mismatch: close=%s volume=%d", adjusted[1].Close, adjusted[1].Volume)
+	}
+	if adjusted[2].Close != model.Yen(300) || adjusted[3].Close != model.Yen(60) {
+		t.Fatalf("recent bars should be unchanged")
+	}
+	if bars[1].Close != model.Yen(210) {
+		t.Fatalf("input should not be modified")
+	}
+}
+
+func TestAdjustForSplitsUsesHistorySplitFields(t *testing.T) {
+	// Shaped like CLMMfdsGetMarketPriceHistory: no xDCFS, and the split
+	// fields are blank except on the first day after a 1:2 split.
+	response := &MarketPriceHistoryResponse{
+		IssueCode: "6501",
+		Entries: []MarketPriceHistoryEntry{
+			{Date: "20240104", Fields: model.Attributes{"pDOP": "100", "pDHP": "110", "pDLP": "90", "pDPP": "105", "pDV": "1000", "pSPUO": "", "pSPUC": "", "pSPUK": ""}},
+			{Date: "20240105", Fields: model.Attributes{"pDOP": "52", "pDHP": "56", "pDLP": "50", "pDPP": "55", "pDV": "2400", "pSPUO": "1", "pSPUC": "2", "pSPUK": "0.5"}},
+			{Date: "20240108", Fields: model.Attributes{"pDOP": "55", "pDHP": "57", "pDLP": "54", "pDPP": "56", "pDV": "1800", "pSPUO": "", "pSPUC": "", "pSPUK": ""}},
+		},
+	}
+	bars, err := response.DailyBars()
+	if err != nil {
+		t.Fatalf("DailyBars() error = %v", err)
+	}
+
+	adjusted := AdjustForSplits(bars)
+	if adjusted[0].Open != model.Yen(50) || adjusted[0].Close != model.Price(525000) || adjusted[0].Volume != 2000 {
+		t.Fatalf("pre-split bar = %+v", adjusted[0])
+	}
+	if adjusted[1].Close != model.Yen(55) || adjusted[1].Volume != 2400 || adjusted[2].Close != model.Yen(56) {
+		t.Fatalf("post-split bars changed: %+v", adjusted[1:])
+	}
+}
@@ -0,0 +1,268 @@
+package price
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+const defaultSnapshotConcurrency = 1
+
+// SnapshotAllOptions controls how SnapshotAll spreads requests over time.
+type SnapshotAllOptions struct {
+	// Concurrency caps in-flight requests. Zero or less means 1.
+	Concurrency int
+	// MinInterval is the minimum delay between the start of two requests.
+	MinInterval time.Duration
+}
+
+// ChunkError reports a failed request for one chunk of issue codes.
+type ChunkError struct {
+	Codes []string
+	Err   error
+}
+
+func (e *ChunkError) Error() string {
+	if e == nil {
+		return "tachibanashi: snapshot chunk error"
+	}
+	return fmt.Sprintf("tachibanashi: snapshot chunk codes=%s: %v", strings.Join(e.Codes, ","), e.Err)
+}
+
+func (e *ChunkError) Unwrap() error {
+	if e == nil {
+		return nil
+	}
+	return e.Err
+}
+
+// PartialError is returned by SnapshotAll when some chunks failed.
+// The accompanying snapshot still holds the quotes of successful chunks.
+type PartialError struct {
+	Chunks []*ChunkError
+}
+
+func (e *PartialError) Error() string {
+	if e == nil || len(e.Chunks) == 0 {
+		return "tachibanashi: partial snapshot"
+	}
+	return fmt.Sprintf("tachibanashi: partial snapshot failed_chunks=%d first=%v", len(e.Chunks), e.Chunks[0].Err)
+}
+
+func (e *PartialError) Unwrap() []error {
+	if e == nil {
+		return nil
+	}
+	errs := make([]error, 0, len(e.Chunks))
+	for _, chunk := range e.Chunks {
+		errs = append(errs, chunk)
+	}
+	return errs
+}
+
+// FailedCodes lists the issue codes of every failed chunk.
+func (e *PartialError) FailedCodes() []string {
+	if e == nil {
+		return nil
+	}
+	var codes []string
+	for _, chunk := range e.Chunks {
+		codes = append(codes, chunk.Codes...)
+	}
+	return codes
+}
+
+// SnapshotAll fetches quotes for any number of codes by splitting them into
+// chunks of 120. Failed chunks are reported as a *PartialError alongside the
+// merged snapshot of the chunks that succeeded.
+func (s *Service) SnapshotAll(ctx context.Context, symbols []string, fields []string, opts SnapshotAllOptions) (*QuoteSnapshot, error) {
+	codes := uniqueList(normalizeList(symbols))
+	if len(codes) == 0 {
+		return nil, &terrors.ValidationError{Field: "issue_codes", Reason: "required"}
+	}
+	cols := normalizeList(fields)
+	if len(cols) == 0 {
+		return nil, &terrors.ValidationError{Field: "columns", Reason: "required"}
+	}
+	for _, col := range cols {
+		if !IsValidQuoteField(col) {
+			return nil, &terrors.ValidationError{Field: "columns", Reason: "invalid field: " + col}
+		}
+	}
+
+	chunks := chunkList(codes, maxIssueCodes)
+	results := make([]*MarketPriceResponse, len(chunks))
+	failures := make([]*ChunkError, len(chunks))
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultSnapshotConcurrency
+	}
+	pace := &pacer{interval: opts.MinInterval}
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		// Take a slot first so MinInterval spaces actual request starts,
+		// not chunks still queued behind the concurrency limit.
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			failures[i] = &ChunkError{Codes: chunk, Err: ctx.Err()}
+			continue
+		}
+		if err := pace.wait(ctx); err != nil {
+			<-sem
+			failures[i] = &ChunkError{Codes: chunk, Err: err}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, chunk []string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			resp, err := s.Snapshot(ctx, chunk, cols)
+			if err != nil {
+				failures[i] = &ChunkError{Codes: chunk, Err: err}
+				return
+			}
+			results[i] = resp
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	snapshot := mergeSnapshots(results)
+	var partial *PartialError
+	for _, failure := range failures {
+		if failure == nil {
+			continue
+		}
+		if partial == nil {
+			partial = &PartialError{}
+		}
+		partial.Chunks = append(partial.Chunks, failure)
+	}
+	if partial != nil {
+		return snapshot, partial
+	}
+	return snapshot, nil
+}
+
+// Quote returns the quote for symbol if present.
+func (s *QuoteSnapshot) Quote(symbol string) (model.Quote, bool) {
+	if s == nil {
+		return model.Quote{}, false
+	}
+	if s.BySymbol != nil {
+		quote, ok := s.BySymbol[symbol]
+		return quote, ok
+	}
+	for _, quote := range s.Quotes {
+		if quote.Symbol == symbol {
+			return quote, true
+		}
+	}
+	return model.Quote{}, false
+}
+
+func mergeSnapshots(results []*MarketPriceResponse) *QuoteSnapshot {
+	merged := &MarketPriceResponse{}
+	snapshot := &QuoteSnapshot{
+		BySymbol: make(map[string]model.Quote),
+		Raw:      merged,
+	}
+	first := true
+	for _, resp := range results {
+		if resp == nil {
+			continue
+		}
+		if first {
+			merged.CommonResponse = resp.CommonResponse
+			first = false
+		}
+		merged.Prices = append(merged.Prices, resp.Prices...)
+		for _, entry := range resp.Prices {
+			if _, ok := snapshot.BySymbol[entry.IssueCode]; ok {
+				continue
+			}
+			quote := model.Quote{
+				Symbol: entry.IssueCode,
+				Fields: cloneAttributes(entry.Fields),
+			}
+			snapshot.Quotes = append(snapshot.Quotes, quote)
+			snapshot.BySymbol[entry.IssueCode] = quote
+		}
+	}
+	return snapshot
+}
+
+func chunkList(values []string, size int) [][]string {
+	if size <= 0 || len(values) == 0 {
+		return nil
+	}
+	chunks := make([][]string, 0, (len(values)+size-1)/size)
+	for start := 0; start < len(values); start += size {
+		end := start + size
+		if end > len(values) {
+			end = len(values)
+		}
+		chunks = append(chunks, values[start:end])
+	}
+	return chunks
+}
+
+func uniqueList(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	seen := make(map[string]struct{}, len(values))
+	out := make([]string, 0, len(values))
+	for _, value := range values {
+		if _, ok := seen[value]; ok {
+			continue
+		}
+		seen[value] = struct{}{}
+		out = append(out, value)
+	}
+	return out
+}
+
+type pacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func (p *pacer) wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if p.interval <= 0 {
+		return nil
+	}
+	p.mu.Lock()
+	now := time.Now()
+	at := p.next
+	if at.Before(now) {
+		at = now
+	}
+	p.next = at.Add(p.interval)
+	p.mu.Unlock()
+
+	delay := time.Until(at)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
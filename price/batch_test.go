@@ -0,0 +1,159 @@
+package price
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ueebee/tachibanashi/auth"
+)
+
+type batchClient struct {
+	urls     auth.VirtualURLs
+	mu       sync.Mutex
+	requests []string
+	inFlight int32
+	maxSeen  int32
+	fail     map[string]error
+}
+
+func (m *batchClient) DoJSON(ctx context.Context, method, path string, req, resp any) error {
+	current := atomic.AddInt32(&m.inFlight, 1)
+	defer atomic.AddInt32(&m.inFlight, -1)
+	for {
+		seen := atomic.LoadInt32(&m.maxSeen)
+		if current <= seen || atomic.CompareAndSwapInt32(&m.maxSeen, seen, current) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	r := req.(*MarketPriceRequest)
+	codes := strings.Split(r.TargetIssueCode, ",")
+	m.mu.Lock()
+	m.requests = append(m.requests, r.TargetIssueCode)
+	m.mu.Unlock()
+	if err, ok := m.fail[codes[0]]; ok {
+		return err
+	}
+
+	entries := make([]string, 0, len(codes))
+	for _, code := range codes {
+		entries = append(entries, fmt.Sprintf(`{"sIssueCode":%q,"pDPP":"100"}`, code))
+	}
+	body := `{"sCLMID":"CLMMfdsGetMarketPrice","aCLMMfdsMarketPrice":[` + strings.Join(entries, ",") + `]}`
+	return json.Unmarshal([]byte(body), resp)
+}
+
+func (m *batchClient) VirtualURLs() auth.VirtualURLs {
+	return m.urls
+}
+
+func testCodes(n int) []string {
+	codes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		codes = append(codes, fmt.Sprintf("%04d", 1000+i))
+	}
+	return codes
+}
+
+func TestSnapshotAllChunksAndMerges(t *testing.T) {
+	client := &batchClient{urls: auth.VirtualURLs{Price: "https://example.invalid/price"}}
+	svc := NewService(client)
+
+	codes := append(testCodes(250), "1000")
+	snapshot, err := svc.SnapshotAll(context.Background(), codes, []string{"pDPP"}, SnapshotAllOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatalf("SnapshotAll() error = %v", err)
+	}
+	if len(client.requests) != 3 {
+		t.Fatalf("request count mismatch: %d", len(client.requests))
+	}
+	if got := atomic.LoadInt32(&client.maxSeen); got > 2 {
+		t.Fatalf("concurrency exceeded: %d", got)
+	}
+	if len(snapshot.Quotes) != 250 {
+		t.Fatalf("quotes length mismatch: %d", len(snapshot.Quotes))
+	}
+	if len(snapshot.BySymbol) != 250 {
+		t.Fatalf("symbol map length mismatch: %d", len(snapshot.BySymbol))
+	}
+	if snapshot.Quotes[0].Symbol != "1000" || snapshot.Quotes[249].Symbol != "1249" {
+		t.Fatalf("quote order mismatch: %s %s", snapshot.Quotes[0].Symbol, snapshot.Quotes[249].Symbol)
+	}
+	quote, ok := snapshot.Quote("1200")
+	if !ok {
+		t.Fatalf("quote lookup failed")
+	}
+	if got := quote.Value("pDPP"); got != "100" {
+		t.Fatalf("last price mismatch: %s", got)
+	}
+	if len(snapshot.Raw.Prices) != 250 {
+		t.Fatalf("raw prices length mismatch: %d", len(snapshot.Raw.Prices))
+	}
+}
+
+func TestSnapshotAllReportsPartialErrors(t *testing.T) {
+	failure := errors.New("boom")
+	client := &batchClient{
+		urls: auth.VirtualURLs{Price: "https://example.invalid/price"},
+		fail: map[string]error{"1120": failure},
+	}
+	svc := NewService(client)
+
+	snapshot, err := svc.SnapshotAll(context.Background(), testCodes(250), []string{"pDPP"}, SnapshotAllOptions{Concurrency: 3})
+	var partial *PartialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("expected partial error, got %v", err)
+	}
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected wrapped chunk error")
+	}
+	if len(partial.Chunks) != 1 {
+		t.Fatalf("failed chunk count mismatch: %d", len(partial.Chunks))
+	}
+	if got := len(partial.FailedCodes()); got != 120 {
+		t.Fatalf("failed codes length mismatch: %d", got)
+	}
+	if snapshot == nil || len(snapshot.Quotes) != 130 {
+		t.Fatalf("expected quotes from successful chunks")
+	}
+	if _, ok := snapshot.Quote("1120"); ok {
+		t.Fatalf("unexpected quote from failed chunk")
+	}
+}
+
+func TestSnapshotAllHonorsMinInterval(t *testing.T) {
+	client := &batchClient{urls: auth.VirtualURLs{Price: "https://example.invalid/price"}}
+	svc := NewService(client)
+
+	start := time.Now()
+	_, err := svc.SnapshotAll(context.Background(), testCodes(241), []string{"pDPP"}, SnapshotAllOptions{
+		Concurrency: 3,
+		MinInterval: 30 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("SnapshotAll() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Fatalf("requests not paced: %s", elapsed)
+	}
+}
+
+func TestSnapshotAllRejectsInvalidColumns(t *testing.T) {
+	client := &batchClient{urls: auth.VirtualURLs{Price: "https://example.invalid/price"}}
+	svc := NewService(client)
+
+	if _, err := svc.SnapshotAll(context.Background(), testCodes(10), []string{"bad"}, SnapshotAllOptions{}); err == nil {
+		t.Fatalf("expected error for invalid column")
+	}
+	if len(client.requests) != 0 {
+		t.Fatalf("unexpected requests: %d", len(client.requests))
+	}
+}
@@ -0,0 +1,94 @@
+package price
+
+//go:generate go run ./internal/fieldgen -in ../docs/info_code_mapping.md -out quote_fields_gen.go
+
+// FieldKind describes how a quote field value is encoded.
+type FieldKind int
+
+const (
+	FieldKindText FieldKind = iota
+	FieldKindTime
+	FieldKindPrice
+	FieldKindQuantity
+	FieldKindInteger
+	FieldKindDecimal
+	FieldKindEnum
+)
+
+func (k FieldKind) String() string {
+	switch k {
+	case FieldKindText:
+		return "text"
+	case FieldKindTime:
+		return "time"
+	case FieldKindPrice:
+		return "price"
+	case FieldKindQuantity:
+		return "quantity"
+	case FieldKindInteger:
+		return "integer"
+	case FieldKindDecimal:
+		return "decimal"
+	case FieldKindEnum:
+		return "enum"
+	default:
+		return "unknown"
+	}
+}
+
+// EnumValue is one documented code of an enum field.
+type EnumValue struct {
+	Code  string
+	Label string
+	// Symbol is the on-screen marker given in parentheses, if any.
+	Symbol string
+}
+
+// QuoteFieldInfo is the metadata of one sTargetColumn field.
+type QuoteFieldInfo struct {
+	Name        string
+	Prefix      string
+	Code        string
+	Kind        FieldKind
+	LabelJA     string
+	LabelEN     string
+	Description string
+	Values      []EnumValue
+}
+
+// Decode returns the documented value for an enum code.
+func (i QuoteFieldInfo) Decode(code string) (EnumValue, bool) {
+	for _, value := range i.Values {
+		if value.Code == code {
+			return value, true
+		}
+	}
+	return EnumValue{}, false
+}
+
+// QuoteFieldInfos returns metadata for every known quote field in table order.
+func QuoteFieldInfos() []QuoteFieldInfo {
+	return append([]QuoteFieldInfo(nil), quoteFieldInfos...)
+}
+
+// LookupQuoteField returns metadata for a field name such as "pDPP".
+func LookupQuoteField(name string) (QuoteFieldInfo, bool) {
+	index, ok := quoteFieldIndex[name]
+	if !ok {
+		return QuoteFieldInfo{}, false
+	}
+	return quoteFieldInfos[index], true
+}
+
+// DecodeEnum returns the label of an enum field value.
+func DecodeEnum(name, code string) (string, bool) {
+	info, ok := LookupQuoteField(name)
+	if !ok {
+		return "", false
+	}
+	value, ok := info.Decode(code)
+	if !ok {
+		return "", false
+	}
+	return value.Label, true
+}
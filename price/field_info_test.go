@@ -0,0 +1,97 @@
+package price
+
+import (
+	"testing"
+
+	"github.com/ueebee/tachibanashi/model"
+)
+
+func TestLookupQuoteFieldMetadata(t *testing.T) {
+	info, ok := LookupQuoteField("pDPG")
+	if !ok {
+		t.Fatalf("pDPG not found")
+	}
+	if info.Kind != FieldKindEnum {
+		t.Fatalf("kind mismatch: %s", info.Kind)
+	}
+	if info.LabelJA != "現値前値比較" || info.LabelEN != "Prev compare" {
+		t.Fatalf("label mismatch: %s / %s", info.LabelJA, info.LabelEN)
+	}
+	value, ok := info.Decode("0057")
+	if !ok {
+		t.Fatalf("0057 not decoded")
+	}
+	if value.Label != "現値＞前値" || value.Symbol != "↑" {
+		t.Fatalf("enum value mismatch: %+v", value)
+	}
+
+	info, ok = LookupQuoteField("tDPP:T")
+	if !ok || info.Kind != FieldKindTime {
+		t.Fatalf("tDPP:T metadata mismatch: %+v", info)
+	}
+	if _, ok := LookupQuoteField("bad"); ok {
+		t.Fatalf("unexpected metadata for unknown field")
+	}
+}
+
+func TestQuoteFieldInfosMatchValidFields(t *testing.T) {
+	infos := QuoteFieldInfos()
+	if len(infos) != len(ValidQuoteFields()) {
+		t.Fatalf("metadata length mismatch: %d", len(infos))
+	}
+	for _, info := range infos {
+		if !IsValidQuoteField(info.Name) {
+			t.Fatalf("field %s not valid", info.Name)
+		}
+	}
+	for _, name := range []string{model.FieldLastPrice, model.FieldAskPrice10, model.FieldBidSize1, model.FieldVWAP} {
+		if !IsValidQuoteField(name) {
+			t.Fatalf("model field %s not valid", name)
+		}
+	}
+}
+
+func TestDecodeQuoteFields(t *testing.T) {
+	fields := DecodeQuoteFields(model.Attributes{
+		"pDPP":   "5179",
+		"tDPP:T": "13:59",
+		"pDV":    "123400",
+		"pDJ":    "639000000",
+		"pDYRP":  "-0.35",
+		"pDYWP":  "-18.5",
+		"pGAP10": "5190",
+		"pGBV1":  "300",
+		"pDHF":   "0071",
+		"pDPG":   "0058",
+		"xLISS":  "CCDFD7B2D1",
+		"pVWAP":  "bad",
+	})
+
+	if fields.LastPrice != model.Yen(5179) {
+		t.Fatalf("last price mismatch: %s", fields.LastPrice)
+	}
+	if fields.LastTime != "13:59" {
+		t.Fatalf("last time mismatch: %s", fields.LastTime)
+	}
+	if fields.Volume != 123400 || fields.Turnover != 639000000 {
+		t.Fatalf("volume/turnover mismatch: %d %d", fields.Volume, fields.Turnover)
+	}
+	if fields.ChangeRate != -0.35 || fields.Change != -model.Price(185000) {
+		t.Fatalf("change mismatch: %v %s", fields.ChangeRate, fields.Change)
+	}
+	if fields.AskPrice10 != model.Yen(5190) || fields.BidSize1 != 300 {
+		t.Fatalf("book mismatch: %s %d", fields.AskPrice10, fields.BidSize1)
+	}
+	if fields.VWAP != 0 {
+		t.Fatalf("malformed value should decode as zero: %v", fields.VWAP)
+	}
+	if got := fields.HighFlagLabel(); got != "ストップ高" {
+		t.Fatalf("high flag label mismatch: %s", got)
+	}
+	if got := fields.PrevCompareLabel(); got != "現値＜前値" {
+		t.Fatalf("prev compare label mismatch: %s", got)
+	}
+	if got := fields.MarketSectionLabel(); got != "プライム" {
+		t.Fatalf("market section label mismatch: %s", got)
+	}
+}
@@ -0,0 +1,294 @@
+// Command fieldgen generates typed quote field metadata from
+// docs/info_code_mapping.md.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+type enumValue struct {
+	Code   string
+	Label  string
+	Symbol string
+}
+
+type field struct {
+	Name        string
+	Prefix      string
+	Code        string
+	LabelJA     string
+	LabelEN     string
+	Description string
+	Values      []enumValue
+	Kind        string
+	Ident       string
+}
+
+var (
+	enumPattern   = regexp.MustCompile(`「([^」]*)」\s*：\s*([^「※]*)`)
+	symbolPattern = regexp.MustCompile(`[（(]([^）)]+)[）)]\s*$`)
+	noteIndex     = "※"
+)
+
+func main() {
+	in := flag.String("in", "", "mapping table markdown")
+	out := flag.String("out", "", "output Go file")
+	pkg := flag.String("pkg", "price", "package name")
+	flag.Parse()
+	if *in == "" || *out == "" {
+		log.Fatal("fieldgen: -in and -out are required")
+	}
+
+	file, err := os.Open(*in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	fields, err := parse(file)
+	if err != nil {
+		log.Fatalf("fieldgen: %v", err)
+	}
+	src, err := generate(*pkg, *in, fields)
+	if err != nil {
+		log.Fatalf("fieldgen: %v", err)
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parse(r io.Reader) ([]field, error) {
+	var fields []field
+	seenNames := make(map[string]struct{})
+	seenIdents := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "|") {
+			continue
+		}
+		cells := strings.Split(strings.Trim(line, "|"), "|")
+		if len(cells) != 8 {
+			continue
+		}
+		for i := range cells {
+			cells[i] = strings.TrimSpace(cells[i])
+		}
+		if !isNumber(cells[0]) {
+			continue
+		}
+
+		f := field{
+			Name:    cells[1],
+			Prefix:  cells[2],
+			Code:    cells[3],
+			LabelJA: cells[4],
+			LabelEN: cells[5],
+		}
+		if f.Prefix+f.Code != f.Name {
+			return nil, fmt.Errorf("row %s: field %q does not match %q+%q", cells[0], f.Name, f.Prefix, f.Code)
+		}
+		if f.LabelEN == "" {
+			return nil, fmt.Errorf("row %s: English label required for %s", cells[0], f.Name)
+		}
+		f.Description, f.Values = parseDescription(cells[7])
+
+		kind, err := kindOf(f, cells[6])
+		if err != nil {
+			return nil, fmt.Errorf("row %s: %w", cells[0], err)
+		}
+		f.Kind = kind
+		f.Ident = identifier(f.LabelEN)
+
+		if _, ok := seenNames[f.Name]; ok {
+			return nil, fmt.Errorf("row %s: duplicate field %s", cells[0], f.Name)
+		}
+		seenNames[f.Name] = struct{}{}
+		if other, ok := seenIdents[f.Ident]; ok {
+			return nil, fmt.Errorf("row %s: identifier %s of %s collides with %s", cells[0], f.Ident, f.Name, other)
+		}
+		seenIdents[f.Ident] = f.Name
+
+		fields = append(fields, f)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields found")
+	}
+	return fields, nil
+}
+
+func parseDescription(text string) (string, []enumValue) {
+	matches := enumPattern.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text, nil
+	}
+	description := strings.TrimSpace(text[:matches[0][0]])
+	if idx := strings.Index(text, noteIndex); idx >= 0 {
+		note := strings.TrimSpace(text[idx:])
+		description = strings.TrimSpace(description + " " + note)
+	}
+
+	values := make([]enumValue, 0, len(matches))
+	for _, m := range matches {
+		value := enumValue{
+			Code:  text[m[2]:m[3]],
+			Label: strings.TrimSpace(text[m[4]:m[5]]),
+		}
+		if sm := symbolPattern.FindStringSubmatch(value.Label); sm != nil && strings.Contains(description, "画面表示記号") {
+			value.Symbol = sm[1]
+			value.Label = strings.TrimSpace(strings.TrimSuffix(value.Label, sm[0]))
+		}
+		values = append(values, value)
+	}
+	return description, values
+}
+
+var kinds = map[string]string{
+	"price":    "FieldKindPrice",
+	"quantity": "FieldKindQuantity",
+	"integer":  "FieldKindInteger",
+	"decimal":  "FieldKindDecimal",
+	"enum":     "FieldKindEnum",
+	"text":     "FieldKindText",
+	"time":     "FieldKindTime",
+}
+
+// kindOf maps the table's 種別 column to a field kind. Every row must
+// name one, so new rows fail loudly instead of guessing.
+func kindOf(f field, name string) (string, error) {
+	kind, ok := kinds[name]
+	if !ok {
+		return "", fmt.Errorf("unknown kind %q for %s", name, f.Name)
+	}
+	if (kind == "FieldKindEnum") != (len(f.Values) > 0) {
+		return "", fmt.Errorf("kind %s of %s does not match its %d enum values", name, f.Name, len(f.Values))
+	}
+	return kind, nil
+}
+
+var goTypes = map[string]string{
+	"FieldKindText":     "string",
+	"FieldKindTime":     "string",
+	"FieldKindEnum":     "string",
+	"FieldKindPrice":    "model.Price",
+	"FieldKindQuantity": "model.Quantity",
+	"FieldKindInteger":  "int64",
+	"FieldKindDecimal":  "float64",
+}
+
+var decoders = map[string]string{
+	"FieldKindText":     "fields.Value",
+	"FieldKindTime":     "fields.Value",
+	"FieldKindEnum":     "fields.Value",
+	"FieldKindPrice":    "decodePrice(fields, ",
+	"FieldKindQuantity": "decodeQuantity(fields, ",
+	"FieldKindInteger":  "decodeInt(fields, ",
+	"FieldKindDecimal":  "decodeFloat(fields, ",
+}
+
+func generate(pkg, source string, fields []field) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by fieldgen from %s; DO NOT EDIT.\n\n", strings.TrimPrefix(source, "../"))
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	b.WriteString("import \"github.com/ueebee/tachibanashi/model\"\n\n")
+
+	b.WriteString("var quoteFieldInfos = []QuoteFieldInfo{\n")
+	for _, f := range fields {
+		fmt.Fprintf(&b, "{Name: %q, Prefix: %q, Code: %q, Kind: %s, LabelJA: %q, LabelEN: %q, Description: %q",
+			f.Name, f.Prefix, f.Code, f.Kind, f.LabelJA, f.LabelEN, f.Description)
+		if len(f.Values) > 0 {
+			b.WriteString(", Values: []EnumValue{\n")
+			for _, v := range f.Values {
+				fmt.Fprintf(&b, "{Code: %q, Label: %q, Symbol: %q},\n", v.Code, v.Label, v.Symbol)
+			}
+			b.WriteString("}")
+		}
+		b.WriteString("},\n")
+	}
+	b.WriteString("}\n\n")
+
+	b.WriteString("var quoteFieldIndex = map[string]int{\n")
+	for i, f := range fields {
+		fmt.Fprintf(&b, "%q: %d,\n", f.Name, i)
+	}
+	b.WriteString("}\n\n")
+
+	b.WriteString("var quoteFieldNames = map[string]struct{}{\n")
+	for _, f := range fields {
+		fmt.Fprintf(&b, "%q: {},\n", f.Name)
+	}
+	b.WriteString("}\n\n")
+
+	b.WriteString("// QuoteFields is a typed view of every documented quote field.\n")
+	b.WriteString("// Missing or malformed values decode as the zero value.\n")
+	b.WriteString("type QuoteFields struct {\n")
+	for _, f := range fields {
+		fmt.Fprintf(&b, "%s %s // %s %s\n", f.Ident, goTypes[f.Kind], f.Name, f.LabelJA)
+	}
+	b.WriteString("}\n\n")
+
+	b.WriteString("// DecodeQuoteFields converts raw attributes into QuoteFields.\n")
+	b.WriteString("func DecodeQuoteFields(fields model.Attributes) QuoteFields {\n")
+	b.WriteString("return QuoteFields{\n")
+	for _, f := range fields {
+		decoder := decoders[f.Kind]
+		if strings.HasSuffix(decoder, ", ") {
+			fmt.Fprintf(&b, "%s: %s%q),\n", f.Ident, decoder, f.Name)
+			continue
+		}
+		fmt.Fprintf(&b, "%s: %s(%q),\n", f.Ident, decoder, f.Name)
+	}
+	b.WriteString("}\n}\n")
+
+	for _, f := range fields {
+		if f.Kind != "FieldKindEnum" {
+			continue
+		}
+		fmt.Fprintf(&b, "\n// %sLabel decodes %s (%s).\n", f.Ident, f.Name, f.LabelJA)
+		fmt.Fprintf(&b, "func (q QuoteFields) %sLabel() string {\n", f.Ident)
+		fmt.Fprintf(&b, "label, _ := DecodeEnum(%q, q.%s)\n", f.Name, f.Ident)
+		b.WriteString("return label\n}\n")
+	}
+
+	return format.Source(b.Bytes())
+}
+
+func identifier(label string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(label, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	return b.String()
+}
+
+func isNumber(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGeneratedFileIsCurrent(t *testing.T) {
+	file, err := os.Open("../../../docs/info_code_mapping.md")
+	if err != nil {
+		t.Fatalf("open mapping: %v", err)
+	}
+	defer file.Close()
+
+	fields, err := parse(file)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	src, err := generate("price", "../docs/info_code_mapping.md", fields)
+	if err != nil {
+		t.Fatalf("generate() error = %v", err)
+	}
+	current, err := os.ReadFile("../../quote_fields_gen.go")
+	if err != nil {
+		t.Fatalf("read generated file: %v", err)
+	}
+	if !bytes.Equal(src, current) {
+		t.Fatalf("quote_fields_gen.go is stale; run go generate ./price")
+	}
+}
+
+func TestParseRequiresKind(t *testing.T) {
+	for _, table := range []string{
+		"| 1 | pZZZ | p | ZZZ | 不明 | Unknown |  |  |\n",
+		"| 1 | pZZZ | p | ZZZ | 不明 | Unknown | size |  |\n",
+		"| 1 | pZZZ | p | ZZZ | 不明 | Unknown | enum |  |\n",
+	} {
+		if _, err := parse(strings.NewReader(table)); err == nil {
+			t.Fatalf("expected error for %q", table)
+		}
+	}
+	fields, err := parse(strings.NewReader("| 1 | pZZZ | p | ZZZ | 不明 | Unknown | price |  |\n"))
+	if err != nil || fields[0].Kind != "FieldKindPrice" {
+		t.Fatalf("parse() = %+v, %v", fields, err)
+	}
+}
+
+func TestParseDescriptionSplitsEnums(t *testing.T) {
+	description, values := parseDescription("「0000」：事象なし 「0071」：ストップ高(S) ※（）内は画面表示記号。")
+	if description != "※（）内は画面表示記号。" {
+		t.Fatalf("description mismatch: %s", description)
+	}
+	if len(values) != 2 {
+		t.Fatalf("values length mismatch: %d", len(values))
+	}
+	if values[1].Code != "0071" || values[1].Label != "ストップ高" || values[1].Symbol != "S" {
+		t.Fatalf("value mismatch: %+v", values[1])
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	if got := identifier("Ask price 10"); got != "AskPrice10" {
+		t.Fatalf("identifier mismatch: %s", got)
+	}
+}
@@ -0,0 +1,175 @@
+package price
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+const defaultPollInterval = time.Second
+
+// PollerConfig configures a Poller.
+type PollerConfig struct {
+	Symbols []string
+	Fields  []string
+	// Interval is the target time between polls (default 1s).
+	Interval time.Duration
+	// MaxRequestsPerMinute caps snapshot requests; the interval is stretched
+	// and requests inside a poll are spaced to stay under it. Zero disables.
+	MaxRequestsPerMinute int
+	// Concurrency caps in-flight requests inside a poll (default 1).
+	Concurrency int
+	// OnError receives non-fatal poll errors such as *PartialError.
+	OnError func(error)
+}
+
+// Poller polls QuoteSnapshot and emits quotes that changed between polls.
+// It implements model.QuoteSource.
+type Poller struct {
+	service *Service
+	symbols []string
+	fields  []string
+	config  PollerConfig
+
+	mu   sync.Mutex
+	last map[string]model.Attributes
+}
+
+var _ model.QuoteSource = (*Poller)(nil)
+
+func NewPoller(service *Service, config PollerConfig) *Poller {
+	return &Poller{
+		service: service,
+		symbols: uniqueList(normalizeList(config.Symbols)),
+		fields:  normalizeList(config.Fields),
+		config:  config,
+		last:    make(map[string]model.Attributes),
+	}
+}
+
+// Interval returns the effective poll interval after applying the budget.
+func (p *Poller) Interval() time.Duration {
+	interval := p.config.Interval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	if budget := p.config.MaxRequestsPerMinute; budget > 0 {
+		perPoll := len(chunkList(p.symbols, maxIssueCodes))
+		minimum := time.Duration(perPoll) * time.Minute / time.Duration(budget)
+		if minimum > interval {
+			interval = minimum
+		}
+	}
+	return interval
+}
+
+// Poll fetches one snapshot and returns quotes that differ from the previous
+// poll. Symbols from failed chunks keep their previous state; the failure is
+// returned as a *PartialError together with the changes that were found.
+func (p *Poller) Poll(ctx context.Context) ([]model.Quote, error) {
+	if p.service == nil {
+		return nil, errors.New("tachibanashi: poller price service is nil")
+	}
+	if len(p.symbols) == 0 {
+		return nil, &terrors.ValidationError{Field: "symbols", Reason: "required"}
+	}
+
+	opts := SnapshotAllOptions{Concurrency: p.config.Concurrency}
+	if budget := p.config.MaxRequestsPerMinute; budget > 0 {
+		opts.MinInterval = time.Minute / time.Duration(budget)
+	}
+	snapshot, err := p.service.SnapshotAll(ctx, p.symbols, p.fields, opts)
+	if snapshot == nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var changed []model.Quote
+	for _, quote := range snapshot.Quotes {
+		previous, ok := p.last[quote.Symbol]
+		if ok && sameAttributes(previous, quote.Fields) {
+			continue
+		}
+		p.last[quote.Symbol] = cloneAttributes(quote.Fields)
+		changed = append(changed, model.Quote{
+			Symbol: quote.Symbol,
+			Fields: cloneAttributes(quote.Fields),
+		})
+	}
+	return changed, err
+}
+
+// Quotes polls until ctx is done. Batches with no changes are not sent.
+func (p *Poller) Quotes(ctx context.Context) (<-chan []model.Quote, <-chan error) {
+	quotes := make(chan []model.Quote)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(quotes)
+		defer close(errs)
+
+		ticker := time.NewTicker(p.Interval())
+		defer ticker.Stop()
+
+		for {
+			changed, err := p.Poll(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					errs <- ctx.Err()
+					return
+				}
+				var validation *terrors.ValidationError
+				if errors.As(err, &validation) {
+					errs <- err
+					return
+				}
+				if p.config.OnError != nil {
+					p.config.OnError(err)
+				}
+			}
+			if len(changed) > 0 {
+				select {
+				case <-ctx.Done():
+					errs <- ctx.Err()
+					return
+				case quotes <- changed:
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return quotes, errs
+}
+
+// Reset forgets the previous snapshot so the next poll emits every symbol.
+func (p *Poller) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.last = make(map[string]model.Attributes)
+}
+
+func sameAttributes(a, b model.Attributes) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		other, ok := b[key]
+		if !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
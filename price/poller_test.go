@@ -0,0 +1,132 @@
+package price
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ueebee/tachibanashi/auth"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+type scriptedClient struct {
+	mu     sync.Mutex
+	urls   auth.VirtualURLs
+	prices map[string]string
+	calls  int
+}
+
+func (m *scriptedClient) set(symbol, price string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prices[symbol] = price
+}
+
+func (m *scriptedClient) DoJSON(ctx context.Context, method, path string, req, resp any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	r := req.(*MarketPriceRequest)
+	entries := make([]string, 0)
+	for _, code := range strings.Split(r.TargetIssueCode, ",") {
+		entries = append(entries, fmt.Sprintf(`{"sIssueCode":%q,"pDPP":%q}`, code, m.prices[code]))
+	}
+	body := `{"aCLMMfdsMarketPrice":[` + strings.Join(entries, ",") + `]}`
+	return json.Unmarshal([]byte(body), resp)
+}
+
+func (m *scriptedClient) VirtualURLs() auth.VirtualURLs {
+	return m.urls
+}
+
+func TestPollerEmitsOnlyChanges(t *testing.T) {
+	client := &scriptedClient{
+		urls:   auth.VirtualURLs{Price: "https://example.invalid/price"},
+		prices: map[string]string{"6501": "100", "6502": "200"},
+	}
+	poller := NewPoller(NewService(client), PollerConfig{
+		Symbols: []string{"6501", "6502"},
+		Fields:  []string{"pDPP"},
+	})
+
+	changed, err := poller.Poll(context.Background())
+	if err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if len(changed) != 2 {
+		t.Fatalf("initial changes mismatch: %d", len(changed))
+	}
+
+	changed, err = poller.Poll(context.Background())
+	if err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if len(changed) != 0 {
+		t.Fatalf("expected no changes: %d", len(changed))
+	}
+
+	client.set("6502", "201")
+	changed, err = poller.Poll(context.Background())
+	if err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if len(changed) != 1 || changed[0].Symbol != "6502" {
+		t.Fatalf("changed quotes mismatch: %+v", changed)
+	}
+	if last, ok := changed[0].LastPrice(); !ok || last != model.Yen(201) {
+		t.Fatalf("last price mismatch: %s", last)
+	}
+}
+
+func TestPollerIntervalHonorsBudget(t *testing.T) {
+	symbols := make([]string, 0, 300)
+	for i := 0; i < 300; i++ {
+		symbols = append(symbols, fmt.Sprintf("%04d", 1000+i))
+	}
+	poller := NewPoller(nil, PollerConfig{
+		Symbols:              symbols,
+		Interval:             time.Second,
+		MaxRequestsPerMinute: 60,
+	})
+	// 3 requests per poll at 60/min needs at least 3s between polls.
+	if got := poller.Interval(); got != 3*time.Second {
+		t.Fatalf("interval mismatch: %s", got)
+	}
+}
+
+func TestPollerQuotesStreamsChanges(t *testing.T) {
+	client := &scriptedClient{
+		urls:   auth.VirtualURLs{Price: "https://example.invalid/price"},
+		prices: map[string]string{"6501": "100"},
+	}
+	var source model.QuoteSource = NewPoller(NewService(client), PollerConfig{
+		Symbols:  []string{"6501"},
+		Fields:   []string{"pDPP"},
+		Interval: 5 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	quotes, errs := source.Quotes(ctx)
+
+	first := <-quotes
+	if len(first) != 1 || first[0].Value("pDPP") != "100" {
+		t.Fatalf("first batch mismatch: %+v", first)
+	}
+	client.set("6501", "101")
+	second := <-quotes
+	if len(second) != 1 || second[0].Value("pDPP") != "101" {
+		t.Fatalf("second batch mismatch: %+v", second)
+	}
+
+	cancel()
+	for range quotes {
+	}
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("terminal error mismatch: %v", err)
+	}
+}
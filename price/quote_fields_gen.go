@@ -0,0 +1,493 @@
+// Code generated by fieldgen from docs/info_code_mapping.md; DO NOT EDIT.
+
+package price
+
+import "github.com/ueebee/tachibanashi/model"
+
+var quoteFieldInfos = []QuoteFieldInfo{
+	{Name: "pAAV", Prefix: "p", Code: "AAV", Kind: FieldKindQuantity, LabelJA: "売数量（成行）", LabelEN: "Market ask size", Description: ""},
+	{Name: "pABV", Prefix: "p", Code: "ABV", Kind: FieldKindQuantity, LabelJA: "買数量（成行）", LabelEN: "Market bid size", Description: ""},
+	{Name: "pAV", Prefix: "p", Code: "AV", Kind: FieldKindQuantity, LabelJA: "売気配数量", LabelEN: "Ask size", Description: ""},
+	{Name: "pBV", Prefix: "p", Code: "BV", Kind: FieldKindQuantity, LabelJA: "買気配数量", LabelEN: "Bid size", Description: ""},
+	{Name: "xDCFS", Prefix: "x", Code: "DCFS", Kind: FieldKindEnum, LabelJA: "不連続要因銘柄区分", LabelEN: "Discontinuity", Description: "※「」内文字を画面表示。", Values: []EnumValue{
+		{Code: "分", Label: "株式分割", Symbol: ""},
+		{Code: "併", Label: "株式併合、減資を伴う併合", Symbol: ""},
+		{Code: "有", Label: "有償", Symbol: ""},
+		{Code: "無", Label: "無償", Symbol: ""},
+		{Code: "預", Label: "権利預り証落ち", Symbol: ""},
+		{Code: "ム", Label: "無償割当", Symbol: ""},
+		{Code: "ラ", Label: "ライツオファリング", Symbol: ""},
+		{Code: "", Label: "上記外", Symbol: ""},
+	}},
+	{Name: "pDHF", Prefix: "p", Code: "DHF", Kind: FieldKindEnum, LabelJA: "日通し高値フラグ", LabelEN: "High flag", Description: "※（）内は画面表示記号。", Values: []EnumValue{
+		{Code: "0000", Label: "事象なし", Symbol: ""},
+		{Code: "0071", Label: "ストップ高", Symbol: "S"},
+	}},
+	{Name: "pDHP", Prefix: "p", Code: "DHP", Kind: FieldKindPrice, LabelJA: "高値", LabelEN: "High price", Description: ""},
+	{Name: "tDHP:T", Prefix: "t", Code: "DHP:T", Kind: FieldKindTime, LabelJA: "高値時刻", LabelEN: "High time", Description: "「HH:MM」"},
+	{Name: "pDJ", Prefix: "p", Code: "DJ", Kind: FieldKindInteger, LabelJA: "売買代金", LabelEN: "Turnover", Description: ""},
+	{Name: "pDLF", Prefix: "p", Code: "DLF", Kind: FieldKindEnum, LabelJA: "日通し安値フラグ", LabelEN: "Low flag", Description: "※（）内は画面表示記号。", Values: []EnumValue{
+		{Code: "0000", Label: "事象なし", Symbol: ""},
+		{Code: "0072", Label: "ストップ安", Symbol: "S"},
+	}},
+	{Name: "pDLP", Prefix: "p", Code: "DLP", Kind: FieldKindPrice, LabelJA: "安値", LabelEN: "Low price", Description: ""},
+	{Name: "tDLP:T", Prefix: "t", Code: "DLP:T", Kind: FieldKindTime, LabelJA: "安値時刻", LabelEN: "Low time", Description: "「HH:MM」"},
+	{Name: "pDOP", Prefix: "p", Code: "DOP", Kind: FieldKindPrice, LabelJA: "始値", LabelEN: "Open price", Description: ""},
+	{Name: "tDOP:T", Prefix: "t", Code: "DOP:T", Kind: FieldKindTime, LabelJA: "始値時刻", LabelEN: "Open time", Description: "「HH:MM」"},
+	{Name: "pDPG", Prefix: "p", Code: "DPG", Kind: FieldKindEnum, LabelJA: "現値前値比較", LabelEN: "Prev compare", Description: "※（）内は画面表示記号。", Values: []EnumValue{
+		{Code: "0000", Label: "事象なし", Symbol: ""},
+		{Code: "0056", Label: "現値＝前値", Symbol: ""},
+		{Code: "0057", Label: "現値＞前値", Symbol: "↑"},
+		{Code: "0058", Label: "現値＜前値", Symbol: "↓"},
+		{Code: "0059", Label: "中断板寄後の初値", Symbol: ""},
+		{Code: "0060", Label: "ザラバ引け", Symbol: "・"},
+		{Code: "0061", Label: "板寄引け", Symbol: ""},
+		{Code: "0062", Label: "中断引け", Symbol: ""},
+		{Code: "0068", Label: "売買停止引け", Symbol: ""},
+	}},
+	{Name: "pDPP", Prefix: "p", Code: "DPP", Kind: FieldKindPrice, LabelJA: "現在値", LabelEN: "Last price", Description: ""},
+	{Name: "tDPP:T", Prefix: "t", Code: "DPP:T", Kind: FieldKindTime, LabelJA: "現在値時刻", LabelEN: "Last time", Description: "「HH:MM」"},
+	{Name: "pDV", Prefix: "p", Code: "DV", Kind: FieldKindQuantity, LabelJA: "出来高", LabelEN: "Volume", Description: ""},
+	{Name: "xDVES", Prefix: "x", Code: "DVES", Kind: FieldKindEnum, LabelJA: "配当落銘柄区分", LabelEN: "Ex dividend", Description: "※「」内文字を画面表示。", Values: []EnumValue{
+		{Code: "配", Label: "配当権利落、中間配当権利落、期中配当権利落", Symbol: ""},
+		{Code: "", Label: "上記外", Symbol: ""},
+	}},
+	{Name: "pDYRP", Prefix: "p", Code: "DYRP", Kind: FieldKindDecimal, LabelJA: "騰落率", LabelEN: "Change rate", Description: ""},
+	{Name: "pDYWP", Prefix: "p", Code: "DYWP", Kind: FieldKindPrice, LabelJA: "前日比", LabelEN: "Change", Description: ""},
+	{Name: "pGAV10", Prefix: "p", Code: "GAV10", Kind: FieldKindQuantity, LabelJA: "売－１０－数量", LabelEN: "Ask size 10", Description: ""},
+	{Name: "pGAP10", Prefix: "p", Code: "GAP10", Kind: FieldKindPrice, LabelJA: "売－１０－値段", LabelEN: "Ask price 10", Description: ""},
+	{Name: "pGAV9", Prefix: "p", Code: "GAV9", Kind: FieldKindQuantity, LabelJA: "売－９－数量", LabelEN: "Ask size 9", Description: ""},
+	{Name: "pGAP9", Prefix: "p", Code: "GAP9", Kind: FieldKindPrice, LabelJA: "売－９－値段", LabelEN: "Ask price 9", Description: ""},
+	{Name: "pGAV8", Prefix: "p", Code: "GAV8", Kind: FieldKindQuantity, LabelJA: "売－８－数量", LabelEN: "Ask size 8", Description: ""},
+	{Name: "pGAP8", Prefix: "p", Code: "GAP8", Kind: FieldKindPrice, LabelJA: "売－８－値段", LabelEN: "Ask price 8", Description: ""},
+	{Name: "pGAV7", Prefix: "p", Code: "GAV7", Kind: FieldKindQuantity, LabelJA: "売－７－数量", LabelEN: "Ask size 7", Description: ""},
+	{Name: "pGAP7", Prefix: "p", Code: "GAP7", Kind: FieldKindPrice, LabelJA: "売－７－値段", LabelEN: "Ask price 7", Description: ""},
+	{Name: "pGAV6", Prefix: "p", Code: "GAV6", Kind: FieldKindQuantity, LabelJA: "売－６－数量", LabelEN: "Ask size 6", Description: ""},
+	{Name: "pGAP6", Prefix: "p", Code: "GAP6", Kind: FieldKindPrice, LabelJA: "売－６－値段", LabelEN: "Ask price 6", Description: ""},
+	{Name: "pGAV5", Prefix: "p", Code: "GAV5", Kind: FieldKindQuantity, LabelJA: "売－５－数量", LabelEN: "Ask size 5", Description: ""},
+	{Name: "pGAP5", Prefix: "p", Code: "GAP5", Kind: FieldKindPrice, LabelJA: "売－５－値段", LabelEN: "Ask price 5", Description: ""},
+	{Name: "pGAV4", Prefix: "p", Code: "GAV4", Kind: FieldKindQuantity, LabelJA: "売－４－数量", LabelEN: "Ask size 4", Description: ""},
+	{Name: "pGAP4", Prefix: "p", Code: "GAP4", Kind: FieldKindPrice, LabelJA: "売－４－値段", LabelEN: "Ask price 4", Description: ""},
+	{Name: "pGAV3", Prefix: "p", Code: "GAV3", Kind: FieldKindQuantity, LabelJA: "売－３－数量", LabelEN: "Ask size 3", Description: ""},
+	{Name: "pGAP3", Prefix: "p", Code: "GAP3", Kind: FieldKindPrice, LabelJA: "売－３－値段", LabelEN: "Ask price 3", Description: ""},
+	{Name: "pGAV2", Prefix: "p", Code: "GAV2", Kind: FieldKindQuantity, LabelJA: "売－２－数量", LabelEN: "Ask size 2", Description: ""},
+	{Name: "pGAP2", Prefix: "p", Code: "GAP2", Kind: FieldKindPrice, LabelJA: "売－２－値段", LabelEN: "Ask price 2", Description: ""},
+	{Name: "pGAV1", Prefix: "p", Code: "GAV1", Kind: FieldKindQuantity, LabelJA: "売－１－数量", LabelEN: "Ask size 1", Description: ""},
+	{Name: "pGAP1", Prefix: "p", Code: "GAP1", Kind: FieldKindPrice, LabelJA: "売－１－値段", LabelEN: "Ask price 1", Description: ""},
+	{Name: "pGBV1", Prefix: "p", Code: "GBV1", Kind: FieldKindQuantity, LabelJA: "買－１－数量", LabelEN: "Bid size 1", Description: ""},
+	{Name: "pGBP1", Prefix: "p", Code: "GBP1", Kind: FieldKindPrice, LabelJA: "買－１－値段", LabelEN: "Bid price 1", Description: ""},
+	{Name: "pGBV2", Prefix: "p", Code: "GBV2", Kind: FieldKindQuantity, LabelJA: "買－２－数量", LabelEN: "Bid size 2", Description: ""},
+	{Name: "pGBP2", Prefix: "p", Code: "GBP2", Kind: FieldKindPrice, LabelJA: "買－２－値段", LabelEN: "Bid price 2", Description: ""},
+	{Name: "pGBV3", Prefix: "p", Code: "GBV3", Kind: FieldKindQuantity, LabelJA: "買－３－数量", LabelEN: "Bid size 3", Description: ""},
+	{Name: "pGBP3", Prefix: "p", Code: "GBP3", Kind: FieldKindPrice, LabelJA: "買－３－値段", LabelEN: "Bid price 3", Description: ""},
+	{Name: "pGBV4", Prefix: "p", Code: "GBV4", Kind: FieldKindQuantity, LabelJA: "買－４－数量", LabelEN: "Bid size 4", Description: ""},
+	{Name: "pGBP4", Prefix: "p", Code: "GBP4", Kind: FieldKindPrice, LabelJA: "買－４－値段", LabelEN: "Bid price 4", Description: ""},
+	{Name: "pGBV5", Prefix: "p", Code: "GBV5", Kind: FieldKindQuantity, LabelJA: "買－５－数量", LabelEN: "Bid size 5", Description: ""},
+	{Name: "pGBP5", Prefix: "p", Code: "GBP5", Kind: FieldKindPrice, LabelJA: "買－５－値段", LabelEN: "Bid price 5", Description: ""},
+	{Name: "pGBV6", Prefix: "p", Code: "GBV6", Kind: FieldKindQuantity, LabelJA: "買－６－数量", LabelEN: "Bid size 6", Description: ""},
+	{Name: "pGBP6", Prefix: "p", Code: "GBP6", Kind: FieldKindPrice, LabelJA: "買－６－値段", LabelEN: "Bid price 6", Description: ""},
+	{Name: "pGBV7", Prefix: "p", Code: "GBV7", Kind: FieldKindQuantity, LabelJA: "買－７－数量", LabelEN: "Bid size 7", Description: ""},
+	{Name: "pGBP7", Prefix: "p", Code: "GBP7", Kind: FieldKindPrice, LabelJA: "買－７－値段", LabelEN: "Bid price 7", Description: ""},
+	{Name: "pGBV8", Prefix: "p", Code: "GBV8", Kind: FieldKindQuantity, LabelJA: "買－８－数量", LabelEN: "Bid size 8", Description: ""},
+	{Name: "pGBP8", Prefix: "p", Code: "GBP8", Kind: FieldKindPrice, LabelJA: "買－８－値段", LabelEN: "Bid price 8", Description: ""},
+	{Name: "pGBV9", Prefix: "p", Code: "GBV9", Kind: FieldKindQuantity, LabelJA: "買－９－数量", LabelEN: "Bid size 9", Description: ""},
+	{Name: "pGBP9", Prefix: "p", Code: "GBP9", Kind: FieldKindPrice, LabelJA: "買－９－値段", LabelEN: "Bid price 9", Description: ""},
+	{Name: "pGBV10", Prefix: "p", Code: "GBV10", Kind: FieldKindQuantity, LabelJA: "買－１０－数量", LabelEN: "Bid size 10", Description: ""},
+	{Name: "pGBP10", Prefix: "p", Code: "GBP10", Kind: FieldKindPrice, LabelJA: "買－１０－値段", LabelEN: "Bid price 10", Description: ""},
+	{Name: "xLISS", Prefix: "x", Code: "LISS", Kind: FieldKindEnum, LabelJA: "所属", LabelEN: "Market section", Description: "ShiftJIS文字列を１６進数文字列として設定。（含む半角カナ）", Values: []EnumValue{
+		{Code: "82509594", Label: "１部", Symbol: ""},
+		{Code: "8250959446", Label: "１部F", Symbol: ""},
+		{Code: "82519594", Label: "２部", Symbol: ""},
+		{Code: "8251959446", Label: "２部F", Symbol: ""},
+		{Code: "4A51BDC0DDC0DEB0C4DE", Label: "JQスタンダード", Symbol: ""},
+		{Code: "4A51BDC0DDC0DEB0C4DE46", Label: "JQスタンダードF", Symbol: ""},
+		{Code: "4A51B8DEDBB0BD", Label: "JQグロース", Symbol: ""},
+		{Code: "4A51B8DEDBB0BD46", Label: "JQグロースF", Symbol: ""},
+		{Code: "CFBBDEB0BDDE", Label: "マザーズ", Symbol: ""},
+		{Code: "CFBBDEB0BDDE46", Label: "マザーズF", Symbol: ""},
+		{Code: "CCDFD7B2D1", Label: "プライム", Symbol: ""},
+		{Code: "CCDFD7B2D146", Label: "プライムＦ", Symbol: ""},
+		{Code: "BDC0DDC0DEB0C4DE", Label: "スタンダード", Symbol: ""},
+		{Code: "BDC0DDC0DEB0C4DE46", Label: "スタンダードＦ", Symbol: ""},
+		{Code: "B8DEDBB0BD", Label: "グロース", Symbol: ""},
+		{Code: "B8DEDBB0BD46", Label: "グロースＦ", Symbol: ""},
+		{Code: "54504D", Label: "TPM", Symbol: ""},
+		{Code: "54504D46", Label: "TPMF", Symbol: ""},
+		{Code: "4A51", Label: "JQ", Symbol: ""},
+	}},
+	{Name: "pPRP", Prefix: "p", Code: "PRP", Kind: FieldKindPrice, LabelJA: "前日終値", LabelEN: "Prev close", Description: ""},
+	{Name: "pQAP", Prefix: "p", Code: "QAP", Kind: FieldKindPrice, LabelJA: "売気配値", LabelEN: "Ask price", Description: ""},
+	{Name: "pQAS", Prefix: "p", Code: "QAS", Kind: FieldKindEnum, LabelJA: "売気配値種類", LabelEN: "Ask type", Description: "※（）内は画面表示記号。", Values: []EnumValue{
+		{Code: "0000", Label: "事象なし", Symbol: ""},
+		{Code: "0101", Label: "一般気配", Symbol: ""},
+		{Code: "0102", Label: "特別気配", Symbol: "ウ"},
+		{Code: "0107", Label: "寄前気配", Symbol: "寄"},
+		{Code: "0108", Label: "停止前特別気配", Symbol: "停"},
+		{Code: "0118", Label: "連続約定気配", Symbol: ""},
+		{Code: "0119", Label: "停止前の連続約定気配", Symbol: "U"},
+		{Code: "0120", Label: "一般気配、買上がり・売下がり中", Symbol: ""},
+		{Code: "0179", Label: "プレクロ開始臨時気配", Symbol: ""},
+		{Code: "0180", Label: "特別約定後気配", Symbol: ""},
+	}},
+	{Name: "pQBP", Prefix: "p", Code: "QBP", Kind: FieldKindPrice, LabelJA: "買気配値", LabelEN: "Bid price", Description: ""},
+	{Name: "pQBS", Prefix: "p", Code: "QBS", Kind: FieldKindEnum, LabelJA: "買気配値種類", LabelEN: "Bid type", Description: "※（）内は画面表示記号。", Values: []EnumValue{
+		{Code: "0000", Label: "事象なし", Symbol: ""},
+		{Code: "0101", Label: "一般気配", Symbol: ""},
+		{Code: "0102", Label: "特別気配", Symbol: "カ"},
+		{Code: "0107", Label: "寄前気配", Symbol: "寄"},
+		{Code: "0108", Label: "停止前特別気配", Symbol: "停"},
+		{Code: "0118", Label: "連続約定気配", Symbol: ""},
+		{Code: "0119", Label: "停止前の連続約定気配", Symbol: "K"},
+		{Code: "0120", Label: "一般気配、買上がり・売下がり中", Symbol: ""},
+		{Code: "0179", Label: "プレクロ開始臨時気配", Symbol: ""},
+		{Code: "0180", Label: "特別約定後気配", Symbol: ""},
+	}},
+	{Name: "pQOV", Prefix: "p", Code: "QOV", Kind: FieldKindQuantity, LabelJA: "売-OVER", LabelEN: "Over size", Description: ""},
+	{Name: "pQUV", Prefix: "p", Code: "QUV", Kind: FieldKindQuantity, LabelJA: "買-UNDER", LabelEN: "Under size", Description: ""},
+	{Name: "pVWAP", Prefix: "p", Code: "VWAP", Kind: FieldKindPrice, LabelJA: "VWAP", LabelEN: "VWAP", Description: ""},
+}
+
+var quoteFieldIndex = map[string]int{
+	"pAAV":   0,
+	"pABV":   1,
+	"pAV":    2,
+	"pBV":    3,
+	"xDCFS":  4,
+	"pDHF":   5,
+	"pDHP":   6,
+	"tDHP:T": 7,
+	"pDJ":    8,
+	"pDLF":   9,
+	"pDLP":   10,
+	"tDLP:T": 11,
+	"pDOP":   12,
+	"tDOP:T": 13,
+	"pDPG":   14,
+	"pDPP":   15,
+	"tDPP:T": 16,
+	"pDV":    17,
+	"xDVES":  18,
+	"pDYRP":  19,
+	"pDYWP":  20,
+	"pGAV10": 21,
+	"pGAP10": 22,
+	"pGAV9":  23,
+	"pGAP9":  24,
+	"pGAV8":  25,
+	"pGAP8":  26,
+	"pGAV7":  27,
+	"pGAP7":  28,
+	"pGAV6":  29,
+	"pGAP6":  30,
+	"pGAV5":  31,
+	"pGAP5":  32,
+	"pGAV4":  33,
+	"pGAP4":  34,
+	"pGAV3":  35,
+	"pGAP3":  36,
+	"pGAV2":  37,
+	"pGAP2":  38,
+	"pGAV1":  39,
+	"pGAP1":  40,
+	"pGBV1":  41,
+	"pGBP1":  42,
+	"pGBV2":  43,
+	"pGBP2":  44,
+	"pGBV3":  45,
+	"pGBP3":  46,
+	"pGBV4":  47,
+	"pGBP4":  48,
+	"pGBV5":  49,
+	"pGBP5":  50,
+	"pGBV6":  51,
+	"pGBP6":  52,
+	"pGBV7":  53,
+	"pGBP7":  54,
+	"pGBV8":  55,
+	"pGBP8":  56,
+	"pGBV9":  57,
+	"pGBP9":  58,
+	"pGBV10": 59,
+	"pGBP10": 60,
+	"xLISS":  61,
+	"pPRP":   62,
+	"pQAP":   63,
+	"pQAS":   64,
+	"pQBP":   65,
+	"pQBS":   66,
+	"pQOV":   67,
+	"pQUV":   68,
+	"pVWAP":  69,
+}
+
+var quoteFieldNames = map[string]struct{}{
+	"pAAV":   {},
+	"pABV":   {},
+	"pAV":    {},
+	"pBV":    {},
+	"xDCFS":  {},
+	"pDHF":   {},
+	"pDHP":   {},
+	"tDHP:T": {},
+	"pDJ":    {},
+	"pDLF":   {},
+	"pDLP":   {},
+	"tDLP:T": {},
+	"pDOP":   {},
+	"tDOP:T": {},
+	"pDPG":   {},
+	"pDPP":   {},
+	"tDPP:T": {},
+	"pDV":    {},
+	"xDVES":  {},
+	"pDYRP":  {},
+	"pDYWP":  {},
+	"pGAV10": {},
+	"pGAP10": {},
+	"pGAV9":  {},
+	"pGAP9":  {},
+	"pGAV8":  {},
+	"pGAP8":  {},
+	"pGAV7":  {},
+	"pGAP7":  {},
+	"pGAV6":  {},
+	"pGAP6":  {},
+	"pGAV5":  {},
+	"pGAP5":  {},
+	"pGAV4":  {},
+	"pGAP4":  {},
+	"pGAV3":  {},
+	"pGAP3":  {},
+	"pGAV2":  {},
+	"pGAP2":  {},
+	"pGAV1":  {},
+	"pGAP1":  {},
+	"pGBV1":  {},
+	"pGBP1":  {},
+	"pGBV2":  {},
+	"pGBP2":  {},
+	"pGBV3":  {},
+	"pGBP3":  {},
+	"pGBV4":  {},
+	"pGBP4":  {},
+	"pGBV5":  {},
+	"pGBP5":  {},
+	"pGBV6":  {},
+	"pGBP6":  {},
+	"pGBV7":  {},
+	"pGBP7":  {},
+	"pGBV8":  {},
+	"pGBP8":  {},
+	"pGBV9":  {},
+	"pGBP9":  {},
+	"pGBV10": {},
+	"pGBP10": {},
+	"xLISS":  {},
+	"pPRP":   {},
+	"pQAP":   {},
+	"pQAS":   {},
+	"pQBP":   {},
+	"pQBS":   {},
+	"pQOV":   {},
+	"pQUV":   {},
+	"pVWAP":  {},
+}
+
+// QuoteFields is a typed view of every documented quote field.
+// Missing or malformed values decode as the zero value.
+type QuoteFields struct {
+	MarketAskSize model.Quantity // pAAV 売数量（成行）
+	MarketBidSize model.Quantity // pABV 買数量（成行）
+	AskSize       model.Quantity // pAV 売気配数量
+	BidSize       model.Quantity // pBV 買気配数量
+	Discontinuity string         // xDCFS 不連続要因銘柄区分
+	HighFlag      string         // pDHF 日通し高値フラグ
+	HighPrice     model.Price    // pDHP 高値
+	HighTime      string         // tDHP:T 高値時刻
+	Turnover      int64          // pDJ 売買代金
+	LowFlag       string         // pDLF 日通し安値フラグ
+	LowPrice      model.Price    // pDLP 安値
+	LowTime       string         // tDLP:T 安値時刻
+	OpenPrice     model.Price    // pDOP 始値
+	OpenTime      string         // tDOP:T 始値時刻
+	PrevCompare   string         // pDPG 現値前値比較
+	LastPrice     model.Price    // pDPP 現在値
+	LastTime      string         // tDPP:T 現在値時刻
+	Volume        model.Quantity // pDV 出来高
+	ExDividend    string         // xDVES 配当落銘柄区分
+	ChangeRate    float64        // pDYRP 騰落率
+	Change        model.Price    // pDYWP 前日比
+	AskSize10     model.Quantity // pGAV10 売－１０－数量
+	AskPrice10    model.Price    // pGAP10 売－１０－値段
+	AskSize9      model.Quantity // pGAV9 売－９－数量
+	AskPrice9     model.Price    // pGAP9 売－９－値段
+	AskSize8      model.Quantity // pGAV8 売－８－数量
+	AskPrice8     model.Price    // pGAP8 売－８－値段
+	AskSize7      model.Quantity // pGAV7 売－７－数量
+	AskPrice7     model.Price    // pGAP7 売－７－値段
+	AskSize6      model.Quantity // pGAV6 売－６－数量
+	AskPrice6     model.Price    // pGAP6 売－６－値段
+	AskSize5      model.Quantity // pGAV5 売－５－数量
+	AskPrice5     model.Price    // pGAP5 売－５－値段
+	AskSize4      model.Quantity // pGAV4 売－４－数量
+	AskPrice4     model.Price    // pGAP4 売－４－値段
+	AskSize3      model.Quantity // pGAV3 売－３－数量
+	AskPrice3     model.Price    // pGAP3 売－３－値段
+	AskSize2      model.Quantity // pGAV2 売－２－数量
+	AskPrice2     model.Price    // pGAP2 売－２－値段
+	AskSize1      model.Quantity // pGAV1 売－１－数量
+	AskPrice1     model.Price    // pGAP1 売－１－値段
+	BidSize1      model.Quantity // pGBV1 買－１－数量
+	BidPrice1     model.Price    // pGBP1 買－１－値段
+	BidSize2      model.Quantity // pGBV2 買－２－数量
+	BidPrice2     model.Price    // pGBP2 買－２－値段
+	BidSize3      model.Quantity // pGBV3 買－３－数量
+	BidPrice3     model.Price    // pGBP3 買－３－値段
+	BidSize4      model.Quantity // pGBV4 買－４－数量
+	BidPrice4     model.Price    // pGBP4 買－４－値段
+	BidSize5      model.Quantity // pGBV5 買－５－数量
+	BidPrice5     model.Price    // pGBP5 買－５－値段
+	BidSize6      model.Quantity // pGBV6 買－６－数量
+	BidPrice6     model.Price    // pGBP6 買－６－値段
+	BidSize7      model.Quantity // pGBV7 買－７－数量
+	BidPrice7     model.Price    // pGBP7 買－７－値段
+	BidSize8      model.Quantity // pGBV8 買－８－数量
+	BidPrice8     model.Price    // pGBP8 買－８－値段
+	BidSize9      model.Quantity // pGBV9 買－９－数量
+	BidPrice9     model.Price    // pGBP9 買－９－値段
+	BidSize10     model.Quantity // pGBV10 買－１０－数量
+	BidPrice10    model.Price    // pGBP10 買－１０－値段
+	MarketSection string         // xLISS 所属
+	PrevClose     model.Price    // pPRP 前日終値
+	AskPrice      model.Price    // pQAP 売気配値
+	AskType       string         // pQAS 売気配値種類
+	BidPrice      model.Price    // pQBP 買気配値
+	BidType       string         // pQBS 買気配値種類
+	OverSize      model.Quantity // pQOV 売-OVER
+	UnderSize     model.Quantity // pQUV 買-UNDER
+	VWAP          model.Price    // pVWAP VWAP
+}
+
+// DecodeQuoteFields converts raw attributes into QuoteFields.
+func DecodeQuoteFields(fields model.Attributes) QuoteFields {
+	return QuoteFields{
+		MarketAskSize: decodeQuantity(fields, "pAAV"),
+		MarketBidSize: decodeQuantity(fields, "pABV"),
+		AskSize:       decodeQuantity(fields, "pAV"),
+		BidSize:       decodeQuantity(fields, "pBV"),
+		Discontinuity: fields.Value("xDCFS"),
+		HighFlag:      fields.Value("pDHF"),
+		HighPrice:     decodePrice(fields, "pDHP"),
+		HighTime:      fields.Value("tDHP:T"),
+		Turnover:      decodeInt(fields, "pDJ"),
+		LowFlag:       fields.Value("pDLF"),
+		LowPrice:      decodePrice(fields, "pDLP"),
+		LowTime:       fields.Value("tDLP:T"),
+		OpenPrice:     decodePrice(fields, "pDOP"),
+		OpenTime:      fields.Value("tDOP:T"),
+		PrevCompare:   fields.Value("pDPG"),
+		LastPrice:     decodePrice(fields, "pDPP"),
+		LastTime:      fields.Value("tDPP:T"),
+		Volume:        decodeQuantity(fields, "pDV"),
+		ExDividend:    fields.Value("xDVES"),
+		ChangeRate:    decodeFloat(fields, "pDYRP"),
+		Change:        decodePrice(fields, "pDYWP"),
+		AskSize10:     decodeQuantity(fields, "pGAV10"),
+		AskPrice10:    decodePrice(fields, "pGAP10"),
+		AskSize9:      decodeQuantity(fields, "pGAV9"),
+		AskPrice9:     decodePrice(fields, "pGAP9"),
+		AskSize8:      decodeQuantity(fields, "pGAV8"),
+		AskPrice8:     decodePrice(fields, "pGAP8"),
+		AskSize7:      decodeQuantity(fields, "pGAV7"),
+		AskPrice7:     decodePrice(fields, "pGAP7"),
+		AskSize6:      decodeQuantity(fields, "pGAV6"),
+		AskPrice6:     decodePrice(fields, "pGAP6"),
+		AskSize5:      decodeQuantity(fields, "pGAV5"),
+		AskPrice5:     decodePrice(fields, "pGAP5"),
+		AskSize4:      decodeQuantity(fields, "pGAV4"),
+		AskPrice4:     decodePrice(fields, "pGAP4"),
+		AskSize3:      decodeQuantity(fields, "pGAV3"),
+		AskPrice3:     decodePrice(fields, "pGAP3"),
+		AskSize2:      decodeQuantity(fields, "pGAV2"),
+		AskPrice2:     decodePrice(fields, "pGAP2"),
+		AskSize1:      decodeQuantity(fields, "pGAV1"),
+		AskPrice1:     decodePrice(fields, "pGAP1"),
+		BidSize1:      decodeQuantity(fields, "pGBV1"),
+		BidPrice1:     decodePrice(fields, "pGBP1"),
+		BidSize2:      decodeQuantity(fields, "pGBV2"),
+		BidPrice2:     decodePrice(fields, "pGBP2"),
+		BidSize3:      decodeQuantity(fields, "pGBV3"),
+		BidPrice3:     decodePrice(fields, "pGBP3"),
+		BidSize4:      decodeQuantity(fields, "pGBV4"),
+		BidPrice4:     decodePrice(fields, "pGBP4"),
+		BidSize5:      decodeQuantity(fields, "pGBV5"),
+		BidPrice5:     decodePrice(fields, "pGBP5"),
+		BidSize6:      decodeQuantity(fields, "pGBV6"),
+		BidPrice6:     decodePrice(fields, "pGBP6"),
+		BidSize7:      decodeQuantity(fields, "pGBV7"),
+		BidPrice7:     decodePrice(fields, "pGBP7"),
+		BidSize8:      decodeQuantity(fields, "pGBV8"),
+		BidPrice8:     decodePrice(fields, "pGBP8"),
+		BidSize9:      decodeQuantity(fields, "pGBV9"),
+		BidPrice9:     decodePrice(fields, "pGBP9"),
+		BidSize10:     decodeQuantity(fields, "pGBV10"),
+		BidPrice10:    decodePrice(fields, "pGBP10"),
+		MarketSection: fields.Value("xLISS"),
+		PrevClose:     decodePrice(fields, "pPRP"),
+		AskPrice:      decodePrice(fields, "pQAP"),
+		AskType:       fields.Value("pQAS"),
+		BidPrice:      decodePrice(fields, "pQBP"),
+		BidType:       fields.Value("pQBS"),
+		OverSize:      decodeQuantity(fields, "pQOV"),
+		UnderSize:     decodeQuantity(fields, "pQUV"),
+		VWAP:          decodePrice(fields, "pVWAP"),
+	}
+}
+
+// DiscontinuityLabel decodes xDCFS (不連続要因銘柄区分).
+func (q QuoteFields) DiscontinuityLabel() string {
+	label, _ := DecodeEnum("xDCFS", q.Discontinuity)
+	return label
+}
+
+// HighFlagLabel decodes pDHF (日通し高値フラグ).
+func (q QuoteFields) HighFlagLabel() string {
+	label, _ := DecodeEnum("pDHF", q.HighFlag)
+	return label
+}
+
+// LowFlagLabel decodes pDLF (日通し安値フラグ).
+func (q QuoteFields) LowFlagLabel() string {
+	label, _ := DecodeEnum("pDLF", q.LowFlag)
+	return label
+}
+
+// PrevCompareLabel decodes pDPG (現値前値比較).
+func (q QuoteFields) PrevCompareLabel() string {
+	label, _ := DecodeEnum("pDPG", q.PrevCompare)
+	return label
+}
+
+// ExDividendLabel decodes xDVES (配当落銘柄区分).
+func (q QuoteFields) ExDividendLabel() string {
+	label, _ := DecodeEnum("xDVES", q.ExDividend)
+	return label
+}
+
+// MarketSectionLabel decodes xLISS (所属).
+func (q QuoteFields) MarketSectionLabel() string {
+	label, _ := DecodeEnum("xLISS", q.MarketSection)
+	return label
+}
+
+// AskTypeLabel decodes pQAS (売気配値種類).
+func (q QuoteFields) AskTypeLabel() string {
+	label, _ := DecodeEnum("pQAS", q.AskType)
+	return label
+}
+
+// BidTypeLabel decodes pQBS (買気配値種類).
+func (q QuoteFields) BidTypeLabel() string {
+	label, _ := DecodeEnum("pQBS", q.BidType)
+	return label
+}
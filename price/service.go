@@ -74,8 +74,9 @@ func (e MarketPriceEntry) Value(key string) string {
 }
 
 type QuoteSnapshot struct {
-	Quotes []model.Quote
-	Raw    *MarketPriceResponse
+	Quotes   []model.Quote
+	BySymbol map[string]model.Quote
+	Raw      *MarketPriceResponse
 }
 
 type MarketPriceHistoryRequest struct {
@@ -164,14 +165,17 @@ func (s *Service) QuoteSnapshot(ctx context.Context, symbols []string, fields []
 	}
 
 	quotes := make([]model.Quote, 0, len(raw.Prices))
+	bySymbol := make(map[string]model.Quote, len(raw.Prices))
 	for _, entry := range raw.Prices {
-		quotes = append(quotes, model.Quote{
+		quote := model.Quote{
 			Symbol: entry.IssueCode,
 			Fields: cloneAttributes(entry.Fields),
-		})
+		}
+		quotes = append(quotes, quote)
+		bySymbol[entry.IssueCode] = quote
 	}
 
-	return &QuoteSnapshot{Quotes: quotes, Raw: raw}, nil
+	return &QuoteSnapshot{Quotes: quotes, BySymbol: bySymbol, Raw: raw}, nil
 }
 
 // History fetches daily price history for a single issue code.
@@ -0,0 +1,225 @@
+package request
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/ticks"
+)
+
+// DefaultBulkConcurrency is the number of cancel/correct requests a bulk
+// operation keeps in flight.
+const DefaultBulkConcurrency = 4
+
+const orderDateTimeLayout = "20060102150405"
+
+// openStatusCodes are the sOrderStatusCode values of orders that can still
+// be cancelled or corrected. 取消中 (6) is excluded.
+var openStatusCodes = map[string]bool{
+	"0":  true, // 受付未済
+	"1":  true, // 未約定
+	"3":  true, // 訂正中
+	"4":  true, // 訂正完了
+	"5":  true, // 訂正失敗
+	"8":  true, // 取消失敗
+	"9":  true, // 一部約定
+	"13": true, // 発注待ち
+	"15": true, // 切替注文 / 逆指注文(切替中)
+	"16": true, // 切替完了 / 逆指注文(未約定)
+	"50": true, // 発注中
+}
+
+// OrderFilter selects open orders from CLMOrderList. Zero fields match
+// everything.
+type OrderFilter struct {
+	Symbol string
+	Side   Side
+	// CashOrMargin matches any of the listed sGenkinShinyouKubun values.
+	CashOrMargin []CashOrMargin
+	// OlderThan matches orders placed at least this long before Now.
+	OlderThan time.Duration
+	// Now defaults to time.Now.
+	Now time.Time
+}
+
+// Match reports whether entry is open and passes the filter.
+func (f OrderFilter) Match(entry OrderEntry) bool {
+	fields := entry.Fields
+	if !openStatusCodes[strings.TrimSpace(fields.Value("sOrderStatusCode"))] {
+		return false
+	}
+	if symbol := strings.TrimSpace(f.Symbol); symbol != "" && strings.TrimSpace(entry.Symbol) != symbol {
+		return false
+	}
+	if f.Side != "" && strings.TrimSpace(fields.Value("sOrderBaibaiKubun")) != string(f.Side) {
+		return false
+	}
+	if len(f.CashOrMargin) > 0 {
+		kind := ListedCashOrMargin(fields)
+		found := false
+		for _, want := range f.CashOrMargin {
+			if kind == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.OlderThan > 0 {
+		placed, err := time.ParseInLocation(orderDateTimeLayout, strings.TrimSpace(fields.Value("sOrderOrderDateTime")), model.JST)
+		if err != nil {
+			return false
+		}
+		now := f.Now
+		if now.IsZero() {
+			now = time.Now()
+		}
+		if now.Sub(placed) < f.OlderThan {
+			return false
+		}
+	}
+	return true
+}
+
+// BulkResult is the outcome of one order in a bulk operation.
+type BulkResult struct {
+	OrderNumber string
+	EigyouDay   string
+	Symbol      string
+	// Price is the new price for RepriceOrders.
+	Price    model.Price
+	Response *OrderResponse
+	Err      error
+}
+
+// TickResolver returns the tick table for an issue. *ticks.Resolver
+// satisfies it.
+type TickResolver interface {
+	ForIssue(issueCode, marketCode string) (ticks.Table, error)
+}
+
+type bulkConfig struct {
+	concurrency int
+}
+
+type BulkOption func(*bulkConfig)
+
+// WithConcurrency bounds the requests in flight (default
+// DefaultBulkConcurrency).
+func WithConcurrency(n int) BulkOption {
+	return func(c *bulkConfig) {
+		if n > 0 {
+			c.concurrency = n
+		}
+	}
+}
+
+// OpenOrders lists the orders that pass filter.
+func (s *Service) OpenOrders(ctx context.Context, filter OrderFilter) ([]OrderEntry, error) {
+	params := OrderParams{}
+	if symbol := strings.TrimSpace(filter.Symbol); symbol != "" {
+		params["sIssueCode"] = symbol
+	}
+	resp, err := s.OrderList(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	var out []OrderEntry
+	for _, entry := range resp.Entries {
+		if filter.Match(entry) {
+			out = append(out, entry)
+		}
+	}
+	return out, nil
+}
+
+// CancelOrders cancels every open order that passes filter. The error is
+// only for listing orders; per-order failures are in the results.
+func (s *Service) CancelOrders(ctx context.Context, filter OrderFilter, secondPassword string, opts ...BulkOption) ([]BulkResult, error) {
+	entries, err := s.OpenOrders(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return runBulk(ctx, entries, opts, func(ctx context.Context, entry OrderEntry, result *BulkResult) {
+		result.Response, result.Err = s.KabuCancelOrder(ctx, CancelParams(result.OrderNumber, result.EigyouDay, secondPassword))
+	}), nil
+}
+
+// RepriceOrders moves the limit price of every open order that passes
+// filter by n ticks; negative n lowers it. Market orders are reported as
+// failures and left alone.
+func (s *Service) RepriceOrders(ctx context.Context, filter OrderFilter, n int, resolver TickResolver, secondPassword string, opts ...BulkOption) ([]BulkResult, error) {
+	if n == 0 {
+		return nil, &terrors.ValidationError{Field: "ticks", Reason: "must not be zero"}
+	}
+	if resolver == nil {
+		return nil, &terrors.ValidationError{Field: "resolver", Reason: "required"}
+	}
+	entries, err := s.OpenOrders(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return runBulk(ctx, entries, opts, func(ctx context.Context, entry OrderEntry, result *BulkResult) {
+		price, ok := parsePrice(entry.Fields.Value("sOrderOrderPrice"))
+		if !ok || price <= 0 {
+			result.Err = &terrors.ValidationError{Field: "sOrderOrderPrice", Reason: "not a limit order"}
+			return
+		}
+		table, err := resolver.ForIssue(entry.Symbol, strings.TrimSpace(entry.Fields.Value("sOrderSizyouC")))
+		if err != nil {
+			result.Err = err
+			return
+		}
+		result.Price, result.Err = table.Step(price, n)
+		if result.Err != nil {
+			return
+		}
+		result.Response, result.Err = s.CorrectOrder(ctx, Correction{
+			OrderNumber:    result.OrderNumber,
+			EigyouDay:      result.EigyouDay,
+			Price:          PriceRef(result.Price),
+			SecondPassword: secondPassword,
+		})
+	}), nil
+}
+
+// runBulk runs fn for each entry with bounded concurrency. Results keep the
+// order of entries.
+func runBulk(ctx context.Context, entries []OrderEntry, opts []BulkOption, fn func(context.Context, OrderEntry, *BulkResult)) []BulkResult {
+	cfg := bulkConfig{concurrency: DefaultBulkConcurrency}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&cfg)
+		}
+	}
+	results := make([]BulkResult, len(entries))
+	sem := make(chan struct{}, cfg.concurrency)
+	var wg sync.WaitGroup
+	for i, entry := range entries {
+		results[i] = BulkResult{
+			OrderNumber: entry.OrderID,
+			EigyouDay:   strings.TrimSpace(entry.Fields.Value("sOrderSikkouDay")),
+			Symbol:      entry.Symbol,
+		}
+		select {
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(entry OrderEntry, result *BulkResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(ctx, entry, result)
+		}(entry, &results[i])
+	}
+	wg.Wait()
+	return results
+}
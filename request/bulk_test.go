@@ -0,0 +1,147 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ueebee/tachibanashi/auth"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/ticks"
+)
+
+// fakeClient answers CLMOrderList with list and records every other
+// request.
+type fakeClient struct {
+	list string
+
+	mu       sync.Mutex
+	requests []map[string]any
+	fail     map[string]bool
+}
+
+func (c *fakeClient) VirtualURLs() auth.VirtualURLs {
+	return auth.VirtualURLs{Request: "https://example/request"}
+}
+
+func (c *fakeClient) DoJSON(ctx context.Context, method, path string, req, resp any) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+	if payload["sCLMID"] == clmOrderList {
+		return json.Unmarshal([]byte(c.list), resp)
+	}
+	c.mu.Lock()
+	c.requests = append(c.requests, payload)
+	c.mu.Unlock()
+	number := fmt.Sprint(payload["sOrderNumber"])
+	if c.fail[number] {
+		return errors.New("rejected")
+	}
+	return json.Unmarshal([]byte(`{"p_errno":"0","sResultCode":"0","sOrderNumber":"`+number+`"}`), resp)
+}
+
+func (c *fakeClient) sent() []map[string]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := append([]map[string]any(nil), c.requests...)
+	sort.Slice(out, func(i, j int) bool { return fmt.Sprint(out[i]["sOrderNumber"]) < fmt.Sprint(out[j]["sOrderNumber"]) })
+	return out
+}
+
+const bulkOrderList = `{"p_errno":"0","sResultCode":"0","aOrderList":[
+{"sOrderOrderNumber":"1","sOrderIssueCode":"6501","sOrderSizyouC":"00","sOrderBaibaiKubun":"3","sGenkinSinyouKubun":"0","sOrderOrderPrice":"3000","sOrderStatusCode":"1","sOrderSikkouDay":"20240603","sOrderOrderDateTime":"20240603090000"},
+{"sOrderOrderNumber":"2","sOrderIssueCode":"6501","sOrderSizyouC":"00","sOrderBaibaiKubun":"1","sGenkinSinyouKubun":"2","sOrderOrderPrice":"3100","sOrderStatusCode":"9","sOrderSikkouDay":"20240603","sOrderOrderDateTime":"20240603092500"},
+{"sOrderOrderNumber":"3","sOrderIssueCode":"7203","sOrderSizyouC":"00","sOrderBaibaiKubun":"3","sGenkinSinyouKubun":"0","sOrderOrderPrice":"0","sOrderStatusCode":"1","sOrderSikkouDay":"20240603","sOrderOrderDateTime":"20240603090500"},
+{"sOrderOrderNumber":"4","sOrderIssueCode":"6501","sOrderSizyouC":"00","sOrderBaibaiKubun":"3","sGenkinSinyouKubun":"0","sOrderOrderPrice":"3000","sOrderStatusCode":"10","sOrderSikkouDay":"20240603","sOrderOrderDateTime":"20240603090000"}
+]}`
+
+func TestOrderFilterMatch(t *testing.T) {
+	var resp OrderListResponse
+	if err := json.Unmarshal([]byte(bulkOrderList), &resp); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	now := time.Date(2024, 6, 3, 9, 30, 0, 0, model.JST)
+	cases := []struct {
+		name   string
+		filter OrderFilter
+		want   string
+	}{
+		{"open", OrderFilter{}, "1,2,3"},
+		{"symbol", OrderFilter{Symbol: "6501"}, "1,2"},
+		{"side", OrderFilter{Side: SideBuy}, "1,3"},
+		{"margin", OrderFilter{CashOrMargin: []CashOrMargin{MarginSystemOpen, MarginGeneralOpen}}, "2"},
+		{"older", OrderFilter{OlderThan: 10 * time.Minute, Now: now}, "1,3"},
+	}
+	for _, tc := range cases {
+		var got []string
+		for _, entry := range resp.Entries {
+			if tc.filter.Match(entry) {
+				got = append(got, entry.OrderID)
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(strings.Split(tc.want, ",")) {
+			t.Fatalf("%s: matched %v, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCancelOrdersReportsPerOrder(t *testing.T) {
+	client := &fakeClient{list: bulkOrderList, fail: map[string]bool{"2": true}}
+	results, err := NewService(client).CancelOrders(context.Background(), OrderFilter{Symbol: "6501"}, "pw", WithConcurrency(2))
+	if err != nil {
+		t.Fatalf("CancelOrders() error = %v", err)
+	}
+	if len(results) != 2 || results[0].OrderNumber != "1" || results[0].Err != nil || results[1].OrderNumber != "2" || results[1].Err == nil {
+		t.Fatalf("results = %+v", results)
+	}
+	sent := client.sent()
+	if len(sent) != 2 || sent[0]["sCLMID"] != clmKabuCancelOrder || sent[0]["sEigyouDay"] != "20240603" || sent[0]["sSecondPassword"] != "pw" {
+		t.Fatalf("sent = %v", sent)
+	}
+}
+
+type fixedTicks struct {
+	table ticks.Table
+}
+
+func (r fixedTicks) ForIssue(issueCode, marketCode string) (ticks.Table, error) {
+	return r.table, nil
+}
+
+func TestRepriceOrders(t *testing.T) {
+	table := ticks.Table{Bands: []ticks.Band{
+		{Upper: model.Yen(3000), Tick: model.Yen(1)},
+		{Upper: model.Yen(5000), Tick: model.Yen(5)},
+	}}
+	client := &fakeClient{list: bulkOrderList}
+	results, err := NewService(client).RepriceOrders(context.Background(), OrderFilter{Side: SideBuy}, -2, fixedTicks{table: table}, "pw")
+	if err != nil {
+		t.Fatalf("RepriceOrders() error = %v", err)
+	}
+	if len(results) != 2 || results[0].Err != nil || results[0].Price != model.Yen(2998) {
+		t.Fatalf("results = %+v", results)
+	}
+	if results[1].OrderNumber != "3" || results[1].Err == nil {
+		t.Fatalf("market order result = %+v", results[1])
+	}
+	sent := client.sent()
+	if len(sent) != 1 || sent[0]["sCLMID"] != clmKabuCorrectOrder || sent[0]["sOrderPrice"] != "2998" || sent[0]["sOrderSuryou"] != "*" {
+		t.Fatalf("sent = %v", sent)
+	}
+
+	if _, err := NewService(client).RepriceOrders(context.Background(), OrderFilter{}, 0, fixedTicks{table: table}, "pw"); err == nil {
+		t.Fatalf("expected error for zero ticks")
+	}
+}
@@ -0,0 +1,124 @@
+package request
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+const unchanged = "*"
+
+// Correction is a typed CLMKabuCorrectOrder request. Zero values leave a
+// field unchanged; nil prices are unchanged and a zero price changes the
+// order to market.
+type Correction struct {
+	OrderNumber string
+	EigyouDay   string
+	Condition   Condition
+	Price       *model.Price
+	// Quantity is the new order quantity including shares already filled
+	// (内出来). It can only be reduced.
+	Quantity       model.Quantity
+	Expire         ExpireDay
+	StopTrigger    *model.Price
+	StopPrice      *model.Price
+	SecondPassword string
+}
+
+// PriceRef returns a pointer to price for Correction fields.
+func PriceRef(price model.Price) *model.Price {
+	return &price
+}
+
+// Validate checks the correction before anything is sent.
+func (c Correction) Validate() error {
+	if strings.TrimSpace(c.OrderNumber) == "" {
+		return &terrors.ValidationError{Field: "sOrderNumber", Reason: "required"}
+	}
+	if strings.TrimSpace(c.EigyouDay) == "" {
+		return &terrors.ValidationError{Field: "sEigyouDay", Reason: "required"}
+	}
+	switch c.Condition {
+	case "", ConditionNone, ConditionOpening, ConditionClosing, ConditionFunari:
+	default:
+		return &terrors.ValidationError{Field: "sCondition", Reason: "invalid value: " + string(c.Condition)}
+	}
+	if c.Quantity < 0 {
+		return &terrors.ValidationError{Field: "sOrderSuryou", Reason: "must not be negative"}
+	}
+	for field, price := range map[string]*model.Price{
+		"sOrderPrice":       c.Price,
+		"sGyakusasiZyouken": c.StopTrigger,
+		"sGyakusasiPrice":   c.StopPrice,
+	} {
+		if price != nil && *price < 0 {
+			return &terrors.ValidationError{Field: field, Reason: "must not be negative"}
+		}
+	}
+	if c.Expire != "" {
+		return validateExpire(c.Expire)
+	}
+	return nil
+}
+
+// ToParams validates the correction and returns the CLMKabuCorrectOrder
+// fields.
+func (c Correction) ToParams() (OrderParams, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	params := OrderParams{
+		"sOrderNumber":      strings.TrimSpace(c.OrderNumber),
+		"sEigyouDay":        strings.TrimSpace(c.EigyouDay),
+		"sCondition":        unchanged,
+		"sOrderPrice":       optionalPrice(c.Price),
+		"sOrderSuryou":      unchanged,
+		"sOrderExpireDay":   unchanged,
+		"sGyakusasiZyouken": optionalPrice(c.StopTrigger),
+		"sGyakusasiPrice":   optionalPrice(c.StopPrice),
+	}
+	if c.Condition != "" {
+		params["sCondition"] = string(c.Condition)
+	}
+	if c.Quantity > 0 {
+		params["sOrderSuryou"] = strconv.FormatInt(int64(c.Quantity), 10)
+	}
+	if c.Expire != "" {
+		params["sOrderExpireDay"] = string(c.Expire)
+	}
+	if c.SecondPassword != "" {
+		params["sSecondPassword"] = c.SecondPassword
+	}
+	return params, nil
+}
+
+// CorrectOrder validates and submits a typed correction via KabuCorrectOrder.
+func (s *Service) CorrectOrder(ctx context.Context, correction Correction) (*OrderResponse, error) {
+	params, err := correction.ToParams()
+	if err != nil {
+		return nil, err
+	}
+	return s.KabuCorrectOrder(ctx, params)
+}
+
+// CancelParams returns the CLMKabuCancelOrder fields for one order.
+func CancelParams(orderNumber, eigyouDay, secondPassword string) OrderParams {
+	params := OrderParams{
+		"sOrderNumber": strings.TrimSpace(orderNumber),
+		"sEigyouDay":   strings.TrimSpace(eigyouDay),
+	}
+	if secondPassword != "" {
+		params["sSecondPassword"] = secondPassword
+	}
+	return params
+}
+
+func optionalPrice(price *model.Price) string {
+	if price == nil {
+		return unchanged
+	}
+	return formatPrice(*price)
+}
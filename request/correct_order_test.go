@@ -0,0 +1,47 @@
+package request
+
+import (
+	"testing"
+
+	"github.com/ueebee/tachibanashi/model"
+)
+
+func TestCorrectionToParams(t *testing.T) {
+	params, err := Correction{
+		OrderNumber:    "9000015",
+		EigyouDay:      "20221209",
+		Price:          PriceRef(0),
+		Quantity:       300,
+		SecondPassword: "pw",
+	}.ToParams()
+	if err != nil {
+		t.Fatalf("ToParams() error = %v", err)
+	}
+	want := map[string]string{
+		"sOrderNumber":      "9000015",
+		"sEigyouDay":        "20221209",
+		"sCondition":        "*",
+		"sOrderPrice":       "0",
+		"sOrderSuryou":      "300",
+		"sOrderExpireDay":   "*",
+		"sGyakusasiZyouken": "*",
+		"sGyakusasiPrice":   "*",
+		"sSecondPassword":   "pw",
+	}
+	if len(params) != len(want) {
+		t.Fatalf("params length mismatch: %d", len(params))
+	}
+	for key, value := range want {
+		if params[key] != value {
+			t.Fatalf("%s mismatch: %v", key, params[key])
+		}
+	}
+
+	params, err = Correction{OrderNumber: "1", EigyouDay: "20221209", StopTrigger: PriceRef(model.Yen(2950))}.ToParams()
+	if err != nil || params["sGyakusasiZyouken"] != "2950" || params["sOrderPrice"] != "*" {
+		t.Fatalf("stop correction = %v, %v", params, err)
+	}
+	if _, err := (Correction{EigyouDay: "20221209"}).ToParams(); err == nil {
+		t.Fatalf("expected error for missing order number")
+	}
+}
@@ -0,0 +1,253 @@
+package request
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+// MarginLot is one open margin position (建玉) from CLMShinyouTategyokuList.
+type MarginLot struct {
+	Number    string // sOrderTategyokuNumber
+	Symbol    string
+	Market    string
+	Side      Side // side of the opening trade: SideBuy (買建) or SideSell (売建)
+	Tax       TaxAccount
+	BuildDate time.Time
+	Price     model.Price // 建単価
+	Valuation model.Price // 評価単価
+	Quantity  model.Quantity
+	// Closable is sOrderHensaiKanouSuryou: shares not already tied up in
+	// pending close orders.
+	Closable model.Quantity
+}
+
+// UnitProfit returns the valuation gain per share.
+func (l MarginLot) UnitProfit() model.Price {
+	if l.Side == SideSell {
+		return l.Price - l.Valuation
+	}
+	return l.Valuation - l.Price
+}
+
+// Lot decodes the entry into a MarginLot.
+func (e ShinyouTategyokuEntry) Lot() (MarginLot, error) {
+	lot := MarginLot{
+		Number: strings.TrimSpace(e.Fields.Value("sOrderTategyokuNumber")),
+		Symbol: e.IssueCode,
+		Market: strings.TrimSpace(e.Fields.Value("sOrderSizyouC")),
+		Side:   Side(strings.TrimSpace(e.Fields.Value("sOrderBaibaiKubun"))),
+		Tax:    TaxAccount(strings.TrimSpace(e.Fields.Value("sOrderZyoutoekiKazeiC"))),
+	}
+	if lot.Number == "" {
+		return MarginLot{}, &terrors.ValidationError{Field: "sOrderTategyokuNumber", Reason: "required"}
+	}
+	if day := strings.TrimSpace(e.Fields.Value("sOrderTategyokuDay")); day != "" && day != "00000000" {
+		date, err := model.ParseDate(day)
+		if err != nil {
+			return MarginLot{}, &terrors.ValidationError{Field: "sOrderTategyokuDay", Reason: "invalid value: " + day}
+		}
+		lot.BuildDate = date
+	}
+	if price, ok := parsePrice(e.Fields.Value("sOrderTategyokuTanka")); ok {
+		lot.Price = price
+	}
+	if price, ok := parsePrice(e.Fields.Value("sOrderHyoukaTanka")); ok {
+		lot.Valuation = price
+	}
+	if qty, ok := parseInt64(e.Fields.Value("sOrderTategyokuSuryou")); ok {
+		lot.Quantity = model.Quantity(qty)
+	}
+	lot.Closable = lot.Quantity
+	if qty, ok := parseInt64(e.Fields.Value("sOrderHensaiKanouSuryou")); ok {
+		lot.Closable = model.Quantity(qty)
+	}
+	return lot, nil
+}
+
+// Lots decodes every entry into a MarginLot.
+func (r *ShinyouTategyokuListResponse) Lots() ([]MarginLot, error) {
+	if r == nil {
+		return nil, nil
+	}
+	lots := make([]MarginLot, 0, len(r.Entries))
+	for _, entry := range r.Entries {
+		lot, err := entry.Lot()
+		if err != nil {
+			return nil, err
+		}
+		lots = append(lots, lot)
+	}
+	return lots, nil
+}
+
+// CloseLot is one aCLMKabuHensaiData row. Its position in NewOrder.CloseLots
+// becomes sTatebiZyuni.
+type CloseLot struct {
+	Number   string
+	Quantity model.Quantity
+}
+
+// WithLots closes the given lots in order with individually specified
+// positions (sTatebiType=1). Quantity becomes the sum of the lots.
+func (o NewOrder) WithLots(lots []CloseLot) NewOrder {
+	o.CloseLots = append([]CloseLot(nil), lots...)
+	o.Positions.Mode = PositionSelectionSpecified
+	var total model.Quantity
+	for _, lot := range lots {
+		total += lot.Quantity
+	}
+	o.Quantity = total
+	return o
+}
+
+// SelectLots picks lots to close qty shares. Lots are taken oldest first,
+// highest unit profit first or highest unit loss first; ties fall back to
+// build date and lot number. The last lot may be closed partially.
+func SelectLots(open []MarginLot, qty model.Quantity, mode PositionSelectionMode) ([]CloseLot, error) {
+	if qty <= 0 {
+		return nil, &terrors.ValidationError{Field: "sOrderSuryou", Reason: "must be positive"}
+	}
+	lots := make([]MarginLot, 0, len(open))
+	for _, lot := range open {
+		if lot.Closable > 0 {
+			lots = append(lots, lot)
+		}
+	}
+	oldest := func(a, b MarginLot) bool {
+		if !a.BuildDate.Equal(b.BuildDate) {
+			return a.BuildDate.Before(b.BuildDate)
+		}
+		return a.Number < b.Number
+	}
+	switch mode {
+	case PositionSelectionOldestFirst:
+		sort.SliceStable(lots, func(i, j int) bool { return oldest(lots[i], lots[j]) })
+	case PositionSelectionProfitFirst:
+		sort.SliceStable(lots, func(i, j int) bool {
+			if lots[i].UnitProfit() != lots[j].UnitProfit() {
+				return lots[i].UnitProfit() > lots[j].UnitProfit()
+			}
+			return oldest(lots[i], lots[j])
+		})
+	case PositionSelectionLossFirst:
+		sort.SliceStable(lots, func(i, j int) bool {
+			if lots[i].UnitProfit() != lots[j].UnitProfit() {
+				return lots[i].UnitProfit() < lots[j].UnitProfit()
+			}
+			return oldest(lots[i], lots[j])
+		})
+	default:
+		return nil, &terrors.ValidationError{Field: "sTatebiType", Reason: "unsupported selection mode: " + string(mode)}
+	}
+
+	var out []CloseLot
+	remaining := qty
+	for _, lot := range lots {
+		if remaining == 0 {
+			break
+		}
+		take := min(lot.Closable, remaining)
+		out = append(out, CloseLot{Number: lot.Number, Quantity: take})
+		remaining -= take
+	}
+	if remaining > 0 {
+		return nil, &terrors.ValidationError{
+			Field:  "sOrderSuryou",
+			Reason: "exceeds closable quantity by " + strconv.FormatInt(int64(remaining), 10),
+		}
+	}
+	return out, nil
+}
+
+// ValidateCloseLots checks a specified-lot close order against the open
+// lots: each lot must exist for the order's symbol, be on the side the order
+// closes (返済売・現引 close 買建, 返済買・現渡 close 売建) and have enough
+// closable shares. A 現引/現渡 must also name the lot's tax account.
+func ValidateCloseLots(order NewOrder, open []MarginLot) error {
+	if err := order.Validate(); err != nil {
+		return err
+	}
+	if order.Positions.Mode != PositionSelectionSpecified {
+		return nil
+	}
+	byNumber := make(map[string]MarginLot, len(open))
+	for _, lot := range open {
+		byNumber[lot.Number] = lot
+	}
+	wantSide := SideBuy
+	switch order.Side {
+	case SideBuy, SideDeliver:
+		wantSide = SideSell
+	}
+	for _, item := range order.CloseLots {
+		lot, ok := byNumber[item.Number]
+		if !ok {
+			return &terrors.ValidationError{Field: "sTategyokuNumber", Reason: "unknown lot: " + item.Number}
+		}
+		if lot.Symbol != "" && lot.Symbol != strings.TrimSpace(order.Symbol) {
+			return &terrors.ValidationError{Field: "sTategyokuNumber", Reason: "lot " + item.Number + " is for " + lot.Symbol}
+		}
+		if lot.Side != wantSide {
+			return &terrors.ValidationError{Field: "sTategyokuNumber", Reason: "lot " + item.Number + " is on the wrong side"}
+		}
+		if order.delivers() && lot.Tax != "" && lot.Tax != order.Positions.Tax {
+			return &terrors.ValidationError{Field: "sTategyokuZyoutoekiKazeiC", Reason: "lot " + item.Number + " is in tax account " + string(lot.Tax)}
+		}
+		if item.Quantity > lot.Closable {
+			return &terrors.ValidationError{
+				Field:  "sOrderSuryou",
+				Reason: "lot " + item.Number + " has " + strconv.FormatInt(int64(lot.Closable), 10) + " closable",
+			}
+		}
+	}
+	return nil
+}
+
+func (o NewOrder) validateCloseLots() error {
+	if o.Positions.Mode != PositionSelectionSpecified {
+		if len(o.CloseLots) > 0 {
+			return &terrors.ValidationError{Field: "aCLMKabuHensaiData", Reason: "only for specified position selection"}
+		}
+		return nil
+	}
+	if len(o.CloseLots) == 0 {
+		return &terrors.ValidationError{Field: "aCLMKabuHensaiData", Reason: "required for specified position selection"}
+	}
+	seen := make(map[string]struct{}, len(o.CloseLots))
+	var total model.Quantity
+	for _, lot := range o.CloseLots {
+		number := strings.TrimSpace(lot.Number)
+		if number == "" {
+			return &terrors.ValidationError{Field: "sTategyokuNumber", Reason: "required"}
+		}
+		if _, dup := seen[number]; dup {
+			return &terrors.ValidationError{Field: "sTategyokuNumber", Reason: "duplicate lot: " + number}
+		}
+		seen[number] = struct{}{}
+		if lot.Quantity <= 0 {
+			return &terrors.ValidationError{Field: "sOrderSuryou", Reason: "lot quantity must be positive"}
+		}
+		total += lot.Quantity
+	}
+	if total != o.Quantity {
+		return &terrors.ValidationError{Field: "sOrderSuryou", Reason: "must equal the sum of lot quantities"}
+	}
+	return nil
+}
+
+func closeLotParams(lots []CloseLot) []map[string]string {
+	out := make([]map[string]string, 0, len(lots))
+	for i, lot := range lots {
+		out = append(out, map[string]string{
+			"sTategyokuNumber": strings.TrimSpace(lot.Number),
+			"sTatebiZyuni":     strconv.Itoa(i + 1),
+			"sOrderSuryou":     strconv.FormatInt(int64(lot.Quantity), 10),
+		})
+	}
+	return out
+}
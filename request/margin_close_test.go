@@ -0,0 +1,173 @@
+package request
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+func testLots() []MarginLot {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, model.JST) }
+	return []MarginLot{
+		{Number: "B", Symbol: "6501", Side: SideBuy, BuildDate: day(5), Price: model.Yen(900), Valuation: model.Yen(1000), Quantity: 200, Closable: 200},
+		{Number: "A", Symbol: "6501", Side: SideBuy, BuildDate: day(4), Price: model.Yen(1100), Valuation: model.Yen(1000), Quantity: 100, Closable: 100},
+		{Number: "C", Symbol: "6501", Side: SideBuy, BuildDate: day(9), Price: model.Yen(950), Valuation: model.Yen(1000), Quantity: 300, Closable: 100},
+	}
+}
+
+func TestShinyouTategyokuEntryLot(t *testing.T) {
+	entry := ShinyouTategyokuEntry{
+		IssueCode: "6501",
+		Fields: model.Attributes{
+			"sOrderTategyokuNumber":   "202401040000001",
+			"sOrderSizyouC":           "00",
+			"sOrderBaibaiKubun":       "3",
+			"sOrderZyoutoekiKazeiC":   "1",
+			"sOrderTategyokuDay":      "20240104",
+			"sOrderTategyokuTanka":    "700.5000",
+			"sOrderHyoukaTanka":       "712.0000",
+			"sOrderTategyokuSuryou":   "300",
+			"sOrderHensaiKanouSuryou": "200",
+		},
+	}
+	lot, err := entry.Lot()
+	if err != nil {
+		t.Fatalf("Lot() error = %v", err)
+	}
+	if lot.Number != "202401040000001" || lot.Symbol != "6501" || lot.Side != SideBuy || lot.Tax != TaxAccountSpecific {
+		t.Fatalf("lot identity mismatch: %+v", lot)
+	}
+	if !lot.BuildDate.Equal(time.Date(2024, 1, 4, 0, 0, 0, 0, model.JST)) {
+		t.Fatalf("build date mismatch: %s", lot.BuildDate)
+	}
+	if lot.Price != model.Price(7005000) || lot.Valuation != model.Yen(712) {
+		t.Fatalf("price mismatch: %s %s", lot.Price, lot.Valuation)
+	}
+	if lot.Quantity != 300 || lot.Closable != 200 {
+		t.Fatalf("quantity mismatch: %d %d", lot.Quantity, lot.Closable)
+	}
+
+	if _, err := (ShinyouTategyokuEntry{Fields: model.Attributes{}}).Lot(); err == nil {
+		t.Fatalf("expected error for missing lot number")
+	}
+}
+
+func TestSelectLots(t *testing.T) {
+	cases := []struct {
+		name string
+		mode PositionSelectionMode
+		qty  model.Quantity
+		want []CloseLot
+	}{
+		{"oldest first", PositionSelectionOldestFirst, 250, []CloseLot{{"A", 100}, {"B", 150}}},
+		{"profit first", PositionSelectionProfitFirst, 250, []CloseLot{{"B", 200}, {"C", 50}}},
+		{"loss first", PositionSelectionLossFirst, 150, []CloseLot{{"A", 100}, {"C", 50}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := SelectLots(testLots(), tc.qty, tc.mode)
+			if err != nil {
+				t.Fatalf("SelectLots() error = %v", err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("lots mismatch: %+v", got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("lot %d mismatch: %+v", i, got[i])
+				}
+			}
+		})
+	}
+
+	if _, err := SelectLots(testLots(), 401, PositionSelectionOldestFirst); err == nil {
+		t.Fatalf("expected error when quantity exceeds closable")
+	}
+}
+
+func TestWithLotsToParams(t *testing.T) {
+	order := MarketSell("6501", MarketTSE, 0).
+		Margin(MarginSystemClose).
+		WithLots([]CloseLot{{Number: "A", Quantity: 100}, {Number: "B", Quantity: 50}})
+
+	params, err := order.ToParams()
+	if err != nil {
+		t.Fatalf("ToParams() error = %v", err)
+	}
+	if params["sTatebiType"] != "1" || params["sOrderSuryou"] != "150" {
+		t.Fatalf("params mismatch: %v %v", params["sTatebiType"], params["sOrderSuryou"])
+	}
+	rows, ok := params["aCLMKabuHensaiData"].([]map[string]string)
+	if !ok || len(rows) != 2 {
+		t.Fatalf("aCLMKabuHensaiData mismatch: %v", params["aCLMKabuHensaiData"])
+	}
+	if rows[1]["sTategyokuNumber"] != "B" || rows[1]["sTatebiZyuni"] != "2" || rows[1]["sOrderSuryou"] != "50" {
+		t.Fatalf("row mismatch: %v", rows[1])
+	}
+
+	if err := ValidateCloseLots(order, testLots()); err != nil {
+		t.Fatalf("ValidateCloseLots() error = %v", err)
+	}
+}
+
+func TestValidateCloseLots(t *testing.T) {
+	base := MarketSell("6501", MarketTSE, 0).Margin(MarginSystemClose)
+	cases := []struct {
+		name  string
+		order NewOrder
+		field string
+	}{
+		{"missing lots", func() NewOrder {
+			o := base
+			o.Quantity = 100
+			o.Positions.Mode = PositionSelectionSpecified
+			return o
+		}(), "aCLMKabuHensaiData"},
+		{"quantity mismatch", func() NewOrder {
+			o := base.WithLots([]CloseLot{{Number: "A", Quantity: 100}})
+			o.Quantity = 200
+			return o
+		}(), "sOrderSuryou"},
+		{"duplicate lot", base.WithLots([]CloseLot{{Number: "A", Quantity: 50}, {Number: "A", Quantity: 50}}), "sTategyokuNumber"},
+		{"unknown lot", base.WithLots([]CloseLot{{Number: "Z", Quantity: 100}}), "sTategyokuNumber"},
+		{"over closable", base.WithLots([]CloseLot{{Number: "C", Quantity: 150}}), "sOrderSuryou"},
+		{"wrong side", MarketBuy("6501", MarketTSE, 0).Margin(MarginSystemClose).WithLots([]CloseLot{{Number: "A", Quantity: 100}}), "sTategyokuNumber"},
+		{"lots without specified", func() NewOrder {
+			o := base
+			o.Quantity = 100
+			o.CloseLots = []CloseLot{{Number: "A", Quantity: 100}}
+			return o
+		}(), "aCLMKabuHensaiData"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateCloseLots(tc.order, testLots())
+			var validation *terrors.ValidationError
+			if !errors.As(err, &validation) {
+				t.Fatalf("expected validation error, got %v", err)
+			}
+			if validation.Field != tc.field {
+				t.Fatalf("field mismatch: %s (%s)", validation.Field, validation.Reason)
+			}
+		})
+	}
+
+	lots := testLots()
+	lots[1].Tax = TaxAccountGeneral
+	if err := ValidateCloseLots(base.WithLots([]CloseLot{{Number: "A", Quantity: 100}}), lots); err != nil {
+		t.Fatalf("返済売 error = %v", err)
+	}
+	receive := base.WithLots([]CloseLot{{Number: "A", Quantity: 100}})
+	receive.Side = SideReceive
+	receive.Positions.Tax = TaxAccountSpecific
+	if err := ValidateCloseLots(receive, lots); err == nil {
+		t.Fatalf("expected error for 現引 from another tax account")
+	}
+	receive.Positions.Tax = TaxAccountGeneral
+	if err := ValidateCloseLots(receive, lots); err != nil {
+		t.Fatalf("現引 error = %v", err)
+	}
+}
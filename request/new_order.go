@@ -0,0 +1,359 @@
+package request
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+// Side is sBaibaiKubun.
+type Side string
+
+const (
+	SideSell    Side = "1"
+	SideBuy     Side = "3"
+	SideDeliver Side = "5" // 現渡
+	SideReceive Side = "7" // 現引
+)
+
+// Condition is sCondition.
+type Condition string
+
+const (
+	ConditionNone    Condition = "0"
+	ConditionOpening Condition = "2" // 寄付
+	ConditionClosing Condition = "4" // 引け
+	ConditionFunari  Condition = "6" // 不成
+)
+
+// CashOrMargin is sGenkinShinyouKubun.
+type CashOrMargin string
+
+const (
+	Cash               CashOrMargin = "0"
+	MarginSystemOpen   CashOrMargin = "2" // 制度信用 新規（6ヶ月）
+	MarginSystemClose  CashOrMargin = "4" // 制度信用 返済
+	MarginGeneralOpen  CashOrMargin = "6" // 一般信用 新規（6ヶ月）
+	MarginGeneralClose CashOrMargin = "8" // 一般信用 返済
+)
+
+func (c CashOrMargin) IsMargin() bool {
+	return c != Cash
+}
+
+func (c CashOrMargin) IsClose() bool {
+	return c == MarginSystemClose || c == MarginGeneralClose
+}
+
+// ListedCashOrMargin reads an order's CashOrMargin from CLMOrderList or
+// CLMOrderListDetail fields, which spell it sGenkinSinyouKubun.
+func ListedCashOrMargin(fields model.Attributes) CashOrMargin {
+	return CashOrMargin(strings.TrimSpace(fields.Value("sGenkinSinyouKubun")))
+}
+
+// TaxAccount is sZyoutoekiKazeiC / sTategyokuZyoutoekiKazeiC.
+type TaxAccount string
+
+const (
+	TaxAccountUnspecified TaxAccount = "*"
+	TaxAccountSpecific    TaxAccount = "1" // 特定
+	TaxAccountGeneral     TaxAccount = "3" // 一般
+	TaxAccountNISA        TaxAccount = "5" // NISA
+	TaxAccountNISAGrowth  TaxAccount = "6" // N成長
+)
+
+// ExpireDay is sOrderExpireDay: "0" for today or YYYYMMDD.
+type ExpireDay string
+
+const ExpireToday ExpireDay = "0"
+
+// ExpireOn returns an expiry on the given date (JST).
+func ExpireOn(t time.Time) ExpireDay {
+	return ExpireDay(model.FormatDate(t))
+}
+
+// StopOrderType is sGyakusasiOrderType.
+type StopOrderType string
+
+const (
+	StopNone       StopOrderType = "0" // 通常
+	StopOnly       StopOrderType = "1" // 逆指値
+	StopWithNormal StopOrderType = "2" // 通常＋逆指値
+)
+
+// StopOrder describes the 逆指値 part of an order.
+// Price zero means market once triggered.
+type StopOrder struct {
+	Type    StopOrderType
+	Trigger model.Price
+	Price   model.Price
+}
+
+// PositionSelectionMode is sTatebiType.
+type PositionSelectionMode string
+
+const (
+	PositionSelectionNone        PositionSelectionMode = "*"
+	PositionSelectionSpecified   PositionSelectionMode = "1" // 個別指定
+	PositionSelectionOldestFirst PositionSelectionMode = "2" // 建日順
+	PositionSelectionProfitFirst PositionSelectionMode = "3" // 単価益順
+	PositionSelectionLossFirst   PositionSelectionMode = "4" // 単価損順
+)
+
+// PositionSelection chooses which margin positions a close order settles.
+// Tax is sTategyokuZyoutoekiKazeiC, the account that receives or delivers
+// the shares of a 現引/現渡; other orders send "*".
+type PositionSelection struct {
+	Mode PositionSelectionMode
+	Tax  TaxAccount
+}
+
+// MarketTSE is sSizyouC for the Tokyo Stock Exchange.
+const MarketTSE = "00"
+
+// NewOrder is a typed CLMKabuNewOrder request. Price zero means market.
+// CloseLots is sent as aCLMKabuHensaiData when Positions.Mode is
+// PositionSelectionSpecified.
+type NewOrder struct {
+	Symbol         string
+	Market         string
+	Side           Side
+	Condition      Condition
+	Price          model.Price
+	Quantity       model.Quantity
+	CashOrMargin   CashOrMargin
+	Expire         ExpireDay
+	Tax            TaxAccount
+	Stop           StopOrder
+	Positions      PositionSelection
+	CloseLots      []CloseLot
+	SecondPassword string
+}
+
+func newOrder(symbol, market string, side Side, price model.Price, qty model.Quantity) NewOrder {
+	return NewOrder{
+		Symbol:       symbol,
+		Market:       market,
+		Side:         side,
+		Condition:    ConditionNone,
+		Price:        price,
+		Quantity:     qty,
+		CashOrMargin: Cash,
+		Expire:       ExpireToday,
+		Tax:          TaxAccountSpecific,
+		Stop:         StopOrder{Type: StopNone},
+		Positions:    PositionSelection{Mode: PositionSelectionNone, Tax: TaxAccountUnspecified},
+	}
+}
+
+// LimitBuy returns a cash limit buy valid for today in a specific account.
+func LimitBuy(symbol, market string, price model.Price, qty model.Quantity) NewOrder {
+	return newOrder(symbol, market, SideBuy, price, qty)
+}
+
+// LimitSell returns a cash limit sell valid for today in a specific account.
+func LimitSell(symbol, market string, price model.Price, qty model.Quantity) NewOrder {
+	return newOrder(symbol, market, SideSell, price, qty)
+}
+
+// MarketBuy returns a cash market buy valid for today in a specific account.
+func MarketBuy(symbol, market string, qty model.Quantity) NewOrder {
+	return newOrder(symbol, market, SideBuy, 0, qty)
+}
+
+// MarketSell returns a cash market sell valid for today in a specific account.
+func MarketSell(symbol, market string, qty model.Quantity) NewOrder {
+	return newOrder(symbol, market, SideSell, 0, qty)
+}
+
+// Margin switches the order to margin trading. Closing orders default to
+// oldest-first position selection; a 現引/現渡 must also set Positions.Tax.
+func (o NewOrder) Margin(kind CashOrMargin) NewOrder {
+	o.CashOrMargin = kind
+	if kind.IsClose() && o.Positions.Mode == PositionSelectionNone {
+		o.Positions.Mode = PositionSelectionOldestFirst
+	}
+	return o
+}
+
+// WithStop attaches a 逆指値 condition.
+func (o NewOrder) WithStop(stop StopOrder) NewOrder {
+	o.Stop = stop
+	return o
+}
+
+// Validate checks field combinations before anything is sent.
+func (o NewOrder) Validate() error {
+	if strings.TrimSpace(o.Symbol) == "" {
+		return &terrors.ValidationError{Field: "sIssueCode", Reason: "required"}
+	}
+	if strings.TrimSpace(o.Market) == "" {
+		return &terrors.ValidationError{Field: "sSizyouC", Reason: "required"}
+	}
+	switch o.Side {
+	case SideSell, SideBuy, SideDeliver, SideReceive:
+	default:
+		return &terrors.ValidationError{Field: "sBaibaiKubun", Reason: "invalid value: " + string(o.Side)}
+	}
+	switch o.Condition {
+	case ConditionNone, ConditionOpening, ConditionClosing:
+	case ConditionFunari:
+		if o.Price <= 0 {
+			return &terrors.ValidationError{Field: "sCondition", Reason: "funari requires a limit price"}
+		}
+	default:
+		return &terrors.ValidationError{Field: "sCondition", Reason: "invalid value: " + string(o.Condition)}
+	}
+	if o.Quantity <= 0 {
+		return &terrors.ValidationError{Field: "sOrderSuryou", Reason: "must be positive"}
+	}
+	if o.Price < 0 {
+		return &terrors.ValidationError{Field: "sOrderPrice", Reason: "must not be negative"}
+	}
+	switch o.CashOrMargin {
+	case Cash, MarginSystemOpen, MarginSystemClose, MarginGeneralOpen, MarginGeneralClose:
+	default:
+		return &terrors.ValidationError{Field: "sGenkinShinyouKubun", Reason: "invalid value: " + string(o.CashOrMargin)}
+	}
+	if err := validateTax("sZyoutoekiKazeiC", o.Tax); err != nil {
+		return err
+	}
+	if err := validateExpire(o.Expire); err != nil {
+		return err
+	}
+	if err := o.validateStop(); err != nil {
+		return err
+	}
+	return o.validatePositions()
+}
+
+func (o NewOrder) validateStop() error {
+	switch o.Stop.Type {
+	case StopNone:
+		return nil
+	case StopOnly, StopWithNormal:
+	default:
+		return &terrors.ValidationError{Field: "sGyakusasiOrderType", Reason: "invalid value: " + string(o.Stop.Type)}
+	}
+	if o.Stop.Trigger <= 0 {
+		return &terrors.ValidationError{Field: "sGyakusasiZyouken", Reason: "required"}
+	}
+	if o.Stop.Price < 0 {
+		return &terrors.ValidationError{Field: "sGyakusasiPrice", Reason: "must not be negative"}
+	}
+	return nil
+}
+
+func (o NewOrder) validatePositions() error {
+	if !o.CashOrMargin.IsClose() {
+		if o.Positions.Mode != PositionSelectionNone && o.Positions.Mode != "" {
+			return &terrors.ValidationError{Field: "sTatebiType", Reason: "only for margin close"}
+		}
+		return nil
+	}
+	switch o.Positions.Mode {
+	case PositionSelectionSpecified, PositionSelectionOldestFirst, PositionSelectionProfitFirst, PositionSelectionLossFirst:
+	default:
+		return &terrors.ValidationError{Field: "sTatebiType", Reason: "required for margin close"}
+	}
+	if o.delivers() {
+		switch o.Positions.Tax {
+		case TaxAccountSpecific, TaxAccountGeneral:
+		default:
+			return &terrors.ValidationError{Field: "sTategyokuZyoutoekiKazeiC", Reason: "invalid value: " + string(o.Positions.Tax)}
+		}
+	} else if o.Positions.Tax != TaxAccountUnspecified && o.Positions.Tax != "" {
+		return &terrors.ValidationError{Field: "sTategyokuZyoutoekiKazeiC", Reason: "only for 現引/現渡"}
+	}
+	return o.validateCloseLots()
+}
+
+// delivers reports whether the order is a 現引 or 現渡.
+func (o NewOrder) delivers() bool {
+	return o.Side == SideDeliver || o.Side == SideReceive
+}
+
+func validateTax(field string, tax TaxAccount) error {
+	switch tax {
+	case TaxAccountSpecific, TaxAccountGeneral, TaxAccountNISA, TaxAccountNISAGrowth:
+		return nil
+	}
+	return &terrors.ValidationError{Field: field, Reason: "invalid value: " + string(tax)}
+}
+
+func validateExpire(expire ExpireDay) error {
+	if expire == ExpireToday {
+		return nil
+	}
+	if _, err := model.ParseDate(string(expire)); err != nil {
+		return &terrors.ValidationError{Field: "sOrderExpireDay", Reason: "invalid value: " + string(expire)}
+	}
+	return nil
+}
+
+// ToParams validates the order and returns the exact CLMKabuNewOrder fields.
+func (o NewOrder) ToParams() (OrderParams, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	orderPrice := formatPrice(o.Price)
+	if o.Stop.Type == StopOnly {
+		orderPrice = "*"
+	}
+	stopTrigger := "0"
+	stopPrice := "*"
+	if o.Stop.Type != StopNone {
+		stopTrigger = formatPrice(o.Stop.Trigger)
+		stopPrice = formatPrice(o.Stop.Price)
+	}
+	tatebi := string(PositionSelectionNone)
+	positionTax := string(TaxAccountUnspecified)
+	if o.CashOrMargin.IsClose() {
+		tatebi = string(o.Positions.Mode)
+	}
+	if o.CashOrMargin.IsClose() && o.delivers() {
+		positionTax = string(o.Positions.Tax)
+	}
+
+	params := OrderParams{
+		"sZyoutoekiKazeiC":          string(o.Tax),
+		"sIssueCode":                strings.TrimSpace(o.Symbol),
+		"sSizyouC":                  strings.TrimSpace(o.Market),
+		"sBaibaiKubun":              string(o.Side),
+		"sCondition":                string(o.Condition),
+		"sOrderPrice":               orderPrice,
+		"sOrderSuryou":              strconv.FormatInt(int64(o.Quantity), 10),
+		"sGenkinShinyouKubun":       string(o.CashOrMargin),
+		"sOrderExpireDay":           string(o.Expire),
+		"sGyakusasiOrderType":       string(o.Stop.Type),
+		"sGyakusasiZyouken":         stopTrigger,
+		"sGyakusasiPrice":           stopPrice,
+		"sTatebiType":               tatebi,
+		"sTategyokuZyoutoekiKazeiC": positionTax,
+	}
+	if o.CashOrMargin.IsClose() && o.Positions.Mode == PositionSelectionSpecified {
+		params["aCLMKabuHensaiData"] = closeLotParams(o.CloseLots)
+	}
+	if o.SecondPassword != "" {
+		params["sSecondPassword"] = o.SecondPassword
+	}
+	return params, nil
+}
+
+// PlaceNewOrder validates and submits a typed order via KabuNewOrder.
+func (s *Service) PlaceNewOrder(ctx context.Context, order NewOrder) (*OrderResponse, error) {
+	params, err := order.ToParams()
+	if err != nil {
+		return nil, err
+	}
+	return s.KabuNewOrder(ctx, params)
+}
+
+func formatPrice(price model.Price) string {
+	return price.String()
+}
@@ -0,0 +1,181 @@
+package request
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+func TestLimitBuyToParams(t *testing.T) {
+	order := LimitBuy("6501", MarketTSE, model.Yen(3000), 100)
+	order.SecondPassword = "pw"
+
+	params, err := order.ToParams()
+	if err != nil {
+		t.Fatalf("ToParams() error = %v", err)
+	}
+	want := map[string]string{
+		"sZyoutoekiKazeiC":          "1",
+		"sIssueCode":                "6501",
+		"sSizyouC":                  "00",
+		"sBaibaiKubun":              "3",
+		"sCondition":                "0",
+		"sOrderPrice":               "3000",
+		"sOrderSuryou":              "100",
+		"sGenkinShinyouKubun":       "0",
+		"sOrderExpireDay":           "0",
+		"sGyakusasiOrderType":       "0",
+		"sGyakusasiZyouken":         "0",
+		"sGyakusasiPrice":           "*",
+		"sTatebiType":               "*",
+		"sTategyokuZyoutoekiKazeiC": "*",
+		"sSecondPassword":           "pw",
+	}
+	if len(params) != len(want) {
+		t.Fatalf("params length mismatch: %d", len(params))
+	}
+	for key, value := range want {
+		if params[key] != value {
+			t.Fatalf("%s mismatch: %v", key, params[key])
+		}
+	}
+	if err := requireParams(params,
+		"sZyoutoekiKazeiC", "sIssueCode", "sSizyouC", "sBaibaiKubun", "sCondition",
+		"sOrderPrice", "sOrderSuryou", "sGenkinShinyouKubun", "sOrderExpireDay",
+		"sGyakusasiOrderType", "sGyakusasiZyouken", "sGyakusasiPrice", "sTatebiType",
+		"sTategyokuZyoutoekiKazeiC", "sSecondPassword",
+	); err != nil {
+		t.Fatalf("params incomplete: %v", err)
+	}
+}
+
+func TestMarginCloseWithStopToParams(t *testing.T) {
+	order := MarketSell("6501", MarketTSE, 200).
+		Margin(MarginSystemClose).
+		WithStop(StopOrder{Type: StopOnly, Trigger: model.Yen(2900)})
+	order.Expire = ExpireOn(time.Date(2024, 1, 10, 12, 0, 0, 0, model.JST))
+
+	params, err := order.ToParams()
+	if err != nil {
+		t.Fatalf("ToParams() error = %v", err)
+	}
+	checks := map[string]string{
+		"sBaibaiKubun":              "1",
+		"sGenkinShinyouKubun":       "4",
+		"sOrderPrice":               "*",
+		"sOrderExpireDay":           "20240110",
+		"sGyakusasiOrderType":       "1",
+		"sGyakusasiZyouken":         "2900",
+		"sGyakusasiPrice":           "0",
+		"sTatebiType":               "2",
+		"sTategyokuZyoutoekiKazeiC": "*",
+	}
+	for key, value := range checks {
+		if params[key] != value {
+			t.Fatalf("%s mismatch: %v", key, params[key])
+		}
+	}
+}
+
+func TestMarginClosePositionTaxToParams(t *testing.T) {
+	sell := MarketSell("6501", MarketTSE, 100).Margin(MarginSystemClose)
+	buy := MarketBuy("6501", MarketTSE, 100).Margin(MarginGeneralClose)
+	buy.Tax = TaxAccountGeneral
+	for _, order := range []NewOrder{sell, buy} {
+		params, err := order.ToParams()
+		if err != nil {
+			t.Fatalf("ToParams() error = %v", err)
+		}
+		if params["sTategyokuZyoutoekiKazeiC"] != "*" || params["sTatebiType"] != "2" {
+			t.Fatalf("side %s: %v / %v", order.Side, params["sTategyokuZyoutoekiKazeiC"], params["sTatebiType"])
+		}
+	}
+
+	receive := MarketBuy("6501", MarketTSE, 100).Margin(MarginSystemClose)
+	receive.Side = SideReceive
+	if _, err := receive.ToParams(); err == nil {
+		t.Fatalf("expected error for 現引 without a position tax account")
+	}
+	receive.Positions.Tax = TaxAccountNISA
+	if _, err := receive.ToParams(); err == nil {
+		t.Fatalf("expected error for 現引 into NISA")
+	}
+	receive.Positions.Tax = TaxAccountSpecific
+	params, err := receive.ToParams()
+	if err != nil {
+		t.Fatalf("ToParams() error = %v", err)
+	}
+	if params["sTategyokuZyoutoekiKazeiC"] != "1" || params["sBaibaiKubun"] != "7" {
+		t.Fatalf("現引 = %v / %v", params["sTategyokuZyoutoekiKazeiC"], params["sBaibaiKubun"])
+	}
+
+	sell.Positions.Tax = TaxAccountSpecific
+	if _, err := sell.ToParams(); err == nil {
+		t.Fatalf("expected error for a position tax account on 返済売")
+	}
+}
+
+func TestNewOrderValidate(t *testing.T) {
+	cases := []struct {
+		name  string
+		order NewOrder
+		field string
+	}{
+		{"missing symbol", LimitBuy("", MarketTSE, model.Yen(100), 100), "sIssueCode"},
+		{"zero quantity", LimitBuy("6501", MarketTSE, model.Yen(100), 0), "sOrderSuryou"},
+		{"funari market", func() NewOrder {
+			o := MarketBuy("6501", MarketTSE, 100)
+			o.Condition = ConditionFunari
+			return o
+		}(), "sCondition"},
+		{"stop without trigger", LimitBuy("6501", MarketTSE, model.Yen(100), 100).WithStop(StopOrder{Type: StopWithNormal}), "sGyakusasiZyouken"},
+		{"tatebi on cash", func() NewOrder {
+			o := LimitBuy("6501", MarketTSE, model.Yen(100), 100)
+			o.Positions.Mode = PositionSelectionOldestFirst
+			return o
+		}(), "sTatebiType"},
+		{"bad expire", func() NewOrder {
+			o := LimitBuy("6501", MarketTSE, model.Yen(100), 100)
+			o.Expire = "tomorrow"
+			return o
+		}(), "sOrderExpireDay"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.order.ToParams()
+			var validation *terrors.ValidationError
+			if !errors.As(err, &validation) {
+				t.Fatalf("expected validation error, got %v", err)
+			}
+			if validation.Field != tc.field {
+				t.Fatalf("field mismatch: %s", validation.Field)
+			}
+		})
+	}
+}
+
+func TestDecimalPriceToParams(t *testing.T) {
+	price, err := model.ParsePrice("2345.5")
+	if err != nil {
+		t.Fatalf("ParsePrice error = %v", err)
+	}
+	params, err := LimitSell("7203", MarketTSE, price, 100).ToParams()
+	if err != nil {
+		t.Fatalf("ToParams() error = %v", err)
+	}
+	if params["sOrderPrice"] != "2345.5" {
+		t.Fatalf("sOrderPrice mismatch: %v", params["sOrderPrice"])
+	}
+}
+
+func TestListedCashOrMargin(t *testing.T) {
+	if got := ListedCashOrMargin(model.Attributes{"sGenkinSinyouKubun": " 4 "}); got != MarginSystemClose {
+		t.Fatalf("ListedCashOrMargin() = %q", got)
+	}
+	if got := ListedCashOrMargin(model.Attributes{"sGenkinShinyouKubun": "4"}); got != "" {
+		t.Fatalf("request key should not be read from list fields: %q", got)
+	}
+}
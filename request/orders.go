@@ -127,7 +127,7 @@ func (e OrderEntry) Order() model.Order {
 		order.Quantity = model.Quantity(qty)
 	}
 	if price, ok := parsePrice(e.Fields.Value("sOrderOrderPrice")); ok {
-		order.Price = model.Price(price)
+		order.Price = price
 	}
 	if status := e.Fields.Value("sOrderStatus"); status != "" {
 		order.Status = status
@@ -197,7 +197,9 @@ type OrderListDetailResponse struct {
 	OrderNumber string
 	EigyouDay   string
 	IssueCode   string
-	Fields      model.Attributes
+	// Executions is aYakuzyouSikkouList, one entry per fill.
+	Executions []ExecutionEntry
+	Fields     model.Attributes
 }
 
 func (r *OrderListDetailResponse) UnmarshalJSON(data []byte) error {
@@ -208,6 +210,12 @@ func (r *OrderListDetailResponse) UnmarshalJSON(data []byte) error {
 	values := make(map[string]string, len(raw))
 	r.Fields = make(model.Attributes, len(raw))
 	for key, value := range raw {
+		if key == "aYakuzyouSikkouList" {
+			if err := decodeList(value, &r.Executions); err != nil {
+				return err
+			}
+			continue
+		}
 		str := jsonString(value)
 		values[key] = str
 		r.Fields[key] = str
@@ -221,6 +229,40 @@ func (r *OrderListDetailResponse) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// ExecutionEntry is one fill in aYakuzyouSikkouList.
+type ExecutionEntry struct {
+	Fields model.Attributes
+}
+
+func (e *ExecutionEntry) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	e.Fields = make(model.Attributes, len(raw))
+	for key, value := range raw {
+		e.Fields[key] = jsonString(value)
+	}
+	return nil
+}
+
+// Execution converts the fill; Time is sYakuzyouDate (YYYYMMDDhhmmss).
+func (e ExecutionEntry) Execution(orderNumber, issueCode string) model.Execution {
+	exec := model.Execution{
+		OrderID: orderNumber,
+		Symbol:  issueCode,
+		Time:    e.Fields.Value("sYakuzyouDate"),
+		Raw:     cloneAttributes(e.Fields),
+	}
+	if price, ok := parsePrice(e.Fields.Value("sYakuzyouPrice")); ok {
+		exec.Price = price
+	}
+	if qty, ok := parseInt64(e.Fields.Value("sYakuzyouSuryou")); ok {
+		exec.Quantity = model.Quantity(qty)
+	}
+	return exec
+}
+
 func (s *Service) KabuNewOrder(ctx context.Context, params OrderParams) (*OrderResponse, error) {
 	if err := requireParams(params,
 		"sZyoutoekiKazeiC",
@@ -103,8 +103,8 @@ func TestOrderListResponseUnmarshal(t *testing.T) {
 	if order.Quantity != 100 {
 		t.Fatalf("order quantity mismatch: %d", order.Quantity)
 	}
-	if order.Price != 2300 {
-		t.Fatalf("order price mismatch: %d", order.Price)
+	if order.Price != model.Yen(2300) {
+		t.Fatalf("order price mismatch: %s", order.Price)
 	}
 	if order.Status != "FILLED" {
 		t.Fatalf("order status mismatch: %s", order.Status)
@@ -164,3 +164,28 @@ func TestRequireParams(t *testing.T) {
 		t.Fatal("expected error for empty string")
 	}
 }
+
+func TestOrderListDetailExecutions(t *testing.T) {
+	raw := []byte(`{
+		"sResultCode":"0",
+		"sOrderNumber":"18000002",
+		"sEigyouDay":"20231018",
+		"sIssueCode":"8411",
+		"aYakuzyouSikkouList":[
+			{"sYakuzyouDate":"20231018091500","sYakuzyouSuryou":"100","sYakuzyouPrice":"2345.5"},
+			{"sYakuzyouDate":"20231018091502","sYakuzyouSuryou":"200","sYakuzyouPrice":"2346"}
+		]
+	}`)
+
+	var resp OrderListDetailResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if len(resp.Executions) != 2 {
+		t.Fatalf("executions = %d", len(resp.Executions))
+	}
+	exec := resp.Executions[0].Execution(resp.OrderNumber, resp.IssueCode)
+	if exec.OrderID != "18000002" || exec.Symbol != "8411" || exec.Quantity != 100 || exec.Price != model.Price(23455000) || exec.Time != "20231018091500" {
+		t.Fatalf("execution = %+v", exec)
+	}
+}
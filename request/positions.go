@@ -106,7 +106,7 @@ func (e GenbutuKabuEntry) Position() model.Position {
 		pos.Quantity = model.Quantity(qty)
 	}
 	if price, ok := parsePrice(e.Fields.Value("sUriOrderGaisanBokaTanka")); ok {
-		pos.AvgPrice = model.Price(price)
+		pos.AvgPrice = price
 	}
 	if pnl, ok := parseInt64(e.Fields.Value("sUriOrderGaisanHyoukaSoneki")); ok {
 		pos.UnrealPnL = pnl
@@ -236,7 +236,7 @@ func (e ShinyouTategyokuEntry) Position() model.Position {
 		pos.Quantity = model.Quantity(qty)
 	}
 	if price, ok := parsePrice(e.Fields.Value("sOrderTategyokuTanka")); ok {
-		pos.AvgPrice = model.Price(price)
+		pos.AvgPrice = price
 	}
 	if pnl, ok := parseInt64(e.Fields.Value("sOrderGaisanHyoukaSoneki")); ok {
 		pos.UnrealPnL = pnl
@@ -292,22 +292,15 @@ func parseInt64(value string) (int64, bool) {
 	return parsed, true
 }
 
-func parsePrice(value string) (int64, bool) {
-	value = strings.TrimSpace(value)
-	if value == "" {
+func parsePrice(value string) (model.Price, bool) {
+	if strings.TrimSpace(value) == "" {
 		return 0, false
 	}
-	if strings.Contains(value, ".") {
-		parts := strings.SplitN(value, ".", 2)
-		if len(parts) != 2 {
-			return 0, false
-		}
-		if strings.TrimRight(parts[1], "0") != "" {
-			return 0, false
-		}
-		value = parts[0]
+	price, err := model.ParsePrice(value)
+	if err != nil {
+		return 0, false
 	}
-	return parseInt64(value)
+	return price, true
 }
 
 func parseFloat64(value string) (float64, bool) {
@@ -0,0 +1,136 @@
+package risk
+
+import "github.com/ueebee/tachibanashi/model"
+
+// holding is a signed position: positive long, negative short.
+type holding struct {
+	quantity model.Quantity
+	avgPrice model.Price
+	// basis is what the day's P&L is measured from: the start-of-day mark
+	// for a position carried into the day, averaged with today's fills. It
+	// is zero until a mark or a fill sets it.
+	basis model.Price
+}
+
+// book tracks positions on an average cost basis and the day's realized
+// P&L against each holding's basis.
+type book struct {
+	holdings map[string]holding
+	marks    map[string]model.Price
+	realized model.Price
+}
+
+func newBook() *book {
+	return &book{
+		holdings: make(map[string]holding),
+		marks:    make(map[string]model.Price),
+	}
+}
+
+// fill applies a signed execution and returns the realized P&L it produced.
+func (b *book) fill(symbol string, qty model.Quantity, price model.Price) model.Price {
+	h := b.holdings[symbol]
+	if h.basis == 0 {
+		// No start-of-day mark: the day is measured from this fill.
+		h.basis = price
+	}
+	var realized model.Price
+	switch {
+	case h.quantity == 0 || (h.quantity > 0) == (qty > 0):
+		total := h.quantity + qty
+		cost := h.avgPrice.Mul(abs(h.quantity)) + price.Mul(abs(qty))
+		basis := h.basis.Mul(abs(h.quantity)) + price.Mul(abs(qty))
+		h.avgPrice = cost.Div(int64(abs(total)))
+		h.basis = basis.Div(int64(abs(total)))
+		h.quantity = total
+	default:
+		closed := min(abs(qty), abs(h.quantity))
+		if h.quantity > 0 {
+			realized = (price - h.basis).Mul(closed)
+		} else {
+			realized = (h.basis - price).Mul(closed)
+		}
+		h.quantity += qty
+		switch {
+		case h.quantity == 0:
+			h.avgPrice, h.basis = 0, 0
+		case (h.quantity > 0) == (qty > 0):
+			// Flipped through zero: the remainder opens at the fill price.
+			h.avgPrice, h.basis = price, price
+		}
+	}
+	b.realized += realized
+	if h.quantity == 0 {
+		delete(b.holdings, symbol)
+	} else {
+		b.holdings[symbol] = h
+	}
+	return realized
+}
+
+func (b *book) set(symbol string, qty model.Quantity, avg model.Price) {
+	if qty == 0 {
+		delete(b.holdings, symbol)
+		return
+	}
+	b.holdings[symbol] = holding{quantity: qty, avgPrice: avg, basis: b.marks[symbol]}
+}
+
+// mark records a price; the first mark of a holding without a basis is
+// its start-of-day mark.
+func (b *book) mark(symbol string, price model.Price) {
+	b.marks[symbol] = price
+	if h, ok := b.holdings[symbol]; ok && h.basis == 0 && price > 0 {
+		h.basis = price
+		b.holdings[symbol] = h
+	}
+}
+
+// rollDay starts a new day: realized P&L is cleared and every holding is
+// measured from its last mark.
+func (b *book) rollDay() {
+	b.realized = 0
+	for symbol, h := range b.holdings {
+		h.basis = b.marks[symbol]
+		b.holdings[symbol] = h
+	}
+}
+
+// price returns the mark for symbol, or the average cost when unmarked.
+func (b *book) price(symbol string) model.Price {
+	if mark, ok := b.marks[symbol]; ok && mark > 0 {
+		return mark
+	}
+	return b.holdings[symbol].avgPrice
+}
+
+func (b *book) unrealized() model.Price {
+	var total model.Price
+	for symbol, h := range b.holdings {
+		mark, ok := b.marks[symbol]
+		if !ok || mark <= 0 || h.basis == 0 {
+			continue
+		}
+		if h.quantity > 0 {
+			total += (mark - h.basis).Mul(h.quantity)
+		} else {
+			total += (h.basis - mark).Mul(-h.quantity)
+		}
+	}
+	return total
+}
+
+func (b *book) gross() model.Price {
+	var total model.Price
+	for symbol, h := range b.holdings {
+		total += b.price(symbol).Mul(abs(h.quantity))
+	}
+	return total
+}
+
+func abs(qty model.Quantity) model.Quantity {
+	if qty < 0 {
+		return -qty
+	}
+	return qty
+}
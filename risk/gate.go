@@ -0,0 +1,735 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/event"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/oms"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+// ErrKilled is returned for every new order while the kill switch is tripped.
+var ErrKilled = errors.New("tachibanashi: kill switch tripped")
+
+// Limit names reported in LimitError.
+const (
+	LimitRestricted      = "restricted"
+	LimitOrderNotional   = "order_notional"
+	LimitPosition        = "position"
+	LimitGrossExposure   = "gross_exposure"
+	LimitBuyingPower     = "buying_power"
+	LimitOrdersPerMinute = "orders_per_minute"
+	LimitDailyLoss       = "daily_loss"
+)
+
+// LimitError reports the limit an order would breach.
+type LimitError struct {
+	Limit  string
+	Reason string
+}
+
+func (e *LimitError) Error() string {
+	if e == nil {
+		return "tachibanashi: risk limit"
+	}
+	return fmt.Sprintf("tachibanashi: risk limit=%s reason=%s", e.Limit, e.Reason)
+}
+
+// Limits configures the gate. Zero values disable a limit. Yen amounts are
+// whole yen.
+type Limits struct {
+	MaxOrderNotional int64
+	// MaxPosition caps the absolute share position per symbol;
+	// PositionBySymbol overrides it for individual symbols.
+	MaxPosition      model.Quantity
+	PositionBySymbol map[string]model.Quantity
+	// MaxGrossExposure caps the sum of |position| × price across symbols,
+	// plus open orders that add to a position, after the order fills.
+	MaxGrossExposure int64
+	// MaxBuyingPowerUse caps an opening order's notional as a fraction
+	// (0-1] of BuyingPower (cash) or MarginBuyingPower (margin).
+	MaxBuyingPowerUse  float64
+	MaxOrdersPerMinute int
+	// MaxDailyLoss trips the kill switch once realized plus marked P&L for
+	// the day falls to -MaxDailyLoss.
+	MaxDailyLoss int64
+	Restricted   []string
+}
+
+// OrderService is the subset of *request.Service the gate wraps.
+type OrderService interface {
+	KabuNewOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error)
+	KabuCorrectOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error)
+	KabuCancelOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error)
+	KabuCancelOrderAll(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error)
+	BuyingPower(ctx context.Context) (*request.BuyingPowerSnapshot, error)
+	MarginBuyingPower(ctx context.Context) (*request.MarginBuyingPowerSnapshot, error)
+}
+
+// Gate enforces Limits in front of the order methods of request.Service.
+// Orders it sends count towards position and exposure limits until Apply
+// sees them fill or end. Cancels always pass so risk can be reduced while
+// the switch is tripped.
+type Gate struct {
+	svc    OrderService
+	limits Limits
+	now    func() time.Time
+	// cancelPassword enables KabuCancelOrderAll when the switch trips.
+	cancelPassword string
+
+	mu         sync.Mutex
+	restricted map[string]struct{}
+	book       *book
+	day        string
+	sent       []time.Time
+	open       []*openOrder
+	lastENO    int64
+	killed     bool
+	reason     string
+}
+
+// openOrder is the unfilled part of an order sent through the gate.
+type openOrder struct {
+	number   string // empty until the response, or when the send was ambiguous
+	symbol   string
+	quantity model.Quantity // order quantity including fills
+	delta    model.Quantity // signed remaining quantity
+	price    model.Price
+	adds     bool      // increases the position, so counts towards gross exposure
+	at       time.Time // the order's slot in the order rate
+}
+
+type Option func(*Gate)
+
+// WithCancelOnKill calls KabuCancelOrderAll with secondPassword when the
+// kill switch trips.
+func WithCancelOnKill(secondPassword string) Option {
+	return func(g *Gate) {
+		g.cancelPassword = secondPassword
+	}
+}
+
+func withClock(now func() time.Time) Option {
+	return func(g *Gate) {
+		g.now = now
+	}
+}
+
+func NewGate(svc OrderService, limits Limits, opts ...Option) *Gate {
+	g := &Gate{
+		svc:        svc,
+		limits:     limits,
+		now:        time.Now,
+		restricted: make(map[string]struct{}, len(limits.Restricted)),
+		book:       newBook(),
+	}
+	for _, symbol := range limits.Restricted {
+		g.restricted[strings.TrimSpace(symbol)] = struct{}{}
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(g)
+		}
+	}
+	return g
+}
+
+// PlaceNewOrder checks order and submits it via KabuNewOrder.
+func (g *Gate) PlaceNewOrder(ctx context.Context, order request.NewOrder) (*request.OrderResponse, error) {
+	params, err := order.ToParams()
+	if err != nil {
+		return nil, err
+	}
+	return g.send(ctx, order, params)
+}
+
+// KabuNewOrder checks raw CLMKabuNewOrder params and submits them.
+func (g *Gate) KabuNewOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error) {
+	order, err := orderFromParams(params)
+	if err != nil {
+		return nil, err
+	}
+	return g.send(ctx, order, params)
+}
+
+// send reserves the order's exposure, then submits it. The reservation is
+// released when the send is rejected; an ambiguous send may be live and is
+// kept until the day rolls.
+func (g *Gate) send(ctx context.Context, order request.NewOrder, params request.OrderParams) (*request.OrderResponse, error) {
+	open, err := g.check(ctx, order, true)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := g.svc.KabuNewOrder(ctx, params)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch {
+	case err == nil && resp != nil && strings.TrimSpace(resp.OrderNumber) != "":
+		open.number = strings.TrimSpace(resp.OrderNumber)
+	case err != nil && oms.Ambiguous(err):
+	default:
+		g.releaseLocked(open)
+	}
+	return resp, err
+}
+
+// KabuCorrectOrder is blocked by the kill switch and counts towards the
+// order rate. A correction of an order sent through the gate is checked
+// against the notional, position and exposure limits as corrected, and the
+// open order takes the new price and quantity; a rejected correction
+// restores them. Orders the gate did not send only have their notional
+// checked, and only when the correction sets both price and quantity.
+func (g *Gate) KabuCorrectOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error) {
+	g.mu.Lock()
+	open, previous, corrected, err := g.correctLocked(params)
+	g.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := g.svc.KabuCorrectOrder(ctx, params)
+	if err != nil && !oms.Ambiguous(err) && open != nil {
+		g.mu.Lock()
+		// Keep fills applied while the correction was in flight.
+		open.delta = previous.delta - (corrected.delta - open.delta)
+		open.quantity, open.price = previous.quantity, previous.price
+		g.mu.Unlock()
+	}
+	return resp, err
+}
+
+// correctLocked checks a correction and applies it to the open order it
+// targets, returning that order and its values before and after the
+// correction. g.mu must be held.
+func (g *Gate) correctLocked(params request.OrderParams) (*openOrder, openOrder, openOrder, error) {
+	if err := g.admitLocked(); err != nil {
+		return nil, openOrder{}, openOrder{}, err
+	}
+	value := paramValue(params)
+	number := value("sOrderNumber")
+	var open *openOrder
+	for _, candidate := range g.open {
+		if number != "" && candidate.number == number {
+			open = candidate
+			break
+		}
+	}
+
+	quantity, price := model.Quantity(0), model.Price(0)
+	if raw := value("sOrderSuryou"); raw != "" && raw != "*" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 0 {
+			return nil, openOrder{}, openOrder{}, &terrors.ValidationError{Field: "sOrderSuryou", Reason: "invalid value"}
+		}
+		quantity = model.Quantity(parsed)
+	}
+	priced := false
+	for _, key := range []string{"sOrderPrice", "sGyakusasiPrice"} {
+		raw := value(key)
+		if raw == "" || raw == "*" {
+			continue
+		}
+		parsed, err := model.ParsePrice(raw)
+		if err != nil {
+			return nil, openOrder{}, openOrder{}, &terrors.ValidationError{Field: key, Reason: "invalid value"}
+		}
+		price, priced = parsed, true
+		break
+	}
+
+	if open == nil {
+		if limit := g.limits.MaxOrderNotional; limit > 0 && quantity > 0 && priced && price > 0 {
+			if notional := price.Mul(quantity); notional > model.Yen(limit) {
+				return nil, openOrder{}, openOrder{}, &LimitError{Limit: LimitOrderNotional, Reason: "corrected notional " + notional.Format(0) + " exceeds " + strconv.FormatInt(limit, 10)}
+			}
+		}
+		g.sent = append(g.sent, g.now())
+		return nil, openOrder{}, openOrder{}, nil
+	}
+
+	previous := *open
+	corrected := previous
+	if quantity > 0 {
+		filled := open.quantity - abs(open.delta)
+		remaining := max(quantity-filled, 0)
+		corrected.quantity = filled + remaining
+		corrected.delta = remaining
+		if open.delta < 0 {
+			corrected.delta = -remaining
+		}
+	}
+	if priced {
+		corrected.price = price
+		if price == 0 {
+			corrected.price = g.book.price(open.symbol)
+		}
+	}
+	if limit := g.limits.MaxOrderNotional; limit > 0 {
+		if notional := corrected.price.Mul(corrected.quantity); notional > model.Yen(limit) {
+			return nil, openOrder{}, openOrder{}, &LimitError{Limit: LimitOrderNotional, Reason: "corrected notional " + notional.Format(0) + " exceeds " + strconv.FormatInt(limit, 10)}
+		}
+	}
+	if abs(corrected.delta) > abs(open.delta) {
+		current := g.book.holdings[open.symbol].quantity + g.pendingLocked(open.symbol, open.delta)
+		projected := current - open.delta + corrected.delta
+		if limit := g.maxPosition(open.symbol); limit > 0 && open.adds && abs(projected) > limit {
+			return nil, openOrder{}, openOrder{}, &LimitError{
+				Limit:  LimitPosition,
+				Reason: open.symbol + " position " + strconv.FormatInt(int64(projected), 10) + " exceeds " + strconv.FormatInt(int64(limit), 10),
+			}
+		}
+	}
+	if limit := g.limits.MaxGrossExposure; limit > 0 && open.adds {
+		before := open.price.Mul(abs(open.delta))
+		after := corrected.price.Mul(abs(corrected.delta))
+		if gross := g.book.gross() + g.openExposureLocked() - before + after; after > before && gross > model.Yen(limit) {
+			return nil, openOrder{}, openOrder{}, &LimitError{Limit: LimitGrossExposure, Reason: "gross exposure " + gross.Format(0) + " exceeds " + strconv.FormatInt(limit, 10)}
+		}
+	}
+	g.sent = append(g.sent, g.now())
+	open.quantity, open.delta, open.price = corrected.quantity, corrected.delta, corrected.price
+	return open, previous, corrected, nil
+}
+
+func (g *Gate) KabuCancelOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error) {
+	return g.svc.KabuCancelOrder(ctx, params)
+}
+
+func (g *Gate) KabuCancelOrderAll(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error) {
+	return g.svc.KabuCancelOrderAll(ctx, params)
+}
+
+// Check runs every limit against order without sending it. A passing order
+// is counted towards the order rate.
+func (g *Gate) Check(ctx context.Context, order request.NewOrder) error {
+	_, err := g.check(ctx, order, false)
+	return err
+}
+
+// check runs the limits and reserves the order's exposure and rate slot
+// under the same lock, so concurrent orders see each other. The
+// reservation is dropped if the buying-power check fails, or when reserve
+// is false.
+func (g *Gate) check(ctx context.Context, order request.NewOrder, reserve bool) (*openOrder, error) {
+	g.mu.Lock()
+	open, notional, err := g.reserveLocked(order)
+	g.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if g.limits.MaxBuyingPowerUse > 0 && opens(order) {
+		power, err := g.buyingPower(ctx, order.CashOrMargin)
+		if err == nil {
+			allowed := model.PriceFromFloat(float64(power) * g.limits.MaxBuyingPowerUse)
+			if notional > allowed {
+				err = &LimitError{Limit: LimitBuyingPower, Reason: "notional " + notional.Format(0) + " exceeds " + allowed.Format(0) + " of buying power"}
+			}
+		}
+		if err != nil {
+			g.mu.Lock()
+			g.releaseLocked(open)
+			g.unsendLocked(open.at)
+			g.mu.Unlock()
+			return nil, err
+		}
+	}
+
+	if !reserve {
+		g.mu.Lock()
+		g.releaseLocked(open)
+		g.mu.Unlock()
+		return nil, nil
+	}
+	return open, nil
+}
+
+// reserveLocked runs every limit but buying power and, if they pass, adds
+// order to the open orders and the order rate. g.mu must be held.
+func (g *Gate) reserveLocked(order request.NewOrder) (*openOrder, model.Price, error) {
+	symbol := strings.TrimSpace(order.Symbol)
+	delta := signedQuantity(order)
+
+	if err := g.admitLocked(); err != nil {
+		return nil, 0, err
+	}
+	if _, ok := g.restricted[symbol]; ok {
+		return nil, 0, &LimitError{Limit: LimitRestricted, Reason: symbol + " is restricted"}
+	}
+
+	price := order.Price
+	if order.Stop.Type == request.StopOnly {
+		price = order.Stop.Price
+		if price == 0 {
+			price = order.Stop.Trigger
+		}
+	}
+	if price == 0 {
+		price = g.book.price(symbol)
+	}
+	notional := price.Mul(order.Quantity)
+	needsPrice := g.limits.MaxOrderNotional > 0 || g.limits.MaxGrossExposure > 0 || g.limits.MaxBuyingPowerUse > 0
+	if price == 0 && needsPrice {
+		return nil, 0, &LimitError{Limit: LimitOrderNotional, Reason: "no reference price for market order in " + symbol}
+	}
+	if limit := g.limits.MaxOrderNotional; limit > 0 && notional > model.Yen(limit) {
+		return nil, 0, &LimitError{Limit: LimitOrderNotional, Reason: "notional " + notional.Format(0) + " exceeds " + strconv.FormatInt(limit, 10)}
+	}
+
+	// Open orders on the same side are assumed to fill first.
+	current := g.book.holdings[symbol].quantity + g.pendingLocked(symbol, delta)
+	projected := current + delta
+	increasing := abs(projected) > abs(current)
+	if limit := g.maxPosition(symbol); limit > 0 && increasing && abs(projected) > limit {
+		return nil, 0, &LimitError{
+			Limit:  LimitPosition,
+			Reason: symbol + " position " + strconv.FormatInt(int64(projected), 10) + " exceeds " + strconv.FormatInt(int64(limit), 10),
+		}
+	}
+	if limit := g.limits.MaxGrossExposure; limit > 0 && increasing {
+		gross := g.book.gross() + g.openExposureLocked() + price.Mul(abs(projected)-abs(current))
+		if gross > model.Yen(limit) {
+			return nil, 0, &LimitError{Limit: LimitGrossExposure, Reason: "gross exposure " + gross.Format(0) + " exceeds " + strconv.FormatInt(limit, 10)}
+		}
+	}
+
+	open := &openOrder{symbol: symbol, quantity: order.Quantity, delta: delta, price: price, adds: increasing, at: g.now()}
+	g.sent = append(g.sent, open.at)
+	g.open = append(g.open, open)
+	return open, notional, nil
+}
+
+// pendingLocked sums the open quantity for symbol on the same side as
+// delta. g.mu must be held.
+func (g *Gate) pendingLocked(symbol string, delta model.Quantity) model.Quantity {
+	var total model.Quantity
+	for _, open := range g.open {
+		if open.symbol == symbol && delta != 0 && (open.delta > 0) == (delta > 0) {
+			total += open.delta
+		}
+	}
+	return total
+}
+
+// openExposureLocked is the notional of open orders that add to a
+// position. g.mu must be held.
+func (g *Gate) openExposureLocked() model.Price {
+	var total model.Price
+	for _, open := range g.open {
+		if open.adds {
+			total += open.price.Mul(abs(open.delta))
+		}
+	}
+	return total
+}
+
+func (g *Gate) releaseLocked(target *openOrder) {
+	for i, open := range g.open {
+		if open == target {
+			g.open = append(g.open[:i], g.open[i+1:]...)
+			return
+		}
+	}
+}
+
+// unsendLocked gives back the order-rate slot taken at at. g.mu must be
+// held.
+func (g *Gate) unsendLocked(at time.Time) {
+	for i, sent := range g.sent {
+		if sent.Equal(at) {
+			g.sent = append(g.sent[:i], g.sent[i+1:]...)
+			return
+		}
+	}
+}
+
+// OpenOrders returns the number of orders still counted as open.
+func (g *Gate) OpenOrders() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.open)
+}
+
+// admitLocked checks the kill switch and order rate. g.mu must be held.
+func (g *Gate) admitLocked() error {
+	if g.killed {
+		return fmt.Errorf("%w: %s", ErrKilled, g.reason)
+	}
+	if limit := g.limits.MaxOrdersPerMinute; limit > 0 {
+		cutoff := g.now().Add(-time.Minute)
+		kept := g.sent[:0]
+		for _, at := range g.sent {
+			if at.After(cutoff) {
+				kept = append(kept, at)
+			}
+		}
+		g.sent = kept
+		if len(g.sent) >= limit {
+			return &LimitError{Limit: LimitOrdersPerMinute, Reason: strconv.Itoa(limit) + " orders in the last minute"}
+		}
+	}
+	return nil
+}
+
+func (g *Gate) maxPosition(symbol string) model.Quantity {
+	if limit, ok := g.limits.PositionBySymbol[symbol]; ok {
+		return limit
+	}
+	return g.limits.MaxPosition
+}
+
+func (g *Gate) buyingPower(ctx context.Context, kind request.CashOrMargin) (int64, error) {
+	if kind.IsMargin() {
+		snapshot, err := g.svc.MarginBuyingPower(ctx)
+		if err != nil {
+			return 0, err
+		}
+		return snapshot.Balance.BuyingPower, nil
+	}
+	snapshot, err := g.svc.BuyingPower(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return snapshot.Balance.BuyingPower, nil
+}
+
+// Kill trips the switch. New orders fail with ErrKilled until Reset; when
+// WithCancelOnKill is set every open order is cancelled.
+func (g *Gate) Kill(ctx context.Context, reason string) error {
+	g.mu.Lock()
+	g.trip(reason)
+	g.mu.Unlock()
+	return g.cancelAll(ctx)
+}
+
+// Killed reports whether the switch is tripped and why.
+func (g *Gate) Killed() (bool, string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.killed, g.reason
+}
+
+// Reset re-arms the switch.
+func (g *Gate) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.killed = false
+	g.reason = ""
+}
+
+func (g *Gate) trip(reason string) bool {
+	if g.killed {
+		return false
+	}
+	g.killed = true
+	g.reason = reason
+	return true
+}
+
+func (g *Gate) cancelAll(ctx context.Context) error {
+	if g.cancelPassword == "" {
+		return nil
+	}
+	_, err := g.svc.KabuCancelOrderAll(ctx, request.OrderParams{"sSecondPassword": g.cancelPassword})
+	return err
+}
+
+// SetPosition seeds a signed position (negative for shorts), e.g. from
+// CashPositions and the margin lots at startup. avgPrice is the cost used
+// as a reference price; the day's P&L is measured from the symbol's
+// start-of-day mark, the last Mark before seeding or else the first one
+// after.
+func (g *Gate) SetPosition(symbol string, qty model.Quantity, avgPrice model.Price) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.book.set(strings.TrimSpace(symbol), qty, avgPrice)
+}
+
+// Position returns the tracked signed position for symbol.
+func (g *Gate) Position(symbol string) model.Quantity {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.book.holdings[strings.TrimSpace(symbol)].quantity
+}
+
+// Mark sets the reference price used for market orders, exposure and
+// unrealized P&L.
+func (g *Gate) Mark(ctx context.Context, symbol string, price model.Price) error {
+	g.mu.Lock()
+	g.rollDayLocked()
+	g.book.mark(strings.TrimSpace(symbol), price)
+	tripped := g.checkLossLocked()
+	g.mu.Unlock()
+	if tripped {
+		return g.cancelAll(ctx)
+	}
+	return nil
+}
+
+// RecordExecution applies a fill. side is sBaibaiKubun; 現引/現渡 fills
+// leave the position unchanged.
+func (g *Gate) RecordExecution(ctx context.Context, symbol string, side request.Side, price model.Price, qty model.Quantity) error {
+	delta := signedQuantity(request.NewOrder{Side: side, Quantity: qty})
+	if delta == 0 {
+		return nil
+	}
+	g.mu.Lock()
+	g.rollDayLocked()
+	g.book.fill(strings.TrimSpace(symbol), delta, price)
+	tripped := g.checkLossLocked()
+	g.mu.Unlock()
+	if tripped {
+		return g.cancelAll(ctx)
+	}
+	return nil
+}
+
+// Apply records EC executions and releases open orders that filled or
+// ended. Events at or below the last p_ENO are replays and ignored. It
+// reports whether the event was a new fill.
+func (g *Gate) Apply(ctx context.Context, ev event.Event) (bool, error) {
+	ec, ok := ev.(event.EC)
+	if !ok {
+		return false, nil
+	}
+	exec, filled := ec.Execution()
+	filled = filled && exec.Quantity > 0
+
+	g.mu.Lock()
+	if eno, err := strconv.ParseInt(strings.TrimSpace(ec.EventNo), 10, 64); err == nil {
+		if g.lastENO > 0 && eno <= g.lastENO {
+			g.mu.Unlock()
+			return false, nil
+		}
+		g.lastENO = eno
+	}
+	if number := strings.TrimSpace(ec.OrderNumber); number != "" {
+		for _, open := range g.open {
+			if open.number != number {
+				continue
+			}
+			if filled {
+				qty := min(exec.Quantity, abs(open.delta))
+				if open.delta < 0 {
+					qty = -qty
+				}
+				open.delta -= qty
+			}
+			if open.delta == 0 || oms.StatusFromCode(ec.OrderStatus).Terminal() {
+				g.releaseLocked(open)
+			}
+			break
+		}
+	}
+	g.mu.Unlock()
+
+	if !filled {
+		return false, nil
+	}
+	return true, g.RecordExecution(ctx, exec.Symbol, request.Side(strings.TrimSpace(ec.Side)), exec.Price, exec.Quantity)
+}
+
+// DailyPnL returns today's realized P&L plus unrealized P&L on marked
+// positions against their start-of-day basis, in whole yen.
+func (g *Gate) DailyPnL() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.rollDayLocked()
+	return (g.book.realized + g.book.unrealized()).Round(0).Yen()
+}
+
+func (g *Gate) checkLossLocked() bool {
+	limit := g.limits.MaxDailyLoss
+	if limit <= 0 {
+		return false
+	}
+	g.rollDayLocked()
+	pnl := g.book.realized + g.book.unrealized()
+	if pnl > -model.Yen(limit) {
+		return false
+	}
+	return g.trip(LimitDailyLoss + ": P&L " + pnl.Format(0) + " breached -" + strconv.FormatInt(limit, 10))
+}
+
+// rollDayLocked starts a new day when the JST date changes: realized P&L
+// is cleared, holdings are measured from their last mark and reservations
+// from ambiguous sends are dropped.
+func (g *Gate) rollDayLocked() {
+	day := model.FormatDate(g.now())
+	if g.day == day {
+		return
+	}
+	if g.day != "" {
+		g.book.rollDay()
+		kept := g.open[:0]
+		for _, open := range g.open {
+			if open.number != "" {
+				kept = append(kept, open)
+			}
+		}
+		g.open = kept
+	}
+	g.day = day
+}
+
+// signedQuantity returns the position change if order fills: buys add,
+// sells subtract, 現引/現渡 do not change the share position.
+func signedQuantity(order request.NewOrder) model.Quantity {
+	switch order.Side {
+	case request.SideBuy:
+		return order.Quantity
+	case request.SideSell:
+		return -order.Quantity
+	}
+	return 0
+}
+
+func opens(order request.NewOrder) bool {
+	if order.CashOrMargin.IsClose() {
+		return false
+	}
+	return order.Side == request.SideBuy || order.CashOrMargin.IsMargin()
+}
+
+func orderFromParams(params request.OrderParams) (request.NewOrder, error) {
+	value := paramValue(params)
+	order := request.NewOrder{
+		Symbol:       value("sIssueCode"),
+		Market:       value("sSizyouC"),
+		Side:         request.Side(value("sBaibaiKubun")),
+		CashOrMargin: request.CashOrMargin(value("sGenkinShinyouKubun")),
+	}
+	qty, err := strconv.ParseInt(value("sOrderSuryou"), 10, 64)
+	if err != nil {
+		return request.NewOrder{}, &terrors.ValidationError{Field: "sOrderSuryou", Reason: "invalid value"}
+	}
+	order.Quantity = model.Quantity(qty)
+	if price := value("sOrderPrice"); price != "" && price != "*" {
+		parsed, err := model.ParsePrice(price)
+		if err != nil {
+			return request.NewOrder{}, &terrors.ValidationError{Field: "sOrderPrice", Reason: "invalid value"}
+		}
+		order.Price = parsed
+	}
+	return order, nil
+}
+
+func paramValue(params request.OrderParams) func(string) string {
+	return func(key string) string {
+		if params == nil {
+			return ""
+		}
+		raw, ok := params[key]
+		if !ok || raw == nil {
+			return ""
+		}
+		return strings.TrimSpace(fmt.Sprint(raw))
+	}
+}
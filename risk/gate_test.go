@@ -0,0 +1,362 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/event"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+type mockService struct {
+	newOrders   int
+	newErr      error
+	corrections int
+	correctErr  error
+	cancelAll   []request.OrderParams
+	buyingPower int64
+	marginPower int64
+	powerErr    error
+	// onBuyingPower runs inside BuyingPower, while the gate is unlocked.
+	onBuyingPower func()
+}
+
+func (m *mockService) KabuNewOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error) {
+	m.newOrders++
+	if m.newErr != nil {
+		return nil, m.newErr
+	}
+	return &request.OrderResponse{OrderNumber: strconv.Itoa(m.newOrders)}, nil
+}
+
+func (m *mockService) KabuCorrectOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error) {
+	m.corrections++
+	if m.correctErr != nil {
+		return nil, m.correctErr
+	}
+	return &request.OrderResponse{}, nil
+}
+
+func (m *mockService) KabuCancelOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error) {
+	return &request.OrderResponse{}, nil
+}
+
+func (m *mockService) KabuCancelOrderAll(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error) {
+	m.cancelAll = append(m.cancelAll, params)
+	return &request.OrderResponse{}, nil
+}
+
+func (m *mockService) BuyingPower(ctx context.Context) (*request.BuyingPowerSnapshot, error) {
+	if hook := m.onBuyingPower; hook != nil {
+		m.onBuyingPower = nil
+		hook()
+	}
+	if m.powerErr != nil {
+		return nil, m.powerErr
+	}
+	return &request.BuyingPowerSnapshot{Balance: model.Balance{BuyingPower: m.buyingPower}}, nil
+}
+
+func (m *mockService) MarginBuyingPower(ctx context.Context) (*request.MarginBuyingPowerSnapshot, error) {
+	return &request.MarginBuyingPowerSnapshot{Balance: model.Balance{BuyingPower: m.marginPower}}, nil
+}
+
+type testClock struct{ now time.Time }
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Date(2024, 6, 3, 9, 0, 0, 0, model.JST)}
+}
+
+func limitOf(err error) string {
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		return limitErr.Limit
+	}
+	return ""
+}
+
+func TestGateOrderLimits(t *testing.T) {
+	cases := []struct {
+		name   string
+		limits Limits
+		setup  func(g *Gate)
+		order  request.NewOrder
+		want   string
+	}{
+		{"restricted", Limits{Restricted: []string{"6501"}}, nil,
+			request.LimitBuy("6501", request.MarketTSE, model.Yen(100), 100), LimitRestricted},
+		{"notional", Limits{MaxOrderNotional: 1_000_000}, nil,
+			request.LimitBuy("6501", request.MarketTSE, model.Yen(3000), 400), LimitOrderNotional},
+		{"market without mark", Limits{MaxOrderNotional: 1_000_000}, nil,
+			request.MarketBuy("6501", request.MarketTSE, 100), LimitOrderNotional},
+		{"position", Limits{MaxPosition: 500}, func(g *Gate) { g.SetPosition("6501", 400, model.Yen(3000)) },
+			request.LimitBuy("6501", request.MarketTSE, model.Yen(3000), 200), LimitPosition},
+		{"symbol override", Limits{MaxPosition: 500, PositionBySymbol: map[string]model.Quantity{"6501": 100}}, nil,
+			request.LimitBuy("6501", request.MarketTSE, model.Yen(3000), 200), LimitPosition},
+		{"gross exposure", Limits{MaxGrossExposure: 2_000_000}, func(g *Gate) { g.SetPosition("7203", -500, model.Yen(3000)) },
+			request.LimitBuy("6501", request.MarketTSE, model.Yen(3000), 200), LimitGrossExposure},
+		{"buying power", Limits{MaxBuyingPowerUse: 0.5}, nil,
+			request.LimitBuy("6501", request.MarketTSE, model.Yen(3000), 200), LimitBuyingPower},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &mockService{buyingPower: 1_000_000}
+			gate := NewGate(svc, tc.limits)
+			if tc.setup != nil {
+				tc.setup(gate)
+			}
+			_, err := gate.PlaceNewOrder(context.Background(), tc.order)
+			if got := limitOf(err); got != tc.want {
+				t.Fatalf("limit = %q, err = %v", got, err)
+			}
+			if svc.newOrders != 0 {
+				t.Fatalf("blocked order reached the API")
+			}
+		})
+	}
+}
+
+func TestGateAllowsReducingOrders(t *testing.T) {
+	svc := &mockService{}
+	gate := NewGate(svc, Limits{MaxPosition: 100, MaxGrossExposure: 100_000})
+	gate.SetPosition("6501", 400, model.Yen(3000))
+
+	if _, err := gate.PlaceNewOrder(context.Background(), request.LimitSell("6501", request.MarketTSE, model.Yen(3000), 200)); err != nil {
+		t.Fatalf("reducing order blocked: %v", err)
+	}
+	if svc.newOrders != 1 {
+		t.Fatalf("order not sent")
+	}
+}
+
+func TestGateOrdersPerMinute(t *testing.T) {
+	clock := newTestClock()
+	svc := &mockService{}
+	gate := NewGate(svc, Limits{MaxOrdersPerMinute: 2}, withClock(clock.Now))
+	order := request.LimitBuy("6501", request.MarketTSE, model.Yen(100), 100)
+
+	for i := 0; i < 2; i++ {
+		if _, err := gate.PlaceNewOrder(context.Background(), order); err != nil {
+			t.Fatalf("order %d blocked: %v", i, err)
+		}
+	}
+	if _, err := gate.PlaceNewOrder(context.Background(), order); limitOf(err) != LimitOrdersPerMinute {
+		t.Fatalf("expected rate limit, got %v", err)
+	}
+	clock.now = clock.now.Add(61 * time.Second)
+	if _, err := gate.PlaceNewOrder(context.Background(), order); err != nil {
+		t.Fatalf("order after window blocked: %v", err)
+	}
+}
+
+func TestGateDailyLossTripsKillSwitch(t *testing.T) {
+	clock := newTestClock()
+	svc := &mockService{}
+	gate := NewGate(svc, Limits{MaxDailyLoss: 50_000}, WithCancelOnKill("pw"), withClock(clock.Now))
+	ctx := context.Background()
+
+	if _, err := gate.Apply(ctx, event.EC{Symbol: "6501", Side: "3", ExecutedPrice: "3000", ExecutedQuantity: "100"}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if err := gate.RecordExecution(ctx, "6501", request.SideSell, model.Yen(2800), 100); err != nil {
+		t.Fatalf("RecordExecution() error = %v", err)
+	}
+	if pnl := gate.DailyPnL(); pnl != -20_000 {
+		t.Fatalf("daily pnl = %d", pnl)
+	}
+	if killed, _ := gate.Killed(); killed {
+		t.Fatalf("kill switch tripped early")
+	}
+
+	// The carried position is measured from its start-of-day mark, not its
+	// cost.
+	gate.Mark(ctx, "7203", model.Yen(2000))
+	gate.SetPosition("7203", 100, model.Yen(1000))
+	if pnl := gate.DailyPnL(); pnl != -20_000 {
+		t.Fatalf("daily pnl after seeding = %d", pnl)
+	}
+	if err := gate.Mark(ctx, "7203", model.Yen(1600)); err != nil {
+		t.Fatalf("Mark() error = %v", err)
+	}
+	if killed, reason := gate.Killed(); !killed || reason == "" {
+		t.Fatalf("kill switch not tripped at pnl %d", gate.DailyPnL())
+	}
+	if len(svc.cancelAll) != 1 || svc.cancelAll[0]["sSecondPassword"] != "pw" {
+		t.Fatalf("cancel all not sent: %v", svc.cancelAll)
+	}
+
+	_, err := gate.PlaceNewOrder(ctx, request.LimitBuy("6501", request.MarketTSE, model.Yen(100), 100))
+	if !errors.Is(err, ErrKilled) {
+		t.Fatalf("expected ErrKilled, got %v", err)
+	}
+	if _, err := gate.KabuCancelOrder(ctx, request.OrderParams{}); err != nil {
+		t.Fatalf("cancel blocked while killed: %v", err)
+	}
+
+	gate.Reset()
+	if _, err := gate.PlaceNewOrder(ctx, request.LimitBuy("6501", request.MarketTSE, model.Yen(100), 100)); err != nil {
+		t.Fatalf("order after reset blocked: %v", err)
+	}
+}
+
+func TestGateCountsOpenOrders(t *testing.T) {
+	svc := &mockService{}
+	gate := NewGate(svc, Limits{MaxPosition: 300, MaxGrossExposure: 1_000_000})
+	ctx := context.Background()
+	buy := request.LimitBuy("6501", request.MarketTSE, model.Yen(3000), 200)
+
+	if _, err := gate.PlaceNewOrder(ctx, buy); err != nil {
+		t.Fatalf("first order blocked: %v", err)
+	}
+	// 200 open + 200 would exceed both limits before anything fills.
+	if _, err := gate.PlaceNewOrder(ctx, buy); limitOf(err) != LimitPosition {
+		t.Fatalf("expected position limit, got %v", err)
+	}
+	if _, err := gate.PlaceNewOrder(ctx, request.LimitBuy("7203", request.MarketTSE, model.Yen(3000), 200)); limitOf(err) != LimitGrossExposure {
+		t.Fatalf("expected gross exposure limit, got %v", err)
+	}
+
+	// A partial fill moves exposure from the order to the position; the
+	// cancel releases the rest.
+	fill := event.EC{EventNo: "1", OrderNumber: "1", Symbol: "6501", Side: "3", OrderStatus: "9", ExecutedPrice: "3000", ExecutedQuantity: "100"}
+	if ok, _ := gate.Apply(ctx, fill); !ok || gate.Position("6501") != 100 {
+		t.Fatalf("fill not applied: position %d", gate.Position("6501"))
+	}
+	if ok, _ := gate.Apply(ctx, fill); ok || gate.Position("6501") != 100 {
+		t.Fatalf("replayed p_ENO applied: position %d", gate.Position("6501"))
+	}
+	gate.Apply(ctx, event.EC{EventNo: "2", OrderNumber: "1", OrderStatus: "7"})
+	if gate.OpenOrders() != 0 {
+		t.Fatalf("open orders = %d", gate.OpenOrders())
+	}
+	if _, err := gate.PlaceNewOrder(ctx, buy); err != nil {
+		t.Fatalf("order after cancel blocked: %v", err)
+	}
+
+	// A rejected send releases its reservation.
+	svc.newErr = &terrors.APIError{Code: "991", Message: "rejected"}
+	gate.PlaceNewOrder(ctx, request.LimitSell("6501", request.MarketTSE, model.Yen(3000), 100))
+	if gate.OpenOrders() != 1 {
+		t.Fatalf("open orders = %d", gate.OpenOrders())
+	}
+}
+
+func TestGateReservesBeforeBuyingPower(t *testing.T) {
+	svc := &mockService{buyingPower: 10_000_000}
+	gate := NewGate(svc, Limits{MaxPosition: 300, MaxBuyingPowerUse: 1})
+	ctx := context.Background()
+	buy := request.LimitBuy("6501", request.MarketTSE, model.Yen(3000), 200)
+
+	// A second order arriving while the first waits on buying power sees
+	// the first one's reservation.
+	var second error
+	svc.onBuyingPower = func() {
+		_, second = gate.PlaceNewOrder(ctx, buy)
+	}
+	if _, err := gate.PlaceNewOrder(ctx, buy); err != nil {
+		t.Fatalf("first order blocked: %v", err)
+	}
+	if limitOf(second) != LimitPosition {
+		t.Fatalf("expected position limit for concurrent order, got %v", second)
+	}
+	if svc.newOrders != 1 || gate.OpenOrders() != 1 {
+		t.Fatalf("sent = %d, open = %d", svc.newOrders, gate.OpenOrders())
+	}
+}
+
+func TestGateReleasesReservationWhenBuyingPowerFails(t *testing.T) {
+	clock := newTestClock()
+	svc := &mockService{buyingPower: 1_000_000, powerErr: errors.New("unavailable")}
+	gate := NewGate(svc, Limits{MaxPosition: 300, MaxBuyingPowerUse: 1, MaxOrdersPerMinute: 1}, withClock(clock.Now))
+	ctx := context.Background()
+	buy := request.LimitBuy("6501", request.MarketTSE, model.Yen(3000), 200)
+
+	if _, err := gate.PlaceNewOrder(ctx, buy); err == nil {
+		t.Fatalf("expected buying power error")
+	}
+	svc.powerErr = nil
+	if _, err := gate.PlaceNewOrder(ctx, request.LimitBuy("6501", request.MarketTSE, model.Yen(6000), 200)); limitOf(err) != LimitBuyingPower {
+		t.Fatalf("expected buying power limit, got %v", err)
+	}
+	if gate.OpenOrders() != 0 {
+		t.Fatalf("open orders = %d", gate.OpenOrders())
+	}
+	if _, err := gate.PlaceNewOrder(ctx, buy); err != nil {
+		t.Fatalf("order after released reservations blocked: %v", err)
+	}
+}
+
+func TestGateChecksCorrections(t *testing.T) {
+	svc := &mockService{}
+	gate := NewGate(svc, Limits{MaxOrderNotional: 1_000_000, MaxGrossExposure: 1_000_000})
+	ctx := context.Background()
+	if _, err := gate.PlaceNewOrder(ctx, request.LimitBuy("6501", request.MarketTSE, model.Yen(3000), 300)); err != nil {
+		t.Fatalf("order blocked: %v", err)
+	}
+	correct := func(price model.Price) error {
+		params, err := request.Correction{OrderNumber: "1", EigyouDay: "20240603", Price: request.PriceRef(price), SecondPassword: "pw"}.ToParams()
+		if err != nil {
+			t.Fatalf("ToParams() error = %v", err)
+		}
+		_, err = gate.KabuCorrectOrder(ctx, params)
+		return err
+	}
+
+	if err := correct(model.Yen(3400)); limitOf(err) != LimitOrderNotional {
+		t.Fatalf("expected notional limit, got %v", err)
+	}
+	if err := correct(model.Yen(3300)); err != nil {
+		t.Fatalf("correction blocked: %v", err)
+	}
+	// The open order now counts at 3300: 990,000 leaves no room for 7203.
+	if _, err := gate.PlaceNewOrder(ctx, request.LimitBuy("7203", request.MarketTSE, model.Yen(1000), 100)); limitOf(err) != LimitGrossExposure {
+		t.Fatalf("expected gross exposure limit, got %v", err)
+	}
+
+	// A rejected correction restores the open order.
+	svc.correctErr = &terrors.APIError{Code: "991", Message: "rejected"}
+	if err := correct(model.Yen(2000)); err == nil {
+		t.Fatalf("expected correction error")
+	}
+	svc.correctErr = nil
+	if _, err := gate.PlaceNewOrder(ctx, request.LimitBuy("7203", request.MarketTSE, model.Yen(1000), 100)); limitOf(err) != LimitGrossExposure {
+		t.Fatalf("expected gross exposure limit after rejected correction, got %v", err)
+	}
+	if svc.corrections != 2 {
+		t.Fatalf("corrections sent = %d", svc.corrections)
+	}
+}
+
+func TestGateKabuNewOrderParams(t *testing.T) {
+	svc := &mockService{}
+	gate := NewGate(svc, Limits{MaxOrderNotional: 100_000})
+	params, err := request.LimitBuy("6501", request.MarketTSE, model.Yen(3000), 100).ToParams()
+	if err != nil {
+		t.Fatalf("ToParams() error = %v", err)
+	}
+	if _, err := gate.KabuNewOrder(context.Background(), params); limitOf(err) != LimitOrderNotional {
+		t.Fatalf("expected notional limit, got %v", err)
+	}
+}
+
+func TestBookAverageCost(t *testing.T) {
+	b := newBook()
+	b.fill("6501", 100, model.Yen(1000))
+	b.fill("6501", 100, model.Yen(1100))
+	if h := b.holdings["6501"]; h.quantity != 200 || h.avgPrice != model.Yen(1050) {
+		t.Fatalf("holding = %+v", h)
+	}
+	if realized := b.fill("6501", -300, model.Yen(1000)); realized != model.Yen(-10000) {
+		t.Fatalf("realized = %s", realized)
+	}
+	if h := b.holdings["6501"]; h.quantity != -100 || h.avgPrice != model.Yen(1000) {
+		t.Fatalf("flipped holding = %+v", h)
+	}
+}
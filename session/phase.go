@@ -0,0 +1,67 @@
+package session
+
+// Phase is a coarse trading phase derived from sUnyouStatus / p_US.
+type Phase int
+
+const (
+	PhaseUnknown Phase = iota
+	PhaseClosed
+	PhasePreOpen
+	PhaseContinuous
+	PhaseLunchBreak
+	PhaseClosingAuction
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseClosed:
+		return "closed"
+	case PhasePreOpen:
+		return "pre-open"
+	case PhaseContinuous:
+		return "continuous"
+	case PhaseLunchBreak:
+		return "lunch-break"
+	case PhaseClosingAuction:
+		return "closing-auction"
+	}
+	return "unknown"
+}
+
+// Open reports whether orders placed now can reach the exchange in this
+// session: pre-open, continuous trading and the closing auction.
+func (p Phase) Open() bool {
+	return p == PhasePreOpen || p == PhaseContinuous || p == PhaseClosingAuction
+}
+
+// Classifier maps a 運用単位 (sUnyouUnit / p_UU) and 運用ステータス to a Phase.
+type Classifier func(unit, status string) Phase
+
+// tseEquityPhases follows the TSE equity order example in the API reference.
+var tseEquityPhases = map[string]Phase{
+	"000": PhaseClosed,         // 受付停止
+	"100": PhasePreOpen,        // 前場受付開始
+	"120": PhaseContinuous,     // 前場立会開始
+	"140": PhaseLunchBreak,     // 前場立会終了
+	"160": PhaseLunchBreak,     // 前場約定通知出力終了
+	"200": PhasePreOpen,        // 後場受付開始
+	"220": PhaseContinuous,     // 後場立会開始
+	"240": PhaseClosingAuction, // 後場立会終了前
+	"260": PhaseClosed,         // 後場立会終了
+	"280": PhaseClosed,         // 後場約定通知出力終了
+	"300": PhaseClosed,         // 株式閉局
+	"400": PhaseClosed,         // 値洗い中
+	"500": PhaseClosed,         // 翌日注文受付開始
+	"600": PhaseClosed,         // 差分注文繰越中
+	"700": PhaseClosed,         // 値洗い完了
+	"900": PhaseClosed,         // オンライン閉局
+}
+
+// DefaultClassifier applies the TSE equity status table to every unit.
+// Codes outside the table are PhaseUnknown.
+func DefaultClassifier(unit, status string) Phase {
+	if phase, ok := tseEquityPhases[status]; ok {
+		return phase
+	}
+	return PhaseUnknown
+}
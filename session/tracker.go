@@ -0,0 +1,334 @@
+package session
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ueebee/tachibanashi/event"
+	"github.com/ueebee/tachibanashi/master"
+)
+
+// Product codes (sSyouhinType / p_SHSB). Equities have no product code.
+const (
+	ProductEquity = ""
+	ProductFuture = "03"
+	ProductOption = "04"
+)
+
+// State sources.
+const (
+	SourceMaster = "master"
+	SourceEvent  = "event"
+)
+
+// Operation categories (sUnyouCategory / p_UC) tracked as market sessions.
+const (
+	categoryEquity     = "01"
+	categoryDerivative = "02"
+)
+
+const (
+	businessDay        = "0"  // sEigyouDayC 営業日
+	gyoumuOrder        = "04" // sTaisyouGyoumu 注文（受付）
+	changeBufferSize   = 16
+	defaultSystemKouza = "102"
+	acceptanceStopped  = "000"
+	acceptanceToday    = "001"
+	acceptanceNextDay  = "002"
+)
+
+// Key identifies a market session.
+type Key struct {
+	Market  string
+	Product string
+}
+
+// State is the latest known session state of one market and product.
+type State struct {
+	Key
+	Unit        string // sUnyouUnit / p_UU
+	Status      string // sUnyouStatus / p_US
+	Phase       Phase
+	BusinessDay bool
+	// Acceptance is sGyoumuZyoutai of the matching 注文（受付） row:
+	// 000 stopped, 001 same-day orders, 002 next-day orders.
+	Acceptance string
+	EventName  string
+	// MeyasuTime is the expected time of the next transition, as sent.
+	MeyasuTime string
+	Source     string // SourceMaster or SourceEvent
+	UpdatedAt  time.Time
+}
+
+// CanOrder reports whether an order sent now can trade in the current
+// session.
+func (s State) CanOrder() bool {
+	if !s.BusinessDay || s.Acceptance == acceptanceStopped || s.Acceptance == acceptanceNextDay {
+		return false
+	}
+	return s.Phase.Open()
+}
+
+// Change is sent whenever a session's phase or status changes.
+type Change struct {
+	Previous State
+	Current  State
+}
+
+// Tracker keeps per-market session state seeded from the CLMUnyouStatus*
+// masters and updated from US events.
+type Tracker struct {
+	classify    Classifier
+	systemKouza string
+	now         func() time.Time
+
+	mu     sync.RWMutex
+	states map[Key]State
+	// guide holds CLMUnyouStatus rows for 注文（受付） keyed by unit and status.
+	guide map[string]master.Record
+	subs  map[chan Change]struct{}
+}
+
+type Option func(*Tracker)
+
+// WithClassifier replaces DefaultClassifier.
+func WithClassifier(classify Classifier) Option {
+	return func(t *Tracker) {
+		if classify != nil {
+			t.classify = classify
+		}
+	}
+}
+
+// WithSystemKouza overrides sSystemKouzaKubun (default 102, e支店).
+func WithSystemKouza(code string) Option {
+	return func(t *Tracker) {
+		t.systemKouza = strings.TrimSpace(code)
+	}
+}
+
+func withClock(now func() time.Time) Option {
+	return func(t *Tracker) {
+		t.now = now
+	}
+}
+
+func NewTracker(opts ...Option) *Tracker {
+	t := &Tracker{
+		classify:    DefaultClassifier,
+		systemKouza: defaultSystemKouza,
+		now:         time.Now,
+		states:      make(map[Key]State),
+		guide:       make(map[string]master.Record),
+		subs:        make(map[chan Change]struct{}),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(t)
+		}
+	}
+	return t
+}
+
+// Seed loads state from the CLMUnyouStatus, CLMUnyouStatusKabu and
+// CLMUnyouStatusHasei records in store. Existing states are replaced.
+func (t *Tracker) Seed(store master.MasterStore) {
+	if store == nil {
+		return
+	}
+	guide := make(map[string]master.Record)
+	for _, record := range store.All(master.MasterUnyouStatus) {
+		fields := record.Fields
+		if !t.ownKouza(fields.Value(master.UnyouStatusFieldSystemKouzaKubun)) {
+			continue
+		}
+		if strings.TrimSpace(fields.Value(master.UnyouStatusFieldTaisyouGyoumu)) != gyoumuOrder {
+			continue
+		}
+		guide[guideKey(fields.Value(master.UnyouStatusFieldUnyouUnit), fields.Value(master.UnyouStatusFieldUnyouStatus))] = record
+	}
+
+	t.mu.Lock()
+	t.guide = guide
+	t.mu.Unlock()
+
+	for _, record := range store.All(master.MasterUnyouStatusKabu) {
+		t.applyMaster(record, ProductEquity)
+	}
+	for _, record := range store.All(master.MasterUnyouStatusHasei) {
+		t.applyMaster(record, strings.TrimSpace(record.Fields.Value(master.UnyouStatusFieldSyouhinType)))
+	}
+}
+
+func (t *Tracker) applyMaster(record master.Record, product string) {
+	fields := record.Fields
+	if !t.ownKouza(fields.Value(master.UnyouStatusFieldSystemKouzaKubun)) {
+		return
+	}
+	t.update(update{
+		key:         Key{Market: strings.TrimSpace(fields.Value(master.UnyouStatusFieldZyouzyouSizyou)), Product: product},
+		unit:        fields.Value(master.UnyouStatusFieldUnyouUnit),
+		status:      fields.Value(master.UnyouStatusFieldUnyouStatus),
+		businessDay: fields.Value(master.UnyouStatusFieldEigyouDayC),
+		source:      SourceMaster,
+	})
+}
+
+// Handler returns a master.DownloadHandler that re-seeds from store when a
+// CLMUnyouStatus* record arrives and then calls next (which may be nil).
+func (t *Tracker) Handler(store master.MasterStore, next master.DownloadHandler) master.DownloadHandler {
+	return func(message master.DownloadMessage) error {
+		switch message.Type {
+		case master.MasterUnyouStatus, master.MasterUnyouStatusKabu, master.MasterUnyouStatusHasei:
+			t.Seed(store)
+		}
+		if next != nil {
+			return next(message)
+		}
+		return nil
+	}
+}
+
+// Apply updates state from a US event. Other events and US categories
+// other than equities and derivatives are ignored.
+func (t *Tracker) Apply(ev event.Event) bool {
+	us, ok := ev.(event.US)
+	if !ok {
+		return false
+	}
+	switch strings.TrimSpace(us.OperationCode) {
+	case categoryEquity, categoryDerivative:
+	default:
+		return false
+	}
+	return t.update(update{
+		key:         Key{Market: strings.TrimSpace(us.MarketCode), Product: strings.TrimSpace(us.InstrumentKind)},
+		unit:        us.OperationUnit,
+		status:      us.OperationStatus,
+		businessDay: us.BusinessDayKind,
+		source:      SourceEvent,
+	})
+}
+
+// Watch applies events until the channel closes or ctx is done.
+func (t *Tracker) Watch(ctx context.Context, events <-chan event.Event) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			t.Apply(ev)
+		}
+	}
+}
+
+// State returns the latest state for market and product.
+func (t *Tracker) State(market, product string) (State, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	state, ok := t.states[Key{Market: strings.TrimSpace(market), Product: strings.TrimSpace(product)}]
+	return state, ok
+}
+
+// States returns every known session.
+func (t *Tracker) States() []State {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	out := make([]State, 0, len(t.states))
+	for _, state := range t.states {
+		out = append(out, state)
+	}
+	return out
+}
+
+// CanOrder reports whether orders for market and product can trade now.
+// Unknown sessions are treated as closed.
+func (t *Tracker) CanOrder(market, product string) bool {
+	state, ok := t.State(market, product)
+	return ok && state.CanOrder()
+}
+
+// Changes subscribes to state changes until ctx is done. The channel is
+// buffered; when a subscriber falls behind further changes are dropped for
+// it, so State remains the source of truth.
+func (t *Tracker) Changes(ctx context.Context) <-chan Change {
+	ch := make(chan Change, changeBufferSize)
+	t.mu.Lock()
+	t.subs[ch] = struct{}{}
+	t.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		t.mu.Lock()
+		delete(t.subs, ch)
+		t.mu.Unlock()
+		close(ch)
+	}()
+	return ch
+}
+
+type update struct {
+	key         Key
+	unit        string
+	status      string
+	businessDay string
+	source      string
+}
+
+func (t *Tracker) update(u update) bool {
+	unit := strings.TrimSpace(u.unit)
+	status := strings.TrimSpace(u.status)
+	if status == "" {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	previous := t.states[u.key]
+	state := State{
+		Key:         u.key,
+		Unit:        unit,
+		Status:      status,
+		Phase:       t.classify(unit, status),
+		BusinessDay: strings.TrimSpace(u.businessDay) == businessDay || strings.TrimSpace(u.businessDay) == "",
+		Acceptance:  acceptanceToday,
+		Source:      u.source,
+		UpdatedAt:   t.now(),
+	}
+	if !state.BusinessDay {
+		state.Phase = PhaseClosed
+	}
+	if record, ok := t.guide[guideKey(unit, status)]; ok {
+		state.Acceptance = strings.TrimSpace(record.Fields.Value(master.UnyouStatusFieldGyoumuZyoutai))
+		state.EventName = record.Fields.Value(master.UnyouStatusFieldEventName)
+		state.MeyasuTime = record.Fields.Value(master.UnyouStatusFieldMeyasuTime)
+	}
+	t.states[u.key] = state
+
+	if previous.Status == state.Status && previous.Phase == state.Phase && previous.BusinessDay == state.BusinessDay && previous.Unit == state.Unit {
+		return true
+	}
+	change := Change{Previous: previous, Current: state}
+	for ch := range t.subs {
+		select {
+		case ch <- change:
+		default:
+		}
+	}
+	return true
+}
+
+func (t *Tracker) ownKouza(code string) bool {
+	code = strings.TrimSpace(code)
+	return code == "" || t.systemKouza == "" || code == t.systemKouza
+}
+
+func guideKey(unit, status string) string {
+	return master.JoinIndex(strings.TrimSpace(unit), strings.TrimSpace(status))
+}
@@ -0,0 +1,136 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ueebee/tachibanashi/event"
+	"github.com/ueebee/tachibanashi/master"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+func seededStore() *master.MemoryStore {
+	store := master.NewMemoryStore()
+	store.Upsert(master.MasterUnyouStatusKabu, "kabu", model.Attributes{
+		master.UnyouStatusFieldSystemKouzaKubun: "102",
+		master.UnyouStatusFieldZyouzyouSizyou:   "00",
+		master.UnyouStatusFieldUnyouCategory:    "01",
+		master.UnyouStatusFieldUnyouUnit:        "0101",
+		master.UnyouStatusFieldEigyouDayC:       "0",
+		master.UnyouStatusFieldUnyouStatus:      "100",
+	}, master.UpdateMeta{})
+	store.Upsert(master.MasterUnyouStatusHasei, "hasei", model.Attributes{
+		master.UnyouStatusFieldSystemKouzaKubun: "102",
+		master.UnyouStatusFieldZyouzyouSizyou:   "01",
+		master.UnyouStatusFieldSyouhinType:      ProductFuture,
+		master.UnyouStatusFieldUnyouCategory:    "02",
+		master.UnyouStatusFieldUnyouUnit:        "0201",
+		master.UnyouStatusFieldEigyouDayC:       "0",
+		master.UnyouStatusFieldUnyouStatus:      "900",
+	}, master.UpdateMeta{})
+	store.Upsert(master.MasterUnyouStatus, "guide", model.Attributes{
+		master.UnyouStatusFieldSystemKouzaKubun: "102",
+		master.UnyouStatusFieldUnyouUnit:        "0101",
+		master.UnyouStatusFieldUnyouStatus:      "120",
+		master.UnyouStatusFieldTaisyouGyoumu:    "04",
+		master.UnyouStatusFieldGyoumuZyoutai:    "001",
+		master.UnyouStatusFieldEventName:        "前場立会開始",
+		master.UnyouStatusFieldMeyasuTime:       "0900",
+	}, master.UpdateMeta{})
+	return store
+}
+
+func fixedClock() func() time.Time {
+	return func() time.Time { return time.Date(2024, 6, 3, 8, 0, 0, 0, model.JST) }
+}
+
+func TestSeedFromMasters(t *testing.T) {
+	tracker := NewTracker(withClock(fixedClock()))
+	tracker.Seed(seededStore())
+
+	state, ok := tracker.State("00", ProductEquity)
+	if !ok {
+		t.Fatalf("missing equity state")
+	}
+	if state.Phase != PhasePreOpen || state.Source != SourceMaster || !state.CanOrder() {
+		t.Fatalf("equity state = %+v", state)
+	}
+	future, ok := tracker.State("01", ProductFuture)
+	if !ok || future.Phase != PhaseClosed || tracker.CanOrder("01", ProductFuture) {
+		t.Fatalf("future state = %+v", future)
+	}
+	if tracker.CanOrder("99", ProductEquity) {
+		t.Fatalf("unknown session should not accept orders")
+	}
+}
+
+func TestApplyUSEventsEmitsChanges(t *testing.T) {
+	tracker := NewTracker(withClock(fixedClock()))
+	tracker.Seed(seededStore())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := tracker.Changes(ctx)
+
+	us := event.US{MarketCode: "00", OperationCode: "01", OperationUnit: "0101", BusinessDayKind: "0", OperationStatus: "120"}
+	if !tracker.Apply(us) {
+		t.Fatalf("US event was not applied")
+	}
+	select {
+	case change := <-changes:
+		if change.Previous.Phase != PhasePreOpen || change.Current.Phase != PhaseContinuous {
+			t.Fatalf("change = %+v", change)
+		}
+		if change.Current.EventName != "前場立会開始" || change.Current.MeyasuTime != "0900" || change.Current.Source != SourceEvent {
+			t.Fatalf("guide not applied: %+v", change.Current)
+		}
+	default:
+		t.Fatalf("expected change")
+	}
+
+	// Same status again: no change notification.
+	tracker.Apply(us)
+	select {
+	case change := <-changes:
+		t.Fatalf("unexpected change %+v", change)
+	default:
+	}
+
+	us.OperationStatus = "140"
+	tracker.Apply(us)
+	if state, _ := tracker.State("00", ""); state.Phase != PhaseLunchBreak || state.CanOrder() {
+		t.Fatalf("lunch state = %+v", state)
+	}
+
+	if tracker.Apply(event.US{MarketCode: "00", OperationCode: "11", OperationUnit: "1100", OperationStatus: "100"}) {
+		t.Fatalf("master update category should be ignored")
+	}
+	if tracker.Apply(event.SS{}) {
+		t.Fatalf("non-US event should be ignored")
+	}
+}
+
+func TestNonBusinessDayIsClosed(t *testing.T) {
+	tracker := NewTracker()
+	tracker.Apply(event.US{MarketCode: "00", OperationCode: "01", OperationUnit: "0101", BusinessDayKind: "1", OperationStatus: "120"})
+	state, ok := tracker.State("00", ProductEquity)
+	if !ok || state.Phase != PhaseClosed || state.CanOrder() {
+		t.Fatalf("state = %+v", state)
+	}
+}
+
+func TestChangesClosesOnCancel(t *testing.T) {
+	tracker := NewTracker()
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := tracker.Changes(ctx)
+	cancel()
+	select {
+	case _, ok := <-changes:
+		if ok {
+			t.Fatalf("expected closed channel")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("channel was not closed")
+	}
+}
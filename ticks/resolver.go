@@ -0,0 +1,120 @@
+package ticks
+
+import (
+	"strings"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/master"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+// dayKeyToday is the CLMDateZyouhou sDayKey for the same-day basis.
+const dayKeyToday = "001"
+
+// Resolver looks up tick tables for issues from downloaded master data.
+type Resolver struct {
+	store   master.MasterStore
+	nextDay bool
+	now     func() time.Time
+}
+
+type Option func(*Resolver)
+
+// WithNextDay resolves next business day tables: sYobineTaniNumberYoku and
+// the CLMYobine row effective on the next business day.
+func WithNextDay() Option {
+	return func(r *Resolver) {
+		r.nextDay = true
+	}
+}
+
+// WithClock sets the clock used to pick the effective sTekiyouDay.
+func WithClock(now func() time.Time) Option {
+	return func(r *Resolver) {
+		r.now = now
+	}
+}
+
+func NewResolver(store master.MasterStore, opts ...Option) *Resolver {
+	r := &Resolver{store: store, now: time.Now}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(r)
+		}
+	}
+	return r
+}
+
+// ForIssue returns the tick table for an issue listed on market.
+func (r *Resolver) ForIssue(issueCode, marketCode string) (Table, error) {
+	tani, err := r.TaniNumber(issueCode, marketCode)
+	if err != nil {
+		return Table{}, err
+	}
+	return r.Table(tani)
+}
+
+// TaniNumber returns sYobineTaniNumber (or ...Yoku) for an issue.
+func (r *Resolver) TaniNumber(issueCode, marketCode string) (string, error) {
+	if r == nil || r.store == nil {
+		return "", &terrors.ValidationError{Field: "store", Reason: "required"}
+	}
+	issueCode = strings.TrimSpace(issueCode)
+	marketCode = strings.TrimSpace(marketCode)
+	record, ok := r.store.Get(master.MasterIssueSizyouMstKabu, master.JoinIndex(issueCode, marketCode))
+	if !ok {
+		return "", &terrors.ValidationError{Field: "sIssueCode", Reason: "unknown issue/market: " + issueCode + "/" + marketCode}
+	}
+	field := master.IssueSizyouKabuFieldYobineTaniNumber
+	if r.nextDay {
+		field = master.IssueSizyouKabuFieldYobineTaniNumberYoku
+	}
+	tani := strings.TrimSpace(record.Fields.Value(field))
+	if tani == "" {
+		return "", &terrors.ValidationError{Field: field, Reason: "empty for " + issueCode + "/" + marketCode}
+	}
+	return tani, nil
+}
+
+// Table returns the CLMYobine table for tani with the latest sTekiyouDay on
+// or before the effective date.
+func (r *Resolver) Table(tani string) (Table, error) {
+	if r == nil || r.store == nil {
+		return Table{}, &terrors.ValidationError{Field: "store", Reason: "required"}
+	}
+	tani = strings.TrimSpace(tani)
+	day := r.effectiveDay()
+	var (
+		best  model.Attributes
+		found string
+	)
+	for _, record := range r.store.All(master.MasterYobine) {
+		if strings.TrimSpace(record.Fields.Value(master.YobineFieldTaniNumber)) != tani {
+			continue
+		}
+		tekiyou := strings.TrimSpace(record.Fields.Value(master.YobineFieldTekiyouDay))
+		if tekiyou > day || (best != nil && tekiyou < found) {
+			continue
+		}
+		best = record.Fields
+		found = tekiyou
+	}
+	if best == nil {
+		return Table{}, &terrors.ValidationError{Field: master.YobineFieldTaniNumber, Reason: "no table effective on " + day + ": " + tani}
+	}
+	return fromAttributes(best)
+}
+
+func (r *Resolver) effectiveDay() string {
+	now := r.now().In(model.JST)
+	if !r.nextDay {
+		return model.FormatDate(now)
+	}
+	if record, ok := r.store.Get(master.MasterDateZyouhou, dayKeyToday); ok {
+		if day := strings.TrimSpace(record.Fields.Value(master.DateInfoFieldYokuEigyouDay1)); day != "" {
+			return day
+		}
+	}
+	return model.FormatDate(now.AddDate(0, 0, 1))
+}
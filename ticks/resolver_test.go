@@ -0,0 +1,74 @@
+package ticks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ueebee/tachibanashi/master"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+func resolverStore() *master.MemoryStore {
+	store := master.NewMemoryStore()
+	store.Upsert(master.MasterIssueSizyouMstKabu, master.JoinIndex("7203", "00"), model.Attributes{
+		master.IssueSizyouKabuFieldYobineTaniNumber:     "101",
+		master.IssueSizyouKabuFieldYobineTaniNumberYoku: "103",
+	}, master.UpdateMeta{})
+	for _, row := range []struct{ tani, day, tick string }{
+		{"101", "20140101", "1.000000"},
+		{"101", "20240701", "2.000000"},
+		{"103", "20140101", "0.100000"},
+	} {
+		store.Upsert(master.MasterYobine, master.JoinIndex(row.tani, row.day), model.Attributes{
+			master.YobineFieldTaniNumber:  row.tani,
+			master.YobineFieldTekiyouDay:  row.day,
+			master.YobineFieldKizunPrice1: "999999999.000000",
+			master.YobineFieldTanka1:      row.tick,
+		}, master.UpdateMeta{})
+	}
+	return store
+}
+
+func TestResolverHonorsTekiyouDay(t *testing.T) {
+	store := resolverStore()
+	before := NewResolver(store, WithClock(func() time.Time { return time.Date(2024, 6, 28, 10, 0, 0, 0, model.JST) }))
+	table, err := before.ForIssue("7203", "00")
+	if err != nil {
+		t.Fatalf("ForIssue error: %v", err)
+	}
+	if table.TickAt(model.Yen(100)) != model.Yen(1) || table.TekiyouDay != "20140101" {
+		t.Fatalf("table = %+v", table)
+	}
+
+	after := NewResolver(store, WithClock(func() time.Time { return time.Date(2024, 7, 1, 10, 0, 0, 0, model.JST) }))
+	table, err = after.ForIssue("7203", "00")
+	if err != nil {
+		t.Fatalf("ForIssue error: %v", err)
+	}
+	if table.TickAt(model.Yen(100)) != model.Yen(2) {
+		t.Fatalf("table = %+v", table)
+	}
+}
+
+func TestResolverNextDay(t *testing.T) {
+	store := resolverStore()
+	store.Upsert(master.MasterDateZyouhou, "001", model.Attributes{
+		master.DateInfoFieldDayKey:         "001",
+		master.DateInfoFieldYokuEigyouDay1: "20240701",
+	}, master.UpdateMeta{})
+	resolver := NewResolver(store, WithNextDay(), WithClock(func() time.Time { return time.Date(2024, 6, 28, 16, 0, 0, 0, model.JST) }))
+	tani, err := resolver.TaniNumber("7203", "00")
+	if err != nil || tani != "103" {
+		t.Fatalf("TaniNumber = %q, %v", tani, err)
+	}
+	table, err := resolver.Table("101")
+	if err != nil {
+		t.Fatalf("Table error: %v", err)
+	}
+	if table.TekiyouDay != "20240701" {
+		t.Fatalf("TekiyouDay = %q", table.TekiyouDay)
+	}
+	if _, err := resolver.ForIssue("9999", "00"); err == nil {
+		t.Fatalf("expected unknown issue error")
+	}
+}
@@ -0,0 +1,207 @@
+package ticks
+
+import (
+	"strconv"
+	"strings"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/master"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+const maxBands = 20
+
+// Band is one row of a CLMYobine table: prices up to and including Upper
+// move in steps of Tick.
+type Band struct {
+	Upper    model.Price
+	Tick     model.Price
+	Decimals int
+}
+
+// Table is the tick schedule for one sYobineTaniNumber.
+type Table struct {
+	TaniNumber string
+	TekiyouDay string
+	Bands      []Band
+}
+
+// FromYobine builds a Table from a CLMYobine record. Bands whose threshold
+// does not increase or whose tick is zero are treated as padding.
+func FromYobine(yobine master.Yobine) (Table, error) {
+	return fromAttributes(yobine.Fields)
+}
+
+func fromAttributes(fields model.Attributes) (Table, error) {
+	table := Table{
+		TaniNumber: strings.TrimSpace(fields.Value(master.YobineFieldTaniNumber)),
+		TekiyouDay: strings.TrimSpace(fields.Value(master.YobineFieldTekiyouDay)),
+	}
+	for i := 1; i <= maxBands; i++ {
+		n := strconv.Itoa(i)
+		rawUpper := fields.Value("sKizunPrice_" + n)
+		rawTick := fields.Value("sYobineTanka_" + n)
+		if strings.TrimSpace(rawUpper) == "" || strings.TrimSpace(rawTick) == "" {
+			continue
+		}
+		upper, err := model.ParsePrice(rawUpper)
+		if err != nil {
+			return Table{}, &terrors.ValidationError{Field: "sKizunPrice_" + n, Reason: "invalid value: " + rawUpper}
+		}
+		tick, err := model.ParsePrice(rawTick)
+		if err != nil {
+			return Table{}, &terrors.ValidationError{Field: "sYobineTanka_" + n, Reason: "invalid value: " + rawTick}
+		}
+		if tick <= 0 {
+			continue
+		}
+		if count := len(table.Bands); count > 0 && upper <= table.Bands[count-1].Upper {
+			continue
+		}
+		decimals, _ := strconv.Atoi(strings.TrimSpace(fields.Value("sDecimal_" + n)))
+		table.Bands = append(table.Bands, Band{Upper: upper, Tick: tick, Decimals: decimals})
+	}
+	if len(table.Bands) == 0 {
+		return Table{}, &terrors.ValidationError{Field: master.YobineFieldTaniNumber, Reason: "no tick bands: " + table.TaniNumber}
+	}
+	return table, nil
+}
+
+// band returns the band for prices approached from below: the first band
+// with price <= Upper. Prices above the last threshold use the last band.
+func (t Table) band(price model.Price) Band {
+	for _, band := range t.Bands {
+		if price <= band.Upper {
+			return band
+		}
+	}
+	return t.Bands[len(t.Bands)-1]
+}
+
+// bandAbove returns the band for prices moving up from price: the first band
+// with price < Upper.
+func (t Table) bandAbove(price model.Price) Band {
+	for _, band := range t.Bands {
+		if price < band.Upper {
+			return band
+		}
+	}
+	return t.Bands[len(t.Bands)-1]
+}
+
+// TickAt returns the tick that applies at price.
+func (t Table) TickAt(price model.Price) model.Price {
+	if len(t.Bands) == 0 {
+		return 0
+	}
+	return t.band(price).Tick
+}
+
+// DecimalsAt returns sDecimal for the band containing price.
+func (t Table) DecimalsAt(price model.Price) int {
+	if len(t.Bands) == 0 {
+		return 0
+	}
+	return t.band(price).Decimals
+}
+
+// Format formats price with the decimals of its band.
+func (t Table) Format(price model.Price) string {
+	return price.Format(t.DecimalsAt(price))
+}
+
+// Valid reports whether price is a positive multiple of its tick.
+func (t Table) Valid(price model.Price) bool {
+	tick := t.TickAt(price)
+	return price > 0 && tick > 0 && price%tick == 0
+}
+
+// RoundDown returns the highest valid price <= price.
+func (t Table) RoundDown(price model.Price) model.Price {
+	tick := t.TickAt(price)
+	if tick <= 0 {
+		return price
+	}
+	return floorTo(price, tick)
+}
+
+// RoundUp returns the lowest valid price >= price.
+func (t Table) RoundUp(price model.Price) model.Price {
+	tick := t.TickAt(price)
+	if tick <= 0 {
+		return price
+	}
+	down := floorTo(price, tick)
+	if down == price {
+		return price
+	}
+	return down + tick
+}
+
+// RoundNearest returns the closest valid price. Ties round up.
+func (t Table) RoundNearest(price model.Price) model.Price {
+	down := t.RoundDown(price)
+	up := t.RoundUp(price)
+	if price-down < up-price {
+		return down
+	}
+	return up
+}
+
+// Step moves price by n ticks (negative n moves down), crossing band
+// boundaries as needed. price must already be valid.
+func (t Table) Step(price model.Price, n int) (model.Price, error) {
+	if !t.Valid(price) {
+		return 0, &terrors.ValidationError{Field: "price", Reason: "not on tick: " + price.String()}
+	}
+	for ; n > 0; n-- {
+		price += t.bandAbove(price).Tick
+	}
+	for ; n < 0; n++ {
+		price -= t.band(price).Tick
+		if price <= 0 {
+			return 0, &terrors.ValidationError{Field: "price", Reason: "stepped below the minimum price"}
+		}
+	}
+	return price, nil
+}
+
+// Count returns the number of ticks from one valid price to another.
+// The result is negative when to is below from.
+func (t Table) Count(from, to model.Price) (int64, error) {
+	if !t.Valid(from) {
+		return 0, &terrors.ValidationError{Field: "from", Reason: "not on tick: " + from.String()}
+	}
+	if !t.Valid(to) {
+		return 0, &terrors.ValidationError{Field: "to", Reason: "not on tick: " + to.String()}
+	}
+	if to < from {
+		count, err := t.Count(to, from)
+		return -count, err
+	}
+	var count int64
+	lower := model.Price(0)
+	for i, band := range t.Bands {
+		upper := band.Upper
+		if i == len(t.Bands)-1 && upper < to {
+			upper = to
+		}
+		start, end := max(lower, from), min(upper, to)
+		if end > start {
+			count += int64((end - start) / band.Tick)
+		}
+		lower = band.Upper
+		if lower >= to {
+			break
+		}
+	}
+	return count, nil
+}
+
+func floorTo(price, tick model.Price) model.Price {
+	rem := price % tick
+	if rem < 0 {
+		rem += tick
+	}
+	return price - rem
+}
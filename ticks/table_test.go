@@ -0,0 +1,133 @@
+package ticks
+
+import (
+	"testing"
+
+	"github.com/ueebee/tachibanashi/master"
+	"github.com/ueebee/tachibanashi/model"
+)
+
+func topix100Table(t *testing.T) Table {
+	t.Helper()
+	table, err := FromYobine(master.Yobine{Fields: model.Attributes{
+		master.YobineFieldTaniNumber:  "103",
+		master.YobineFieldTekiyouDay:  "20140722",
+		master.YobineFieldKizunPrice1: "1000.000000",
+		master.YobineFieldTanka1:      "0.100000",
+		master.YobineFieldDecimal1:    "1",
+		master.YobineFieldKizunPrice2: "3000.000000",
+		master.YobineFieldTanka2:      "0.500000",
+		master.YobineFieldDecimal2:    "1",
+		master.YobineFieldKizunPrice3: "10000.000000",
+		master.YobineFieldTanka3:      "1.000000",
+		master.YobineFieldKizunPrice4: "30000.000000",
+		master.YobineFieldTanka4:      "5.000000",
+		master.YobineFieldKizunPrice5: "999999999.000000",
+		master.YobineFieldTanka5:      "10.000000",
+		master.YobineFieldKizunPrice6: "999999999.000000",
+		master.YobineFieldTanka6:      "10.000000",
+	}})
+	if err != nil {
+		t.Fatalf("FromYobine error: %v", err)
+	}
+	return table
+}
+
+func mustPrice(t *testing.T, value string) model.Price {
+	t.Helper()
+	price, err := model.ParsePrice(value)
+	if err != nil {
+		t.Fatalf("model.ParsePrice(%q) error: %v", value, err)
+	}
+	return price
+}
+
+func TestFromYobineSkipsPadding(t *testing.T) {
+	table := topix100Table(t)
+	if len(table.Bands) != 5 {
+		t.Fatalf("bands = %d", len(table.Bands))
+	}
+	if table.TaniNumber != "103" || table.TekiyouDay != "20140722" {
+		t.Fatalf("table = %+v", table)
+	}
+}
+
+func TestTickAtAndRounding(t *testing.T) {
+	table := topix100Table(t)
+	cases := []struct {
+		price, tick, down, up, nearest string
+	}{
+		{"999.93", "0.1", "999.9", "1000", "999.9"},
+		{"1000", "0.1", "1000", "1000", "1000"},
+		{"1000.2", "0.5", "1000", "1000.5", "1000"},
+		{"1000.25", "0.5", "1000", "1000.5", "1000.5"},
+		{"3050", "1", "3050", "3050", "3050"},
+		{"10002", "5", "10000", "10005", "10000"},
+	}
+	for _, tc := range cases {
+		price := mustPrice(t, tc.price)
+		if got := table.TickAt(price); got != mustPrice(t, tc.tick) {
+			t.Fatalf("TickAt(%s) = %s", tc.price, got)
+		}
+		if got := table.RoundDown(price); got != mustPrice(t, tc.down) {
+			t.Fatalf("RoundDown(%s) = %s", tc.price, got)
+		}
+		if got := table.RoundUp(price); got != mustPrice(t, tc.up) {
+			t.Fatalf("RoundUp(%s) = %s", tc.price, got)
+		}
+		if got := table.RoundNearest(price); got != mustPrice(t, tc.nearest) {
+			t.Fatalf("RoundNearest(%s) = %s", tc.price, got)
+		}
+	}
+	if got := table.Format(mustPrice(t, "999.9")); got != "999.9" {
+		t.Fatalf("Format = %q", got)
+	}
+	if got := table.Format(model.Yen(3050)); got != "3050" {
+		t.Fatalf("Format = %q", got)
+	}
+}
+
+func TestStepAcrossBands(t *testing.T) {
+	table := topix100Table(t)
+	got, err := table.Step(mustPrice(t, "999.9"), 3)
+	if err != nil {
+		t.Fatalf("Step error: %v", err)
+	}
+	if got != mustPrice(t, "1001") {
+		t.Fatalf("Step up = %s", got)
+	}
+	got, err = table.Step(got, -3)
+	if err != nil {
+		t.Fatalf("Step error: %v", err)
+	}
+	if got != mustPrice(t, "999.9") {
+		t.Fatalf("Step down = %s", got)
+	}
+	if _, err := table.Step(mustPrice(t, "1000.2"), 1); err == nil {
+		t.Fatalf("expected error for off-tick price")
+	}
+	if _, err := table.Step(mustPrice(t, "0.1"), -1); err == nil {
+		t.Fatalf("expected error below minimum")
+	}
+}
+
+func TestCount(t *testing.T) {
+	table := topix100Table(t)
+	count, err := table.Count(mustPrice(t, "999.9"), mustPrice(t, "1001"))
+	if err != nil {
+		t.Fatalf("Count error: %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("count = %d", count)
+	}
+	count, err = table.Count(model.Yen(30010), model.Yen(9999))
+	if err != nil {
+		t.Fatalf("Count error: %v", err)
+	}
+	if want := int64(-(1 + 4000 + 1)); count != want {
+		t.Fatalf("count = %d, want %d", count, want)
+	}
+	if _, err := table.Count(mustPrice(t, "1000.2"), model.Yen(1001)); err == nil {
+		t.Fatalf("expected error")
+	}
+}
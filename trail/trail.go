@@ -0,0 +1,605 @@
+package trail
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/event"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/oms"
+	"github.com/ueebee/tachibanashi/request"
+	"github.com/ueebee/tachibanashi/ticks"
+)
+
+// DefaultStaleAfter is how long the feed may be silent before stops pause.
+const DefaultStaleAfter = 10 * time.Second
+
+// matchWindow is how long after an ambiguous send the close may still
+// appear in CLMOrderList.
+const matchWindow = 2 * time.Minute
+
+// Action is what happens when a stop moves or is breached.
+type Action string
+
+const (
+	// ActionMarket sends a market close when the stop is breached.
+	ActionMarket Action = "market"
+	// ActionLimit sends a limit close at the stop level (less LimitOffset)
+	// when the stop is breached.
+	ActionLimit Action = "limit"
+	// ActionNative amends the trigger of an existing 逆指値 order with
+	// KabuCorrectOrder whenever the stop moves; the server fires it.
+	ActionNative Action = "native"
+)
+
+// State is the state of one trailing stop.
+type State string
+
+const (
+	StateArmed State = "armed"
+	// StateTriggered has sent, or is sending, the close. A send the server
+	// rejects re-arms the stop so the next breached frame tries again.
+	StateTriggered State = "triggered"
+	// StateUnknown sent the close but the send failed ambiguously, so the
+	// order may be live. Reconcile finds it in the order list, or re-arms
+	// the stop once the match window has passed without it.
+	StateUnknown State = "unknown"
+	// StateFailed could not build the close order; it is not retried.
+	StateFailed State = "failed"
+)
+
+// Stop configures a trailing stop. Exactly one of Amount, Percent and Ticks
+// sets the distance from the best price seen.
+type Stop struct {
+	ID string
+	// Close is the closing order. SideSell trails a long position and
+	// SideBuy a short one. Price is set when the stop fires.
+	Close   request.NewOrder
+	Amount  model.Price
+	Percent float64
+	Ticks   int
+	// Table is required for Ticks. When set, stop levels and limit prices
+	// are rounded to valid ticks.
+	Table       *ticks.Table
+	Action      Action
+	LimitOffset model.Price
+	// OrderNumber and EigyouDay identify the 逆指値 order for ActionNative.
+	OrderNumber string
+	EigyouDay   string
+	// Initial is the starting level; the stop never moves back past it.
+	// It is optional except for ActionNative, where it is the current
+	// trigger of the order.
+	Initial model.Price
+}
+
+// Status is the current state of a trailing stop.
+type Status struct {
+	ID    string
+	State State
+	// Best is the highest price seen for a long, the lowest for a short.
+	Best        model.Price
+	Level       model.Price
+	Last        model.Price
+	OrderNumber string
+	Error       string
+	// SentAt is when the close was sent.
+	SentAt    time.Time
+	UpdatedAt time.Time
+}
+
+// OrderRouter sends and corrects orders. *request.Service and *risk.Gate
+// satisfy it.
+type OrderRouter interface {
+	KabuNewOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error)
+	KabuCorrectOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error)
+}
+
+type stop struct {
+	config Stop
+	status Status
+	// busy is set while an order or correction for the stop is in flight.
+	busy bool
+	// closing is the close order as sent, for Reconcile to match.
+	closing request.NewOrder
+}
+
+func (s *stop) long() bool {
+	return s.config.Close.Side == request.SideSell
+}
+
+// tighter reports whether level is closer to the market than the current
+// level.
+func (s *stop) tighter(level model.Price) bool {
+	current := s.status.Level
+	return current == 0 || (s.long() && level > current) || (!s.long() && level < current)
+}
+
+// call is a router call planned under m.mu and made without it.
+type call struct {
+	stop   *stop
+	fire   bool
+	level  model.Price
+	params request.OrderParams
+}
+
+// Manager ratchets trailing stops from FD last prices (pDPP). When neither
+// an FD nor a KP frame arrives within the stale window, stops pause: the
+// frame that ends the pause only updates prices, and breaches are acted
+// on from the next frame.
+type Manager struct {
+	router         OrderRouter
+	symbols        map[int]string
+	staleAfter     time.Duration
+	secondPassword string
+	now            func() time.Time
+
+	mu        sync.Mutex
+	book      *event.QuoteBook
+	lastFrame time.Time
+	stops     map[string]*stop
+}
+
+type Option func(*Manager)
+
+// WithStaleAfter sets the feed silence after which stops pause.
+func WithStaleAfter(d time.Duration) Option {
+	return func(m *Manager) {
+		if d > 0 {
+			m.staleAfter = d
+		}
+	}
+}
+
+// WithSecondPassword sets sSecondPassword for close orders and corrections.
+func WithSecondPassword(password string) Option {
+	return func(m *Manager) {
+		m.secondPassword = password
+	}
+}
+
+func withClock(now func() time.Time) Option {
+	return func(m *Manager) {
+		m.now = now
+	}
+}
+
+// NewManager follows FD rows mapped to issue codes by symbols (p_gyou_no
+// to sIssueCode), as registered with the event service.
+func NewManager(router OrderRouter, symbols map[int]string, opts ...Option) *Manager {
+	copied := make(map[int]string, len(symbols))
+	for row, symbol := range symbols {
+		copied[row] = symbol
+	}
+	m := &Manager{
+		router:     router,
+		symbols:    copied,
+		staleAfter: DefaultStaleAfter,
+		now:        time.Now,
+		book:       event.NewQuoteBook(),
+		stops:      make(map[string]*stop),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(m)
+		}
+	}
+	return m
+}
+
+// Add registers a stop. It starts from the next last price for its symbol.
+func (m *Manager) Add(config Stop) error {
+	if err := validate(config); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.stops[config.ID]; ok {
+		return &terrors.ValidationError{Field: "id", Reason: "duplicate: " + config.ID}
+	}
+	config.Close.SecondPassword = ""
+	m.stops[config.ID] = &stop{
+		config: config,
+		status: Status{
+			ID:          config.ID,
+			State:       StateArmed,
+			Level:       config.Initial,
+			OrderNumber: config.OrderNumber,
+			UpdatedAt:   m.now(),
+		},
+	}
+	return nil
+}
+
+// Remove stops tracking id. Orders already sent are left alone.
+func (m *Manager) Remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.stops, id)
+}
+
+// Paused reports whether the feed has been silent longer than the stale
+// window, or no frame has arrived yet.
+func (m *Manager) Paused() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pausedLocked()
+}
+
+func (m *Manager) pausedLocked() bool {
+	return m.lastFrame.IsZero() || m.now().Sub(m.lastFrame) > m.staleAfter
+}
+
+// Apply handles an FD or KP frame. Other events are ignored.
+func (m *Manager) Apply(ctx context.Context, ev event.Event) error {
+	switch ev := ev.(type) {
+	case event.KP:
+		m.mu.Lock()
+		m.lastFrame = m.now()
+		m.mu.Unlock()
+		return nil
+	case event.FD:
+		return m.applyFD(ctx, ev)
+	}
+	return nil
+}
+
+func (m *Manager) applyFD(ctx context.Context, fd event.FD) error {
+	m.mu.Lock()
+	resuming := m.pausedLocked()
+	m.lastFrame = m.now()
+	quotes := m.book.Apply(fd)
+
+	var (
+		calls []*call
+		errs  []error
+	)
+	index := 0
+	for _, row := range fd.Rows {
+		if row.Fields == nil || index >= len(quotes) {
+			continue
+		}
+		quote := quotes[index]
+		index++
+		symbol := m.symbols[row.Row]
+		last, ok := quote.LastPrice()
+		if symbol == "" || !ok || last <= 0 {
+			continue
+		}
+		for _, s := range m.sortedStops() {
+			if s.config.Close.Symbol != symbol || s.status.State != StateArmed {
+				continue
+			}
+			c, err := m.update(s, last, resuming)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if c != nil {
+				calls = append(calls, c)
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	errs = append(errs, m.run(ctx, calls))
+	return errors.Join(errs...)
+}
+
+// run makes the planned router calls without holding m.mu and records
+// each result.
+func (m *Manager) run(ctx context.Context, calls []*call) error {
+	var errs []error
+	for _, c := range calls {
+		var (
+			resp *request.OrderResponse
+			err  error
+		)
+		if c.fire {
+			resp, err = m.router.KabuNewOrder(ctx, c.params)
+		} else {
+			_, err = m.router.KabuCorrectOrder(ctx, c.params)
+		}
+		m.mu.Lock()
+		m.record(c, resp, err)
+		m.mu.Unlock()
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// record applies the result of a call. m.mu must be held.
+func (m *Manager) record(c *call, resp *request.OrderResponse, err error) {
+	s := c.stop
+	s.busy = false
+	s.status.UpdatedAt = m.now()
+	switch {
+	case err != nil:
+		s.status.Error = err.Error()
+		switch {
+		case c.fire && oms.Ambiguous(err):
+			s.status.State = StateUnknown
+		case c.fire:
+			s.status.State = StateArmed
+		}
+	case c.fire:
+		s.status.OrderNumber = strings.TrimSpace(resp.OrderNumber)
+		s.status.Error = ""
+	default:
+		// The level only moves once the server has the new trigger.
+		if s.tighter(c.level) {
+			s.status.Level = c.level
+		}
+		s.status.Error = ""
+	}
+}
+
+// Watch applies events until the channel closes or ctx is done. Errors
+// from orders are passed to onError, which may be nil.
+func (m *Manager) Watch(ctx context.Context, events <-chan event.Event, onError func(error)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := m.Apply(ctx, ev); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Reconcile resolves stops in StateUnknown against CLMOrderList: a
+// matching close makes the stop triggered, and one still missing after the
+// match window re-arms it.
+func (m *Manager) Reconcile(ctx context.Context, lister oms.OrderLister) error {
+	m.mu.Lock()
+	unknown := false
+	for _, s := range m.stops {
+		unknown = unknown || s.status.State == StateUnknown
+	}
+	m.mu.Unlock()
+	if !unknown {
+		return nil
+	}
+	// Read before listing so a stop only re-arms on a list taken after
+	// its window closed.
+	now := m.now()
+	resp, err := lister.OrderList(ctx, request.OrderParams{})
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	taken := make(map[string]struct{})
+	for _, s := range m.stops {
+		if s.status.OrderNumber != "" {
+			taken[s.status.OrderNumber] = struct{}{}
+		}
+	}
+	for _, s := range m.sortedStops() {
+		if s.status.State != StateUnknown || s.busy {
+			continue
+		}
+		entry, found := oms.MatchOrder(resp.Entries, s.closing, s.status.SentAt, matchWindow, func(number string) bool {
+			_, ok := taken[number]
+			return ok
+		})
+		switch {
+		case found:
+			s.status.State = StateTriggered
+			s.status.OrderNumber = entry.OrderID
+			s.status.Error = ""
+			taken[entry.OrderID] = struct{}{}
+		case now.Sub(s.status.SentAt) >= matchWindow:
+			s.status.State = StateArmed
+		default:
+			continue
+		}
+		s.status.UpdatedAt = now
+	}
+	return nil
+}
+
+// Status returns the state of one stop.
+func (m *Manager) Status(id string) (Status, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.stops[id]
+	if !ok {
+		return Status{}, false
+	}
+	return s.status, true
+}
+
+// Stops returns the state of every stop ordered by ID.
+func (m *Manager) Stops() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Status, 0, len(m.stops))
+	for _, s := range m.sortedStops() {
+		out = append(out, s.status)
+	}
+	return out
+}
+
+func (m *Manager) sortedStops() []*stop {
+	out := make([]*stop, 0, len(m.stops))
+	for _, s := range m.stops {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].config.ID < out[j].config.ID })
+	return out
+}
+
+// update records last and plans the correction or close it calls for.
+// m.mu must be held.
+func (m *Manager) update(s *stop, last model.Price, resuming bool) (*call, error) {
+	status := &s.status
+	status.Last = last
+	status.UpdatedAt = m.now()
+
+	long := s.long()
+	if status.Best == 0 || (long && last > status.Best) || (!long && last < status.Best) {
+		status.Best = last
+	}
+	native := s.config.Action == ActionNative
+	if native && s.busy {
+		return nil, nil
+	}
+	// Computed on every frame so a failed correction is retried.
+	level, err := s.level(status.Best)
+	if err != nil {
+		return nil, err
+	}
+	if s.tighter(level) {
+		if native {
+			return m.amend(s, level)
+		}
+		status.Level = level
+	}
+	if resuming || native || s.busy {
+		return nil, nil
+	}
+	if (long && last <= status.Level) || (!long && last >= status.Level) {
+		return m.fire(s)
+	}
+	return nil, nil
+}
+
+// level returns the stop level for best, rounded away from the market.
+func (s *stop) level(best model.Price) (model.Price, error) {
+	long := s.long()
+	table := s.config.Table
+	var level model.Price
+	switch {
+	case s.config.Ticks > 0:
+		n := s.config.Ticks
+		start := table.RoundUp(best)
+		if long {
+			n = -n
+			start = table.RoundDown(best)
+		}
+		stepped, err := table.Step(start, n)
+		if err != nil {
+			return 0, err
+		}
+		return stepped, nil
+	case s.config.Percent > 0:
+		distance := model.Price(math.Round(float64(best) * s.config.Percent / 100))
+		level = best + distance
+		if long {
+			level = best - distance
+		}
+	default:
+		level = best + s.config.Amount
+		if long {
+			level = best - s.config.Amount
+		}
+	}
+	if table == nil {
+		return level, nil
+	}
+	if long {
+		return table.RoundDown(level), nil
+	}
+	return table.RoundUp(level), nil
+}
+
+func (m *Manager) fire(s *stop) (*call, error) {
+	order := s.config.Close
+	order.SecondPassword = m.secondPassword
+	order.Price = 0
+	if s.config.Action == ActionLimit {
+		order.Price = s.status.Level + s.config.LimitOffset
+		if s.long() {
+			order.Price = s.status.Level - s.config.LimitOffset
+		}
+		if table := s.config.Table; table != nil {
+			if s.long() {
+				order.Price = table.RoundDown(order.Price)
+			} else {
+				order.Price = table.RoundUp(order.Price)
+			}
+		}
+	}
+	params, err := order.ToParams()
+	if err != nil {
+		s.status.State = StateFailed
+		s.status.Error = err.Error()
+		return nil, err
+	}
+	s.status.State = StateTriggered
+	s.status.SentAt = m.now()
+	order.SecondPassword = ""
+	s.closing = order
+	s.busy = true
+	return &call{stop: s, fire: true, params: params}, nil
+}
+
+func (m *Manager) amend(s *stop, level model.Price) (*call, error) {
+	params, err := request.Correction{
+		OrderNumber:    s.config.OrderNumber,
+		EigyouDay:      s.config.EigyouDay,
+		StopTrigger:    request.PriceRef(level),
+		SecondPassword: m.secondPassword,
+	}.ToParams()
+	if err != nil {
+		s.status.Error = err.Error()
+		return nil, err
+	}
+	s.busy = true
+	return &call{stop: s, level: level, params: params}, nil
+}
+
+func validate(config Stop) error {
+	if strings.TrimSpace(config.ID) == "" {
+		return &terrors.ValidationError{Field: "id", Reason: "required"}
+	}
+	if config.Close.Side != request.SideSell && config.Close.Side != request.SideBuy {
+		return &terrors.ValidationError{Field: "sBaibaiKubun", Reason: "close side must be sell or buy"}
+	}
+	distances := 0
+	if config.Amount > 0 {
+		distances++
+	}
+	if config.Percent > 0 {
+		distances++
+	}
+	if config.Ticks > 0 {
+		distances++
+		if config.Table == nil {
+			return &terrors.ValidationError{Field: "table", Reason: "required for ticks"}
+		}
+	}
+	if distances != 1 {
+		return &terrors.ValidationError{Field: "distance", Reason: "set exactly one of amount, percent and ticks"}
+	}
+	if config.LimitOffset < 0 {
+		return &terrors.ValidationError{Field: "limit_offset", Reason: "must not be negative"}
+	}
+	switch config.Action {
+	case ActionMarket, ActionLimit:
+		return config.Close.Validate()
+	case ActionNative:
+		if strings.TrimSpace(config.OrderNumber) == "" || strings.TrimSpace(config.EigyouDay) == "" {
+			return &terrors.ValidationError{Field: "sOrderNumber", Reason: "native stops need the order number and sEigyouDay"}
+		}
+		if config.Initial <= 0 {
+			return &terrors.ValidationError{Field: "sGyakusasiZyouken", Reason: "native stops need the current trigger as Initial"}
+		}
+		if strings.TrimSpace(config.Close.Symbol) == "" {
+			return &terrors.ValidationError{Field: "sIssueCode", Reason: "required"}
+		}
+		return nil
+	}
+	return &terrors.ValidationError{Field: "action", Reason: "invalid value: " + string(config.Action)}
+}
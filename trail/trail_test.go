@@ -0,0 +1,337 @@
+package trail
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	terrors "github.com/ueebee/tachibanashi/errors"
+	"github.com/ueebee/tachibanashi/event"
+	"github.com/ueebee/tachibanashi/model"
+	"github.com/ueebee/tachibanashi/request"
+	"github.com/ueebee/tachibanashi/ticks"
+)
+
+type mockRouter struct {
+	placed     []request.OrderParams
+	corrected  []request.OrderParams
+	newErr     error
+	correctErr error
+}
+
+func (m *mockRouter) KabuNewOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error) {
+	m.placed = append(m.placed, params)
+	if err := m.newErr; err != nil {
+		m.newErr = nil
+		return nil, err
+	}
+	return &request.OrderResponse{OrderNumber: strconv.Itoa(100 + len(m.placed))}, nil
+}
+
+func (m *mockRouter) KabuCorrectOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error) {
+	m.corrected = append(m.corrected, params)
+	if err := m.correctErr; err != nil {
+		m.correctErr = nil
+		return nil, err
+	}
+	return &request.OrderResponse{}, nil
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func newTestManager(router *mockRouter) (*Manager, *testClock) {
+	clock := &testClock{now: time.Date(2024, 6, 3, 9, 0, 0, 0, model.JST)}
+	manager := NewManager(router, map[int]string{1: "6501"}, WithStaleAfter(5*time.Second), WithSecondPassword("pw"), withClock(clock.Now))
+	return manager, clock
+}
+
+func lastPrice(price string) event.FD {
+	return event.FD{Rows: []event.FDRow{{Row: 1, Fields: model.Attributes{model.FieldLastPrice: price}}}}
+}
+
+func feed(t *testing.T, manager *Manager, clock *testClock, prices ...string) {
+	t.Helper()
+	for _, price := range prices {
+		clock.now = clock.now.Add(time.Second)
+		if err := manager.Apply(context.Background(), lastPrice(price)); err != nil {
+			t.Fatalf("Apply(%s) error = %v", price, err)
+		}
+	}
+}
+
+func TestAmountStopRatchetsAndFiresMarket(t *testing.T) {
+	router := &mockRouter{}
+	manager, clock := newTestManager(router)
+	err := manager.Add(Stop{
+		ID:     "s1",
+		Close:  request.MarketSell("6501", request.MarketTSE, 100),
+		Amount: model.Yen(50),
+		Action: ActionMarket,
+	})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	feed(t, manager, clock, "3000", "3100", "3060", "3080")
+	status, _ := manager.Status("s1")
+	if status.Level != model.Yen(3050) || status.Best != model.Yen(3100) || len(router.placed) != 0 {
+		t.Fatalf("status = %+v, placed = %v", status, router.placed)
+	}
+
+	feed(t, manager, clock, "3050")
+	status, _ = manager.Status("s1")
+	if status.State != StateTriggered || status.OrderNumber != "101" || len(router.placed) != 1 {
+		t.Fatalf("status = %+v", status)
+	}
+	if router.placed[0]["sOrderPrice"] != "0" || router.placed[0]["sSecondPassword"] != "pw" {
+		t.Fatalf("placed = %v", router.placed[0])
+	}
+
+	feed(t, manager, clock, "3000")
+	if len(router.placed) != 1 {
+		t.Fatalf("fired twice")
+	}
+}
+
+func TestTickStopOnShortFiresLimit(t *testing.T) {
+	router := &mockRouter{}
+	manager, clock := newTestManager(router)
+	table := ticks.Table{Bands: []ticks.Band{
+		{Upper: model.Yen(3000), Tick: model.Yen(1)},
+		{Upper: model.Yen(5000), Tick: model.Yen(5)},
+	}}
+	err := manager.Add(Stop{
+		ID:          "s1",
+		Close:       request.LimitBuy("6501", request.MarketTSE, model.Yen(1), 100),
+		Ticks:       3,
+		Table:       &table,
+		Action:      ActionLimit,
+		LimitOffset: model.Yen(2),
+	})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	feed(t, manager, clock, "2999", "2998")
+	status, _ := manager.Status("s1")
+	// 2998 + 1 + 1 + 5 crosses into the 5 yen band.
+	if status.Level != model.Yen(3005) {
+		t.Fatalf("level = %s", status.Level)
+	}
+	feed(t, manager, clock, "3005")
+	if len(router.placed) != 1 || router.placed[0]["sOrderPrice"] != "3010" || router.placed[0]["sBaibaiKubun"] != "3" {
+		t.Fatalf("placed = %v", router.placed)
+	}
+}
+
+func TestPercentStopAmendsNativeOrder(t *testing.T) {
+	router := &mockRouter{}
+	manager, clock := newTestManager(router)
+	err := manager.Add(Stop{
+		ID:          "s1",
+		Close:       request.MarketSell("6501", request.MarketTSE, 100),
+		Percent:     2,
+		Action:      ActionNative,
+		OrderNumber: "900",
+		EigyouDay:   "20240603",
+		Initial:     model.Yen(2900),
+	})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	feed(t, manager, clock, "2950", "3000", "2800")
+	if len(router.corrected) != 1 || router.corrected[0]["sGyakusasiZyouken"] != "2940" || router.corrected[0]["sOrderNumber"] != "900" {
+		t.Fatalf("corrected = %v", router.corrected)
+	}
+	if len(router.placed) != 0 {
+		t.Fatalf("native stop sent an order")
+	}
+}
+
+func TestFailedAmendKeepsLevelAndRetries(t *testing.T) {
+	router := &mockRouter{correctErr: errors.New("timeout")}
+	manager, clock := newTestManager(router)
+	manager.Add(Stop{
+		ID:          "s1",
+		Close:       request.MarketSell("6501", request.MarketTSE, 100),
+		Amount:      model.Yen(50),
+		Action:      ActionNative,
+		OrderNumber: "900",
+		EigyouDay:   "20240603",
+		Initial:     model.Yen(2900),
+	})
+
+	clock.now = clock.now.Add(time.Second)
+	if err := manager.Apply(context.Background(), lastPrice("3000")); err == nil {
+		t.Fatalf("Apply() expected correction error")
+	}
+	status, _ := manager.Status("s1")
+	if status.Level != model.Yen(2900) || status.Error == "" {
+		t.Fatalf("status = %+v", status)
+	}
+	feed(t, manager, clock, "2990")
+	status, _ = manager.Status("s1")
+	if len(router.corrected) != 2 || status.Level != model.Yen(2950) || status.Error != "" {
+		t.Fatalf("status = %+v, corrected = %v", status, router.corrected)
+	}
+}
+
+type mockLister struct {
+	entries []request.OrderEntry
+}
+
+func (m *mockLister) OrderList(ctx context.Context, params request.OrderParams) (*request.OrderListResponse, error) {
+	return &request.OrderListResponse{Entries: m.entries}, nil
+}
+
+func TestRejectedFireRearms(t *testing.T) {
+	router := &mockRouter{newErr: &terrors.APIError{Code: "991", Message: "rejected"}}
+	manager, clock := newTestManager(router)
+	manager.Add(Stop{
+		ID:     "s1",
+		Close:  request.MarketSell("6501", request.MarketTSE, 100),
+		Amount: model.Yen(50),
+		Action: ActionMarket,
+	})
+	feed(t, manager, clock, "3000")
+
+	clock.now = clock.now.Add(time.Second)
+	if err := manager.Apply(context.Background(), lastPrice("2950")); err == nil {
+		t.Fatalf("Apply() expected order error")
+	}
+	if status, _ := manager.Status("s1"); status.State != StateArmed || status.Error == "" {
+		t.Fatalf("status = %+v", status)
+	}
+	feed(t, manager, clock, "2940")
+	if status, _ := manager.Status("s1"); status.State != StateTriggered || status.OrderNumber != "102" {
+		t.Fatalf("status = %+v", status)
+	}
+}
+
+func TestAmbiguousFireWaitsForReconcile(t *testing.T) {
+	router := &mockRouter{newErr: context.DeadlineExceeded}
+	manager, clock := newTestManager(router)
+	manager.Add(Stop{
+		ID:     "s1",
+		Close:  request.MarketSell("6501", request.MarketTSE, 100),
+		Amount: model.Yen(50),
+		Action: ActionMarket,
+	})
+	feed(t, manager, clock, "3000")
+
+	clock.now = clock.now.Add(time.Second)
+	if err := manager.Apply(context.Background(), lastPrice("2950")); err == nil {
+		t.Fatalf("Apply() expected order error")
+	}
+	if status, _ := manager.Status("s1"); status.State != StateUnknown || status.Error == "" {
+		t.Fatalf("status = %+v", status)
+	}
+	// The close may be live, so further breaches must not send another.
+	feed(t, manager, clock, "2940")
+	if len(router.placed) != 1 {
+		t.Fatalf("placed = %d, want 1", len(router.placed))
+	}
+
+	lister := &mockLister{}
+	if err := manager.Reconcile(context.Background(), lister); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if status, _ := manager.Status("s1"); status.State != StateUnknown {
+		t.Fatalf("status = %+v", status)
+	}
+
+	lister.entries = []request.OrderEntry{{
+		OrderID: "7001",
+		Symbol:  "6501",
+		Fields: model.Attributes{
+			"sOrderBaibaiKubun":   "1",
+			"sOrderOrderSuryou":   "100",
+			"sOrderOrderPrice":    "0.0000",
+			"sOrderOrderDateTime": "20240603090002",
+		},
+	}}
+	if err := manager.Reconcile(context.Background(), lister); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if status, _ := manager.Status("s1"); status.State != StateTriggered || status.OrderNumber != "7001" || status.Error != "" {
+		t.Fatalf("status = %+v", status)
+	}
+}
+
+func TestAmbiguousFireRearmsAfterMatchWindow(t *testing.T) {
+	router := &mockRouter{newErr: context.DeadlineExceeded}
+	manager, clock := newTestManager(router)
+	manager.Add(Stop{
+		ID:     "s1",
+		Close:  request.MarketSell("6501", request.MarketTSE, 100),
+		Amount: model.Yen(50),
+		Action: ActionMarket,
+	})
+	feed(t, manager, clock, "3000")
+	clock.now = clock.now.Add(time.Second)
+	manager.Apply(context.Background(), lastPrice("2950"))
+
+	clock.now = clock.now.Add(matchWindow)
+	if err := manager.Reconcile(context.Background(), &mockLister{}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if status, _ := manager.Status("s1"); status.State != StateArmed {
+		t.Fatalf("status = %+v", status)
+	}
+	// The feed went stale meanwhile, so the first frame only resumes.
+	feed(t, manager, clock, "2940", "2940")
+	if status, _ := manager.Status("s1"); status.State != StateTriggered || status.OrderNumber != "102" {
+		t.Fatalf("status = %+v", status)
+	}
+}
+
+func TestStaleFeedPausesTrigger(t *testing.T) {
+	router := &mockRouter{}
+	manager, clock := newTestManager(router)
+	manager.Add(Stop{
+		ID:     "s1",
+		Close:  request.MarketSell("6501", request.MarketTSE, 100),
+		Amount: model.Yen(50),
+		Action: ActionMarket,
+	})
+	feed(t, manager, clock, "3000", "3100")
+
+	clock.now = clock.now.Add(3 * time.Second)
+	manager.Apply(context.Background(), event.KP{})
+	clock.now = clock.now.Add(10 * time.Second)
+	if !manager.Paused() {
+		t.Fatalf("expected pause")
+	}
+
+	feed(t, manager, clock, "3000")
+	if len(router.placed) != 0 {
+		t.Fatalf("fired while resuming")
+	}
+	feed(t, manager, clock, "3000")
+	if len(router.placed) != 1 {
+		t.Fatalf("placed = %v", router.placed)
+	}
+}
+
+func TestAddRejectsAmbiguousDistance(t *testing.T) {
+	manager, _ := newTestManager(&mockRouter{})
+	err := manager.Add(Stop{
+		ID:      "s1",
+		Close:   request.MarketSell("6501", request.MarketTSE, 100),
+		Amount:  model.Yen(50),
+		Percent: 1,
+		Action:  ActionMarket,
+	})
+	if err == nil {
+		t.Fatalf("Add() expected error")
+	}
+}
@@ -0,0 +1,70 @@
+package watchdog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ueebee/tachibanashi/auth"
+)
+
+// OrderRef identifies an order to cancel.
+type OrderRef struct {
+	OrderNumber string
+	EigyouDay   string
+}
+
+// State is what a bot shares with an external watchdog through a local file.
+// It holds live session URLs, so the file is created readable by the owner
+// only; the second password is never written.
+type State struct {
+	PID         int
+	VirtualURLs auth.VirtualURLs
+	// PNo is the last p_no the bot used. The watchdog continues above it.
+	PNo       int64
+	Heartbeat time.Time
+	// LastEvent is when the bot last received an event frame.
+	LastEvent time.Time
+	Orders    []OrderRef
+	UpdatedAt time.Time
+}
+
+// ReadState reads a state file written by WriteState.
+func ReadState(path string) (State, error) {
+	var state State
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return State{}, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return State{}, err
+	}
+	return state, nil
+}
+
+// WriteState replaces path atomically.
+func WriteState(path string, state State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
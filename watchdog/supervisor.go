@@ -0,0 +1,391 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ueebee/tachibanashi/auth"
+	"github.com/ueebee/tachibanashi/event"
+	"github.com/ueebee/tachibanashi/oms"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+const (
+	defaultCheckInterval = time.Second
+	cancelTimeout        = 10 * time.Second
+	defaultRetryBackoff  = time.Second
+	defaultMaxBackoff    = time.Minute
+)
+
+// Mode selects what is cancelled when the supervisor trips.
+type Mode string
+
+const (
+	// CancelSession cancels the orders tracked by the supervisor.
+	CancelSession Mode = "session"
+	// CancelEverything sends KabuCancelOrderAll.
+	CancelEverything Mode = "all"
+)
+
+// Trip reasons.
+const (
+	ReasonFeed      = "event feed lost"
+	ReasonHeartbeat = "heartbeat lost"
+	ReasonSignal    = "signal"
+)
+
+// Canceller cancels orders. *request.Service satisfies it.
+type Canceller interface {
+	KabuCancelOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error)
+	KabuCancelOrderAll(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error)
+}
+
+// Session is the client state shared with an external watchdog.
+// *client.Client satisfies it.
+type Session interface {
+	VirtualURLs() auth.VirtualURLs
+	TokenStore() auth.TokenStore
+}
+
+// Supervisor is a dead-man switch: it trips once when the event feed or the
+// strategy heartbeat goes quiet for too long, or when a watched signal
+// arrives, and then cancels open orders. Failed cancels stay pending and are
+// retried with backoff until they succeed or GiveUp is called. Zero timeouts
+// disable that check.
+type Supervisor struct {
+	canceller        Canceller
+	mode             Mode
+	secondPassword   string
+	feedTimeout      time.Duration
+	heartbeatTimeout time.Duration
+	retryBackoff     time.Duration
+	maxBackoff       time.Duration
+	signals          []os.Signal
+	now              func() time.Time
+
+	mu            sync.Mutex
+	lastEvent     time.Time
+	lastHeartbeat time.Time
+	orders        map[string]OrderRef
+	tripped       bool
+	reason        string
+	pending       bool // cancels not yet confirmed
+	sending       bool
+	gaveUp        bool
+	attempts      int
+	nextRetry     time.Time
+}
+
+type Option func(*Supervisor)
+
+// WithMode sets what is cancelled (default CancelSession).
+func WithMode(mode Mode) Option {
+	return func(s *Supervisor) {
+		if mode != "" {
+			s.mode = mode
+		}
+	}
+}
+
+// WithSecondPassword sets sSecondPassword for cancels.
+func WithSecondPassword(password string) Option {
+	return func(s *Supervisor) {
+		s.secondPassword = password
+	}
+}
+
+// WithFeedTimeout trips when no event frame, including KP keepalives,
+// arrives for d.
+func WithFeedTimeout(d time.Duration) Option {
+	return func(s *Supervisor) {
+		s.feedTimeout = d
+	}
+}
+
+// WithHeartbeatTimeout trips when Heartbeat is not called for d.
+func WithHeartbeatTimeout(d time.Duration) Option {
+	return func(s *Supervisor) {
+		s.heartbeatTimeout = d
+	}
+}
+
+// WithRetryBackoff sets the delay before the first cancel retry, doubled up
+// to max after each failure (defaults 1s and 1m).
+func WithRetryBackoff(initial, max time.Duration) Option {
+	return func(s *Supervisor) {
+		if initial > 0 {
+			s.retryBackoff = initial
+		}
+		if max > 0 {
+			s.maxBackoff = max
+		}
+	}
+}
+
+// WithSignals makes Run trip and return on any of sigs, e.g. SIGTERM.
+func WithSignals(sigs ...os.Signal) Option {
+	return func(s *Supervisor) {
+		s.signals = append(s.signals, sigs...)
+	}
+}
+
+func withClock(now func() time.Time) Option {
+	return func(s *Supervisor) {
+		s.now = now
+	}
+}
+
+func NewSupervisor(canceller Canceller, opts ...Option) *Supervisor {
+	s := &Supervisor{
+		canceller:    canceller,
+		mode:         CancelSession,
+		retryBackoff: defaultRetryBackoff,
+		maxBackoff:   defaultMaxBackoff,
+		now:          time.Now,
+		orders:       make(map[string]OrderRef),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	now := s.now()
+	s.lastEvent, s.lastHeartbeat = now, now
+	return s
+}
+
+// Heartbeat records that the strategy is alive.
+func (s *Supervisor) Heartbeat() {
+	s.mu.Lock()
+	s.lastHeartbeat = s.now()
+	s.mu.Unlock()
+}
+
+// Track adds an order placed by this session.
+func (s *Supervisor) Track(orderNumber, eigyouDay string) {
+	orderNumber = strings.TrimSpace(orderNumber)
+	if orderNumber == "" {
+		return
+	}
+	s.mu.Lock()
+	s.orders[orderNumber] = OrderRef{OrderNumber: orderNumber, EigyouDay: strings.TrimSpace(eigyouDay)}
+	s.mu.Unlock()
+}
+
+// Untrack removes an order that is no longer open.
+func (s *Supervisor) Untrack(orderNumber string) {
+	s.mu.Lock()
+	delete(s.orders, strings.TrimSpace(orderNumber))
+	s.mu.Unlock()
+}
+
+// Orders returns the tracked orders.
+func (s *Supervisor) Orders() []OrderRef {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ordersLocked()
+}
+
+func (s *Supervisor) ordersLocked() []OrderRef {
+	out := make([]OrderRef, 0, len(s.orders))
+	for _, order := range s.orders {
+		out = append(out, order)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].OrderNumber < out[j].OrderNumber })
+	return out
+}
+
+// Apply marks the feed alive and untracks orders whose EC status is
+// terminal.
+func (s *Supervisor) Apply(ev event.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastEvent = s.now()
+	if ec, ok := ev.(event.EC); ok && oms.StatusFromCode(ec.OrderStatus).Terminal() {
+		delete(s.orders, strings.TrimSpace(ec.OrderNumber))
+	}
+}
+
+// Observe replaces liveness and orders with a state file written by the
+// bot, for use in a separate watchdog process.
+func (s *Supervisor) Observe(state State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state.Heartbeat.After(s.lastHeartbeat) {
+		s.lastHeartbeat = state.Heartbeat
+	}
+	if state.LastEvent.After(s.lastEvent) {
+		s.lastEvent = state.LastEvent
+	}
+	s.orders = make(map[string]OrderRef, len(state.Orders))
+	for _, order := range state.Orders {
+		s.orders[order.OrderNumber] = order
+	}
+}
+
+// State returns the state to write for an external watchdog.
+func (s *Supervisor) State(session Session) State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := State{
+		PID:       os.Getpid(),
+		Heartbeat: s.lastHeartbeat,
+		LastEvent: s.lastEvent,
+		Orders:    s.ordersLocked(),
+		UpdatedAt: s.now(),
+	}
+	if session != nil {
+		state.VirtualURLs = session.VirtualURLs()
+		if store := session.TokenStore(); store != nil {
+			state.PNo = store.Current()
+		}
+	}
+	return state
+}
+
+// Tripped reports whether the supervisor has fired and why.
+func (s *Supervisor) Tripped() (bool, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tripped, s.reason
+}
+
+// Pending reports whether the supervisor has tripped and some cancels have
+// not succeeded yet. It is false after GiveUp.
+func (s *Supervisor) Pending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending && !s.gaveUp
+}
+
+// GiveUp stops retrying pending cancels. Orders still tracked are left
+// open.
+func (s *Supervisor) GiveUp() {
+	s.mu.Lock()
+	s.gaveUp = true
+	s.mu.Unlock()
+}
+
+// Check trips if the feed or the heartbeat has timed out, and retries
+// pending cancels once their backoff has passed.
+func (s *Supervisor) Check(ctx context.Context) error {
+	s.mu.Lock()
+	now := s.now()
+	reason := ""
+	switch {
+	case s.tripped:
+		reason = s.reason
+	case s.feedTimeout > 0 && now.Sub(s.lastEvent) > s.feedTimeout:
+		reason = ReasonFeed
+	case s.heartbeatTimeout > 0 && now.Sub(s.lastHeartbeat) > s.heartbeatTimeout:
+		reason = ReasonHeartbeat
+	}
+	s.mu.Unlock()
+	if reason == "" {
+		return nil
+	}
+	return s.Trip(ctx, reason)
+}
+
+// Trip marks the supervisor tripped and cancels orders. Later calls only
+// retry cancels that are still pending and whose backoff has passed; the
+// first reason is kept. Cancels are sent even if ctx is already done, e.g.
+// during shutdown.
+func (s *Supervisor) Trip(ctx context.Context, reason string) error {
+	s.mu.Lock()
+	if !s.tripped {
+		s.tripped = true
+		s.reason = reason
+		s.pending = true
+	}
+	if !s.pending || s.gaveUp || s.sending || s.now().Before(s.nextRetry) {
+		s.mu.Unlock()
+		return nil
+	}
+	s.sending = true
+	orders := s.ordersLocked()
+	s.mu.Unlock()
+
+	err := s.cancel(ctx, orders)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sending = false
+	if err == nil {
+		s.pending = false
+		return nil
+	}
+	backoff := s.retryBackoff
+	for i := 0; i < s.attempts && backoff < s.maxBackoff; i++ {
+		backoff *= 2
+	}
+	s.attempts++
+	s.nextRetry = s.now().Add(min(backoff, s.maxBackoff))
+	return err
+}
+
+// cancel sends one round of cancels and untracks orders that succeeded.
+func (s *Supervisor) cancel(ctx context.Context, orders []OrderRef) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cancelTimeout)
+	defer cancel()
+	if s.mode == CancelEverything {
+		params := request.OrderParams{}
+		if s.secondPassword != "" {
+			params["sSecondPassword"] = s.secondPassword
+		}
+		_, err := s.canceller.KabuCancelOrderAll(ctx, params)
+		return err
+	}
+	var errs []error
+	for _, order := range orders {
+		if _, err := s.canceller.KabuCancelOrder(ctx, request.CancelParams(order.OrderNumber, order.EigyouDay, s.secondPassword)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		s.Untrack(order.OrderNumber)
+	}
+	return errors.Join(errs...)
+}
+
+// Run applies events and checks timeouts until the supervisor has tripped
+// and no cancels are pending, or ctx is done. A watched signal trips it.
+// events may be nil when liveness comes from Observe.
+func (s *Supervisor) Run(ctx context.Context, events <-chan event.Event) error {
+	var sigs chan os.Signal
+	if len(s.signals) > 0 {
+		sigs = make(chan os.Signal, 1)
+		signal.Notify(sigs, s.signals...)
+		defer signal.Stop(sigs)
+	}
+	ticker := time.NewTicker(defaultCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-sigs:
+			s.Trip(ctx, ReasonSignal)
+			if tripped, _ := s.Tripped(); tripped && !s.Pending() {
+				return nil
+			}
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			s.Apply(ev)
+		case <-ticker.C:
+			// Cancel failures are retried; Pending reports what is left.
+			s.Check(ctx)
+			if tripped, _ := s.Tripped(); tripped && !s.Pending() {
+				return nil
+			}
+		}
+	}
+}
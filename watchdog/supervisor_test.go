@@ -0,0 +1,228 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ueebee/tachibanashi/auth"
+	"github.com/ueebee/tachibanashi/event"
+	"github.com/ueebee/tachibanashi/request"
+)
+
+type mockCanceller struct {
+	cancelled []request.OrderParams
+	all       []request.OrderParams
+	fail      map[string]bool
+}
+
+func (m *mockCanceller) KabuCancelOrder(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.cancelled = append(m.cancelled, params)
+	if m.fail[params["sOrderNumber"].(string)] {
+		return nil, errors.New("cancel failed")
+	}
+	return &request.OrderResponse{}, nil
+}
+
+func (m *mockCanceller) KabuCancelOrderAll(ctx context.Context, params request.OrderParams) (*request.OrderResponse, error) {
+	m.all = append(m.all, params)
+	return &request.OrderResponse{}, nil
+}
+
+type manualClock struct {
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	return c.now
+}
+
+func TestSupervisorTripsOnFeedTimeout(t *testing.T) {
+	canceller := &mockCanceller{}
+	clock := &manualClock{now: time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)}
+	s := NewSupervisor(canceller,
+		WithFeedTimeout(30*time.Second),
+		WithSecondPassword("pw"),
+		withClock(clock.Now),
+	)
+	s.Track("1", "20240603")
+	s.Track("2", "20240603")
+	s.Track("3", "20240603")
+	s.Apply(event.EC{OrderNumber: "2", OrderStatus: "10"})
+
+	clock.now = clock.now.Add(20 * time.Second)
+	s.Apply(event.KP{})
+	clock.now = clock.now.Add(20 * time.Second)
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if tripped, _ := s.Tripped(); tripped {
+		t.Fatalf("tripped while feed alive")
+	}
+
+	clock.now = clock.now.Add(11 * time.Second)
+	// A done context must not stop the cancels.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Check(ctx); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if tripped, reason := s.Tripped(); !tripped || reason != ReasonFeed {
+		t.Fatalf("Tripped() = %v, %q", tripped, reason)
+	}
+	if len(canceller.cancelled) != 2 || canceller.cancelled[0]["sOrderNumber"] != "1" || canceller.cancelled[1]["sOrderNumber"] != "3" {
+		t.Fatalf("cancelled = %v", canceller.cancelled)
+	}
+	if canceller.cancelled[0]["sSecondPassword"] != "pw" {
+		t.Fatalf("params = %v", canceller.cancelled[0])
+	}
+	if len(s.Orders()) != 0 {
+		t.Fatalf("orders = %v", s.Orders())
+	}
+
+	if err := s.Trip(context.Background(), ReasonSignal); err != nil || len(canceller.cancelled) != 2 {
+		t.Fatalf("second Trip() = %v, cancelled = %v", err, canceller.cancelled)
+	}
+}
+
+func TestSupervisorCancelAllOnHeartbeatTimeout(t *testing.T) {
+	canceller := &mockCanceller{}
+	clock := &manualClock{now: time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)}
+	s := NewSupervisor(canceller,
+		WithHeartbeatTimeout(5*time.Second),
+		WithMode(CancelEverything),
+		WithSecondPassword("pw"),
+		withClock(clock.Now),
+	)
+	clock.now = clock.now.Add(4 * time.Second)
+	s.Heartbeat()
+	clock.now = clock.now.Add(6 * time.Second)
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if tripped, reason := s.Tripped(); !tripped || reason != ReasonHeartbeat {
+		t.Fatalf("Tripped() = %v, %q", tripped, reason)
+	}
+	if len(canceller.all) != 1 || canceller.all[0]["sSecondPassword"] != "pw" || len(canceller.cancelled) != 0 {
+		t.Fatalf("all = %v, cancelled = %v", canceller.all, canceller.cancelled)
+	}
+}
+
+func TestSupervisorRetriesFailedCancels(t *testing.T) {
+	canceller := &mockCanceller{fail: map[string]bool{"2": true}}
+	clock := &manualClock{now: time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)}
+	s := NewSupervisor(canceller, WithRetryBackoff(time.Second, 3*time.Second), withClock(clock.Now))
+	s.Track("1", "20240603")
+	s.Track("2", "20240603")
+	if err := s.Trip(context.Background(), ReasonSignal); err == nil {
+		t.Fatalf("Trip() expected error")
+	}
+	if orders := s.Orders(); len(orders) != 1 || orders[0].OrderNumber != "2" {
+		t.Fatalf("orders = %v", orders)
+	}
+	if tripped, _ := s.Tripped(); !tripped || !s.Pending() {
+		t.Fatalf("expected tripped and pending")
+	}
+
+	// Within the backoff nothing is sent.
+	s.Check(context.Background())
+	if len(canceller.cancelled) != 2 {
+		t.Fatalf("retried before backoff: %v", canceller.cancelled)
+	}
+	clock.now = clock.now.Add(time.Second)
+	if err := s.Check(context.Background()); err == nil || len(canceller.cancelled) != 3 {
+		t.Fatalf("Check() = %v, cancelled = %v", err, canceller.cancelled)
+	}
+	// The backoff doubles after each failure.
+	clock.now = clock.now.Add(time.Second)
+	s.Check(context.Background())
+	if len(canceller.cancelled) != 3 {
+		t.Fatalf("backoff did not grow: %v", canceller.cancelled)
+	}
+
+	canceller.fail = nil
+	clock.now = clock.now.Add(time.Second)
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if s.Pending() || len(s.Orders()) != 0 {
+		t.Fatalf("pending = %v, orders = %v", s.Pending(), s.Orders())
+	}
+	if tripped, reason := s.Tripped(); !tripped || reason != ReasonSignal {
+		t.Fatalf("Tripped() = %v, %q", tripped, reason)
+	}
+}
+
+func TestSupervisorGiveUp(t *testing.T) {
+	canceller := &mockCanceller{fail: map[string]bool{"1": true}}
+	clock := &manualClock{now: time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)}
+	s := NewSupervisor(canceller, withClock(clock.Now))
+	s.Track("1", "20240603")
+	s.Trip(context.Background(), ReasonSignal)
+	s.GiveUp()
+	if s.Pending() {
+		t.Fatalf("pending after GiveUp")
+	}
+	clock.now = clock.now.Add(time.Hour)
+	s.Check(context.Background())
+	if len(canceller.cancelled) != 1 || len(s.Orders()) != 1 {
+		t.Fatalf("cancelled = %v, orders = %v", canceller.cancelled, s.Orders())
+	}
+}
+
+type stubSession struct {
+	urls  auth.VirtualURLs
+	store auth.TokenStore
+}
+
+func (s stubSession) VirtualURLs() auth.VirtualURLs { return s.urls }
+func (s stubSession) TokenStore() auth.TokenStore   { return s.store }
+
+func TestStateRoundTrip(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)}
+	bot := NewSupervisor(&mockCanceller{}, withClock(clock.Now))
+	bot.Track("7", "20240603")
+	store := auth.NewMemoryTokenStore()
+	store.Set(42)
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := WriteState(path, bot.State(stubSession{urls: auth.VirtualURLs{Request: "https://example/request"}, store: store})); err != nil {
+		t.Fatalf("WriteState() error = %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("perm = %o", perm)
+	}
+
+	state, err := ReadState(path)
+	if err != nil {
+		t.Fatalf("ReadState() error = %v", err)
+	}
+	if state.PNo != 42 || state.VirtualURLs.Request != "https://example/request" || len(state.Orders) != 1 || !state.Heartbeat.Equal(clock.now) {
+		t.Fatalf("state = %+v", state)
+	}
+
+	canceller := &mockCanceller{}
+	clock.now = clock.now.Add(time.Minute)
+	watchdog := NewSupervisor(canceller, WithHeartbeatTimeout(30*time.Second), withClock(clock.Now))
+	watchdog.Observe(state)
+	if err := watchdog.Check(context.Background()); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(canceller.cancelled) != 0 {
+		t.Fatalf("tripped on a fresh watchdog")
+	}
+	clock.now = clock.now.Add(31 * time.Second)
+	watchdog.Check(context.Background())
+	if len(canceller.cancelled) != 1 || canceller.cancelled[0]["sOrderNumber"] != "7" {
+		t.Fatalf("cancelled = %v", canceller.cancelled)
+	}
+}